@@ -0,0 +1,4 @@
+// Package hermesv1 holds the Go bindings of the gRPC service defined in hermes.proto
+package hermesv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative hermes/v1/hermes.proto
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+func collectionPath(name string) string {
+	return "/collections/" + url.PathEscape(name)
+}
+
+func pointPath(collection, id string) string {
+	return collectionPath(collection) + "/points/" + url.PathEscape(id)
+}
+
+// Collections lists the collections of the server, sorted by name
+func (c *Client) Collections(ctx context.Context) ([]CollectionInfo, error) {
+	var resp listCollectionsResponse
+	if err := c.do(ctx, http.MethodGet, "/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Collections, nil
+}
+
+// CreateCollection creates a collection of vectors of the given dimension, compared by distance:
+// "cosine", the default when empty, or "euclidean". It fails with ErrConflict if it exists, unless
+// the request was retried and the collection is the one asked for, created by the lost attempt
+func (c *Client) CreateCollection(ctx context.Context, name string, dimension int, distance string) (CollectionInfo, error) {
+	var info CollectionInfo
+	retried, err := c.call(ctx, http.MethodPut, collectionPath(name), createCollectionRequest{Dimension: dimension, Distance: distance}, &info)
+	if retried && errors.Is(err, ErrConflict) {
+		if distance == "" {
+			distance = "cosine"
+		}
+		stats, serr := c.Collection(ctx, name)
+		if serr == nil && stats.Dimension == dimension && stats.Distance == distance {
+			return stats.CollectionInfo, nil
+		}
+	}
+	return info, err
+}
+
+// Collection returns a collection and the number of points it holds
+func (c *Client) Collection(ctx context.Context, name string) (CollectionStats, error) {
+	var stats CollectionStats
+	err := c.do(ctx, http.MethodGet, collectionPath(name), nil, &stats)
+	return stats, err
+}
+
+// DropCollection deletes a collection and its points
+func (c *Client) DropCollection(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, collectionPath(name), nil, nil)
+}
+
+// Upsert writes the points in one request, overwriting those stored under the same IDs
+func (c *Client) Upsert(ctx context.Context, collection string, points ...Point) error {
+	return c.do(ctx, http.MethodPut, collectionPath(collection)+"/points", upsertRequest{Points: points}, &upsertResponse{})
+}
+
+// UpsertBatch writes the points batchSize at a time, DefaultBatchSize when 0, so large imports
+// stay under the request size limit of the server. It returns how many points were written
+// before an error
+func (c *Client) UpsertBatch(ctx context.Context, collection string, points []Point, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	written := 0
+	for start := 0; start < len(points); start += batchSize {
+		end := min(start+batchSize, len(points))
+		var resp upsertResponse
+		if err := c.do(ctx, http.MethodPut, collectionPath(collection)+"/points", upsertRequest{Points: points[start:end]}, &resp); err != nil {
+			return written, err
+		}
+		written += resp.Upserted
+	}
+	return written, nil
+}
+
+// Scan calls f with every point of the collection, in no particular order, stopping at the first
+// error f returns. It is not retried once points were handed to f
+func (c *Client) Scan(ctx context.Context, collection string, f func(Point) error) error {
+	resp, _, err := c.roundTrip(ctx, http.MethodGet, collectionPath(collection)+"/points", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var p Point
+		err := dec.Decode(&p)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(p); err != nil {
+			return err
+		}
+	}
+}
+
+// Get returns the point stored under id, failing with ErrNotFound if there is none
+func (c *Client) Get(ctx context.Context, collection, id string) (Point, error) {
+	var p Point
+	err := c.do(ctx, http.MethodGet, pointPath(collection, id), nil, &p)
+	return p, err
+}
+
+// Delete removes the point stored under id, failing with ErrNotFound if there is none
+func (c *Client) Delete(ctx context.Context, collection, id string) error {
+	return c.do(ctx, http.MethodDelete, pointPath(collection, id), nil, nil)
+}
+
+// DeleteBatch removes the points stored under ids, skipping those that do not exist, and returns
+// how many were removed
+func (c *Client) DeleteBatch(ctx context.Context, collection string, ids []string) (int, error) {
+	deleted := 0
+	for _, id := range ids {
+		err := c.Delete(ctx, collection, id)
+		switch {
+		case err == nil:
+			deleted++
+		case !errors.Is(err, ErrNotFound):
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// Search returns the points closest to req.Vector within req.MaxDistance, closest first
+func (c *Client) Search(ctx context.Context, collection string, req SearchRequest) ([]Hit, error) {
+	var resp searchResponse
+	if err := c.do(ctx, http.MethodPost, collectionPath(collection)+"/search", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Hits, nil
+}
@@ -0,0 +1,313 @@
+// Package client is the Go client of the Hermes HTTP API, as served by cmd/hermes.
+//
+// A Client is safe for concurrent use and keeps a pool of connections to the server. Failed
+// requests are retried with exponential backoff, moving on to the next endpoint when one cannot
+// be reached, and a redirect to the leader of a replicated deployment makes the client send every
+// following request there
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/trace"
+)
+
+// Config tunes a Client, zero fields taking the defaults below
+type Config struct {
+	// Endpoints are the base URLs of the servers, like http://localhost:8080, tried in turn
+	Endpoints []string
+	// HTTPClient replaces the pooled client built from the fields below
+	HTTPClient *http.Client
+	// MaxIdleConnsPerHost is the number of connections kept open to each server, 16 by default
+	MaxIdleConnsPerHost int
+	// Timeout bounds every attempt of a request, 30s by default
+	Timeout time.Duration
+	// MaxRetries is how many times a failed request is retried, 3 by default and none when negative
+	MaxRetries int
+	// MinBackoff is the wait before the first retry, doubled at every retry up to MaxBackoff.
+	// 50ms and 2s by default
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+const (
+	DefaultMaxIdleConnsPerHost = 16
+	DefaultTimeout             = 30 * time.Second
+	DefaultMaxRetries          = 3
+	DefaultMinBackoff          = 50 * time.Millisecond
+	DefaultMaxBackoff          = 2 * time.Second
+	// DefaultBatchSize is the number of points UpsertBatch sends per request when not told otherwise
+	DefaultBatchSize = 256
+
+	// maxRedirects bounds the leader redirects followed by one request, against redirect loops
+	maxRedirects = 5
+)
+
+// Client talks to a Hermes server
+type Client struct {
+	cfg       Config
+	http      *http.Client
+	endpoints []string
+	// current is the endpoint in use, leader the one a server redirected to, if any
+	current int
+	leader  string
+	mu      sync.Mutex
+}
+
+// New returns a client of the servers listed in cfg.Endpoints
+func New(cfg Config) (*Client, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("client needs at least one endpoint")
+	}
+	endpoints := make([]string, 0, len(cfg.Endpoints))
+	for _, e := range cfg.Endpoints {
+		u, err := url.Parse(e)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", e)
+		}
+		endpoints = append(endpoints, strings.TrimSuffix(e, "/"))
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+
+	hc := cfg.HTTPClient
+	if hc == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = cfg.MaxIdleConnsPerHost * len(endpoints)
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		hc = &http.Client{Transport: transport}
+	} else {
+		copied := *hc
+		hc = &copied
+	}
+	// redirects are followed by do, which remembers the leader they point at
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &Client{cfg: cfg, http: hc, endpoints: endpoints}, nil
+}
+
+// Close drops the idle connections of the pool
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// Leader returns the endpoint requests are sent to: the leader a server redirected to, or the
+// endpoint in use
+func (c *Client) Leader() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.endpoint()
+}
+
+// endpoint expects mu held
+func (c *Client) endpoint() string {
+	if c.leader != "" {
+		return c.leader
+	}
+	return c.endpoints[c.current]
+}
+
+// failover moves on from an endpoint that could not be reached, unless another request did already
+func (c *Client) failover(endpoint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.leader == endpoint {
+		c.leader = ""
+		return
+	}
+	if c.endpoints[c.current] == endpoint {
+		c.current = (c.current + 1) % len(c.endpoints)
+	}
+}
+
+func (c *Client) follow(leader string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leader = leader
+}
+
+// backoff returns the wait before retry attempt, exponential with jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.MinBackoff << attempt
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		d = c.cfg.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether a request answered status may succeed if sent again
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends the request, see roundTrip, and decodes the response into out unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	_, err := c.call(ctx, method, path, in, out)
+	return err
+}
+
+// call is do also reporting whether the request was retried, so an earlier attempt may have
+// reached the server even though its response was lost
+func (c *Client) call(ctx context.Context, method, path string, in, out any) (bool, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return false, err
+		}
+	}
+	resp, retried, err := c.roundTrip(ctx, method, path, body)
+	if err != nil {
+		return retried, err
+	}
+	return retried, decodeResponse(resp, out)
+}
+
+// roundTrip sends the request, retrying and following leader redirects, and returns the first
+// response that is not worth retrying and whether it took a retry. A retried request that went
+// through the first time answers as it would the second time, like a create answering 409, so
+// callers of such requests look at the report
+func (c *Client) roundTrip(ctx context.Context, method, path string, body []byte) (*http.Response, bool, error) {
+	redirects := 0
+	for attempt := 0; ; {
+		c.mu.Lock()
+		endpoint := c.endpoint()
+		c.mu.Unlock()
+
+		resp, err := c.send(ctx, method, endpoint+path, body)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, attempt > 0, ctx.Err()
+			}
+			c.failover(endpoint)
+		case resp.StatusCode == http.StatusTemporaryRedirect || resp.StatusCode == http.StatusPermanentRedirect:
+			leader, lerr := leaderOf(resp)
+			resp.Body.Close()
+			if lerr != nil {
+				return nil, attempt > 0, lerr
+			}
+			if redirects++; redirects > maxRedirects {
+				return nil, attempt > 0, fmt.Errorf("%s %s: too many redirects", method, path)
+			}
+			c.follow(leader)
+			continue
+		case retryable(resp.StatusCode):
+			err = decodeError(resp)
+		default:
+			return resp, attempt > 0, nil
+		}
+
+		if attempt >= c.cfg.MaxRetries {
+			return nil, attempt > 0, err
+		}
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			return nil, attempt > 0, ctx.Err()
+		}
+		attempt++
+	}
+}
+
+// send makes one attempt, within a client span whose trace context the server continues
+func (c *Client) send(ctx context.Context, method, target string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	ctx, span := trace.Start(ctx, "HTTP "+method, trace.WithKind(trace.KindClient),
+		trace.WithAttributes(trace.Attr("http.method", method), trace.Attr("http.url", target)))
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		span.RecordError(err)
+		return nil, err
+	}
+	trace.Inject(ctx, req.Header)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := CorrelationID(ctx); id != "" {
+		req.Header.Set(CorrelationIDHeader, id)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		cancel()
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(trace.Attr("http.status_code", resp.StatusCode))
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of an attempt once its response is read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// leaderOf returns the base URL of the server a redirect points at
+func leaderOf(resp *http.Response) (string, error) {
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("redirect without a leader: %w", err)
+	}
+	return location.Scheme + "://" + location.Host, nil
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func decodeError(resp *http.Response) error {
+	defer resp.Body.Close()
+	apiErr := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get(RequestIDHeader)}
+	var body errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		apiErr.Message = body.Error
+	} else {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
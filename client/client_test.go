@@ -0,0 +1,176 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/client"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer runs an in-process server over a temporary data directory
+func startServer(t *testing.T, wrap ...func(http.Handler) http.Handler) *httptest.Server {
+	logger, _ := log.NewForTest()
+	s, err := server.New(server.Config{DataDir: t.TempDir()}, logger)
+	require.NoError(t, err)
+	h := s.Handler()
+	for _, w := range wrap {
+		h = w(h)
+	}
+	ts := httptest.NewServer(h)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+func newClient(t *testing.T, endpoints ...string) *client.Client {
+	c, err := client.New(client.Config{Endpoints: endpoints, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, startServer(t).URL)
+
+	info, err := c.CreateCollection(ctx, "docs", 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, "cosine", info.Distance)
+	_, err = c.CreateCollection(ctx, "docs", 2, "")
+	assert.ErrorIs(t, err, client.ErrConflict)
+
+	points := []client.Point{}
+	for i := 0; i < 10; i++ {
+		points = append(points, client.Point{ID: fmt.Sprintf("p%d", i), Vector: []float64{1, float64(i)}})
+	}
+	written, err := c.UpsertBatch(ctx, "docs", points, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 10, written)
+	require.NoError(t, c.Upsert(ctx, "docs", client.Point{ID: "x axis", Vector: []float64{1, 0}}))
+
+	err = c.Upsert(ctx, "docs", client.Point{ID: "bad", Vector: []float64{1, 2, 3}})
+	assert.ErrorIs(t, err, client.ErrInvalidRequest)
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.NotEmpty(t, apiErr.RequestID)
+
+	p, err := c.Get(ctx, "docs", "x axis")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 0}, p.Vector)
+
+	hits, err := c.Search(ctx, "docs", client.SearchRequest{Vector: []float64{1, 0}, Limit: 3, WithVectors: true})
+	require.NoError(t, err)
+	require.Len(t, hits, 3)
+	assert.ElementsMatch(t, []string{"x axis", "p0"}, []string{hits[0].ID, hits[1].ID})
+	assert.Equal(t, "p1", hits[2].ID)
+	assert.NotEmpty(t, hits[2].Vector)
+
+	hits, err = c.Search(ctx, "docs", client.SearchRequest{Vector: []float64{1, 0}, Limit: 10, MaxDistance: client.MaxDistance(0.01)})
+	require.NoError(t, err)
+	assert.Len(t, hits, 2, "only the points on the x axis are that close")
+
+	deleted, err := c.DeleteBatch(ctx, "docs", []string{"p0", "p1", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	_, err = c.Get(ctx, "docs", "p0")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+
+	stats, err := c.Collection(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, 9, stats.Points)
+
+	collections, err := c.Collections(ctx)
+	require.NoError(t, err)
+	require.Len(t, collections, 1)
+	require.NoError(t, c.DropCollection(ctx, "docs"))
+	_, err = c.Collection(ctx, "docs")
+	assert.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func TestClientRetriesUnavailableServer(t *testing.T) {
+	var calls atomic.Int32
+	flaky := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	c := newClient(t, startServer(t, flaky).URL)
+	_, err := c.Collections(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(-10)
+	_, err = c.Collections(context.Background())
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr, "gives up after MaxRetries")
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+}
+
+func TestClientRetriedCreateSucceeds(t *testing.T) {
+	var calls atomic.Int32
+	// the first create reaches the server but its response is lost
+	lossy := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && calls.Add(1) == 1 {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	c := newClient(t, startServer(t, lossy).URL)
+	ctx := context.Background()
+
+	info, err := c.CreateCollection(ctx, "docs", 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, "docs", info.Name)
+	assert.Equal(t, "cosine", info.Distance)
+
+	_, err = c.CreateCollection(ctx, "docs", 2, "")
+	assert.ErrorIs(t, err, client.ErrConflict, "a create sent once still conflicts")
+	calls.Store(0)
+	_, err = c.CreateCollection(ctx, "docs", 3, "")
+	assert.ErrorIs(t, err, client.ErrConflict, "a retry does not hide a collection of another dimension")
+}
+
+func TestClientFailsOverAndFollowsLeader(t *testing.T) {
+	ctx := context.Background()
+	leader := startServer(t)
+	var followerCalls atomic.Int32
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followerCalls.Add(1)
+		http.Redirect(w, r, leader.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	defer follower.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c := newClient(t, down.URL, follower.URL)
+	_, err := c.CreateCollection(ctx, "docs", 2, "euclidean")
+	require.NoError(t, err, "skips the endpoint that is down, then follows the redirect")
+	assert.Equal(t, leader.URL, c.Leader())
+
+	require.NoError(t, c.Upsert(ctx, "docs", client.Point{ID: "a", Vector: []float64{0, 1}}))
+	assert.Equal(t, int32(1), followerCalls.Load(), "later requests go to the leader directly")
+
+	ctx = client.WithCorrelationID(ctx, "op-1")
+	p, err := c.Get(ctx, "docs", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", p.ID)
+}
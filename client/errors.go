@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound matches errors of requests for a collection or point that does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict matches errors of requests creating a collection that exists already
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidRequest matches errors of requests the server rejected, a vector of the wrong
+	// dimension for instance
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrTooLarge matches errors of requests whose body exceeds the server limit, see UpsertBatch
+	ErrTooLarge = errors.New("request too large")
+)
+
+// Error is an error answered by the server. It matches the Err values above with errors.Is
+type Error struct {
+	StatusCode int
+	Message    string
+	// RequestID identifies the request in the server logs
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	if e.RequestID == "" {
+		return fmt.Sprintf("hermes: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("hermes: %d %s (request %s)", e.StatusCode, e.Message, e.RequestID)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == 404
+	case ErrConflict:
+		return e.StatusCode == 409
+	case ErrInvalidRequest:
+		return e.StatusCode == 400
+	case ErrTooLarge:
+		return e.StatusCode == 413
+	}
+	return false
+}
+
+const (
+	// RequestIDHeader carries the ID the server gave a request
+	RequestIDHeader = "X-Request-ID"
+	// CorrelationIDHeader carries the correlation ID set with WithCorrelationID
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
+type contextKey int
+
+const correlationIDKey contextKey = iota
+
+// WithCorrelationID returns a copy of ctx whose requests carry id, so the server logs tie them together
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation ID set on ctx, empty if there is none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
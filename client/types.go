@@ -0,0 +1,78 @@
+package client
+
+import "time"
+
+// CollectionInfo describes a collection
+type CollectionInfo struct {
+	Name      string    `json:"name"`
+	Dimension int       `json:"dimension"`
+	Distance  string    `json:"distance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CollectionStats is a collection and the number of points it holds
+type CollectionStats struct {
+	CollectionInfo
+	Points int `json:"points"`
+}
+
+// Point is a datapoint. Only the text field of the payload is kept by the server, indexed for
+// keyword search, so points read back have none
+type Point struct {
+	ID      string            `json:"id"`
+	Vector  []float64         `json:"vector"`
+	Payload map[string]string `json:"payload,omitempty"`
+}
+
+// SearchRequest is a vector query. MaxDistance is its only filter: the server keeps no payload
+// but the indexed text, so there is nothing to filter hits on by field
+type SearchRequest struct {
+	Vector []float64 `json:"vector"`
+	// Limit is the number of hits returned at most, 10 when 0
+	Limit int `json:"limit,omitempty"`
+	// Offset skips that many of the closest hits, for paging through them
+	Offset int `json:"offset,omitempty"`
+	// MaxDistance drops hits farther than it: 1 - cos for cosine collections, the plain distance
+	// for euclidean ones
+	MaxDistance *float64 `json:"max_distance,omitempty"`
+	// WithVectors returns the vectors of the hits too
+	WithVectors bool `json:"with_vectors,omitempty"`
+}
+
+// Hit is one search result, Distance being 0 for an identical vector
+type Hit struct {
+	ID       string    `json:"id"`
+	Distance float64   `json:"distance"`
+	Vector   []float64 `json:"vector,omitempty"`
+}
+
+// MaxDistance returns a pointer to d, for filling SearchRequest.MaxDistance
+func MaxDistance(d float64) *float64 {
+	return &d
+}
+
+type createCollectionRequest struct {
+	Dimension int    `json:"dimension"`
+	Distance  string `json:"distance,omitempty"`
+}
+
+type listCollectionsResponse struct {
+	Collections []CollectionInfo `json:"collections"`
+}
+
+type upsertRequest struct {
+	Points []Point `json:"points"`
+}
+
+type upsertResponse struct {
+	Upserted int `json:"upserted"`
+}
+
+type searchResponse struct {
+	Hits []Hit `json:"hits"`
+}
+
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id"`
+}
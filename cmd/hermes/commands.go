@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/bjornaer/hermes/client"
+)
+
+// invocation is one run of a command
+type invocation struct {
+	cli   *cli
+	store store
+	args  []string
+	out   *printer
+}
+
+// command is a subcommand working on a store
+type command struct {
+	name    string
+	args    string
+	summary string
+	// create makes a missing local file instead of failing, for the commands writing data
+	create bool
+	// flags registers the flags of the command and returns what runs it
+	flags func(fs *flag.FlagSet) func(ctx context.Context, inv *invocation) error
+}
+
+var commands = []command{
+	{name: "put", args: "<id> <vector>", summary: "write a point, the vector written 1,2,3 or [-1,2,3]", create: true, flags: putFlags},
+	{name: "get", args: "<id>", summary: "print a point", flags: getFlags},
+	{name: "delete", args: "<id>", summary: "delete a point", flags: deleteFlags},
+	{name: "search", args: "<vector>", summary: "print the points closest to a vector", flags: searchFlags},
+	{name: "import", args: "[file]", summary: "write the points of a JSON lines file, or of stdin", create: true, flags: importFlags},
+	{name: "export", args: "[file]", summary: "write every point as JSON lines to a file, or to stdout", flags: exportFlags},
+	{name: "inspect", summary: "describe the storage file or the collection", flags: inspectFlags},
+	{name: "verify", summary: "read back every point and report the broken ones", flags: verifyFlags},
+	{name: "compact", summary: "rewrite a storage file without its deleted pairs", flags: compactFlags},
+}
+
+func lookup(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// wantArgs fails unless the command got between min and max arguments
+func (inv *invocation) wantArgs(min, max int) error {
+	if len(inv.args) < min || len(inv.args) > max {
+		return errUsage
+	}
+	return nil
+}
+
+func putFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	text := fs.String("text", "", "text of the point, indexed for keyword search")
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(2, 2); err != nil {
+			return err
+		}
+		v, err := parseVector(inv.args[1])
+		if err != nil {
+			return err
+		}
+		p := client.Point{ID: inv.args[0], Vector: v}
+		if *text != "" {
+			p.Payload = map[string]string{"text": *text}
+		}
+		if err := inv.store.Put(ctx, p); err != nil {
+			return err
+		}
+		return inv.out.message(map[string]string{"put": p.ID}, "put "+p.ID)
+	}
+}
+
+func getFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(1, 1); err != nil {
+			return err
+		}
+		p, err := inv.store.Get(ctx, inv.args[0])
+		if err != nil {
+			return err
+		}
+		return inv.out.table(p, []string{"ID", "VECTOR"}, [][]string{{p.ID, formatVector(p.Vector)}})
+	}
+}
+
+func deleteFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(1, 1); err != nil {
+			return err
+		}
+		if err := inv.store.Delete(ctx, inv.args[0]); err != nil {
+			return err
+		}
+		return inv.out.message(map[string]string{"deleted": inv.args[0]}, "deleted "+inv.args[0])
+	}
+}
+
+func searchFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	limit := fs.Int("limit", 10, "number of points printed at most")
+	offset := fs.Int("offset", 0, "number of closest points skipped")
+	maxDistance := fs.Float64("max-distance", -1, "leave out points farther than this, 1 - cos for cosine; no limit when negative")
+	withVectors := fs.Bool("vectors", false, "print the vectors of the points too")
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(1, 1); err != nil {
+			return err
+		}
+		v, err := parseVector(inv.args[0])
+		if err != nil {
+			return err
+		}
+		req := client.SearchRequest{Vector: v, Limit: *limit, Offset: *offset, WithVectors: *withVectors}
+		if *maxDistance >= 0 {
+			req.MaxDistance = client.MaxDistance(*maxDistance)
+		}
+		hits, err := inv.store.Search(ctx, req)
+		if err != nil {
+			return err
+		}
+		header := []string{"ID", "DISTANCE"}
+		if *withVectors {
+			header = append(header, "VECTOR")
+		}
+		rows := [][]string{}
+		for _, hit := range hits {
+			row := []string{hit.ID, formatFloat(hit.Distance)}
+			if *withVectors {
+				row = append(row, formatVector(hit.Vector))
+			}
+			rows = append(rows, row)
+		}
+		return inv.out.table(hits, header, rows)
+	}
+}
+
+func importFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	batch := fs.Int("batch", client.DefaultBatchSize, "number of points written at once")
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(0, 1); err != nil {
+			return err
+		}
+		in := inv.cli.stdin
+		if len(inv.args) == 1 && inv.args[0] != "-" {
+			f, err := os.Open(inv.args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		imported := 0
+		points := []client.Point{}
+		flush := func() error {
+			if err := inv.store.Put(ctx, points...); err != nil {
+				return fmt.Errorf("after %d points: %w", imported, err)
+			}
+			imported += len(points)
+			points = points[:0]
+			return nil
+		}
+		dec := json.NewDecoder(bufio.NewReader(in))
+		for {
+			var p client.Point
+			err := dec.Decode(&p)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("point %d: %w", imported+len(points)+1, err)
+			}
+			if points = append(points, p); len(points) >= *batch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		return inv.out.message(map[string]int{"imported": imported}, "imported "+strconv.Itoa(imported)+" points")
+	}
+}
+
+func exportFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(0, 1); err != nil {
+			return err
+		}
+		out := inv.cli.stdout
+		if len(inv.args) == 1 && inv.args[0] != "-" {
+			f, err := os.Create(inv.args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		w := bufio.NewWriter(out)
+		enc := json.NewEncoder(w)
+		exported := 0
+		err := inv.store.Scan(ctx, func(p client.Point) error {
+			exported++
+			return enc.Encode(p)
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(inv.cli.stderr, "exported %d points\n", exported)
+		return nil
+	}
+}
+
+func inspectFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(0, 0); err != nil {
+			return err
+		}
+		info, err := inv.store.Inspect(ctx)
+		if err != nil {
+			return err
+		}
+		return inv.out.record(info)
+	}
+}
+
+func verifyFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(0, 0); err != nil {
+			return err
+		}
+		problems, err := inv.store.Verify(ctx)
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			return inv.out.message(problems, "ok")
+		}
+		rows := [][]string{}
+		for _, p := range problems {
+			rows = append(rows, []string{p.ID, p.Err})
+		}
+		if err := inv.out.table(problems, []string{"ID", "PROBLEM"}, rows); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d broken points", len(problems))
+	}
+}
+
+func compactFlags(fs *flag.FlagSet) func(context.Context, *invocation) error {
+	return func(ctx context.Context, inv *invocation) error {
+		if err := inv.wantArgs(0, 0); err != nil {
+			return err
+		}
+		before, after, err := inv.store.Compact(ctx)
+		if err != nil {
+			return err
+		}
+		return inv.out.message(map[string]int64{"before": before, "after": after},
+			fmt.Sprintf("compacted %d bytes into %d", before, after))
+	}
+}
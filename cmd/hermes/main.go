@@ -1,7 +1,176 @@
+// Command hermes serves the vector store and works on its data, either directly on a storage
+// file or remotely against a server:
+//
+//	hermes serve -addr :8080 -data ./data
+//	hermes serve -config hermes.yaml -log.level debug
+//	hermes put -server http://localhost:8080 -collection docs doc1 0.1,0.2,0.3
+//	hermes search -file docs.db -limit 5 0.1,0.2,0.3
+//	hermes repl -file docs.db
 package main
 
-import "log"
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/bjornaer/hermes/internal/cluster"
+	"github.com/bjornaer/hermes/internal/config"
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/server"
+)
+
+// errUsage makes a command print its usage
+var errUsage = errors.New("usage")
+
+// cli runs commands, reading and writing the streams it holds
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	// store is the store the repl opened, commands open their own otherwise
+	store store
+	// format is the default output format
+	format string
+}
 
 func main() {
-	log.Println("I'm Hermes, your fast vector DB")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	cl := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, format: formatTable}
+	err := cl.run(ctx, os.Args[1:])
+	stop()
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) && !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "hermes:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command named by args[0], serving when there is none
+func (cl *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return serve(ctx, args)
+	}
+	switch {
+	case args[0] == "help", args[0] == "-h", args[0] == "-help":
+		cl.usage()
+		return nil
+	case strings.HasPrefix(args[0], "-"):
+		// `hermes -addr ...` keeps serving, as before there were subcommands
+		return serve(ctx, args)
+	}
+	switch args[0] {
+	case "serve":
+		return serve(ctx, args[1:])
+	case "repl":
+		return cl.repl(ctx, args[1:])
+	}
+	cmd, ok := lookup(args[0])
+	if !ok {
+		cl.usage()
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cl.runCommand(ctx, cmd, args[1:])
+}
+
+func (cl *cli) runCommand(ctx context.Context, cmd command, args []string) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(cl.stderr)
+	var target targetFlags
+	if cl.store == nil {
+		target.register(fs)
+	}
+	format := fs.String("o", cl.format, "output format: table or json")
+	runner := cmd.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(cl.stderr, "usage: hermes %s [flags] %s\n\n%s\n\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	out, err := newPrinter(cl.stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	s := cl.store
+	if s == nil {
+		if s, err = target.open(cmd.create); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+	err = runner(ctx, &invocation{cli: cl, store: s, args: fs.Args(), out: out})
+	if errors.Is(err, errUsage) {
+		fs.Usage()
+	}
+	return err
+}
+
+func (cl *cli) usage() {
+	fmt.Fprintln(cl.stderr, "usage: hermes <command> [flags] [arguments]")
+	fmt.Fprintln(cl.stderr)
+	fmt.Fprintf(cl.stderr, "  %-8s %s\n", "serve", "serve the HTTP API, and the gRPC one with -grpc-addr, the default without a command")
+	fmt.Fprintf(cl.stderr, "  %-8s %s\n", "repl", "run commands read line by line against one store")
+	for _, cmd := range commands {
+		fmt.Fprintf(cl.stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(cl.stderr)
+	fmt.Fprintln(cl.stderr, "Commands work on a storage file (-file) or on a collection of a server (-server, -collection).")
+	fmt.Fprintln(cl.stderr, "Run hermes <command> -h for the flags of a command.")
+}
+
+// serve loads the configuration from the -config file, the environment and the flags of args, then
+// serves until ctx is done
+func serve(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags := config.NewFlags(fs)
+	flags.Alias("addr", "server.addr")
+	flags.Alias("grpc-addr", "server.grpc_addr")
+	flags.Alias("data", "server.data_dir")
+	flags.Alias("max-body", "server.max_body_bytes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := flags.Load(os.Environ())
+	if err != nil {
+		return err
+	}
+
+	logger, err := log.NewFromConfig(cfg.LogConfig())
+	if err != nil {
+		return err
+	}
+	logger.Info("I'm Hermes, your fast vector DB")
+	srvCfg := cfg.ServerConfig()
+	if cfg.Cluster.Enabled {
+		if srvCfg.Cluster, err = cluster.New(cfg.ClusterConfig()); err != nil {
+			return err
+		}
+	}
+	if cfg.Cluster.Gossip {
+		transport := gossip.NewHTTPTransport(logger)
+		defer transport.Close()
+		gossipCfg := cfg.GossipConfig()
+		gossipCfg.Transport = transport
+		gossipCfg.Logger = logger
+		if srvCfg.Gossip, err = gossip.New(gossipCfg); err != nil {
+			return err
+		}
+		srvCfg.Gossip.Start()
+		defer srvCfg.Gossip.Stop()
+		srvCfg.Cluster.UseGossip(srvCfg.Gossip)
+	}
+	srv, err := server.New(srvCfg, logger)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", srvCfg.DataDir, err)
+	}
+	return srv.ListenAndServe(ctx)
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bjornaer/hermes/client"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hermes runs a command line, returning what it printed
+func hermes(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cl := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr, format: formatTable}
+	err := cl.run(context.Background(), args)
+	return stdout.String(), err
+}
+
+func TestLocalFileCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cli.db")
+	_, err := hermes(t, "", "get", "-file", file, "a")
+	require.Error(t, err, "reading commands do not create files")
+
+	_, err = hermes(t, "", "put", "-file", file, "a", "1,0")
+	require.NoError(t, err)
+	_, err = hermes(t, "", "put", "-file", file, "-text", "north", "b", "[0,1]")
+	require.NoError(t, err)
+
+	out, err := hermes(t, "", "search", "-file", file, "-o", "json", "-limit", "1", "1,0.1")
+	require.NoError(t, err)
+	var hits []client.Hit
+	require.NoError(t, json.Unmarshal([]byte(out), &hits))
+	require.Len(t, hits, 1)
+	assert.Equal(t, "a", hits[0].ID)
+
+	out, err = hermes(t, "", "get", "-file", file, "b")
+	require.NoError(t, err)
+	assert.Contains(t, out, "[0,1]")
+
+	out, err = hermes(t, "", "inspect", "-file", file)
+	require.NoError(t, err)
+	assert.Regexp(t, `POINTS\s+2`, out)
+
+	_, err = hermes(t, "", "delete", "-file", file, "a")
+	require.NoError(t, err)
+	_, err = hermes(t, "", "delete", "-file", file, "a")
+	assert.ErrorIs(t, err, errNotFound)
+	out, err = hermes(t, "", "verify", "-file", file)
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+	_, err = hermes(t, "", "compact", "-file", file)
+	require.NoError(t, err)
+	_, err = hermes(t, "", "get", "-file", file, "b")
+	assert.NoError(t, err, "compaction keeps live points")
+
+	out, err = hermes(t, "put c 2,2\nget c\nget a\nexit\n", "repl", "-file", file)
+	require.NoError(t, err)
+	assert.Contains(t, out, "put c")
+	assert.Contains(t, out, "[2,2]")
+}
+
+func TestImportExportAgainstServer(t *testing.T) {
+	logger, _ := log.NewForTest()
+	srv, err := server.New(server.Config{DataDir: t.TempDir()}, logger)
+	require.NoError(t, err)
+	defer srv.Close()
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	points := `{"id":"a","vector":[1,0,0]}
+{"id":"b","vector":[0,1,0]}
+{"id":"c","vector":[0,0,1]}
+`
+	out, err := hermes(t, points, "import", "-server", ts.URL, "-collection", "docs", "-batch", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "imported 3 points\n", out, "the collection is created on the way")
+
+	out, err = hermes(t, "", "search", "-server", ts.URL, "-collection", "docs", "-max-distance", "0.5", "0,0.9,0.1")
+	require.NoError(t, err)
+	assert.Regexp(t, `(?m)^b\s`, out)
+	assert.NotContains(t, out, "a ")
+
+	out, err = hermes(t, "", "export", "-server", ts.URL, "-collection", "docs")
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(out, "\n"))
+	file := filepath.Join(t.TempDir(), "copy.db")
+	_, err = hermes(t, out, "import", "-file", file)
+	require.NoError(t, err)
+	out, err = hermes(t, "", "inspect", "-file", file, "-o", "json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"points":3`)
+
+	_, err = hermes(t, "", "compact", "-server", ts.URL, "-collection", "docs")
+	assert.Error(t, err, "compaction needs the file")
+}
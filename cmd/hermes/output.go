@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// printer writes command results as aligned tables or as JSON
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	if format != formatTable && format != formatJSON {
+		return nil, fmt.Errorf("unknown output format %q, use %s or %s", format, formatTable, formatJSON)
+	}
+	return &printer{w: w, format: format}, nil
+}
+
+// table prints rows under header, or v when the output is JSON
+func (p *printer) table(v any, header []string, rows [][]string) error {
+	if p.format == formatJSON {
+		return p.json(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// record prints the fields of v one per row, sorted by name
+func (p *printer) record(v any) error {
+	if p.format == formatJSON {
+		return p.json(v)
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, []string{strings.ToUpper(name), fmt.Sprint(fields[name])})
+	}
+	return p.table(v, []string{"FIELD", "VALUE"}, rows)
+}
+
+// message prints text, or v when the output is JSON
+func (p *printer) message(v any, text string) error {
+	if p.format == formatJSON {
+		return p.json(v)
+	}
+	_, err := fmt.Fprintln(p.w, text)
+	return err
+}
+
+func (p *printer) json(v any) error {
+	return json.NewEncoder(p.w).Encode(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+
+func formatVector(v []float64) string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = formatFloat(f)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// parseVector reads a vector written as 1,2,3 or [1,2,3]
+func parseVector(s string) ([]float64, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	if s == "" {
+		return nil, fmt.Errorf("empty vector")
+	}
+	parts := strings.Split(s, ",")
+	v := make([]float64, len(parts))
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("vector component %d: %w", i, err)
+		}
+		v[i] = f
+	}
+	return v, nil
+}
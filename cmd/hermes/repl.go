@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+const prompt = "hermes> "
+
+// repl opens the store selected by args once, then runs the commands read from stdin against it
+// until exit or the end of the input. A failing command prints its error and the loop goes on
+func (cl *cli) repl(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(cl.stderr)
+	var target targetFlags
+	target.register(fs)
+	fs.StringVar(&cl.format, "o", cl.format, "default output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := newPrinter(cl.stdout, cl.format); err != nil {
+		return err
+	}
+	s, err := target.open(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	session := &cli{stdin: cl.stdin, stdout: cl.stdout, stderr: cl.stderr, store: s, format: cl.format}
+
+	lines := bufio.NewScanner(cl.stdin)
+	for {
+		fmt.Fprint(cl.stdout, prompt)
+		if !lines.Scan() {
+			fmt.Fprintln(cl.stdout)
+			return lines.Err()
+		}
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			session.replUsage()
+			continue
+		}
+		cmd, ok := lookup(fields[0])
+		if !ok {
+			fmt.Fprintf(cl.stderr, "unknown command %q, try help\n", fields[0])
+			continue
+		}
+		if err := session.runCommand(ctx, cmd, fields[1:]); err != nil && !errors.Is(err, errUsage) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(cl.stderr, "error:", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (cl *cli) replUsage() {
+	for _, cmd := range commands {
+		fmt.Fprintf(cl.stderr, "  %-8s %-16s %s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	fmt.Fprintf(cl.stderr, "  %-8s %-16s %s\n", "exit", "", "leave the repl")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bjornaer/hermes/client"
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+)
+
+var errNotFound = errors.New("point does not exist")
+
+// store is what the data and admin commands run against: a local storage file or a collection
+// of a remote server
+type store interface {
+	Put(ctx context.Context, points ...client.Point) error
+	Get(ctx context.Context, id string) (client.Point, error)
+	Delete(ctx context.Context, id string) error
+	Search(ctx context.Context, req client.SearchRequest) ([]client.Hit, error)
+	Scan(ctx context.Context, f func(client.Point) error) error
+	// Inspect returns what describes the store, for printing
+	Inspect(ctx context.Context) (any, error)
+	Verify(ctx context.Context) ([]disk.Problem, error)
+	Compact(ctx context.Context) (before, after int64, err error)
+	Close() error
+}
+
+// targetFlags select the store of a command
+type targetFlags struct {
+	file       string
+	server     string
+	collection string
+	distance   string
+	blockSize  int
+}
+
+func (t *targetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.file, "file", "", "local storage file to work on")
+	fs.StringVar(&t.server, "server", "", "URL of the server to work against, instead of a file")
+	fs.StringVar(&t.collection, "collection", "", "collection of the server to work on")
+	fs.StringVar(&t.distance, "distance", "cosine", "distance measure of a local file: cosine or euclidean")
+	fs.IntVar(&t.blockSize, "block-size", diskblock.DefaultBlockSize, "block size of a local file, the one it was created with")
+}
+
+// open opens the selected store. A missing local file is only created when create is set, for
+// the commands writing data
+func (t *targetFlags) open(create bool) (store, error) {
+	switch {
+	case t.file != "" && t.server != "":
+		return nil, errors.New("-file and -server cannot be used together")
+	case t.file != "":
+		if _, err := os.Stat(t.file); !create && err != nil {
+			return nil, err
+		}
+		return openLocal(t.file, t.distance, t.blockSize)
+	case t.server != "":
+		if t.collection == "" {
+			return nil, errors.New("-server needs a -collection")
+		}
+		return openRemote(t.server, t.collection, t.distance)
+	}
+	return nil, errors.New("pick a storage file with -file or a server with -server")
+}
+
+// localStore works on a DiskStorage file directly, the server must not have it open meanwhile
+type localStore struct {
+	path            string
+	blockSize       int
+	storage         *disk.DiskStorage[string]
+	distanceMeasure vector.DistanceMeasure
+}
+
+func openLocal(path, distance string, blockSize int) (*localStore, error) {
+	var dm vector.DistanceMeasure
+	switch distance {
+	case "cosine", "":
+		dm = vector.NewCosineDistanceMeasure()
+	case "euclidean":
+		dm = vector.NewEuclideanDistanceMeasure()
+	default:
+		return nil, fmt.Errorf("unknown distance %q", distance)
+	}
+	s := &localStore{path: path, blockSize: blockSize, distanceMeasure: dm}
+	return s, s.reopen()
+}
+
+func (s *localStore) reopen() error {
+	storage, err := disk.OpenDiskStorage[string](btree.Config{Path: s.path, BlockSize: s.blockSize})
+	if err != nil {
+		return err
+	}
+	storage.SetDistanceMeasure(s.distanceMeasure)
+	s.storage = storage
+	return nil
+}
+
+func (s *localStore) Put(ctx context.Context, points ...client.Point) error {
+	for _, p := range points {
+		if err := s.storage.AddContext(ctx, *types.NewDataPointWithPayload(p.ID, p.Vector, p.Payload)); err != nil {
+			return fmt.Errorf("point %q: %w", p.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *localStore) Get(ctx context.Context, id string) (client.Point, error) {
+	v, found, err := s.storage.GetContext(ctx, id)
+	if err != nil {
+		return client.Point{}, err
+	}
+	if !found {
+		return client.Point{}, errNotFound
+	}
+	return client.Point{ID: id, Vector: v}, nil
+}
+
+func (s *localStore) Delete(ctx context.Context, id string) error {
+	err := s.storage.DeleteContext(ctx, id)
+	if errors.Is(err, disk.ErrNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+// Search ranks like the server does, reporting normalized distances
+func (s *localStore) Search(ctx context.Context, req client.SearchRequest) ([]client.Hit, error) {
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	opts := disk.SearchOptions{Limit: req.Limit, Offset: req.Offset}
+	if req.MaxDistance != nil {
+		threshold := s.distanceMeasure.Denormalize(*req.MaxDistance)
+		opts.Threshold = &threshold
+	}
+	results, err := s.storage.SearchContext(ctx, req.Vector, opts)
+	if err != nil {
+		return nil, err
+	}
+	hits := []client.Hit{}
+	for _, result := range *results {
+		hit := client.Hit{ID: result.ID, Distance: result.Distance}
+		if req.WithVectors {
+			hit.Vector = result.Vector
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+func (s *localStore) Scan(ctx context.Context, f func(client.Point) error) error {
+	return s.storage.EachContext(ctx, func(id, value string, _ time.Time) error {
+		v, _, err := vector.DecodeEmbedding(value)
+		if err != nil {
+			return fmt.Errorf("point %q: %w", id, err)
+		}
+		return f(client.Point{ID: id, Vector: v})
+	})
+}
+
+func (s *localStore) Inspect(context.Context) (any, error) {
+	return s.storage.Stats()
+}
+
+func (s *localStore) Verify(context.Context) ([]disk.Problem, error) {
+	return s.storage.Verify()
+}
+
+// Compact closes the file for the rewrite, then opens the compacted one
+func (s *localStore) Compact(context.Context) (int64, int64, error) {
+	if err := s.storage.Close(); err != nil {
+		return 0, 0, err
+	}
+	before, after, err := disk.Compact(s.path, s.blockSize)
+	if rerr := s.reopen(); err == nil {
+		err = rerr
+	}
+	return before, after, err
+}
+
+func (s *localStore) Close() error {
+	return s.storage.Close()
+}
+
+// remoteStore works on a collection of a server through the client
+type remoteStore struct {
+	client     *client.Client
+	collection string
+	// distance is the measure of the collection if Put has to create it
+	distance string
+}
+
+func openRemote(server, collection, distance string) (*remoteStore, error) {
+	c, err := client.New(client.Config{Endpoints: []string{server}})
+	if err != nil {
+		return nil, err
+	}
+	return &remoteStore{client: c, collection: collection, distance: distance}, nil
+}
+
+// Put creates the collection, with the dimension of the first point, if it does not exist yet
+func (s *remoteStore) Put(ctx context.Context, points ...client.Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	_, err := s.client.UpsertBatch(ctx, s.collection, points, 0)
+	if !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+	_, err = s.client.CreateCollection(ctx, s.collection, len(points[0].Vector), s.distance)
+	if err != nil && !errors.Is(err, client.ErrConflict) {
+		return err
+	}
+	_, err = s.client.UpsertBatch(ctx, s.collection, points, 0)
+	return err
+}
+
+func (s *remoteStore) Get(ctx context.Context, id string) (client.Point, error) {
+	p, err := s.client.Get(ctx, s.collection, id)
+	if errors.Is(err, client.ErrNotFound) {
+		return p, errNotFound
+	}
+	return p, err
+}
+
+func (s *remoteStore) Delete(ctx context.Context, id string) error {
+	err := s.client.Delete(ctx, s.collection, id)
+	if errors.Is(err, client.ErrNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+func (s *remoteStore) Search(ctx context.Context, req client.SearchRequest) ([]client.Hit, error) {
+	return s.client.Search(ctx, s.collection, req)
+}
+
+func (s *remoteStore) Scan(ctx context.Context, f func(client.Point) error) error {
+	return s.client.Scan(ctx, s.collection, f)
+}
+
+func (s *remoteStore) Inspect(ctx context.Context) (any, error) {
+	return s.client.Collection(ctx, s.collection)
+}
+
+// Verify reads back every point of the collection, checking it has the collection dimension
+func (s *remoteStore) Verify(ctx context.Context) ([]disk.Problem, error) {
+	info, err := s.client.Collection(ctx, s.collection)
+	if err != nil {
+		return nil, err
+	}
+	problems := []disk.Problem{}
+	err = s.client.Scan(ctx, s.collection, func(p client.Point) error {
+		if len(p.Vector) != info.Dimension {
+			problems = append(problems, disk.Problem{ID: p.ID, Err: fmt.Sprintf("dimension %d, expected %d", len(p.Vector), info.Dimension)})
+		}
+		return nil
+	})
+	return problems, err
+}
+
+func (s *remoteStore) Compact(context.Context) (int64, int64, error) {
+	return 0, 0, errors.New("compact works on local files only, stop the server and run it with -file")
+}
+
+func (s *remoteStore) Close() error {
+	s.client.Close()
+	return nil
+}
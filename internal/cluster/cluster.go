@@ -1,22 +1,159 @@
 package cluster
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"sync"
 
-const initialPeerAddr = 8008
+	"github.com/bjornaer/hermes/internal/gossip"
+)
 
+const (
+	// DefaultHost is the host of the local nodes of a cluster
+	DefaultHost = "localhost"
+	// DefaultBasePort is the port of the first local node, the others listening on the following ones
+	DefaultBasePort = 8008
+)
+
+// Config describes the nodes a cluster starts with
+type Config struct {
+	// Host is the host of the Size local nodes, DefaultHost when empty
+	Host string
+	// BasePort is the port of the first local node, DefaultBasePort when 0
+	BasePort int
+	// Size is the number of local nodes, 1 when 0
+	Size int
+	// Peers are the addresses of further nodes, such as http://10.0.0.2:8008
+	Peers []string
+}
+
+var (
+	// ErrNodeExists is returned when adding an address that is already a member
+	ErrNodeExists = errors.New("node already in cluster")
+	// ErrUnknownNode is returned when removing an address that is not a member
+	ErrUnknownNode = errors.New("node not in cluster")
+)
+
+// Cluster is the list of node addresses. Nodes can be added and removed at runtime,
+// the replicated membership itself is kept by the raft group. Without gossip the list is static
+// and nothing checks whether its nodes are alive
 type Cluster struct {
-	Nodes []string
+	nodes  []string
+	gossip *gossip.Node
+	mu     sync.RWMutex
 }
 
-func NewCluster(peers ...int) *Cluster {
-	port := initialPeerAddr
+// NewCluster returns a cluster of peers[0] local nodes listening on consecutive ports from 8008,
+// a single node when called without arguments
+func NewCluster(peers ...int) (*Cluster, error) {
+	cfg := Config{}
+	if len(peers) > 0 {
+		cfg.Size = peers[0]
+	}
+	return New(cfg)
+}
+
+// New returns a cluster of cfg.Size local nodes listening on consecutive ports from cfg.BasePort,
+// followed by cfg.Peers
+func New(cfg Config) (*Cluster, error) {
+	if cfg.Host == "" {
+		cfg.Host = DefaultHost
+	}
+	if cfg.BasePort == 0 {
+		cfg.BasePort = DefaultBasePort
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 1
+	}
+	if cfg.BasePort < 0 || cfg.BasePort+cfg.Size-1 > 65535 {
+		return nil, fmt.Errorf("ports %d to %d are out of range", cfg.BasePort, cfg.BasePort+cfg.Size-1)
+	}
 	nodes := []string{}
-	if len(peers) == 0 {
-		peers[0] = 1
+	for i := 0; i < cfg.Size; i++ {
+		nodes = append(nodes, fmt.Sprintf("http://%s:%d", cfg.Host, cfg.BasePort+i))
+	}
+	c := &Cluster{nodes: nodes}
+	for _, addr := range cfg.Peers {
+		if err := c.Add(addr); err != nil {
+			return nil, fmt.Errorf("peer %s: %w", addr, err)
+		}
+	}
+	return c, nil
+}
+
+// Add appends addr to the cluster
+func (c *Cluster) Add(addr string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.nodes {
+		if n == addr {
+			return ErrNodeExists
+		}
+	}
+	c.nodes = append(c.nodes, addr)
+	return nil
+}
+
+// Remove drops addr from the cluster
+func (c *Cluster) Remove(addr string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, n := range c.nodes {
+		if n == addr {
+			c.nodes = append(c.nodes[:i:i], c.nodes[i+1:]...)
+			return nil
+		}
+	}
+	return ErrUnknownNode
+}
+
+// Nodes returns a copy of the node addresses added to the cluster, whether they are alive or not
+func (c *Cluster) Nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string{}, c.nodes...)
+}
+
+// UseGossip makes the cluster follow the failure detector of g: Members only lists the nodes
+// not known to be dead and State reports what g knows about each one
+func (c *Cluster) UseGossip(g *gossip.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gossip = g
+}
+
+// Members returns a copy of the current node addresses
+func (c *Cluster) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.gossip == nil {
+		return append([]string{}, c.nodes...)
+	}
+	addrs := []string{}
+	for _, m := range c.gossip.Alive() {
+		addrs = append(addrs, addressOf(m))
+	}
+	return addrs
+}
+
+// State returns every known node with its state. Nodes of a static cluster are all reported alive
+func (c *Cluster) State() []gossip.Member {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.gossip != nil {
+		return c.gossip.Members()
+	}
+	members := []gossip.Member{}
+	for _, addr := range c.nodes {
+		members = append(members, gossip.Member{ID: addr, Addr: addr, State: gossip.StateAlive})
 	}
-	for i := 0; i < peers[0]; i++ {
-		peer := fmt.Sprintf("http://localhost:%d", port+i)
-		nodes = append(nodes, peer)
+	return members
+}
+
+// addressOf falls back to the ID of members whose address did not reach us yet
+func addressOf(m gossip.Member) string {
+	if m.Addr == "" {
+		return m.ID
 	}
-	return &Cluster{Nodes: nodes}
+	return m.Addr
 }
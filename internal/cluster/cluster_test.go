@@ -0,0 +1,86 @@
+package cluster_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/cluster"
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClusterWithoutPeers(t *testing.T) {
+	c, err := cluster.NewCluster()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://localhost:8008"}, c.Members())
+
+	c, err = cluster.NewCluster(3)
+	require.NoError(t, err)
+	assert.Len(t, c.Members(), 3)
+
+	_, err = cluster.NewCluster(65536)
+	assert.Error(t, err, "ports past 65535")
+}
+
+func TestNewFromConfig(t *testing.T) {
+	c, err := cluster.New(cluster.Config{Host: "node", BasePort: 9000, Size: 2, Peers: []string{"http://peer:9000"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://node:9000", "http://node:9001", "http://peer:9000"}, c.Members())
+
+	_, err = cluster.New(cluster.Config{Peers: []string{"http://localhost:8008"}})
+	assert.ErrorIs(t, err, cluster.ErrNodeExists)
+	_, err = cluster.New(cluster.Config{BasePort: 65535, Size: 2})
+	assert.Error(t, err)
+}
+
+func TestAddAndRemoveNodes(t *testing.T) {
+	c, err := cluster.NewCluster(2)
+	require.NoError(t, err)
+	assert.NoError(t, c.Add("http://localhost:9000"))
+	assert.ErrorIs(t, c.Add("http://localhost:9000"), cluster.ErrNodeExists)
+	assert.NoError(t, c.Remove("http://localhost:8008"))
+	assert.ErrorIs(t, c.Remove("http://localhost:8008"), cluster.ErrUnknownNode)
+	assert.Equal(t, []string{"http://localhost:8009", "http://localhost:9000"}, c.Members())
+	assert.Equal(t, c.Members(), c.Nodes())
+}
+
+func TestClusterFollowsGossip(t *testing.T) {
+	network := gossip.NewNetwork()
+	nodes := []*gossip.Node{}
+	for _, id := range []string{"a", "b", "c"} {
+		logger, _ := log.NewForTest()
+		g, err := gossip.New(gossip.Config{
+			ID:            id,
+			Addr:          "http://" + id,
+			Seeds:         []string{"a"},
+			Transport:     network,
+			Logger:        logger,
+			TickInterval:  2 * time.Millisecond,
+			ProbeTick:     5,
+			SuspicionTick: 20,
+		})
+		require.NoError(t, err)
+		network.Register(id, g.Step)
+		g.Start()
+		t.Cleanup(g.Stop)
+		nodes = append(nodes, g)
+	}
+
+	c, err := cluster.NewCluster()
+	require.NoError(t, err)
+	c.UseGossip(nodes[0])
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"http://a", "http://b", "http://c"}, c.Members())
+	}, 5*time.Second, 5*time.Millisecond)
+
+	network.Unregister("c")
+	require.Eventually(t, func() bool {
+		return len(c.Members()) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	state := c.State()
+	require.Len(t, state, 3)
+	assert.Equal(t, gossip.StateDead, state[2].State)
+	assert.Equal(t, []string{"http://localhost:8008"}, c.Nodes(), "gossip does not change the nodes added")
+}
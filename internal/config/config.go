@@ -0,0 +1,230 @@
+// Package config gathers the settings of a hermes node: the API server, the storage files, the
+// cluster and the logger. Settings start from Default and are overridden, in this order, by a YAML
+// or TOML file, by HERMES_<SECTION>_<KEY> environment variables and by command line flags
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/cluster"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/server"
+)
+
+// ErrInvalid is wrapped by every error Validate returns
+var ErrInvalid = errors.New("invalid configuration")
+
+// Config holds every setting. The yaml tags name the keys of files, environment variables and flags,
+// the help tags describe them in the usage of the flags
+type Config struct {
+	Server  Server  `yaml:"server"`
+	Storage Storage `yaml:"storage"`
+	Cluster Cluster `yaml:"cluster"`
+	Raft    Raft    `yaml:"raft"`
+	Log     Log     `yaml:"log"`
+}
+
+// Server configures the HTTP API
+type Server struct {
+	Addr            string        `yaml:"addr" help:"address to serve the API on"`
+	GRPCAddr        string        `yaml:"grpc_addr" help:"address to serve the gRPC API on, none when empty"`
+	DataDir         string        `yaml:"data_dir" help:"directory holding the collections"`
+	MaxBodyBytes    int64         `yaml:"max_body_bytes" help:"largest request body accepted, in bytes"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" help:"time requests in flight get to finish on shutdown"`
+}
+
+// Storage configures the B-tree files
+type Storage struct {
+	BlockSize int `yaml:"block_size" help:"block size of new files, a multiple of 512"`
+}
+
+// Cluster configures the nodes the server knows about
+type Cluster struct {
+	Enabled  bool     `yaml:"enabled" help:"serve the cluster nodes at /cluster"`
+	Host     string   `yaml:"host" help:"host of the local nodes"`
+	BasePort int      `yaml:"base_port" help:"port of the first local node"`
+	Size     int      `yaml:"size" help:"number of local nodes"`
+	Peers    []string `yaml:"peers" help:"addresses of further nodes, comma separated"`
+	// Gossip replaces the static node list by the live nodes a failure detector finds
+	Gossip    bool     `yaml:"gossip" help:"gossip with the other nodes over HTTP, only listing the live ones"`
+	Advertise string   `yaml:"advertise" help:"address other nodes reach this one at, such as http://10.0.0.1:8080"`
+	Seeds     []string `yaml:"seeds" help:"addresses of the nodes to gossip with first, comma separated"`
+}
+
+// Raft configures the replication of the collections
+type Raft struct {
+	Enabled bool     `yaml:"enabled" help:"replicate the collections over raft groups of the nodes"`
+	NodeID  string   `yaml:"node_id" help:"ID of this node among the nodes"`
+	Nodes   []string `yaml:"nodes" help:"every node, this one included, as id=address, comma separated"`
+}
+
+// Log configures the logger
+type Log struct {
+	Level       string `yaml:"level" help:"lowest level logged: debug, info, warn or error"`
+	Format      string `yaml:"format" help:"json or console"`
+	Development bool   `yaml:"development" help:"log stack traces from warnings up"`
+}
+
+// Default returns the settings used when nothing overrides them
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:            server.DefaultAddr,
+			DataDir:         "data",
+			MaxBodyBytes:    server.DefaultMaxBodyBytes,
+			ShutdownTimeout: server.DefaultShutdownTimeout,
+		},
+		Storage: Storage{
+			BlockSize: diskblock.DefaultBlockSize,
+		},
+		Cluster: Cluster{
+			Host:     cluster.DefaultHost,
+			BasePort: cluster.DefaultBasePort,
+			Size:     1,
+			Peers:    []string{},
+			Seeds:    []string{},
+		},
+		Raft: Raft{
+			Nodes: []string{},
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true, "dpanic": true, "panic": true, "fatal": true}
+
+// Validate reports every setting that cannot be used
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s %s", ErrInvalid, key, fmt.Sprintf(format, args...)))
+	}
+	if c.Server.Addr == "" {
+		invalid("server.addr", "is empty")
+	}
+	if c.Server.GRPCAddr != "" && c.Server.GRPCAddr == c.Server.Addr {
+		invalid("server.grpc_addr", "must differ from server.addr, both are %q", c.Server.Addr)
+	}
+	if c.Server.DataDir == "" {
+		invalid("server.data_dir", "is empty")
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		invalid("server.max_body_bytes", "must be positive, got %d", c.Server.MaxBodyBytes)
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		invalid("server.shutdown_timeout", "must not be negative, got %s", c.Server.ShutdownTimeout)
+	}
+	if err := diskblock.ValidateBlockSize(c.Storage.BlockSize); err != nil {
+		invalid("storage.block_size", "%v", err)
+	}
+	if c.Cluster.Host == "" {
+		invalid("cluster.host", "is empty")
+	}
+	if c.Cluster.Size < 1 {
+		invalid("cluster.size", "must be at least 1, got %d", c.Cluster.Size)
+	}
+	if c.Cluster.BasePort < 1 || c.Cluster.BasePort+c.Cluster.Size-1 > 65535 {
+		invalid("cluster.base_port", "leaves ports out of 1-65535, got %d", c.Cluster.BasePort)
+	}
+	if c.Cluster.Gossip {
+		if !c.Cluster.Enabled {
+			invalid("cluster.gossip", "needs cluster.enabled")
+		}
+		if u, err := url.Parse(c.Cluster.Advertise); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("cluster.advertise", "must be an http URL when gossiping, got %q", c.Cluster.Advertise)
+		}
+	}
+	if c.Raft.Enabled {
+		nodes, err := c.raftNodes()
+		if err != nil {
+			invalid("raft.nodes", "%v", err)
+		} else if _, ok := nodes[c.Raft.NodeID]; !ok {
+			invalid("raft.node_id", "must be one of the nodes, got %q", c.Raft.NodeID)
+		}
+	}
+	if !logLevels[c.Log.Level] {
+		invalid("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "console" {
+		invalid("log.format", "must be json or console, got %q", c.Log.Format)
+	}
+	return errors.Join(errs...)
+}
+
+// ServerConfig returns the settings of the API server, without cluster
+func (c Config) ServerConfig() server.Config {
+	return server.Config{
+		Addr:            c.Server.Addr,
+		GRPCAddr:        c.Server.GRPCAddr,
+		DataDir:         c.Server.DataDir,
+		MaxBodyBytes:    c.Server.MaxBodyBytes,
+		ShutdownTimeout: c.Server.ShutdownTimeout,
+		BlockSize:       c.Storage.BlockSize,
+		Replication:     c.replication(),
+	}
+}
+
+// replication returns the nodes replicating the collections, nil unless raft is enabled
+func (c Config) replication() *server.Replication {
+	if !c.Raft.Enabled {
+		return nil
+	}
+	nodes, _ := c.raftNodes()
+	return &server.Replication{NodeID: c.Raft.NodeID, Peers: nodes}
+}
+
+// raftNodes parses the id=address pairs of raft.nodes
+func (c Config) raftNodes() (map[string]string, error) {
+	nodes := map[string]string{}
+	for _, node := range c.Raft.Nodes {
+		id, addr, ok := strings.Cut(node, "=")
+		if u, err := url.Parse(addr); !ok || id == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q is not id=http://host:port", node)
+		}
+		if _, dup := nodes[id]; dup {
+			return nil, fmt.Errorf("node %q is listed twice", id)
+		}
+		nodes[id] = addr
+	}
+	return nodes, nil
+}
+
+// BtreeConfig returns the settings of the tree file at path
+func (c Config) BtreeConfig(path string) btree.Config {
+	return btree.Config{Path: path, BlockSize: c.Storage.BlockSize}
+}
+
+// ClusterConfig returns the settings of the cluster
+func (c Config) ClusterConfig() cluster.Config {
+	return cluster.Config{
+		Host:     c.Cluster.Host,
+		BasePort: c.Cluster.BasePort,
+		Size:     c.Cluster.Size,
+		Peers:    append([]string{}, c.Cluster.Peers...),
+	}
+}
+
+// GossipConfig returns the settings of the failure detector, which goes by the advertised address.
+// Its transport and logger are left to the caller
+func (c Config) GossipConfig() gossip.Config {
+	return gossip.Config{
+		ID:    c.Cluster.Advertise,
+		Addr:  c.Cluster.Advertise,
+		Seeds: append([]string{}, c.Cluster.Seeds...),
+	}
+}
+
+// LogConfig returns the settings of the logger
+func (c Config) LogConfig() log.Config {
+	return log.Config{Level: c.Log.Level, Format: c.Log.Format, Development: c.Log.Development}
+}
@@ -0,0 +1,174 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func load(t *testing.T, args []string, environ []string) (config.Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := config.NewFlags(fs)
+	flags.Alias("addr", "server.addr")
+	require.NoError(t, fs.Parse(args))
+	return flags.Load(environ)
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	cfg, err := load(t, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.Default(), cfg)
+	assert.Equal(t, ":8080", cfg.ServerConfig().Addr)
+	assert.Equal(t, 4096, cfg.BtreeConfig("x.db").BlockSize)
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, "hermes.yaml", `
+server:
+  addr: ":9000"
+  data_dir: /var/lib/hermes
+  shutdown_timeout: 30s
+storage:
+  block_size: 8192
+cluster:
+  peers: [http://10.0.0.2:8008, http://10.0.0.3:8008]
+log:
+  level: warn
+`)
+	environ := []string{
+		"HERMES_SERVER_DATA_DIR=/srv/hermes",
+		"HERMES_LOG_LEVEL=debug",
+		"PATH=/usr/bin",
+	}
+	cfg, err := load(t, []string{"-config", path, "-log.level", "error", "-cluster.enabled"}, environ)
+	require.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.Addr, "file over defaults")
+	assert.Equal(t, "/srv/hermes", cfg.Server.DataDir, "env over file")
+	assert.Equal(t, "error", cfg.Log.Level, "flags over env")
+	assert.Equal(t, 30*time.Second, cfg.Server.ShutdownTimeout)
+	assert.Equal(t, 8192, cfg.ServerConfig().BlockSize)
+	assert.Equal(t, []string{"http://10.0.0.2:8008", "http://10.0.0.3:8008"}, cfg.ClusterConfig().Peers)
+	assert.True(t, cfg.Cluster.Enabled)
+	assert.Equal(t, "json", cfg.Log.Format, "untouched settings keep their default")
+}
+
+func TestConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, "hermes.toml", `
+# a node of a three node cluster
+[server]
+addr = ":7000" # the API
+max_body_bytes = 1_048_576
+
+[cluster]
+host = "node-1"
+size = 3
+peers = ["http://other:8008"]
+
+[log]
+development = true
+format = 'console'
+`)
+	cfg, err := load(t, []string{"-addr", ":7001"}, []string{"HERMES_CONFIG=" + path})
+	require.NoError(t, err)
+	assert.Equal(t, ":7001", cfg.Server.Addr)
+	assert.Equal(t, int64(1<<20), cfg.Server.MaxBodyBytes)
+	assert.Equal(t, "node-1", cfg.Cluster.Host)
+	assert.Equal(t, 3, cfg.Cluster.Size)
+	assert.Equal(t, []string{"http://other:8008"}, cfg.Cluster.Peers)
+	assert.True(t, cfg.Log.Development)
+	assert.Equal(t, "console", cfg.Log.Format)
+}
+
+func TestGossipSettings(t *testing.T) {
+	environ := []string{"HERMES_CLUSTER_SEEDS=http://10.0.0.2:8080,http://10.0.0.3:8080"}
+	cfg, err := load(t, []string{"-cluster.enabled", "-cluster.gossip", "-cluster.advertise", "http://10.0.0.1:8080"}, environ)
+	require.NoError(t, err)
+	g := cfg.GossipConfig()
+	assert.Equal(t, "http://10.0.0.1:8080", g.ID)
+	assert.Equal(t, "http://10.0.0.1:8080", g.Addr)
+	assert.Equal(t, []string{"http://10.0.0.2:8080", "http://10.0.0.3:8080"}, g.Seeds)
+}
+
+func TestRaftSettings(t *testing.T) {
+	environ := []string{"HERMES_RAFT_NODES=a=http://10.0.0.1:8080, b=http://10.0.0.2:8080"}
+	cfg, err := load(t, []string{"-raft.enabled", "-raft.node-id", "b"}, environ)
+	require.NoError(t, err)
+	rep := cfg.ServerConfig().Replication
+	require.NotNil(t, rep)
+	assert.Equal(t, "b", rep.NodeID)
+	assert.Equal(t, map[string]string{"a": "http://10.0.0.1:8080", "b": "http://10.0.0.2:8080"}, rep.Peers)
+	assert.Nil(t, config.Default().ServerConfig().Replication)
+
+	_, err = load(t, []string{"-raft.enabled", "-raft.node-id", "c"}, environ)
+	assert.ErrorContains(t, err, "raft.node_id")
+	_, err = load(t, []string{"-raft.enabled", "-raft.node-id", "a"}, []string{"HERMES_RAFT_NODES=a=10.0.0.1:8080"})
+	assert.ErrorContains(t, err, "raft.nodes")
+}
+
+func TestUnknownSettings(t *testing.T) {
+	_, err := load(t, []string{"-config", writeFile(t, "a.yaml", "server:\n  port: 80\n")}, nil)
+	assert.Error(t, err)
+
+	_, err = load(t, []string{"-config", writeFile(t, "a.toml", "[server]\nport = 80\n")}, nil)
+	assert.ErrorContains(t, err, "unknown setting server.port")
+
+	_, err = load(t, nil, []string{"HERMES_SERVER_PORT=80"})
+	assert.ErrorContains(t, err, "unknown setting HERMES_SERVER_PORT")
+
+	_, err = load(t, []string{"-config", writeFile(t, "a.json", "{}")}, nil)
+	assert.ErrorContains(t, err, "unknown configuration format")
+}
+
+func TestBadValues(t *testing.T) {
+	_, err := load(t, []string{"-server.max-body-bytes", "lots"}, nil)
+	assert.ErrorContains(t, err, "server.max_body_bytes")
+
+	_, err = load(t, nil, []string{"HERMES_SERVER_SHUTDOWN_TIMEOUT=soon"})
+	assert.ErrorContains(t, err, "HERMES_SERVER_SHUTDOWN_TIMEOUT")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage.BlockSize = 1000
+	cfg.Cluster.BasePort = 65535
+	cfg.Cluster.Size = 2
+	cfg.Log.Format = "xml"
+	cfg.Server.DataDir = ""
+	err := cfg.Validate()
+	assert.ErrorIs(t, err, config.ErrInvalid)
+	for _, key := range []string{"storage.block_size", "cluster.base_port", "log.format", "server.data_dir"} {
+		assert.ErrorContains(t, err, key)
+	}
+
+	cfg = config.Default()
+	cfg.Cluster.Gossip = true
+	cfg.Cluster.Advertise = ":8080"
+	err = cfg.Validate()
+	for _, key := range []string{"cluster.gossip", "cluster.advertise"} {
+		assert.ErrorContains(t, err, key)
+	}
+
+	_, err = load(t, []string{"-storage.block-size", "100"}, nil)
+	assert.ErrorIs(t, err, config.ErrInvalid)
+	_, err = load(t, []string{"-server.addr", ":9090", "-server.grpc-addr", ":9090"}, nil)
+	assert.ErrorContains(t, err, "server.grpc_addr")
+}
+
+func TestGRPCAddr(t *testing.T) {
+	assert.Empty(t, config.Default().ServerConfig().GRPCAddr)
+	cfg, err := load(t, nil, []string{"HERMES_SERVER_GRPC_ADDR=:9090"})
+	require.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.ServerConfig().GRPCAddr)
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the names of the environment variables, HERMES_SERVER_ADDR setting server.addr
+const EnvPrefix = "HERMES_"
+
+// EnvConfig names the environment variable giving the configuration file when -config is not set
+const EnvConfig = EnvPrefix + "CONFIG"
+
+// setting is one key of the configuration, such as server.addr, and the field holding it
+type setting struct {
+	key   string
+	help  string
+	field reflect.Value
+}
+
+// settings lists the keys of c in declaration order, their fields pointing into c
+func settings(c *Config) []setting {
+	all := []setting{}
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Type().Field(i).Tag.Get("yaml")
+		fields := sections.Field(i)
+		for j := 0; j < fields.NumField(); j++ {
+			f := fields.Type().Field(j)
+			all = append(all, setting{key: section + "." + f.Tag.Get("yaml"), help: f.Tag.Get("help"), field: fields.Field(j)})
+		}
+	}
+	return all
+}
+
+func lookupSetting(c *Config, key string) (setting, bool) {
+	for _, s := range settings(c) {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses raw into the field of s, lists being comma separated
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if s.field.Kind() == reflect.Slice {
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return s.setList(items)
+	}
+	if s.field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.key, err)
+		}
+		s.field.SetInt(int64(d))
+		return nil
+	}
+	switch s.field.Kind() {
+	case reflect.String:
+		s.field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.key, err)
+		}
+		s.field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.key, err)
+		}
+		s.field.SetInt(n)
+	default:
+		return fmt.Errorf("%s: unsupported type %s", s.key, s.field.Type())
+	}
+	return nil
+}
+
+func (s setting) setList(items []string) error {
+	if s.field.Kind() != reflect.Slice {
+		return fmt.Errorf("%s: expected a single value, got a list", s.key)
+	}
+	s.field.Set(reflect.ValueOf(items))
+	return nil
+}
+
+// String formats the field of s as set parses it
+func (s setting) String() string {
+	if s.field.Kind() == reflect.Slice {
+		return strings.Join(s.field.Interface().([]string), ",")
+	}
+	return fmt.Sprint(s.field.Interface())
+}
+
+// envName returns the environment variable of key, HERMES_SERVER_DATA_DIR for server.data_dir
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// flagName returns the flag of key, -server.data-dir for server.data_dir
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// LoadFile applies the settings of a YAML (.yaml, .yml) or TOML (.toml) file to c. Unknown keys are an error
+func (c *Config) LoadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		if err := c.loadTOML(raw); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unknown configuration format %q, want .yaml, .yml or .toml", path, ext)
+	}
+	return nil
+}
+
+// LoadEnv applies the HERMES_<SECTION>_<KEY> variables of environ, formatted as os.Environ does.
+// Variables under the prefix that name no setting are an error, except HERMES_CONFIG
+func (c *Config) LoadEnv(environ []string) error {
+	byName := map[string]setting{}
+	for _, s := range settings(c) {
+		byName[envName(s.key)] = s
+	}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || name == EnvConfig {
+			continue
+		}
+		s, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown setting %s", name)
+		}
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Flags registers -config and one flag per setting on a flag set, then loads the configuration
+// once the flag set parsed its arguments
+type Flags struct {
+	fs     *flag.FlagSet
+	file   *string
+	values map[string]*flagValue
+}
+
+// flagValue keeps what a flag was given, it is applied by Load
+type flagValue struct {
+	key    string
+	raw    string
+	isBool bool
+}
+
+func (v *flagValue) String() string { return v.raw }
+
+// IsBoolFlag lets boolean settings be set by naming them alone, as -cluster.enabled
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+func (v *flagValue) Set(raw string) error {
+	v.raw = raw
+	return nil
+}
+
+// NewFlags registers the flags of every setting on fs, named like -server.addr, with the defaults as values
+func NewFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs, values: map[string]*flagValue{}}
+	f.file = fs.String("config", "", "YAML or TOML configuration file, $"+EnvConfig+" when not set")
+	defaults := Default()
+	for _, s := range settings(&defaults) {
+		v := &flagValue{key: s.key, raw: s.String(), isBool: s.field.Kind() == reflect.Bool}
+		f.values[flagName(s.key)] = v
+		fs.Var(v, flagName(s.key), s.help)
+	}
+	return f
+}
+
+// Alias registers name as another flag for the setting key, for flags that predate the configuration
+func (f *Flags) Alias(name, key string) {
+	v := f.values[flagName(key)]
+	if v == nil {
+		panic("config: no setting " + key)
+	}
+	f.values[name] = v
+	f.fs.Var(v, name, "same as -"+flagName(key))
+}
+
+// Load returns the defaults overridden by the configuration file, then by environ and then by the
+// flags explicitly set, and checks the result
+func (f *Flags) Load(environ []string) (Config, error) {
+	c := Default()
+	path := *f.file
+	if path == "" {
+		path = lookupEnv(environ, EnvConfig)
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := c.LoadEnv(environ); err != nil {
+		return Config{}, err
+	}
+	var errs []error
+	f.fs.Visit(func(fl *flag.Flag) {
+		v, ok := f.values[fl.Name]
+		if !ok {
+			return
+		}
+		s, _ := lookupSetting(&c, v.key)
+		if err := s.set(v.raw); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", fl.Name, err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+func lookupEnv(environ []string, name string) string {
+	for _, kv := range environ {
+		if n, v, ok := strings.Cut(kv, "="); ok && n == name {
+			return v
+		}
+	}
+	return ""
+}
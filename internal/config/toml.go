@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// loadTOML applies a TOML document to c. Only what the configuration needs is understood: [section]
+// tables, and keys holding strings, integers, booleans or single line arrays of those
+func (c *Config) loadTOML(raw []byte) error {
+	section := ""
+	lines := bufio.NewScanner(bytes.NewReader(raw))
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(lines.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return fmt.Errorf("line %d: bad table header %q", n, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", n)
+		}
+		key := strings.TrimSpace(name)
+		if section != "" {
+			key = section + "." + key
+		}
+		s, ok := lookupSetting(c, key)
+		if !ok {
+			return fmt.Errorf("line %d: unknown setting %s", n, key)
+		}
+		if err := applyTOMLValue(s, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return lines.Err()
+}
+
+func applyTOMLValue(s setting, value string) error {
+	if strings.HasPrefix(value, "[") {
+		if !strings.HasSuffix(value, "]") {
+			return fmt.Errorf("%s: arrays must fit on one line", s.key)
+		}
+		items := []string{}
+		for _, item := range splitTOMLArray(value[1 : len(value)-1]) {
+			v, err := tomlScalar(item)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.key, err)
+			}
+			items = append(items, v)
+		}
+		return s.setList(items)
+	}
+	v, err := tomlScalar(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.key, err)
+	}
+	if s.field.Kind() == reflect.Slice {
+		return s.setList([]string{v})
+	}
+	return s.set(v)
+}
+
+// tomlScalar returns the text of a string, integer or boolean value
+func tomlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "true", value == "false":
+		return value, nil
+	}
+	if _, err := strconv.ParseInt(strings.ReplaceAll(value, "_", ""), 10, 64); err != nil {
+		return "", fmt.Errorf("unsupported value %s", value)
+	}
+	return strings.ReplaceAll(value, "_", ""), nil
+}
+
+// splitTOMLArray splits the inside of an array on the commas outside of strings
+func splitTOMLArray(inside string) []string {
+	items := []string{}
+	var quote rune
+	start := 0
+	for i, r := range inside {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || inside[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, inside[start:i])
+			start = i + 1
+		}
+	}
+	items = append(items, inside[start:])
+	trimmed := []string{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			trimmed = append(trimmed, item)
+		}
+	}
+	return trimmed
+}
+
+// stripComment drops what follows a # outside of strings
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || line[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
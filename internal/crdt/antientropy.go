@@ -0,0 +1,123 @@
+package crdt
+
+import "time"
+
+// SetDigest is what replicas of a LWWSet exchange to find out which key ranges they disagree on,
+// its size only depends on the depth of the trees and not on the size of the set
+type SetDigest struct {
+	Additions *MerkleTree `json:"additions"`
+	Removals  *MerkleTree `json:"removals"`
+}
+
+// Diff returns the ranges of additions and removals whose content differs between d and other
+func (d *SetDigest) Diff(other *SetDigest) (Ranges, error) {
+	additions, err := d.Additions.Diff(other.Additions)
+	if err != nil {
+		return Ranges{}, err
+	}
+	removals, err := d.Removals.Diff(other.Removals)
+	if err != nil {
+		return Ranges{}, err
+	}
+	return Ranges{Depth: d.Additions.Depth, Additions: additions, Removals: removals}, nil
+}
+
+// Ranges lists key ranges of additions and removals, as numbered by a MerkleTree of Depth
+type Ranges struct {
+	Depth     int   `json:"depth"`
+	Additions []int `json:"additions"`
+	Removals  []int `json:"removals"`
+}
+
+// Empty reports whether there is no range to transfer
+func (r Ranges) Empty() bool {
+	return len(r.Additions) == 0 && len(r.Removals) == 0
+}
+
+// RangeState is the content of some ranges of a set, which is all a replica has to ship to repair
+// those ranges on another one
+type RangeState[T any] struct {
+	Additions []Entry[T] `json:"additions"`
+	Removals  []Entry[T] `json:"removals"`
+}
+
+// Len returns the number of elements carried
+func (rs *RangeState[T]) Len() int {
+	return len(rs.Additions) + len(rs.Removals)
+}
+
+// Digest summarizes additions and removals into Merkle trees of the given depth
+func (s *LWWSet[T]) Digest(depth int) (*SetDigest, error) {
+	additions, err := BuildMerkleTree(s.Additions, depth)
+	if err != nil {
+		return nil, err
+	}
+	removals, err := BuildMerkleTree(s.Removals, depth)
+	if err != nil {
+		return nil, err
+	}
+	return &SetDigest{Additions: additions, Removals: removals}, nil
+}
+
+// RangeState returns the elements of the set falling in r
+func (s *LWWSet[T]) RangeState(r Ranges) (*RangeState[T], error) {
+	additions, err := entriesIn(s.Additions, r.Additions, r.Depth)
+	if err != nil {
+		return nil, err
+	}
+	removals, err := entriesIn(s.Removals, r.Removals, r.Depth)
+	if err != nil {
+		return nil, err
+	}
+	return &RangeState[T]{Additions: additions, Removals: removals}, nil
+}
+
+// MergeRangeState merges the elements of rs like Merge does with a whole set
+func (s *LWWSet[T]) MergeRangeState(rs *RangeState[T]) error {
+	defer observeMerge("lwwset_range", time.Now())
+	for _, e := range rs.Additions {
+		if err := s.addWithTime(e.Key, e.Value, e.Timestamp); err != nil {
+			return err
+		}
+	}
+	for _, e := range rs.Removals {
+		if err := s.removeWithTime(e.Key, e.Value, e.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AntiEntropy runs one round of anti-entropy between two replicas: a sends its digest to b, b
+// answers with the ranges they disagree on and its content of them, and a sends back its own.
+// Afterwards both hold the same state. It returns how many elements were transferred
+func AntiEntropy[T any](a, b LastWriterWinsSet[T], depth int) (int, error) {
+	digestA, err := a.Digest(depth)
+	if err != nil {
+		return 0, err
+	}
+	digestB, err := b.Digest(depth)
+	if err != nil {
+		return 0, err
+	}
+	ranges, err := digestB.Diff(digestA)
+	if err != nil || ranges.Empty() {
+		return 0, err
+	}
+
+	fromB, err := b.RangeState(ranges)
+	if err != nil {
+		return 0, err
+	}
+	fromA, err := a.RangeState(ranges)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.MergeRangeState(fromB); err != nil {
+		return 0, err
+	}
+	if err := b.MergeRangeState(fromA); err != nil {
+		return 0, err
+	}
+	return fromA.Len() + fromB.Len(), nil
+}
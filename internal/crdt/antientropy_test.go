@@ -0,0 +1,78 @@
+package crdt_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/crdt"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSet() crdt.LastWriterWinsSet[string] {
+	return crdt.NewLWWSet[string](crdt.NewTimeSet[string](), crdt.NewTimeSet[string]())
+}
+
+func TestMerkleDiffFindsChangedRanges(t *testing.T) {
+	a, b := crdt.NewTimeSet[string](), crdt.NewTimeSet[string]()
+	at := hlc.Timestamp{Wall: 100}
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.NoError(t, a.AddWithTime(key, "v", at))
+		require.NoError(t, b.AddWithTime(key, "v", at))
+	}
+	ta, err := crdt.BuildMerkleTree[string](a, 6)
+	require.NoError(t, err)
+	tb, err := crdt.BuildMerkleTree[string](b, 6)
+	require.NoError(t, err)
+	assert.Equal(t, ta.Root(), tb.Root())
+
+	require.NoError(t, b.AddWithTime("key-42", "changed", hlc.Timestamp{Wall: 101}))
+	tb, err = crdt.BuildMerkleTree[string](b, 6)
+	require.NoError(t, err)
+	assert.NotEqual(t, ta.Root(), tb.Root())
+	ranges, err := ta.Diff(tb)
+	require.NoError(t, err)
+	assert.Len(t, ranges, 1)
+
+	shallow, err := crdt.BuildMerkleTree[string](b, 2)
+	require.NoError(t, err)
+	_, err = ta.Diff(shallow)
+	assert.ErrorIs(t, err, crdt.ErrDigestMismatch)
+}
+
+func TestAntiEntropyOnlyShipsDifferingRanges(t *testing.T) {
+	a, b := newSet(), newSet()
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		require.NoError(t, a.Add(key, "v"))
+	}
+	_, err := crdt.AntiEntropy(a, b, crdt.DefaultMerkleDepth)
+	require.NoError(t, err)
+
+	require.NoError(t, a.Add("only-a", "v"))
+	// b saw the timestamps of a during the first round, so its removal wins without waiting
+	require.NoError(t, b.Remove("key-7", "v"))
+	require.NoError(t, b.Add("only-b", "v"))
+
+	transferred, err := crdt.AntiEntropy(a, b, crdt.DefaultMerkleDepth)
+	require.NoError(t, err)
+	assert.Less(t, transferred, 50, "only the few ranges that changed travel")
+
+	for _, s := range []crdt.LastWriterWinsSet[string]{a, b} {
+		assert.True(t, s.Exists("only-a"))
+		assert.True(t, s.Exists("only-b"))
+		assert.False(t, s.Exists("key-7"))
+		assert.True(t, s.Exists("key-8"))
+	}
+	da, err := a.Digest(crdt.DefaultMerkleDepth)
+	require.NoError(t, err)
+	db, err := b.Digest(crdt.DefaultMerkleDepth)
+	require.NoError(t, err)
+	assert.Equal(t, da, db)
+
+	transferred, err = crdt.AntiEntropy(a, b, crdt.DefaultMerkleDepth)
+	require.NoError(t, err)
+	assert.Zero(t, transferred)
+}
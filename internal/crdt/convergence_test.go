@@ -0,0 +1,287 @@
+package crdt_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/crdt"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/bjornaer/hermes/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const replicas = 3
+
+// op is one random step of a replica: a write, or a merge of another replica's state when Kind
+// says so. Fields are exported for testing/quick to fill them
+type op struct {
+	Replica, Kind, Key, Field, Amount uint8
+}
+
+func (o op) replica() int { return int(o.Replica) % replicas }
+func (o op) key() string  { return fmt.Sprintf("k%d", o.Key%8) }
+func (o op) syncs() bool  { return o.Kind%5 == 0 }
+func (o op) from() int    { return int(o.Key) % replicas }
+
+// skewedClocks returns one clock per replica, replicas being seconds apart, all reading the same
+// fake time that moves on at every read so replays issue the exact same timestamps
+func skewedClocks() []*hlc.Clock {
+	var tick int64
+	clocks := []*hlc.Clock{}
+	for i := 0; i < replicas; i++ {
+		skew := time.Duration(i-1) * time.Second
+		clocks = append(clocks, hlc.NewClock(fmt.Sprintf("r%d", i), func() time.Time {
+			tick++
+			return time.Unix(1000, tick).Add(skew)
+		}))
+	}
+	return clocks
+}
+
+// converges replays ops twice, then makes the replicas exchange their states in two different
+// orders, merging some states more than once. Every replica of both runs has to end up the same
+func converges[S any](ops []op, build func([]op) []S, merge func(into, from S) error, observe func(S) any) bool {
+	forward, backward := build(ops), build(ops)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < replicas; i++ {
+			for j := 0; j < replicas; j++ {
+				if merge(forward[i], forward[j]) != nil {
+					return false
+				}
+			}
+		}
+	}
+	for i := replicas - 1; i >= 0; i-- {
+		for j := replicas - 1; j >= 0; j-- {
+			if merge(backward[i], backward[j]) != nil || merge(backward[i], backward[j]) != nil {
+				return false
+			}
+		}
+	}
+	for i := replicas - 1; i >= 0; i-- {
+		for j := 0; j < replicas; j++ {
+			if merge(backward[i], backward[j]) != nil {
+				return false
+			}
+		}
+	}
+	want := observe(forward[0])
+	for i := 0; i < replicas; i++ {
+		if !assert.ObjectsAreEqual(want, observe(forward[i])) || !assert.ObjectsAreEqual(want, observe(backward[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+var quickConfig = &quick.Config{MaxCount: 200}
+
+func TestORSetConverges(t *testing.T) {
+	build := func(ops []op) []*crdt.ORSet[string] {
+		sets := []*crdt.ORSet[string]{}
+		for i := 0; i < replicas; i++ {
+			sets = append(sets, crdt.NewORSet[string](fmt.Sprintf("r%d", i)))
+		}
+		for _, o := range ops {
+			s := sets[o.replica()]
+			switch {
+			case o.syncs():
+				_ = s.Merge(sets[o.from()])
+			case o.Kind%2 == 0:
+				s.Remove(o.key())
+			default:
+				s.Add(o.key())
+			}
+		}
+		return sets
+	}
+	observe := func(s *crdt.ORSet[string]) any {
+		elements := s.Elements()
+		sort.Strings(elements)
+		return elements
+	}
+	property := func(ops []op) bool {
+		return converges(ops, build, (*crdt.ORSet[string]).Merge, observe)
+	}
+	require.NoError(t, quick.Check(property, quickConfig))
+}
+
+func TestPNCounterConverges(t *testing.T) {
+	build := func(ops []op) []*crdt.PNCounter {
+		counters := []*crdt.PNCounter{}
+		for i := 0; i < replicas; i++ {
+			counters = append(counters, crdt.NewPNCounter(fmt.Sprintf("r%d", i)))
+		}
+		for _, o := range ops {
+			c := counters[o.replica()]
+			switch {
+			case o.syncs():
+				_ = c.Merge(counters[o.from()])
+			case o.Kind%2 == 0:
+				c.Decrement(uint64(o.Amount))
+			default:
+				c.Increment(uint64(o.Amount))
+			}
+		}
+		return counters
+	}
+	property := func(ops []op) bool {
+		var want int64
+		for _, o := range ops {
+			if !o.syncs() {
+				if o.Kind%2 == 0 {
+					want -= int64(o.Amount)
+				} else {
+					want += int64(o.Amount)
+				}
+			}
+		}
+		observe := func(c *crdt.PNCounter) any { return c.Value() }
+		counters := build(ops)
+		for _, c := range counters {
+			_ = counters[0].Merge(c)
+		}
+		// every increment is counted exactly once once replicas merged
+		return converges(ops, build, (*crdt.PNCounter).Merge, observe) && counters[0].Value() == want
+	}
+	require.NoError(t, quick.Check(property, quickConfig))
+
+	a, b := crdt.NewPNCounter("a"), crdt.NewPNCounter("b")
+	a.Increment(5)
+	b.Increment(3)
+	b.Decrement(10)
+	require.NoError(t, a.Merge(b))
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, int64(-2), a.Value())
+}
+
+func TestLWWMapConverges(t *testing.T) {
+	build := func(ops []op) []*crdt.LWWMap[uint8] {
+		clocks := skewedClocks()
+		maps := []*crdt.LWWMap[uint8]{}
+		for i := 0; i < replicas; i++ {
+			maps = append(maps, crdt.NewLWWMap[uint8](clocks[i]))
+		}
+		for _, o := range ops {
+			m := maps[o.replica()]
+			field := fmt.Sprintf("f%d", o.Field%3)
+			switch {
+			case o.syncs():
+				_ = m.Merge(maps[o.from()])
+			case o.Kind%7 == 1:
+				m.DeleteRecord(o.key())
+			case o.Kind%3 == 0:
+				m.Delete(o.key(), field)
+			default:
+				m.Set(o.key(), field, o.Amount)
+			}
+		}
+		return maps
+	}
+	observe := func(m *crdt.LWWMap[uint8]) any {
+		records := map[string]map[string]uint8{}
+		for _, key := range m.Keys() {
+			records[key], _ = m.Get(key)
+		}
+		return records
+	}
+	property := func(ops []op) bool {
+		return converges(ops, build, (*crdt.LWWMap[uint8]).Merge, observe)
+	}
+	require.NoError(t, quick.Check(property, quickConfig))
+}
+
+func TestLWWSetConverges(t *testing.T) {
+	build := func(ops []op) []crdt.LastWriterWinsSet[uint8] {
+		clocks := skewedClocks()
+		sets := []crdt.LastWriterWinsSet[uint8]{}
+		for i := 0; i < replicas; i++ {
+			sets = append(sets, crdt.NewLWWSet[uint8](crdt.NewTimeSet[uint8](clocks[i]), crdt.NewTimeSet[uint8](clocks[i]), clocks[i]))
+		}
+		for _, o := range ops {
+			s := sets[o.replica()]
+			switch {
+			case o.syncs():
+				_ = s.Merge(sets[o.from()])
+			case o.Kind%2 == 0:
+				_ = s.Remove(o.key(), 0)
+			default:
+				_ = s.Add(o.key(), o.Amount)
+			}
+		}
+		return sets
+	}
+	observe := func(s crdt.LastWriterWinsSet[uint8]) any {
+		all, err := s.GetAll()
+		if err != nil {
+			return err
+		}
+		return all
+	}
+	merge := func(into, from crdt.LastWriterWinsSet[uint8]) error { return into.Merge(from) }
+	property := func(ops []op) bool {
+		return converges(ops, build, merge, observe)
+	}
+	require.NoError(t, quick.Check(property, quickConfig))
+}
+
+func TestORSetAddWins(t *testing.T) {
+	a, b := crdt.NewORSet[string]("a"), crdt.NewORSet[string]("b")
+	a.Add("x")
+	require.NoError(t, b.Merge(a))
+
+	// b removes the x it saw while a adds it again concurrently
+	b.Remove("x")
+	a.Add("x")
+	require.NoError(t, a.Merge(b))
+	require.NoError(t, b.Merge(a))
+	assert.True(t, a.Contains("x"))
+	assert.True(t, b.Contains("x"))
+
+	// a remove that observed every add sticks
+	b.Remove("x")
+	require.NoError(t, a.Merge(b))
+	assert.False(t, a.Contains("x"))
+}
+
+func TestLWWMapKeepsConcurrentFields(t *testing.T) {
+	a, b := crdt.NewLWWMap[string](), crdt.NewLWWMap[string]()
+	a.Set("doc", "title", "hermes")
+	b.Set("doc", "owner", "bjornaer")
+	require.NoError(t, a.Merge(b))
+	fields, ok := a.Get("doc")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"title": "hermes", "owner": "bjornaer"}, fields)
+
+	a.Delete("doc", "owner")
+	require.NoError(t, b.Merge(a))
+	_, ok = b.GetField("doc", "owner")
+	assert.False(t, ok)
+}
+
+func TestLWWSetGetAll(t *testing.T) {
+	s := newSet()
+	require.NoError(t, s.Add("a", "1"))
+	require.NoError(t, s.Add("b", "2"))
+	require.NoError(t, s.Remove("b", ""))
+	all, err := s.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, all)
+}
+
+func TestMergesAreCounted(t *testing.T) {
+	a, b := crdt.NewORSet[string]("a"), crdt.NewORSet[string]("b")
+	a.Add("x")
+	require.NoError(t, b.Merge(a))
+	require.NoError(t, b.Merge(a))
+
+	var out bytes.Buffer
+	require.NoError(t, metrics.Default.WriteText(&out))
+	assert.Regexp(t, `hermes_crdt_merges_total\{kind="orset"\} [1-9]`, out.String())
+	assert.Contains(t, out.String(), `hermes_crdt_merge_seconds_count{kind="orset"}`)
+}
@@ -0,0 +1,103 @@
+package crdt
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	_ Mergeable[*GCounter]  = (*GCounter)(nil)
+	_ Mergeable[*PNCounter] = (*PNCounter)(nil)
+)
+
+// GCounter is a grow-only counter. Every replica only increments its own slot and a merge keeps
+// the highest count seen for each slot, so the value is the sum of the slots
+type GCounter struct {
+	node   string
+	Counts map[string]uint64 `json:"counts"`
+	mutex  sync.RWMutex
+}
+
+// NewGCounter returns a zero counter for the replica node, which has to be unique among the replicas
+func NewGCounter(node string) *GCounter {
+	return &GCounter{node: node, Counts: map[string]uint64{}}
+}
+
+// Increment adds n to the slot of this replica
+func (c *GCounter) Increment(n uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Counts[c.node] += n
+}
+
+// Value returns the sum of every replica's slot
+func (c *GCounter) Value() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var total uint64
+	for _, n := range c.Counts {
+		total += n
+	}
+	return total
+}
+
+// Merge keeps the highest count of each slot
+func (c *GCounter) Merge(other *GCounter) error {
+	defer observeMerge("gcounter", time.Now())
+	if c == other {
+		return nil
+	}
+	counts := other.counts()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for node, n := range counts {
+		if n > c.Counts[node] {
+			c.Counts[node] = n
+		}
+	}
+	return nil
+}
+
+// counts copies the slots, so merging never holds the locks of two counters at once
+func (c *GCounter) counts() map[string]uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	counts := make(map[string]uint64, len(c.Counts))
+	for node, n := range c.Counts {
+		counts[node] = n
+	}
+	return counts
+}
+
+// PNCounter is a counter that can also be decremented, made of a grow-only counter of increments
+// and another of decrements
+type PNCounter struct {
+	P *GCounter `json:"p"`
+	N *GCounter `json:"n"`
+}
+
+// NewPNCounter returns a zero counter for the replica node, which has to be unique among the replicas
+func NewPNCounter(node string) *PNCounter {
+	return &PNCounter{P: NewGCounter(node), N: NewGCounter(node)}
+}
+
+func (c *PNCounter) Increment(n uint64) {
+	c.P.Increment(n)
+}
+
+func (c *PNCounter) Decrement(n uint64) {
+	c.N.Increment(n)
+}
+
+// Value returns the increments minus the decrements
+func (c *PNCounter) Value() int64 {
+	return int64(c.P.Value()) - int64(c.N.Value())
+}
+
+// Merge merges increments and decrements separately
+func (c *PNCounter) Merge(other *PNCounter) error {
+	if err := c.P.Merge(other.P); err != nil {
+		return err
+	}
+	return c.N.Merge(other.N)
+}
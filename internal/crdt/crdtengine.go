@@ -1,12 +1,21 @@
 package crdt
 
-import "time"
+import "github.com/bjornaer/hermes/internal/hlc"
 
 type CrdtEngine[T any] interface {
 	Add(string, T) error
-	AddWithTime(string, T, time.Time) error
-	AddedAt(string) (time.Time, bool)
-	Each(func(string, T, time.Time) error) error
+	AddWithTime(string, T, hlc.Timestamp) error
+	AddedAt(string) (hlc.Timestamp, bool)
+	Each(func(string, T, hlc.Timestamp) error) error
 	Size() int
 	Get(string) (T, bool)
+	// Delete drops the element stored under a key, deleting a missing key is a no-op
+	Delete(string) error
+}
+
+// Mergeable is the contract shared by the replicated types of this package. Merge folds the state
+// of another replica into the receiver; it is commutative, associative and idempotent, so replicas
+// that merged each other's states in any order, any number of times, hold the same state
+type Mergeable[S any] interface {
+	Merge(other S) error
 }
@@ -0,0 +1,89 @@
+package crdt
+
+import (
+	"time"
+
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+// Delta holds the additions and removals made to a LWWSet since the last flush. Only the latest
+// element of every key is kept, so a batch of writes to the same keys stays small
+type Delta[T any] struct {
+	Additions map[string]Element[T] `json:"additions"`
+	Removals  map[string]Element[T] `json:"removals"`
+}
+
+// NewDelta returns an empty delta
+func NewDelta[T any]() *Delta[T] {
+	return &Delta[T]{Additions: map[string]Element[T]{}, Removals: map[string]Element[T]{}}
+}
+
+func keepLatest[T any](elements map[string]Element[T], key string, e Element[T]) {
+	if current, ok := elements[key]; !ok || e.Timestamp.After(current.Timestamp) {
+		elements[key] = e
+	}
+}
+
+// Join folds other into d, so several deltas can be shipped as one
+func (d *Delta[T]) Join(other *Delta[T]) {
+	for key, e := range other.Additions {
+		keepLatest(d.Additions, key, e)
+	}
+	for key, e := range other.Removals {
+		keepLatest(d.Removals, key, e)
+	}
+}
+
+// Len returns the number of elements carried
+func (d *Delta[T]) Len() int {
+	return len(d.Additions) + len(d.Removals)
+}
+
+// Empty reports whether d carries nothing
+func (d *Delta[T]) Empty() bool {
+	return d.Len() == 0
+}
+
+// record buffers an addition or removal made at t
+func (s *LWWSet[T]) record(removal bool, key string, value T, t hlc.Timestamp) {
+	s.deltaMu.Lock()
+	defer s.deltaMu.Unlock()
+	if s.delta == nil {
+		s.delta = NewDelta[T]()
+	}
+	if removal {
+		keepLatest(s.delta.Removals, key, Element[T]{Value: value, Timestamp: t})
+		return
+	}
+	keepLatest(s.delta.Additions, key, Element[T]{Value: value, Timestamp: t})
+}
+
+// FlushDelta returns the additions and removals made through Add and Remove since the previous
+// flush and starts buffering anew. Deltas merged from peers are not buffered again
+func (s *LWWSet[T]) FlushDelta() *Delta[T] {
+	s.deltaMu.Lock()
+	defer s.deltaMu.Unlock()
+	d := s.delta
+	s.delta = nil
+	if d == nil {
+		return NewDelta[T]()
+	}
+	return d
+}
+
+// MergeDelta applies a delta from a peer. Merging every delta a replica flushed converges to the
+// same state as merging the replica itself
+func (s *LWWSet[T]) MergeDelta(d *Delta[T]) error {
+	defer observeMerge("lwwset_delta", time.Now())
+	for key, e := range d.Additions {
+		if err := s.addWithTime(key, e.Value, e.Timestamp); err != nil {
+			return err
+		}
+	}
+	for key, e := range d.Removals {
+		if err := s.removeWithTime(key, e.Value, e.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
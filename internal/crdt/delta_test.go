@@ -0,0 +1,84 @@
+package crdt_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/crdt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltasConvergeLikeFullMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	replicas := []crdt.LastWriterWinsSet[string]{newSet(), newSet(), newSet()}
+	// what every replica flushed but did not ship yet, batched per recipient
+	outbox := map[int]*crdt.Delta[string]{0: crdt.NewDelta[string](), 1: crdt.NewDelta[string](), 2: crdt.NewDelta[string]()}
+
+	ship := func(from int) {
+		d := replicas[from].FlushDelta()
+		for to := range replicas {
+			if to != from {
+				outbox[to].Join(d)
+			}
+		}
+	}
+	deliver := func(to int) {
+		require.NoError(t, replicas[to].MergeDelta(outbox[to]))
+		outbox[to] = crdt.NewDelta[string]()
+	}
+
+	for i := 0; i < 600; i++ {
+		n := r.Intn(len(replicas))
+		key := fmt.Sprintf("key-%d", r.Intn(40))
+		if r.Intn(3) == 0 {
+			require.NoError(t, replicas[n].Remove(key, ""))
+		} else {
+			require.NoError(t, replicas[n].Add(key, fmt.Sprintf("v%d", i)))
+		}
+		switch r.Intn(10) {
+		case 0:
+			ship(n)
+		case 1:
+			deliver(n)
+		}
+	}
+	for n := range replicas {
+		ship(n)
+	}
+	for n := range replicas {
+		deliver(n)
+	}
+
+	full := newSet()
+	for _, replica := range replicas {
+		require.NoError(t, full.Merge(replica))
+	}
+	want, err := full.Digest(crdt.DefaultMerkleDepth)
+	require.NoError(t, err)
+	for n, replica := range replicas {
+		got, err := replica.Digest(crdt.DefaultMerkleDepth)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "replica %d diverged", n)
+	}
+}
+
+func TestDeltaKeepsLatestPerKey(t *testing.T) {
+	s := newSet()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.Add("k", fmt.Sprintf("v%d", i)))
+	}
+	require.NoError(t, s.Remove("gone", ""))
+	d := s.FlushDelta()
+	assert.Equal(t, 2, d.Len())
+	assert.Equal(t, "v4", d.Additions["k"].Value)
+	assert.True(t, s.FlushDelta().Empty(), "a flush starts a new batch")
+
+	other := newSet()
+	require.NoError(t, other.MergeDelta(d))
+	v, ok := other.Get("k")
+	assert.True(t, ok)
+	assert.Equal(t, "v4", v)
+	assert.True(t, other.FlushDelta().Empty(), "merged deltas are not shipped again")
+}
@@ -0,0 +1,143 @@
+package crdt
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+var _ CrdtEngine[string] = (*DiskEngine)(nil)
+
+// valueMarker prefixes stored values, the tree reading an empty value as a missing key while
+// removals are often stored without one
+const valueMarker = "="
+
+// DiskEngine is a CrdtEngine keeping its elements in a B-tree file, so they survive restarts.
+// Keys and values are limited to what fits in a pair, see pair.Validate, minus one byte of the value
+type DiskEngine struct {
+	tree  *btree.Btree[string]
+	clock *hlc.Clock
+	// mutex makes the read and the write of AddWithTime one step
+	mutex sync.Mutex
+}
+
+// NewDiskEngine opens, or creates, the engine stored at path. Add stamps elements with clock[0],
+// or with a clock of its own when none is given
+func NewDiskEngine(path string, clock ...*hlc.Clock) (*DiskEngine, error) {
+	tree, err := btree.InitializeBtree[string](path)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskEngine{tree: tree, clock: clockOrNew(clock)}, nil
+}
+
+func (e *DiskEngine) Add(key string, value string) error {
+	return e.AddWithTime(key, value, e.clock.Now())
+}
+
+// AddWithTime stores the element unless the one already stored under key is more recent, like TimeMap does
+func (e *DiskEngine) AddWithTime(key string, value string, t hlc.Timestamp) error {
+	p := pair.NewPairWithTimestamp(key, valueMarker+value, t)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	e.clock.Update(t)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, addedAt, found, err := e.tree.Get(key)
+	if err != nil {
+		return err
+	}
+	if found && !t.After(addedAt) {
+		return nil
+	}
+	return e.tree.Insert(p)
+}
+
+// AddedAt returns the timestamp of a given element if it exists
+//
+// The second return value (bool) indicates whether the element exists or not
+func (e *DiskEngine) AddedAt(key string) (hlc.Timestamp, bool) {
+	_, addedAt, found, err := e.tree.Get(key)
+	if err != nil {
+		return hlc.Timestamp{}, false
+	}
+	return addedAt, found
+}
+
+// Each traverses the elements stored in the tree
+func (e *DiskEngine) Each(f func(key string, val string, addedAt hlc.Timestamp) error) error {
+	err := e.tree.Iterate(func(key string, val string, addedAt hlc.Timestamp) error {
+		return f(key, strings.TrimPrefix(val, valueMarker), addedAt)
+	})
+	if err != nil {
+		return err
+	}
+	return e.tree.Error()
+}
+
+// Size counts the elements stored, walking the whole tree
+func (e *DiskEngine) Size() int {
+	size, err := e.tree.Count()
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+func (e *DiskEngine) Get(key string) (string, bool) {
+	value, _, found, err := e.tree.Get(key)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimPrefix(value, valueMarker), found
+}
+
+func (e *DiskEngine) Delete(key string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if err := e.tree.Delete(key); err != nil && !errors.Is(err, btree.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Close releases the tree file
+func (e *DiskEngine) Close() error {
+	return e.tree.Close()
+}
+
+// NewDiskLWWSet returns a LWWSet whose additions and removals are kept in dir, in additions.db and
+// removals.db, reopening them if they exist. The acknowledgements and the floor of its tombstone
+// collection are kept in gc.db, so purged elements do not come back after a restart
+func NewDiskLWWSet(dir string, clock ...*hlc.Clock) (LastWriterWinsSet[string], error) {
+	c := clockOrNew(clock)
+	additions, err := NewDiskEngine(filepath.Join(dir, "additions.db"), c)
+	if err != nil {
+		return nil, err
+	}
+	removals, err := NewDiskEngine(filepath.Join(dir, "removals.db"), c)
+	if err != nil {
+		additions.Close()
+		return nil, err
+	}
+	gcState, err := NewDiskEngine(filepath.Join(dir, "gc.db"), c)
+	if err != nil {
+		additions.Close()
+		removals.Close()
+		return nil, err
+	}
+	set := NewLWWSet[string](additions, removals, c).(*LWWSet[string])
+	if err := set.loadGCState(gcState); err != nil {
+		additions.Close()
+		removals.Close()
+		gcState.Close()
+		return nil, err
+	}
+	return set, nil
+}
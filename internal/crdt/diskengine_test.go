@@ -0,0 +1,52 @@
+package crdt_test
+
+import (
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/crdt"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskLWWSetSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := crdt.NewDiskLWWSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Add("a", "1"))
+	require.NoError(t, s.Add("b", "2"))
+	require.NoError(t, s.Remove("b", ""))
+	require.NoError(t, s.GetAdditions().(*crdt.DiskEngine).Close())
+	require.NoError(t, s.GetRemovals().(*crdt.DiskEngine).Close())
+
+	s, err = crdt.NewDiskLWWSet(dir)
+	require.NoError(t, err)
+	all, err := s.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, all)
+	assert.Equal(t, 2, s.GetAdditions().Size())
+
+	// a disk set and a memory set converge like any other pair of replicas
+	memory := newSet()
+	require.NoError(t, memory.Add("c", "3"))
+	require.NoError(t, memory.Merge(s))
+	require.NoError(t, s.Merge(memory))
+	for _, replica := range []crdt.LastWriterWinsSet[string]{s, memory} {
+		all, err := replica.GetAll()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "c": "3"}, all)
+	}
+}
+
+func TestDiskEngineKeepsLatestWrite(t *testing.T) {
+	e, err := crdt.NewDiskEngine(t.TempDir() + "/engine.db")
+	require.NoError(t, err)
+	require.NoError(t, e.AddWithTime("k", "new", hlc.Timestamp{Wall: 20}))
+	require.NoError(t, e.AddWithTime("k", "old", hlc.Timestamp{Wall: 10}))
+	v, ok := e.Get("k")
+	assert.True(t, ok)
+	assert.Equal(t, "new", v)
+	at, _ := e.AddedAt("k")
+	assert.Equal(t, hlc.Timestamp{Wall: 20}, at)
+	assert.Error(t, e.Add("a key much too long to fit in a pair", "v"))
+}
@@ -2,32 +2,35 @@ package crdt
 
 import (
 	"sync"
-	"time"
+
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/google/uuid"
 )
 
 type Element[T any] struct {
 	Value     T
-	Timestamp time.Time
+	Timestamp hlc.Timestamp
 }
 
 // TimeMap is an implementation of a timeSet that uses a map data structure. We map items to timestamps.
 type TimeMap[T any] struct {
 	Storage map[string]Element[T] `json:"elements"`
 	mutex   sync.RWMutex          // Maps in Go are not thread safe by default and that's why we use a mutex
+	clock   *hlc.Clock
 }
 
 // Add an element in the set if one of the following condition is met:
 // - Given element does not exist yet
 // - Given element already exists but with a lesser timestamp than the given one
 func (s *TimeMap[T]) Add(key string, value T) error {
-	t := time.Now()
-	return s.AddWithTime(key, value, t)
+	return s.AddWithTime(key, value, s.clock.Now())
 }
 
 // Add an element in the set if one of the following condition is met:
 // - Given element does not exist yet
 // - Given element already exists but with a lesser timestamp than the given one
-func (s *TimeMap[T]) AddWithTime(key string, value T, t time.Time) error {
+func (s *TimeMap[T]) AddWithTime(key string, value T, t hlc.Timestamp) error {
+	s.clock.Update(t)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	elm, ok := s.Storage[key]
@@ -42,7 +45,7 @@ func (s *TimeMap[T]) AddWithTime(key string, value T, t time.Time) error {
 //
 // The second return value (bool) indicates whether the element exists or not
 // If the given element does not exist, the second return (bool) is false
-func (s *TimeMap[T]) AddedAt(key string) (time.Time, bool) {
+func (s *TimeMap[T]) AddedAt(key string) (hlc.Timestamp, bool) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 	v, ok := s.Storage[key]
@@ -51,7 +54,7 @@ func (s *TimeMap[T]) AddedAt(key string) (time.Time, bool) {
 
 // Each traverses the items in the Set, calling the provided function
 // for each element key/value/timestamp association
-func (s *TimeMap[T]) Each(f func(key string, val T, addedAt time.Time) error) error {
+func (s *TimeMap[T]) Each(f func(key string, val T, addedAt hlc.Timestamp) error) error {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 	for key, element := range s.Storage {
@@ -80,9 +83,27 @@ func (s *TimeMap[T]) Get(key string) (T, bool) {
 	return v.Value, ok
 }
 
-// newTimeSet returns an empty map-backed implementation of the CrdtEngine interface
-func NewTimeSet[T comparable]() *TimeMap[T] {
+func (s *TimeMap[T]) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.Storage, key)
+	return nil
+}
+
+// newTimeSet returns an empty map-backed implementation of the CrdtEngine interface.
+// Add stamps elements with clock[0], or with a clock of its own when none is given
+func NewTimeSet[T comparable](clock ...*hlc.Clock) *TimeMap[T] {
 	return &TimeMap[T]{
 		Storage: make(map[string]Element[T]),
+		clock:   clockOrNew(clock),
+	}
+}
+
+// clockOrNew returns the optional clock argument of a constructor, or a new clock with a random
+// node name so elements of different replicas never tie
+func clockOrNew(clock []*hlc.Clock) *hlc.Clock {
+	if len(clock) > 0 && clock[0] != nil {
+		return clock[0]
 	}
+	return hlc.NewClock(uuid.NewString())
 }
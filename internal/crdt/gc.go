@@ -0,0 +1,146 @@
+package crdt
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+// DefaultGCGracePeriod is how long a removal is kept after it became stable, unless set otherwise
+const DefaultGCGracePeriod = time.Minute
+
+// keys of the GC state engine, each holding its timestamp as the time it was added at
+const (
+	floorKey  = "floor"
+	ackPrefix = "ack/"
+)
+
+// SetReplicas sets the other replicas of the set, all of which have to acknowledge a removal
+// before it is collected. Without replicas nothing is ever collected
+func (s *LWWSet[T]) SetReplicas(replicas ...string) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	s.replicas = append([]string{}, replicas...)
+}
+
+// SetGCGracePeriod sets how long a stable removal is kept before CollectGarbage purges it, on top
+// of the time it took to become stable
+func (s *LWWSet[T]) SetGCGracePeriod(d time.Duration) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	s.grace = d
+}
+
+// Acknowledge records that replica holds every addition and removal stamped at or before t, as
+// it reports after merging the state of every other replica. Acknowledgements only move forward.
+// Sets kept on disk persist them before they count
+func (s *LWWSet[T]) Acknowledge(replica string, t hlc.Timestamp) error {
+	s.clock.Update(t)
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	if !t.After(s.acks[replica]) {
+		return nil
+	}
+	if s.gcState != nil {
+		if err := s.gcState.AddWithTime(ackPrefix+replica, "", t); err != nil {
+			return err
+		}
+	}
+	if s.acks == nil {
+		s.acks = map[string]hlc.Timestamp{}
+	}
+	s.acks[replica] = t
+	return nil
+}
+
+// loadGCState reads back the acks and the floor persisted in state, which the set keeps up to date
+func (s *LWWSet[T]) loadGCState(state CrdtEngine[string]) error {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	s.gcState = state
+	s.acks = map[string]hlc.Timestamp{}
+	return state.Each(func(key string, _ string, t hlc.Timestamp) error {
+		switch {
+		case key == floorKey:
+			s.floor = t
+		case strings.HasPrefix(key, ackPrefix):
+			s.acks[strings.TrimPrefix(key, ackPrefix)] = t
+		}
+		s.clock.Update(t)
+		return nil
+	})
+}
+
+// stable returns the timestamp every replica acknowledged, false while one of them did not yet.
+// It expects gcMu held
+func (s *LWWSet[T]) stable() (hlc.Timestamp, bool) {
+	if len(s.replicas) == 0 {
+		return hlc.Timestamp{}, false
+	}
+	var point hlc.Timestamp
+	for i, replica := range s.replicas {
+		ack, ok := s.acks[replica]
+		if !ok {
+			return hlc.Timestamp{}, false
+		}
+		if i == 0 || ack.Before(point) {
+			point = ack
+		}
+	}
+	return point, true
+}
+
+// CollectGarbage purges the removals every replica acknowledged that are older than the grace
+// period, together with the additions they removed, and returns how many removals went.
+//
+// Causal stability is what makes this safe: every replica already holds those removals, so none
+// can bring the removed additions back. Writes stamped at or before the stable point are all known
+// already, so merging them again is skipped rather than resurrecting purged elements
+func (s *LWWSet[T]) CollectGarbage() (int, error) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	point, ok := s.stable()
+	if !ok {
+		return 0, nil
+	}
+	if point.After(s.floor) {
+		// the floor is persisted before anything is purged, so a restart never forgets a purge
+		if s.gcState != nil {
+			if err := s.gcState.AddWithTime(floorKey, "", point); err != nil {
+				return 0, err
+			}
+		}
+		s.floor = point
+	}
+	cutoff := s.clock.Now().Time().Add(-s.grace)
+
+	stale := map[string]hlc.Timestamp{}
+	err := s.Removals.Each(func(key string, _ T, removedAt hlc.Timestamp) error {
+		if !removedAt.After(point) && removedAt.Time().Before(cutoff) {
+			stale[key] = removedAt
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for key, removedAt := range stale {
+		// an addition made after the removal outlives it, only the removal goes
+		if addedAt, added := s.Additions.AddedAt(key); added && addedAt.Before(removedAt) {
+			if err := s.Additions.Delete(key); err != nil {
+				return 0, err
+			}
+		}
+		if err := s.Removals.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// collected reports whether a write stamped t is at or before the last stable point collected,
+// so it was known to every replica and possibly purged already. It expects gcMu held
+func (s *LWWSet[T]) collected(t hlc.Timestamp) bool {
+	return !s.floor.IsZero() && !t.After(s.floor)
+}
@@ -0,0 +1,159 @@
+package crdt_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/crdt"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gcReplica struct {
+	name  string
+	clock *hlc.Clock
+	set   crdt.LastWriterWinsSet[string]
+}
+
+func newGCReplicas(t *testing.T, now func() time.Time) []gcReplica {
+	names := []string{"a", "b", "c"}
+	replicas := []gcReplica{}
+	for i, name := range names {
+		clock := hlc.NewClock(name, now)
+		var set crdt.LastWriterWinsSet[string]
+		if i == 0 {
+			// tombstones are purged from B-tree files too
+			var err error
+			set, err = crdt.NewDiskLWWSet(t.TempDir(), clock)
+			require.NoError(t, err)
+		} else {
+			set = crdt.NewLWWSet[string](crdt.NewTimeSet[string](clock), crdt.NewTimeSet[string](clock), clock)
+		}
+		others := []string{}
+		for _, other := range names {
+			if other != name {
+				others = append(others, other)
+			}
+		}
+		set.SetReplicas(others...)
+		set.SetGCGracePeriod(0)
+		replicas = append(replicas, gcReplica{name: name, clock: clock, set: set})
+	}
+	return replicas
+}
+
+func syncAll(t *testing.T, replicas []gcReplica) {
+	for round := 0; round < 2; round++ {
+		for _, into := range replicas {
+			for _, from := range replicas {
+				require.NoError(t, into.set.Merge(from.set))
+			}
+		}
+	}
+}
+
+// ackAll has every replica tell the others it holds everything up to its clock, which holds once
+// they all synced and nobody writes
+func ackAll(t *testing.T, replicas []gcReplica) {
+	for _, from := range replicas {
+		at := from.clock.Now()
+		for _, to := range replicas {
+			if to.name != from.name {
+				require.NoError(t, to.set.Acknowledge(from.name, at))
+			}
+		}
+	}
+}
+
+func TestStableRemovalsAreCollected(t *testing.T) {
+	replicas := newGCReplicas(t, time.Now)
+	a, b, c := replicas[0].set, replicas[1].set, replicas[2].set
+	require.NoError(t, a.Add("x", "1"))
+	require.NoError(t, a.Add("y", "2"))
+	syncAll(t, replicas)
+	require.NoError(t, b.Remove("x", ""))
+	syncAll(t, replicas)
+
+	purged, err := a.CollectGarbage()
+	require.NoError(t, err)
+	assert.Zero(t, purged, "nothing is collected before every replica acknowledged")
+
+	ackAll(t, replicas)
+	for _, r := range replicas[:2] {
+		purged, err := r.set.CollectGarbage()
+		require.NoError(t, err)
+		assert.Equal(t, 1, purged, r.name)
+		assert.Equal(t, 0, r.set.GetRemovals().Size())
+		assert.Equal(t, 1, r.set.GetAdditions().Size(), "the removed addition is purged too")
+		all, err := r.set.GetAll()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"y": "2"}, all)
+	}
+
+	// c did not collect yet, merging its old tombstone and addition must not bring x back
+	require.NoError(t, a.Merge(c))
+	assert.False(t, a.Exists("x"))
+	assert.Equal(t, 1, a.GetAdditions().Size())
+
+	// writes after the stable point still go through
+	require.NoError(t, c.Add("x", "3"))
+	require.NoError(t, a.Merge(c))
+	v, ok := a.Get("x")
+	assert.True(t, ok)
+	assert.Equal(t, "3", v)
+}
+
+func TestGracePeriodDelaysCollection(t *testing.T) {
+	wall := time.Unix(1000, 0)
+	replicas := newGCReplicas(t, func() time.Time { return wall })
+	a := replicas[0].set
+	a.SetGCGracePeriod(10 * time.Second)
+	require.NoError(t, a.Add("x", "1"))
+	require.NoError(t, a.Remove("x", ""))
+	syncAll(t, replicas)
+	ackAll(t, replicas)
+
+	purged, err := a.CollectGarbage()
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	wall = wall.Add(11 * time.Second)
+	purged, err = a.CollectGarbage()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, 0, a.GetAdditions().Size())
+}
+
+func TestDiskSetKeepsCollectionAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	replicas := newGCReplicas(t, time.Now)
+	reopen := func() crdt.LastWriterWinsSet[string] {
+		set, err := crdt.NewDiskLWWSet(dir, replicas[0].clock)
+		require.NoError(t, err)
+		set.SetReplicas("b", "c")
+		set.SetGCGracePeriod(0)
+		return set
+	}
+	replicas[0].set = reopen()
+	b, c := replicas[1].set, replicas[2].set
+
+	require.NoError(t, replicas[0].set.Add("x", "1"))
+	syncAll(t, replicas)
+	require.NoError(t, b.Remove("x", ""))
+	syncAll(t, replicas)
+	ackAll(t, replicas)
+
+	// the acknowledgements survive a restart
+	a := reopen()
+	purged, err := a.CollectGarbage()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	// so does the floor: c's old addition and tombstone still count as collected
+	a = reopen()
+	require.NoError(t, a.Merge(c))
+	assert.False(t, a.Exists("x"))
+	assert.Equal(t, 0, a.GetAdditions().Size())
+	assert.Equal(t, 0, a.GetRemovals().Size())
+}
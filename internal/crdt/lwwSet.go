@@ -1,7 +1,10 @@
 package crdt
 
 import (
+	"sync"
 	"time"
+
+	"github.com/bjornaer/hermes/internal/hlc"
 )
 
 type LastWriterWinsSet[T any] interface {
@@ -13,21 +16,56 @@ type LastWriterWinsSet[T any] interface {
 	Merge(LastWriterWinsSet[T]) error
 	GetAdditions() CrdtEngine[T]
 	GetRemovals() CrdtEngine[T]
+	Digest(depth int) (*SetDigest, error)
+	RangeState(Ranges) (*RangeState[T], error)
+	MergeRangeState(*RangeState[T]) error
+	FlushDelta() *Delta[T]
+	MergeDelta(*Delta[T]) error
+	SetReplicas(...string)
+	SetGCGracePeriod(time.Duration)
+	Acknowledge(string, hlc.Timestamp) error
+	CollectGarbage() (int, error)
 }
 
+var _ Mergeable[LastWriterWinsSet[string]] = (*LWWSet[string])(nil)
+
 // LWWSet is a Last-Writer-Wins Set implementation
 type LWWSet[T any] struct {
 	Additions CrdtEngine[T] `json:"additions"`
 	Removals  CrdtEngine[T] `json:"removals"`
+	clock     *hlc.Clock
+	delta     *Delta[T]
+	deltaMu   sync.Mutex
+	// tombstone collection, see CollectGarbage. Writes hold gcMu for reading so none interleaves with a purge
+	replicas []string
+	acks     map[string]hlc.Timestamp
+	grace    time.Duration
+	floor    hlc.Timestamp
+	gcMu     sync.RWMutex
+	// gcState persists acks and floor for sets whose elements survive restarts, nil otherwise
+	gcState CrdtEngine[string]
 }
 
 // Add marks an element to be added at a given timestamp
 func (s *LWWSet[T]) Add(key string, value T) error {
-	return s.Additions.Add(key, value)
+	s.gcMu.RLock()
+	defer s.gcMu.RUnlock()
+	t := s.clock.Now()
+	if err := s.Additions.AddWithTime(key, value, t); err != nil {
+		return err
+	}
+	s.record(false, key, value, t)
+	return nil
 }
 
 // Add marks an element to be added at a given timestamp
-func (s *LWWSet[T]) addWithTime(key string, value T, t time.Time) error {
+func (s *LWWSet[T]) addWithTime(key string, value T, t hlc.Timestamp) error {
+	s.clock.Update(t)
+	s.gcMu.RLock()
+	defer s.gcMu.RUnlock()
+	if s.collected(t) {
+		return nil
+	}
 	return s.Additions.AddWithTime(key, value, t)
 }
 
@@ -37,11 +75,24 @@ func (s *LWWSet[T]) GetAdditions() CrdtEngine[T] {
 
 // Remove marks an element to be removed at a given timestamp
 func (s *LWWSet[T]) Remove(key string, value T) error {
-	return s.Removals.Add(key, value)
+	s.gcMu.RLock()
+	defer s.gcMu.RUnlock()
+	t := s.clock.Now()
+	if err := s.Removals.AddWithTime(key, value, t); err != nil {
+		return err
+	}
+	s.record(true, key, value, t)
+	return nil
 }
 
 // Remove marks an element to be removed at a given timestamp
-func (s *LWWSet[T]) removeWithTime(key string, value T, t time.Time) error {
+func (s *LWWSet[T]) removeWithTime(key string, value T, t hlc.Timestamp) error {
+	s.clock.Update(t)
+	s.gcMu.RLock()
+	defer s.gcMu.RUnlock()
+	if s.collected(t) {
+		return nil
+	}
 	return s.Removals.AddWithTime(key, value, t)
 }
 
@@ -59,7 +110,7 @@ func (s *LWWSet[T]) Exists(key string) bool {
 }
 
 // isRemoved checks if an element is marked for removal
-func (s *LWWSet[T]) isRemoved(key string, since time.Time) bool {
+func (s *LWWSet[T]) isRemoved(key string, since hlc.Timestamp) bool {
 	removedAt, removed := s.Removals.AddedAt(key)
 
 	if !removed {
@@ -81,9 +132,9 @@ func (s *LWWSet[T]) Get(key string) (T, bool) {
 
 // Get returns set content
 func (s *LWWSet[T]) GetAll() (map[string]T, error) {
-	var result map[string]T
+	result := map[string]T{}
 
-	err := s.Additions.Each(func(key string, value T, addedAt time.Time) error {
+	err := s.Additions.Each(func(key string, value T, addedAt hlc.Timestamp) error {
 		removed := s.isRemoved(key, addedAt)
 
 		if !removed {
@@ -101,7 +152,11 @@ func (s *LWWSet[T]) GetAll() (map[string]T, error) {
 
 // Merge additions and removals from other LWWSet into current set
 func (s *LWWSet[T]) Merge(other LastWriterWinsSet[T]) error {
-	err := other.GetAdditions().Each(func(key string, value T, addedAt time.Time) error {
+	defer observeMerge("lwwset", time.Now())
+	if other, ok := other.(*LWWSet[T]); ok && other == s {
+		return nil // iterating our own engines while writing to them would deadlock
+	}
+	err := other.GetAdditions().Each(func(key string, value T, addedAt hlc.Timestamp) error {
 		err := s.addWithTime(key, value, addedAt)
 		if err != nil {
 			return err
@@ -113,7 +168,7 @@ func (s *LWWSet[T]) Merge(other LastWriterWinsSet[T]) error {
 		return err
 	}
 
-	err = other.GetRemovals().Each(func(key string, value T, addedAt time.Time) error {
+	err = other.GetRemovals().Each(func(key string, value T, addedAt hlc.Timestamp) error {
 		err := s.removeWithTime(key, value, addedAt)
 		if err != nil {
 			return err
@@ -128,10 +183,13 @@ func (s *LWWSet[T]) Merge(other LastWriterWinsSet[T]) error {
 	return nil
 }
 
-// NewLWWSet returns an implementation of a LastWriterWinsSet
-func NewLWWSet[T comparable](addition, removal CrdtEngine[T]) LastWriterWinsSet[T] {
+// NewLWWSet returns an implementation of a LastWriterWinsSet. Additions and removals are stamped
+// by clock[0], which should be shared with any other set of the same node, or by a clock of their own
+func NewLWWSet[T comparable](addition, removal CrdtEngine[T], clock ...*hlc.Clock) LastWriterWinsSet[T] {
 	return &LWWSet[T]{
 		Additions: addition,
 		Removals:  removal,
+		clock:     clockOrNew(clock),
+		grace:     DefaultGCGracePeriod,
 	}
 }
@@ -0,0 +1,142 @@
+package crdt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+var _ Mergeable[*LWWMap[string]] = (*LWWMap[string])(nil)
+
+// Register is a last-writer-wins register: of two writes the one with the later timestamp wins.
+// A deletion is a write too, so it is ordered against concurrent sets
+type Register[T any] struct {
+	Value     T             `json:"value"`
+	Timestamp hlc.Timestamp `json:"timestamp"`
+	Deleted   bool          `json:"deleted,omitempty"`
+}
+
+// LWWMap maps keys to records of fields, every field being a register of its own. Concurrent
+// writes to different fields of a record both survive, only writes to the same field compete,
+// which suits metadata edited field by field
+type LWWMap[T any] struct {
+	Records map[string]map[string]Register[T] `json:"records"`
+	clock   *hlc.Clock
+	mutex   sync.RWMutex
+}
+
+// NewLWWMap returns an empty map stamping writes with clock[0], or with a clock of its own
+func NewLWWMap[T any](clock ...*hlc.Clock) *LWWMap[T] {
+	return &LWWMap[T]{Records: map[string]map[string]Register[T]{}, clock: clockOrNew(clock)}
+}
+
+// write keeps r for key.field unless the register already holds a later write. It expects the lock held
+func (m *LWWMap[T]) write(key, field string, r Register[T]) {
+	fields := m.Records[key]
+	if fields == nil {
+		fields = map[string]Register[T]{}
+		m.Records[key] = fields
+	}
+	if current, ok := fields[field]; !ok || r.Timestamp.After(current.Timestamp) {
+		fields[field] = r
+	}
+}
+
+// Set writes value to the field of the record stored under key
+func (m *LWWMap[T]) Set(key, field string, value T) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.write(key, field, Register[T]{Value: value, Timestamp: m.clock.Now()})
+}
+
+// Delete removes a field of the record stored under key
+func (m *LWWMap[T]) Delete(key, field string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.write(key, field, Register[T]{Timestamp: m.clock.Now(), Deleted: true})
+}
+
+// DeleteRecord removes every field of the record this replica knows of. A field set concurrently
+// by another replica survives
+func (m *LWWMap[T]) DeleteRecord(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	t := m.clock.Now()
+	for field := range m.Records[key] {
+		m.write(key, field, Register[T]{Timestamp: t, Deleted: true})
+	}
+}
+
+// GetField returns the value of a field of the record stored under key
+func (m *LWWMap[T]) GetField(key, field string) (T, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	r, ok := m.Records[key][field]
+	if !ok || r.Deleted {
+		var empty T
+		return empty, false
+	}
+	return r.Value, true
+}
+
+// Get returns the fields of the record stored under key, false if it has none
+func (m *LWWMap[T]) Get(key string) (map[string]T, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	fields := map[string]T{}
+	for field, r := range m.Records[key] {
+		if !r.Deleted {
+			fields[field] = r.Value
+		}
+	}
+	return fields, len(fields) > 0
+}
+
+// Keys returns the keys of the records holding at least one field, in no particular order
+func (m *LWWMap[T]) Keys() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	keys := []string{}
+	for key, fields := range m.Records {
+		for _, r := range fields {
+			if !r.Deleted {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// Merge keeps the latest write of every field
+func (m *LWWMap[T]) Merge(other *LWWMap[T]) error {
+	defer observeMerge("lwwmap", time.Now())
+	if m == other {
+		return nil
+	}
+	records := other.records()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key, fields := range records {
+		for field, r := range fields {
+			m.clock.Update(r.Timestamp)
+			m.write(key, field, r)
+		}
+	}
+	return nil
+}
+
+// records copies the registers, so merging never holds the locks of two maps at once
+func (m *LWWMap[T]) records() map[string]map[string]Register[T] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	records := make(map[string]map[string]Register[T], len(m.Records))
+	for key, fields := range m.Records {
+		records[key] = make(map[string]Register[T], len(fields))
+		for field, r := range fields {
+			records[key][field] = r
+		}
+	}
+	return records
+}
@@ -0,0 +1,137 @@
+package crdt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+// DefaultMerkleDepth splits the key space in 1024 ranges
+const DefaultMerkleDepth = 10
+
+const maxMerkleDepth = 20
+
+// ErrDigestMismatch is returned when comparing digests built with different depths
+var ErrDigestMismatch = errors.New("digests do not cover the same ranges")
+
+// MerkleTree summarizes the content of a CrdtEngine. The key space is split into 2^Depth ranges of
+// key hashes, every leaf hashes the keys, timestamps and values of one range and every inner node
+// hashes its two children, so two replicas holding the same range have the same leaf and two
+// replicas holding the same data have the same root.
+//
+// Nodes are laid out as a binary heap: the children of node i are 2i+1 and 2i+2 and the leaf of
+// range r is node 2^Depth-1+r
+type MerkleTree struct {
+	Depth int      `json:"depth"`
+	Nodes [][]byte `json:"nodes"`
+}
+
+// rangeOf returns the range of the key space key falls in at depth
+func rangeOf(key string, depth int) int {
+	if depth == 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int(h.Sum64() >> (64 - depth))
+}
+
+// BuildMerkleTree hashes every element of engine into a tree of the given depth
+func BuildMerkleTree[T any](engine CrdtEngine[T], depth int) (*MerkleTree, error) {
+	if depth < 0 || depth > maxMerkleDepth {
+		return nil, fmt.Errorf("merkle depth %d out of [0, %d]", depth, maxMerkleDepth)
+	}
+	ranges := make([][]string, 1<<depth)
+	err := engine.Each(func(key string, val T, addedAt hlc.Timestamp) error {
+		r := rangeOf(key, depth)
+		ranges[r] = append(ranges[r], fmt.Sprintf("%q %s %v", key, addedAt, val))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := 1 << depth
+	m := &MerkleTree{Depth: depth, Nodes: make([][]byte, 2*leaves-1)}
+	for r, entries := range ranges {
+		if len(entries) == 0 {
+			continue // empty ranges keep a nil hash, so sparse sets stay cheap to compare
+		}
+		sort.Strings(entries)
+		h := sha256.New()
+		for _, e := range entries {
+			h.Write([]byte(e))
+			h.Write([]byte{0})
+		}
+		m.Nodes[leaves-1+r] = h.Sum(nil)
+	}
+	for i := leaves - 2; i >= 0; i-- {
+		left, right := m.Nodes[2*i+1], m.Nodes[2*i+2]
+		if left == nil && right == nil {
+			continue
+		}
+		h := sha256.New()
+		h.Write(left)
+		h.Write([]byte{1})
+		h.Write(right)
+		m.Nodes[i] = h.Sum(nil)
+	}
+	return m, nil
+}
+
+// Root returns the hash of the whole tree, nil when the engine is empty
+func (m *MerkleTree) Root() []byte {
+	return m.Nodes[0]
+}
+
+// Diff returns the ranges whose content differs between m and other, sorted. It only descends
+// into subtrees whose hashes differ
+func (m *MerkleTree) Diff(other *MerkleTree) ([]int, error) {
+	if m.Depth != other.Depth || len(m.Nodes) != len(other.Nodes) {
+		return nil, ErrDigestMismatch
+	}
+	firstLeaf := len(m.Nodes) / 2
+	ranges := []int{}
+	var walk func(i int)
+	walk = func(i int) {
+		if bytes.Equal(m.Nodes[i], other.Nodes[i]) {
+			return
+		}
+		if i >= firstLeaf {
+			ranges = append(ranges, i-firstLeaf)
+			return
+		}
+		walk(2*i + 1)
+		walk(2*i + 2)
+	}
+	walk(0)
+	return ranges, nil
+}
+
+// Entry is an element of a CrdtEngine together with its key
+type Entry[T any] struct {
+	Key       string        `json:"key"`
+	Value     T             `json:"value"`
+	Timestamp hlc.Timestamp `json:"timestamp"`
+}
+
+// entriesIn returns the elements of engine falling in ranges at depth
+func entriesIn[T any](engine CrdtEngine[T], ranges []int, depth int) ([]Entry[T], error) {
+	wanted := map[int]bool{}
+	for _, r := range ranges {
+		wanted[r] = true
+	}
+	entries := []Entry[T]{}
+	err := engine.Each(func(key string, val T, addedAt hlc.Timestamp) error {
+		if wanted[rangeOf(key, depth)] {
+			entries = append(entries, Entry[T]{Key: key, Value: val, Timestamp: addedAt})
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,18 @@
+package crdt
+
+import (
+	"time"
+
+	"github.com/bjornaer/hermes/internal/metrics"
+)
+
+var (
+	merges       = metrics.NewCounterVec("hermes_crdt_merges_total", "Replica states merged, by kind of CRDT and of state.", "kind")
+	mergeSeconds = metrics.NewHistogramVec("hermes_crdt_merge_seconds", "Time taken to merge a replica state.", nil, "kind")
+)
+
+// observeMerge records a merge of kind that started at start, meant to be deferred
+func observeMerge(kind string, start time.Time) {
+	merges.With(kind).Inc()
+	mergeSeconds.With(kind).Since(start)
+}
@@ -0,0 +1,117 @@
+package crdt
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ Mergeable[*ORSet[string]] = (*ORSet[string])(nil)
+
+// ORSet is an observed-remove set. Every add tags the element with a tag unique to the replica and
+// a remove only drops the tags its replica observed, so an add concurrent with a remove wins
+type ORSet[T comparable] struct {
+	node    string
+	counter uint64
+	// Entries holds the live tags of every element
+	Entries map[T]map[string]struct{} `json:"entries"`
+	// Tombstones holds the tags removed so far, so a merge does not bring them back
+	Tombstones map[string]struct{} `json:"tombstones"`
+	mutex      sync.RWMutex
+}
+
+// NewORSet returns an empty set for the replica node, which has to be unique among the replicas
+func NewORSet[T comparable](node string) *ORSet[T] {
+	return &ORSet[T]{node: node, Entries: map[T]map[string]struct{}{}, Tombstones: map[string]struct{}{}}
+}
+
+// Add inserts e under a fresh tag
+func (s *ORSet[T]) Add(e T) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counter++
+	tag := s.node + ":" + strconv.FormatUint(s.counter, 10)
+	if s.Entries[e] == nil {
+		s.Entries[e] = map[string]struct{}{}
+	}
+	s.Entries[e][tag] = struct{}{}
+}
+
+// Remove drops e as observed by this replica, adds of e this replica did not see yet survive it
+func (s *ORSet[T]) Remove(e T) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for tag := range s.Entries[e] {
+		s.Tombstones[tag] = struct{}{}
+	}
+	delete(s.Entries, e)
+}
+
+// Contains reports whether e has a live tag
+func (s *ORSet[T]) Contains(e T) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.Entries[e]) > 0
+}
+
+// Elements returns the elements of the set, in no particular order
+func (s *ORSet[T]) Elements() []T {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	elements := make([]T, 0, len(s.Entries))
+	for e := range s.Entries {
+		elements = append(elements, e)
+	}
+	return elements
+}
+
+// Merge takes the union of the tags of both sets minus the union of their tombstones
+func (s *ORSet[T]) Merge(other *ORSet[T]) error {
+	defer observeMerge("orset", time.Now())
+	if s == other {
+		return nil
+	}
+	entries, tombstones := other.state()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for tag := range tombstones {
+		s.Tombstones[tag] = struct{}{}
+	}
+	for e, tags := range entries {
+		for tag := range tags {
+			if s.Entries[e] == nil {
+				s.Entries[e] = map[string]struct{}{}
+			}
+			s.Entries[e][tag] = struct{}{}
+		}
+	}
+	for e, tags := range s.Entries {
+		for tag := range tags {
+			if _, removed := s.Tombstones[tag]; removed {
+				delete(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			delete(s.Entries, e)
+		}
+	}
+	return nil
+}
+
+// state copies the tags and tombstones, so merging never holds the locks of two sets at once
+func (s *ORSet[T]) state() (map[T]map[string]struct{}, map[string]struct{}) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entries := make(map[T]map[string]struct{}, len(s.Entries))
+	for e, tags := range s.Entries {
+		entries[e] = make(map[string]struct{}, len(tags))
+		for tag := range tags {
+			entries[e][tag] = struct{}{}
+		}
+	}
+	tombstones := make(map[string]struct{}, len(s.Tombstones))
+	for tag := range s.Tombstones {
+		tombstones[tag] = struct{}{}
+	}
+	return entries, tombstones
+}
@@ -27,3 +27,12 @@ func (s *DB) Get(key string) (string, bool) {
 func NewDB(c crdt.LastWriterWinsSet[string]) *DB {
 	return &DB{Crdt: c}
 }
+
+// NewDiskDB returns a DB whose state is kept in B-tree files under dir, surviving restarts
+func NewDiskDB(dir string) (*DB, error) {
+	c, err := crdt.NewDiskLWWSet(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewDB(c), nil
+}
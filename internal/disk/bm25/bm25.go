@@ -0,0 +1,432 @@
+package bm25
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+// ReservedPrefix marks keys that belong to the text index rather than to user datapoints.
+// Datapoint IDs can not start with it
+const ReservedPrefix = "\x00"
+
+const (
+	statsKey      = ReservedPrefix + "s"
+	docPrefix     = ReservedPrefix + "d" // hash(docID) $ slot -> docNo$length$docID
+	ordinalPrefix = ReservedPrefix + "n" // docNo -> docID$length
+	postingPrefix = ReservedPrefix + "p" // term \x00 docNo -> term frequency
+	textPrefix    = ReservedPrefix + "t" // docNo $ chunk -> a slice of the indexed text
+
+	// posting keys must fit in a pair key: 2 prefix bytes + term + separator + docNo
+	maxTermLength = 20
+)
+
+const (
+	DefaultK1 = 1.2
+	DefaultB  = 0.75
+)
+
+// Store is the slice of the B tree the index needs, keeping both indexes in the same file
+type Store interface {
+	Get(key string) (string, hlc.Timestamp, bool, error)
+	Insert(value *pair.Pairs) error
+	Delete(key string) error
+	IteratePrefix(prefix string, f func(key string, val string, addedAt hlc.Timestamp) error) error
+}
+
+// Hit is a document matched by a text query
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index is an inverted index with BM25 scoring persisted as reserved pairs of a Store.
+//
+// Every (re)indexed document gets a fresh ordinal which its postings and its text point at. The text
+// tells which postings to delete once the document is re-indexed or removed
+type Index struct {
+	store Store
+	K1    float64
+	B     float64
+	mu    sync.Mutex
+}
+
+type stats struct {
+	nextDocNo   uint64
+	docs        uint64
+	totalLength uint64
+}
+
+// NewIndex returns a BM25 index with the usual k1 and b parameters
+func NewIndex(store Store) *Index {
+	return &Index{store: store, K1: DefaultK1, B: DefaultB}
+}
+
+// IsReserved reports whether a key belongs to the index keyspace
+func IsReserved(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
+
+// Tokenize lowercases text and splits it on anything that is not a letter or a digit
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, f := range fields {
+		fields[i] = truncateTerm(f)
+	}
+	return fields
+}
+
+func truncateTerm(term string) string {
+	if len(term) <= maxTermLength {
+		return term
+	}
+	cut := maxTermLength
+	for cut > 0 && !utf8.RuneStart(term[cut]) {
+		cut--
+	}
+	return term[:cut]
+}
+
+// Index (re)indexes the text of a document, superseding whatever was indexed for it before
+func (idx *Index) Index(docID, text string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	st, err := idx.readStats()
+	if err != nil {
+		return err
+	}
+	slot, err := idx.supersede(docID, &st)
+	if err != nil {
+		return err
+	}
+
+	terms := Tokenize(text)
+	if len(terms) == 0 {
+		return idx.writeStats(st)
+	}
+	tf := make(map[string]int, len(terms))
+	for _, t := range terms {
+		tf[t]++
+	}
+
+	docNo := strconv.FormatUint(st.nextDocNo, 36)
+	st.nextDocNo++
+	st.docs++
+	st.totalLength += uint64(len(terms))
+
+	for term, freq := range tf {
+		if err := idx.put(postingKey(term, docNo), strconv.Itoa(freq)); err != nil {
+			return err
+		}
+	}
+	for i := 0; len(text) > 0; i++ {
+		n := min(len(text), pair.MaxValueLength)
+		if err := idx.put(textKey(docNo, i), text[:n]); err != nil {
+			return err
+		}
+		text = text[n:]
+	}
+	if err := idx.put(ordinalPrefix+docNo, fmt.Sprintf("%s$%d", docID, len(terms))); err != nil {
+		return err
+	}
+	if err := idx.put(slot, fmt.Sprintf("%s$%d$%s", docNo, len(terms), docID)); err != nil {
+		return err
+	}
+	return idx.writeStats(st)
+}
+
+// Remove drops a document from the index with its postings
+func (idx *Index) Remove(docID string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	st, err := idx.readStats()
+	if err != nil {
+		return err
+	}
+	before := st
+	if _, err := idx.supersede(docID, &st); err != nil {
+		return err
+	}
+	if st == before {
+		return nil // the document was not indexed
+	}
+	return idx.writeStats(st)
+}
+
+// Search ranks documents against query by BM25, best first, returning at most limit hits
+func (idx *Index) Search(query string, limit int) ([]Hit, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	st, err := idx.readStats()
+	if err != nil {
+		return nil, err
+	}
+	if st.docs == 0 || limit <= 0 {
+		return []Hit{}, nil
+	}
+	avgdl := float64(st.totalLength) / float64(st.docs)
+
+	seen := map[string]bool{}
+	scores := map[string]float64{}
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		type posting struct {
+			docID  string
+			tf     float64
+			length float64
+		}
+		// the ordinals are looked up once the walk is over, the store being locked during walks
+		frequencies := map[string]int{}
+		err := idx.store.IteratePrefix(postingKey(term, ""), func(key, val string, _ hlc.Timestamp) error {
+			tf, err := strconv.Atoi(val)
+			if err != nil {
+				return diskerr.Corrupt("text index posting %q: %v", key, err)
+			}
+			frequencies[key[len(postingKey(term, "")):]] = tf
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		postings := []posting{}
+		for docNo, tf := range frequencies {
+			docID, length, live, err := idx.lookupOrdinal(docNo)
+			if err != nil {
+				return nil, err
+			}
+			if live {
+				postings = append(postings, posting{docID, float64(tf), float64(length)})
+			}
+		}
+
+		n := float64(len(postings))
+		idf := math.Log((float64(st.docs)-n+0.5)/(n+0.5) + 1)
+		for _, p := range postings {
+			norm := p.tf + idx.K1*(1-idx.B+idx.B*p.length/avgdl)
+			scores[p.docID] += idf * p.tf * (idx.K1 + 1) / norm
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score == hits[j].Score {
+			return hits[i].ID < hits[j].ID
+		}
+		return hits[i].Score > hits[j].Score
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// Documents returns the text indexed for every document, by document ID
+func (idx *Index) Documents() (map[string]string, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// the ordinals are looked up once the walk is over, the store being locked during walks
+	chunks := map[string]map[int]string{}
+	err := idx.store.IteratePrefix(textPrefix, func(key, val string, _ hlc.Timestamp) error {
+		docNo, chunk, ok := strings.Cut(key[len(textPrefix):], "$")
+		i, err := strconv.Atoi(chunk)
+		if !ok || err != nil {
+			return diskerr.Corrupt("text index text %q", key)
+		}
+		if chunks[docNo] == nil {
+			chunks[docNo] = map[int]string{}
+		}
+		chunks[docNo][i] = val
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	docs := map[string]string{}
+	for docNo, c := range chunks {
+		docID, _, live, err := idx.lookupOrdinal(docNo)
+		if err != nil {
+			return nil, err
+		}
+		if live {
+			docs[docID] = joinChunks(c)
+		}
+	}
+	return docs, nil
+}
+
+// supersede deletes what is indexed for docID, if anything, returning the key its entry goes under
+func (idx *Index) supersede(docID string, st *stats) (string, error) {
+	slot, val, found, err := idx.lookupDoc(docID)
+	if err != nil || !found {
+		return slot, err
+	}
+	parts := strings.SplitN(val, "$", 3)
+	length, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", diskerr.Corrupt("text index entry for %q: %v", docID, err)
+	}
+	docNo := parts[0]
+
+	chunks := map[int]string{}
+	err = idx.store.IteratePrefix(textPrefix+docNo+"$", func(key, val string, _ hlc.Timestamp) error {
+		i, err := strconv.Atoi(key[len(textPrefix+docNo+"$"):])
+		if err != nil {
+			return diskerr.Corrupt("text index text %q: %v", key, err)
+		}
+		chunks[i] = val
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	seen := map[string]bool{}
+	for _, term := range Tokenize(joinChunks(chunks)) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		if err := idx.delete(postingKey(term, docNo)); err != nil {
+			return "", err
+		}
+	}
+	for i := range chunks {
+		if err := idx.delete(textKey(docNo, i)); err != nil {
+			return "", err
+		}
+	}
+	if err := idx.delete(ordinalPrefix + docNo); err != nil {
+		return "", err
+	}
+	if err := idx.delete(slot); err != nil {
+		return "", err
+	}
+	st.docs--
+	st.totalLength -= length
+	return slot, nil
+}
+
+// lookupDoc finds the entry of docID among those whose ID hashes the same. When there is none the
+// key returned is a free one for it
+func (idx *Index) lookupDoc(docID string) (string, string, bool, error) {
+	prefix := docKey(docID)
+	taken := map[string]bool{}
+	var slot, entry string
+	err := idx.store.IteratePrefix(prefix, func(key, val string, _ hlc.Timestamp) error {
+		parts := strings.SplitN(val, "$", 3)
+		if len(parts) != 3 {
+			return diskerr.Corrupt("text index entry %q", key)
+		}
+		taken[key] = true
+		if parts[2] == docID {
+			slot, entry = key, val
+		}
+		return nil
+	})
+	if err != nil || slot != "" {
+		return slot, entry, slot != "", err
+	}
+	for i := 0; ; i++ {
+		if key := prefix + strconv.Itoa(i); !taken[key] {
+			return key, "", false, nil
+		}
+	}
+}
+
+func (idx *Index) lookupOrdinal(docNo string) (string, int, bool, error) {
+	val, _, found, err := idx.store.Get(ordinalPrefix + docNo)
+	if err != nil || !found {
+		return "", 0, false, err
+	}
+	sep := strings.LastIndex(val, "$")
+	if sep < 0 {
+		return "", 0, false, diskerr.Corrupt("text index ordinal %q", docNo)
+	}
+	length, err := strconv.Atoi(val[sep+1:])
+	if err != nil {
+		return "", 0, false, diskerr.Corrupt("text index ordinal %q: %v", docNo, err)
+	}
+	return val[:sep], length, true, nil
+}
+
+func (idx *Index) readStats() (stats, error) {
+	val, _, found, err := idx.store.Get(statsKey)
+	if err != nil || !found {
+		return stats{}, err
+	}
+	var st stats
+	if _, err := fmt.Sscanf(val, "%d$%d$%d", &st.nextDocNo, &st.docs, &st.totalLength); err != nil {
+		return stats{}, diskerr.Corrupt("text index stats: %v", err)
+	}
+	return st, nil
+}
+
+func (idx *Index) writeStats(st stats) error {
+	return idx.put(statsKey, fmt.Sprintf("%d$%d$%d", st.nextDocNo, st.docs, st.totalLength))
+}
+
+func (idx *Index) put(key, value string) error {
+	p := pair.NewPair(key, value)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return idx.store.Insert(p)
+}
+
+// delete tolerates keys already gone, such as those a write cut short never stored
+func (idx *Index) delete(key string) error {
+	if err := idx.store.Delete(key); err != nil && !errors.Is(err, diskerr.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func postingKey(term, docNo string) string {
+	return postingPrefix + term + "\x00" + docNo
+}
+
+func joinChunks(chunks map[int]string) string {
+	var text strings.Builder
+	for i := 0; i < len(chunks); i++ {
+		text.WriteString(chunks[i])
+	}
+	return text.String()
+}
+
+func textKey(docNo string, chunk int) string {
+	return textPrefix + docNo + "$" + strconv.Itoa(chunk)
+}
+
+// docKey is the prefix of the entries of docID and of any other document whose ID hashes the same
+func docKey(docID string) string {
+	return docPrefix + strconv.FormatUint(hashDocID(docID), 16) + "$"
+}
+
+var hashDocID = func(docID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(docID))
+	return h.Sum64()
+}
@@ -0,0 +1,149 @@
+package bm25_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk/bm25"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIndex(t *testing.T) *bm25.Index {
+	idx, _ := newIndexAndTree(t)
+	return idx
+}
+
+func newIndexAndTree(t *testing.T) (*bm25.Index, *btree.Btree[string]) {
+	tree, err := btree.InitializeBtree[string](filepath.Join(t.TempDir(), "bm25.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bm25.NewIndex(tree), tree
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "vector", "db", "42"}, bm25.Tokenize("Hello, Vector-DB 42!"))
+	assert.Equal(t, []string{"supercalifragilistic"}, bm25.Tokenize("supercalifragilisticexpialidocious"))
+}
+
+func TestSearchRanksByBM25(t *testing.T) {
+	idx := newIndex(t)
+	assert.Nil(t, idx.Index("a", "the quick brown fox"))
+	assert.Nil(t, idx.Index("b", "the lazy dog sleeps all day long"))
+	assert.Nil(t, idx.Index("c", "fox fox fox"))
+
+	hits, err := idx.Search("fox", 10)
+	assert.Nil(t, err)
+	assert.Len(t, hits, 2)
+	assert.Equal(t, "c", hits[0].ID, "higher term frequency in a shorter document should win")
+	assert.Equal(t, "a", hits[1].ID)
+
+	hits, err = idx.Search("dog", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, ids(hits))
+}
+
+func TestReindexSupersedesOldPostings(t *testing.T) {
+	idx := newIndex(t)
+	assert.Nil(t, idx.Index("a", "red apple"))
+	assert.Nil(t, idx.Index("a", "green pear"))
+
+	hits, err := idx.Search("apple", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, hits)
+
+	hits, err = idx.Search("pear", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, ids(hits))
+
+	assert.Nil(t, idx.Remove("a"))
+	hits, err = idx.Search("pear", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestSupersededEntriesAreDeleted(t *testing.T) {
+	idx, tree := newIndexAndTree(t)
+	long := strings.Repeat("word ", 50)
+	require.NoError(t, idx.Index("a", "red apple "+long))
+	require.NoError(t, idx.Index("a", "green pear"))
+	require.NoError(t, idx.Index("b", "pear pear"))
+	assert.ElementsMatch(t, []string{"pear/a", "pear/b", "green/a"}, postings(t, tree))
+
+	require.NoError(t, idx.Remove("a"))
+	require.NoError(t, idx.Remove("b"))
+	var left []string
+	require.NoError(t, tree.IteratePrefix(bm25.ReservedPrefix, func(key, _ string, _ hlc.Timestamp) error {
+		left = append(left, key)
+		return nil
+	}))
+	assert.Equal(t, []string{bm25.ReservedPrefix + "s"}, left, "only the stats are left")
+}
+
+func TestHashCollisions(t *testing.T) {
+	defer bm25.SetHashDocID(func(string) uint64 { return 7 })()
+	idx := newIndex(t)
+	require.NoError(t, idx.Index("a", "red apple"))
+	require.NoError(t, idx.Index("b", "green pear"))
+	require.NoError(t, idx.Index("a", "red cherry"))
+
+	docs, err := idx.Documents()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "red cherry", "b": "green pear"}, docs)
+
+	require.NoError(t, idx.Remove("a"))
+	hits, err := idx.Search("pear red", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ids(hits))
+	require.NoError(t, idx.Index("c", "red"))
+	hits, err = idx.Search("red", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, ids(hits))
+}
+
+func TestDocumentsKeepIndexedText(t *testing.T) {
+	idx := newIndex(t)
+	assert.Nil(t, idx.Index("a", "Red apple, red!"))
+	assert.Nil(t, idx.Index("b", "green pear"))
+	assert.Nil(t, idx.Index("b", "yellow pear"))
+	assert.Nil(t, idx.Index("c", "gone"))
+	assert.Nil(t, idx.Remove("c"))
+
+	docs, err := idx.Documents()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "Red apple, red!", "b": "yellow pear"}, docs)
+
+	long := strings.Repeat("Lorem ipsum, dolor sit amet. ", 20)
+	assert.Nil(t, idx.Index("a", long))
+	docs, err = idx.Documents()
+	assert.Nil(t, err)
+	assert.Equal(t, long, docs["a"], "text longer than a pair comes back whole")
+}
+
+// postings lists the postings of tree as term/document
+func postings(t *testing.T, tree *btree.Btree[string]) []string {
+	docs := map[string]string{}
+	require.NoError(t, tree.IteratePrefix(bm25.ReservedPrefix+"n", func(key, val string, _ hlc.Timestamp) error {
+		docs[key[2:]] = val[:strings.LastIndexByte(val, '$')]
+		return nil
+	}))
+	out := []string{}
+	require.NoError(t, tree.IteratePrefix(bm25.ReservedPrefix+"p", func(key, _ string, _ hlc.Timestamp) error {
+		sep := strings.LastIndexByte(key, 0)
+		out = append(out, key[2:sep]+"/"+docs[key[sep+1:]])
+		return nil
+	}))
+	return out
+}
+
+func ids(hits []bm25.Hit) []string {
+	out := make([]string, len(hits))
+	for i, h := range hits {
+		out[i] = h.ID
+	}
+	return out
+}
@@ -0,0 +1,8 @@
+package bm25
+
+// SetHashDocID makes documents hash with h until the returned function is called
+func SetHashDocID(h func(string) uint64) func() {
+	prev := hashDocID
+	hashDocID = h
+	return func() { hashDocID = prev }
+}
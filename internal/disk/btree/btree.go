@@ -1,38 +1,72 @@
 package btree
 
 import (
+	"context"
+	"io"
 	"os"
-	"time"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
 	"github.com/bjornaer/hermes/internal/disk/pair"
 	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/hlc"
 )
 
 type node = types.Node
 
+var (
+	// ErrNotFound is returned by Update and Delete when there is no pair stored under the key
+	ErrNotFound = diskerr.ErrNotFound
+	// ErrVersionConflict is returned by CompareAndSwap when the stored version moved on
+	ErrVersionConflict = diskerr.ErrVersionConflict
+	// ErrClosed is returned by every method of a tree once it is closed
+	ErrClosed = diskerr.ErrClosed
+)
+
+// CreateOrOpenFile opens the tree file at path for reading and writing, creating it if needed
 func CreateOrOpenFile(path string) (*os.File, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return os.Create(path)
-	}
-	return os.Open(path)
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+}
+
+// DefaultPath is the tree file opened when no path is given
+const DefaultPath = "./db/hermes/olympus.db"
+
+// Config selects the tree file and how it is laid out
+type Config struct {
+	// Path is the tree file, DefaultPath when empty
+	Path string
+	// BlockSize is the size of the blocks of the file, diskblock.DefaultBlockSize when 0. It has to
+	// be the one the file was created with
+	BlockSize int
 }
 
 // Btree - Our in memory Btree struct
 type Btree[T any] struct {
-	root node
-	err  error
+	root      node
+	err       error
+	path      string
+	blockSize int
+	file      *os.File
+	shape     shape
+	mu        sync.RWMutex
+	closed    atomic.Bool
 }
 
 // Size returns number of Nodes | well, should, this one is wrong
 func (bt *Btree[T]) Size() int {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
 	return bt.root.Size()
 }
 
 // Count returns number of pairs stored
 func (bt *Btree[T]) Count() (int, error) {
 	size := 0
-	err := bt.Iterate(func(k string, v string, t time.Time) error {
+	err := bt.Iterate(func(k string, v string, t hlc.Timestamp) error {
 		size += 1
 		return nil
 	})
@@ -48,39 +82,261 @@ func (bt *Btree[T]) IsRootNode(n node) bool {
 
 // NewBtree - Create a new btree
 func InitializeBtree[T any](optionalPath ...string) (*Btree[T], error) {
-	path := "./db/hermes/olympus.db"
+	cfg := Config{}
 	if len(optionalPath) != 0 {
-		path = optionalPath[0]
+		cfg.Path = optionalPath[0]
+	}
+	return OpenBtree[T](cfg)
+}
+
+// OpenBtree opens, or creates, the tree file cfg describes
+func OpenBtree[T any](cfg Config) (*Btree[T], error) {
+	if cfg.Path == "" {
+		cfg.Path = DefaultPath
+	}
+	if cfg.BlockSize == 0 {
+		cfg.BlockSize = diskblock.DefaultBlockSize
+	}
+	if err := diskblock.ValidateBlockSize(cfg.BlockSize); err != nil {
+		return nil, err
 	}
 
-	file, err := CreateOrOpenFile(path)
+	file, err := CreateOrOpenFile(cfg.Path)
 	if err != nil {
 		return nil, err
 	}
-	dns := diskblock.NewDiskNodeService(file)
+	root, err := diskblock.NewDiskNodeServiceWithBlockSize(file, cfg.BlockSize).GetRootNodeFromDisk()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	bt := &Btree[T]{root: root, err: nil, path: cfg.Path, blockSize: cfg.BlockSize, file: file}
+	bt.exportShape()
+	return bt, nil
+}
+
+// Snapshot copies the whole tree file to w. Writers wait until the copy is done
+func (bt *Btree[T]) Snapshot(w io.Writer) error {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+	if bt.closed.Load() {
+		return ErrClosed
+	}
+	f, err := os.Open(bt.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Restore replaces the tree with the file read from r, as written by Snapshot.
+// The new file is written aside and renamed over the old one, so a failed restore leaves the tree untouched
+func (bt *Btree[T]) Restore(r io.Reader) error {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.closed.Load() {
+		return ErrClosed
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(bt.path), filepath.Base(bt.path)+".*.restore")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), bt.path); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	root, err := diskblock.NewDiskNodeServiceWithBlockSize(tmp, bt.blockSize).GetRootNodeFromDisk()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	bt.file.Close()
+	bt.file = tmp
+	bt.root = root
+	bt.shape = shape{}
+	return nil
+}
 
-	root, err := dns.GetRootNodeFromDisk()
-	if root == nil || err != nil {
-		panic(err)
+// Path returns the path of the tree file
+func (bt *Btree[T]) Path() string {
+	return bt.path
+}
+
+// BlockSize returns the size of the blocks of the tree file
+func (bt *Btree[T]) BlockSize() int {
+	return bt.blockSize
+}
+
+// Close releases the tree file. Every method, Close included, fails with ErrClosed afterwards
+func (bt *Btree[T]) Close() error {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.closed.Swap(true) {
+		return ErrClosed
 	}
-	return &Btree[T]{root: root, err: nil}, nil
+	bt.unexportShape()
+	return bt.file.Close()
 }
 
-// Insert - Insert element in tree
+// Insert - Insert element in tree, replacing the stored pair if the key already exists
 func (bt *Btree[T]) Insert(value *pair.Pairs) error {
-	return bt.root.InsertPair(value, bt)
+	return bt.InsertContext(context.Background(), value)
+}
+
+// InsertContext is Insert giving up with the error of ctx if ctx is done before the write starts.
+// A write that started always completes, stopping halfway would leave the tree inconsistent
+func (bt *Btree[T]) InsertContext(ctx context.Context, value *pair.Pairs) error {
+	if err := bt.lock(ctx); err != nil {
+		return err
+	}
+	defer bt.mu.Unlock()
+	return bt.insert(value)
 }
 
-func (bt *Btree[T]) Get(key string) (string, time.Time, bool, error) {
-	value, addedAt, err := bt.root.GetValue(key)
+// lock takes the write lock unless ctx is done or the tree closed once it got it, the caller
+// unlocking on success
+func (bt *Btree[T]) lock(ctx context.Context) error {
+	bt.mu.Lock()
+	if bt.closed.Load() {
+		bt.mu.Unlock()
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		bt.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Update - Replace the pair stored under value.Key, fails with ErrNotFound if there is none
+func (bt *Btree[T]) Update(value *pair.Pairs) error {
+	return bt.UpdateContext(context.Background(), value)
+}
+
+// UpdateContext is Update giving up with the error of ctx if ctx is done before the write starts
+func (bt *Btree[T]) UpdateContext(ctx context.Context, value *pair.Pairs) error {
+	if err := bt.lock(ctx); err != nil {
+		return err
+	}
+	defer bt.mu.Unlock()
+	stored, err := bt.root.GetPair(value.Key)
 	if err != nil {
-		return "", time.Time{}, false, err
+		return err
+	}
+	if !live(stored) {
+		return ErrNotFound
+	}
+	return bt.insert(value)
+}
+
+// CompareAndSwap - Store value only if the version currently stored under its key is expected.
+// An expected version of 0 means the key must not exist yet. Writers that lost the race
+// get ErrVersionConflict and should re-read before retrying
+func (bt *Btree[T]) CompareAndSwap(value *pair.Pairs, expected uint32) error {
+	return bt.CompareAndSwapContext(context.Background(), value, expected)
+}
+
+// CompareAndSwapContext is CompareAndSwap giving up with the error of ctx if ctx is done before the write starts
+func (bt *Btree[T]) CompareAndSwapContext(ctx context.Context, value *pair.Pairs, expected uint32) error {
+	if err := bt.lock(ctx); err != nil {
+		return err
+	}
+	defer bt.mu.Unlock()
+	stored, err := bt.root.GetPair(value.Key)
+	if err != nil {
+		return err
+	}
+	var current uint32
+	if live(stored) {
+		current = stored.Version
+	}
+	if current != expected {
+		return ErrVersionConflict
+	}
+	return bt.insert(value)
+}
+
+// Delete removes the pair stored under key, failing with ErrNotFound if there is none. Deletion
+// is lazy: the pair keeps its slot with an empty value, which Get and the iterators treat as
+// missing, and the slot is reused if the key is written again
+func (bt *Btree[T]) Delete(key string) error {
+	return bt.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is Delete giving up with the error of ctx if ctx is done before the write starts
+func (bt *Btree[T]) DeleteContext(ctx context.Context, key string) error {
+	if err := bt.lock(ctx); err != nil {
+		return err
+	}
+	defer bt.mu.Unlock()
+	stored, err := bt.root.GetPair(key)
+	if err != nil {
+		return err
+	}
+	if !live(stored) {
+		return ErrNotFound
+	}
+	return bt.insert(pair.NewPairWithTimestamp(key, "", hlc.Timestamp{}))
+}
+
+// live reports whether stored is a pair rather than nothing or the slot a deleted pair kept
+func live(stored *pair.Pairs) bool {
+	return stored != nil && stored.Value != ""
+}
+
+// Version returns the version of the pair stored under key, the bool is false if it does not exist.
+// Versions keep counting across deletes, so a key written again never reuses one
+func (bt *Btree[T]) Version(key string) (uint32, bool, error) {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+	if bt.closed.Load() {
+		return 0, false, ErrClosed
+	}
+	stored, err := bt.root.GetPair(key)
+	if err != nil || !live(stored) {
+		return 0, false, err
+	}
+	return stored.Version, true, nil
+}
+
+func (bt *Btree[T]) Get(key string) (string, hlc.Timestamp, bool, error) {
+	return bt.GetContext(context.Background(), key)
+}
+
+// GetContext is Get reading the blocks within ctx, so they show up in its trace. It fails with the
+// error of ctx once ctx is done
+func (bt *Btree[T]) GetContext(ctx context.Context, key string) (string, hlc.Timestamp, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", hlc.Timestamp{}, false, err
+	}
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+	if bt.closed.Load() {
+		return "", hlc.Timestamp{}, false, ErrClosed
+	}
+	value, addedAt, err := bt.rootWithContext(ctx).GetValue(key)
+	if err != nil {
+		return "", hlc.Timestamp{}, false, err
 	}
 	if value == "" {
-		return "", time.Time{}, false, nil
+		return "", hlc.Timestamp{}, false, nil
 	}
 	if addedAt.IsZero() {
-		return "", time.Time{}, false, nil
+		return "", hlc.Timestamp{}, false, nil
 	}
 	return value, addedAt, true, nil
 }
@@ -89,24 +345,74 @@ func (bt *Btree[T]) SetRootNode(n node) {
 	bt.root = n
 }
 
-func (bt *Btree[T]) Iterate(f func(key string, val string, addedAt time.Time) error) error {
-	return depthFirstPostOrder(bt.root, f)
+func (bt *Btree[T]) Iterate(f func(key string, val string, addedAt hlc.Timestamp) error) error {
+	return bt.IterateContext(context.Background(), f)
+}
+
+// IterateContext is Iterate reading the blocks within ctx, so they show up in its trace. The walk
+// stops with the error of ctx once ctx is done, f is not called afterwards.
+// Writers wait for the walk to end, so f must not call the tree
+func (bt *Btree[T]) IterateContext(ctx context.Context, f func(key string, val string, addedAt hlc.Timestamp) error) error {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+	if bt.closed.Load() {
+		return ErrClosed
+	}
+	if ctx.Done() == nil {
+		return depthFirstPostOrder(bt.rootWithContext(ctx), f)
+	}
+	return depthFirstPostOrder(bt.rootWithContext(ctx), func(key string, val string, addedAt hlc.Timestamp) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return f(key, val, addedAt)
+	})
+}
+
+// rootWithContext returns a read only copy of the root reading its descendants within ctx
+func (bt *Btree[T]) rootWithContext(ctx context.Context) node {
+	if ctx == context.Background() {
+		return bt.root
+	}
+	return bt.root.(*diskblock.DiskNode).WithContext(ctx)
+}
+
+// IteratePrefix walks, in key order, every pair whose key starts with prefix.
+// Subtrees that cannot hold such keys are never read from disk
+func (bt *Btree[T]) IteratePrefix(prefix string, f func(key string, val string, addedAt hlc.Timestamp) error) error {
+	return bt.IteratePrefixContext(context.Background(), prefix, f)
+}
+
+// IteratePrefixContext is IteratePrefix stopping with the error of ctx once ctx is done.
+// Writers wait for the walk to end, so f must not call the tree
+func (bt *Btree[T]) IteratePrefixContext(ctx context.Context, prefix string, f func(key string, val string, addedAt hlc.Timestamp) error) error {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+	if bt.closed.Load() {
+		return ErrClosed
+	}
+	return inOrderPrefix(bt.rootWithContext(ctx), prefix, f)
 }
 
 func (bt *Btree[T]) Error() error {
 	return bt.err
 }
 
-func depthFirstPostOrder[T any](node types.Node, f func(key string, val T, addedAt time.Time) error) error {
+func depthFirstPostOrder[T any](node types.Node, f func(key string, val T, addedAt hlc.Timestamp) error) error {
 	diskNode := node.(*diskblock.DiskNode)
 	children, err := diskNode.GetChildNodes()
 	if err != nil {
 		return err
 	}
 	for _, child := range children {
-		depthFirstPostOrder(child, f)
+		if err := depthFirstPostOrder(child, f); err != nil {
+			return err
+		}
 	}
 	for _, elm := range diskNode.GetElements() {
+		if elm.Value == "" {
+			continue // deleted
+		}
 		err := f(elm.Key, any(elm.Value).(T), elm.Timestamp)
 		if err != nil {
 			return err
@@ -114,3 +420,36 @@ func depthFirstPostOrder[T any](node types.Node, f func(key string, val T, added
 	}
 	return nil
 }
+
+func inOrderPrefix(node types.Node, prefix string, f func(key string, val string, addedAt hlc.Timestamp) error) error {
+	diskNode := node.(*diskblock.DiskNode)
+	elements := diskNode.GetElements()
+	for i := 0; i <= len(elements); i++ {
+		// child i holds the keys between elements[i-1] and elements[i]
+		if !diskNode.IsLeaf() && childMayHavePrefix(elements, i, prefix) {
+			child, err := diskNode.GetChildAtIndex(i)
+			if err != nil {
+				return err
+			}
+			if err := inOrderPrefix(child, prefix, f); err != nil {
+				return err
+			}
+		}
+		if i < len(elements) && elements[i].Value != "" && strings.HasPrefix(elements[i].Key, prefix) {
+			if err := f(elements[i].Key, elements[i].Value, elements[i].Timestamp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func childMayHavePrefix(elements []*pair.Pairs, i int, prefix string) bool {
+	if i < len(elements) && elements[i].Key < prefix {
+		return false
+	}
+	if i > 0 && elements[i-1].Key > prefix && !strings.HasPrefix(elements[i-1].Key, prefix) {
+		return false
+	}
+	return true
+}
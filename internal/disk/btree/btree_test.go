@@ -1,13 +1,17 @@
 package btree_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"sort"
 	"testing"
-	"time"
 
 	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
 	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/hlc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -88,7 +92,7 @@ func BtreeGetInexistent(s *UnitTestSuite) {
 
 func BtreeIterateF(s *UnitTestSuite) {
 	counter := 0
-	err := s.tree.Iterate(func(k string, v string, t time.Time) error {
+	err := s.tree.Iterate(func(k string, v string, t hlc.Timestamp) error {
 		counter += 1
 		assert.NotZero(s.T(), k)
 		assert.NotZero(s.T(), v)
@@ -105,6 +109,134 @@ func BtreeIterateF(s *UnitTestSuite) {
 	assert.Equal(s.T(), expected, counter)
 }
 
+func BtreeUpsert(s *UnitTestSuite) {
+	before, err := s.tree.Count()
+	assert.Nil(s.T(), err)
+	err = s.tree.Insert(pair.NewPair("key-1", "updated"))
+	assert.Nil(s.T(), err)
+
+	value, _, found, err := s.tree.Get("key-1")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), found)
+	assert.Equal(s.T(), "updated", value)
+
+	after, err := s.tree.Count()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), before, after, "upsert should not add a second pair")
+
+	err = s.tree.Update(pair.NewPair("missing-key", "value"))
+	assert.ErrorIs(s.T(), err, btree.ErrNotFound)
+}
+
+func BtreeCompareAndSwap(s *UnitTestSuite) {
+	err := s.tree.CompareAndSwap(pair.NewPair("cas-key", "first"), 0)
+	assert.Nil(s.T(), err)
+	version, found, err := s.tree.Version("cas-key")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), found)
+
+	// two writers read the same version, only the first one wins
+	err = s.tree.CompareAndSwap(pair.NewPair("cas-key", "second"), version)
+	assert.Nil(s.T(), err)
+	err = s.tree.CompareAndSwap(pair.NewPair("cas-key", "lost"), version)
+	assert.ErrorIs(s.T(), err, btree.ErrVersionConflict)
+
+	value, _, _, err := s.tree.Get("cas-key")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "second", value)
+
+	err = s.tree.CompareAndSwap(pair.NewPair("cas-key", "again"), 0)
+	assert.ErrorIs(s.T(), err, btree.ErrVersionConflict)
+}
+
+func BtreeIteratePrefix(s *UnitTestSuite) {
+	keys := []string{}
+	err := s.tree.IteratePrefix("key-1", func(k string, v string, t hlc.Timestamp) error {
+		keys = append(keys, k)
+		return nil
+	})
+	assert.Nil(s.T(), err)
+	// key-1, key-10..19 and key-100..199
+	assert.Len(s.T(), keys, 111)
+	assert.True(s.T(), sort.StringsAreSorted(keys), "prefix scan should walk keys in order")
+}
+
+func BtreeSnapshotRestore(s *UnitTestSuite) {
+	before, err := s.tree.Count()
+	assert.Nil(s.T(), err)
+	stored, _, _, err := s.tree.Get("key-1")
+	assert.Nil(s.T(), err)
+	var snapshot bytes.Buffer
+	err = s.tree.Snapshot(&snapshot)
+	assert.Nil(s.T(), err)
+
+	err = s.tree.Insert(pair.NewPair("after-snapshot", "value"))
+	assert.Nil(s.T(), err)
+	err = s.tree.Insert(pair.NewPair("key-1", "changed-"+stored))
+	assert.Nil(s.T(), err)
+
+	err = s.tree.Restore(&snapshot)
+	assert.Nil(s.T(), err)
+	_, _, found, err := s.tree.Get("after-snapshot")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), found, "writes after the snapshot are gone")
+	value, _, _, err := s.tree.Get("key-1")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), stored, value)
+
+	// the restored tree takes writes again
+	err = s.tree.Insert(pair.NewPair("after-restore", "value"))
+	assert.Nil(s.T(), err)
+	count, err := s.tree.Count()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), before+1, count)
+}
+
+func BtreeDelete(s *UnitTestSuite) {
+	err := s.tree.Insert(pair.NewPair("to-delete", "value"))
+	assert.Nil(s.T(), err)
+	before, err := s.tree.Count()
+	assert.Nil(s.T(), err)
+
+	err = s.tree.Delete("to-delete")
+	assert.Nil(s.T(), err)
+	_, _, found, err := s.tree.Get("to-delete")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), found)
+	after, err := s.tree.Count()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), before-1, after, "deleted pairs are not iterated")
+	assert.ErrorIs(s.T(), s.tree.Delete("to-delete"), btree.ErrNotFound)
+
+	// the slot is reused
+	err = s.tree.Insert(pair.NewPair("to-delete", "again"))
+	assert.Nil(s.T(), err)
+	value, _, _, err := s.tree.Get("to-delete")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "again", value)
+}
+
+func BtreeDeletedKeysAreAbsent(s *UnitTestSuite) {
+	assert.Nil(s.T(), s.tree.Insert(pair.NewPair("tombstone", "value")))
+	assert.Nil(s.T(), s.tree.Delete("tombstone"))
+
+	_, found, err := s.tree.Version("tombstone")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), found, "delete then version")
+	assert.ErrorIs(s.T(), s.tree.Update(pair.NewPair("tombstone", "updated")), btree.ErrNotFound, "delete then update")
+	_, _, found, err = s.tree.Get("tombstone")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), found)
+
+	// delete then compare and swap, a deleted key counting as one never written
+	assert.ErrorIs(s.T(), s.tree.CompareAndSwap(pair.NewPair("tombstone", "swapped"), 2), btree.ErrVersionConflict)
+	assert.Nil(s.T(), s.tree.CompareAndSwap(pair.NewPair("tombstone", "swapped"), 0))
+	version, found, err := s.tree.Version("tombstone")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), found)
+	assert.Equal(s.T(), uint32(3), version, "versions keep counting across deletes")
+}
+
 func (s *UnitTestSuite) Test_TableTest() {
 
 	type testCase struct {
@@ -129,6 +261,30 @@ func (s *UnitTestSuite) Test_TableTest() {
 			name:   "Iterate Over Whole Tree",
 			treeFn: BtreeIterateF,
 		},
+		{
+			name:   "Upsert Existing Key",
+			treeFn: BtreeUpsert,
+		},
+		{
+			name:   "Compare And Swap",
+			treeFn: BtreeCompareAndSwap,
+		},
+		{
+			name:   "Iterate Keys With Prefix",
+			treeFn: BtreeIteratePrefix,
+		},
+		{
+			name:   "Snapshot And Restore",
+			treeFn: BtreeSnapshotRestore,
+		},
+		{
+			name:   "Delete Key",
+			treeFn: BtreeDelete,
+		},
+		{
+			name:   "Deleted Keys Are Absent",
+			treeFn: BtreeDeletedKeysAreAbsent,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -142,3 +298,87 @@ func (s *UnitTestSuite) Test_TableTest() {
 func TestUnitTestSuite(t *testing.T) {
 	suite.Run(t, new(UnitTestSuite))
 }
+
+func TestOpenBtreeWithBlockSize(t *testing.T) {
+	path := t.TempDir() + "/big.db"
+	tree, err := btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 8192})
+	assert.NoError(t, err)
+	assert.Equal(t, 8192, tree.BlockSize())
+	for i := 0; i < 500; i++ {
+		assert.NoError(t, tree.Insert(pair.NewPair(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))))
+	}
+	assert.NoError(t, tree.Close())
+
+	tree, err = btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 8192})
+	assert.NoError(t, err)
+	count, err := tree.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 500, count)
+	v, _, found, err := tree.Get("key-321")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "value-321", v)
+	assert.NoError(t, tree.Close())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size()%8192)
+}
+
+func TestOpenBtreeRejectsBadBlockSizes(t *testing.T) {
+	_, err := btree.OpenBtree[string](btree.Config{Path: t.TempDir() + "/odd.db", BlockSize: 1000})
+	assert.ErrorIs(t, err, diskblock.ErrBlockSize)
+
+	path := t.TempDir() + "/small.db"
+	tree, err := btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 1536})
+	assert.NoError(t, err)
+	assert.NoError(t, tree.Insert(pair.NewPair("key", "value")))
+	assert.NoError(t, tree.Close())
+	_, err = btree.OpenBtree[string](btree.Config{Path: path})
+	assert.ErrorIs(t, err, diskblock.ErrBlockSize)
+}
+
+func TestShapeFollowsSplits(t *testing.T) {
+	path := t.TempDir() + "/shape.db"
+	tree, err := btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 1024})
+	assert.NoError(t, err)
+	depth, nodes := tree.Shape()
+	assert.Equal(t, 1, depth)
+	assert.Equal(t, 1, nodes)
+
+	for i := 0; i < 400; i++ {
+		assert.NoError(t, tree.Insert(pair.NewPair(fmt.Sprintf("key-%03d", i), "value")))
+	}
+	depth, nodes = tree.Shape()
+	assert.Greater(t, depth, 2)
+	assert.NoError(t, tree.Close())
+
+	// a reopened tree walks its nodes again
+	tree, err = btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 1024})
+	assert.NoError(t, err)
+	defer tree.Close()
+	walkedDepth, walkedNodes := tree.Shape()
+	assert.Equal(t, walkedDepth, depth)
+	assert.Equal(t, walkedNodes, nodes)
+}
+
+func TestTruncatedTreeFailsToIterate(t *testing.T) {
+	path := t.TempDir() + "/truncated.db"
+	tree, err := btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 1024})
+	assert.NoError(t, err)
+	for i := 0; i < 400; i++ {
+		assert.NoError(t, tree.Insert(pair.NewPair(fmt.Sprintf("key-%03d", i), "value")))
+	}
+	assert.NoError(t, tree.Close())
+	assert.ErrorIs(t, tree.Close(), btree.ErrClosed)
+	_, _, _, err = tree.Get("key-001")
+	assert.ErrorIs(t, err, btree.ErrClosed)
+
+	// children past the end of the file are reported, not skipped
+	assert.NoError(t, os.Truncate(path, 3*1024))
+	tree, err = btree.OpenBtree[string](btree.Config{Path: path, BlockSize: 1024})
+	assert.NoError(t, err)
+	defer tree.Close()
+	_, err = tree.Count()
+	assert.ErrorIs(t, err, diskerr.ErrCorrupt)
+}
@@ -0,0 +1,81 @@
+package btree
+
+import (
+	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/metrics"
+)
+
+var (
+	treeDepth = metrics.NewGaugeVec("hermes_btree_depth", "Levels of the B-tree of an open file, 1 for a lone root.", "file")
+	treeNodes = metrics.NewGaugeVec("hermes_btree_nodes", "Nodes reachable from the root of the B-tree of an open file.", "file")
+)
+
+// shape is the depth and node count of a tree. They are walked the first time they are collected
+// and then kept up to date by the writes, from the splits they cause
+type shape struct {
+	known      bool
+	depth      int
+	nodes      int
+	splitsSeen uint64
+}
+
+// exportShape publishes the shape of the tree under its path until it is closed
+func (bt *Btree[T]) exportShape() {
+	treeDepth.Func(func() float64 { depth, _ := bt.Shape(); return float64(depth) }, bt.path)
+	treeNodes.Func(func() float64 { _, nodes := bt.Shape(); return float64(nodes) }, bt.path)
+}
+
+func (bt *Btree[T]) unexportShape() {
+	treeDepth.Delete(bt.path)
+	treeNodes.Delete(bt.path)
+}
+
+// Shape returns the depth of the tree and its number of nodes. The first call reads every node
+func (bt *Btree[T]) Shape() (depth, nodes int) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if !bt.shape.known {
+		root := bt.root.(*diskblock.DiskNode)
+		depth, nodes, err := walkShape(root)
+		if err != nil {
+			return 0, 0
+		}
+		bt.shape = shape{known: true, depth: depth, nodes: nodes, splitsSeen: root.BlockService.Splits()}
+	}
+	return bt.shape.depth, bt.shape.nodes
+}
+
+func walkShape(n *diskblock.DiskNode) (depth, nodes int, err error) {
+	children, err := n.GetChildNodes()
+	if err != nil {
+		return 0, 0, err
+	}
+	nodes = 1
+	for _, child := range children {
+		d, c, err := walkShape(child)
+		if err != nil {
+			return 0, 0, err
+		}
+		depth = max(depth, d)
+		nodes += c
+	}
+	return depth + 1, nodes, nil
+}
+
+// insert writes value from the root, keeping the shape current: a split replaces a node with two,
+// and splitting the root adds a level and a new root on top. It expects mu held
+func (bt *Btree[T]) insert(value *pair.Pairs) error {
+	root := bt.root
+	err := bt.root.InsertPair(value, bt)
+	if bt.shape.known {
+		splits := bt.root.(*diskblock.DiskNode).BlockService.Splits()
+		bt.shape.nodes += int(splits - bt.shape.splitsSeen)
+		bt.shape.splitsSeen = splits
+		if bt.root != root {
+			bt.shape.depth++
+			bt.shape.nodes++
+		}
+	}
+	return err
+}
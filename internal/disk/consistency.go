@@ -0,0 +1,84 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk/types"
+)
+
+// ReadConsistency is how fresh a read of a ReplicatedStorage has to be
+type ReadConsistency int
+
+const (
+	// ReadLinearizable reads observe every write acknowledged before the read started. They are
+	// served by the leader after a quorum confirmed it still leads, followers return a raft.NotLeaderError.
+	// It is the zero value, so the default of ReadOptions
+	ReadLinearizable ReadConsistency = iota
+	// ReadBoundedStaleness reads are served by any replica that heard from the leader within
+	// MaxStaleness and applied everything the leader had committed by then
+	ReadBoundedStaleness
+	// ReadEventual reads are served by any replica from whatever it applied so far
+	ReadEventual
+)
+
+const defaultMaxStaleness = time.Second
+
+// ErrStaleRead is returned by bounded staleness reads on a replica lagging more than allowed
+var ErrStaleRead = errors.New("replica is too stale for the requested read")
+
+// ReadOptions tune a single read, the zero value is a linearizable read
+type ReadOptions struct {
+	Consistency ReadConsistency
+	// MaxStaleness bounds how old a bounded staleness read may be, one second when 0
+	MaxStaleness time.Duration
+}
+
+// checkRead blocks until the local replica may serve a read with opts, ProposeTimeout at most and never past ctx
+func (rs *ReplicatedStorage[T]) checkRead(ctx context.Context, opts ReadOptions) error {
+	switch opts.Consistency {
+	case ReadLinearizable:
+		ctx, cancel := context.WithTimeout(ctx, rs.ProposeTimeout)
+		defer cancel()
+		_, err := rs.node.ReadIndex(ctx)
+		return err
+	case ReadBoundedStaleness:
+		bound := opts.MaxStaleness
+		if bound <= 0 {
+			bound = defaultMaxStaleness
+		}
+		st := rs.node.Status()
+		if st.LastContact.IsZero() || time.Since(st.LastContact) > bound || st.LastApplied < st.LeaderCommit {
+			return ErrStaleRead
+		}
+		return nil
+	}
+	return nil
+}
+
+// GetWithOptions is Get with the consistency chosen by opts
+func (rs *ReplicatedStorage[T]) GetWithOptions(id string, opts ReadOptions) ([]float64, bool, error) {
+	return rs.GetWithOptionsContext(context.Background(), id, opts)
+}
+
+// GetWithOptionsContext is GetWithOptions giving up with the error of ctx once ctx is done
+func (rs *ReplicatedStorage[T]) GetWithOptionsContext(ctx context.Context, id string, opts ReadOptions) ([]float64, bool, error) {
+	if err := rs.checkRead(ctx, opts); err != nil {
+		return nil, false, err
+	}
+	return rs.local.GetContext(ctx, id)
+}
+
+// SearchByVectorWithOptions is SearchByVector with the consistency chosen by opts
+func (rs *ReplicatedStorage[T]) SearchByVectorWithOptions(input []float64, limit int, opts ReadOptions) (*[]types.SearchResult[T], error) {
+	return rs.SearchByVectorWithOptionsContext(context.Background(), input, limit, opts)
+}
+
+// SearchByVectorWithOptionsContext is SearchByVectorWithOptions giving up with the error of ctx once ctx is done
+func (rs *ReplicatedStorage[T]) SearchByVectorWithOptionsContext(ctx context.Context, input []float64, limit int, opts ReadOptions) (*[]types.SearchResult[T], error) {
+	if err := rs.checkRead(ctx, opts); err != nil {
+		return nil, err
+	}
+	return rs.local.SearchByVectorContext(ctx, input, limit)
+}
@@ -0,0 +1,80 @@
+package disk_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelledScansStop(t *testing.T) {
+	ds := newStorage(t)
+	ds.SetWorkers(2)
+	const points = 3000
+	for i := 0; i < points; i++ {
+		require.NoError(t, ds.Add(*types.NewDataPoint(fmt.Sprintf("p-%04d", i), []float64{float64(i), 1})))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := 0
+	err := ds.EachContext(ctx, func(string, string, time.Time) error {
+		if seen++; seen == 10 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 10, seen, "no row is handed out once cancelled")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	it := ds.SearchWithinRadiusContext(ctx, []float64{0, 1}, 2)
+	seen = 0
+	for it.Next() {
+		if seen++; seen == 5 {
+			cancel()
+		}
+	}
+	assert.ErrorIs(t, it.Err(), context.Canceled)
+	assert.Less(t, seen, points, "the scan stopped before the end")
+
+	_, err = ds.SearchContext(ctx, []float64{0, 1}, disk.SearchOptions{Limit: 3})
+	assert.ErrorIs(t, err, context.Canceled)
+	expired, stop := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer stop()
+	_, err = ds.SearchByVectorContext(expired, []float64{0, 1}, 3)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = ds.HybridSearchContext(expired, []float64{0, 1}, "fruit", 3, disk.HybridOptions{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	results, err := ds.SearchContext(context.Background(), []float64{0, 1}, disk.SearchOptions{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p-0000", "p-0001", "p-0002"}, resultIDs(*results), "cancelled scans leave the storage usable")
+}
+
+func TestCancelledReadsAndWrites(t *testing.T) {
+	ds := newStorage(t)
+	require.NoError(t, ds.Add(*types.NewDataPoint("a", []float64{1, 0})))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := ds.GetContext(ctx, "a")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, ds.AddContext(ctx, *types.NewDataPoint("b", []float64{0, 1})), context.Canceled)
+	assert.ErrorIs(t, ds.UpdateContext(ctx, *types.NewDataPoint("a", []float64{0, 1})), context.Canceled)
+	assert.ErrorIs(t, ds.CompareAndSwapContext(ctx, *types.NewDataPoint("a", []float64{0, 1}), 1), context.Canceled)
+	assert.ErrorIs(t, ds.DeleteContext(ctx, "a"), context.Canceled)
+
+	v, found, err := ds.GetContext(context.Background(), "a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []float64{1, 0}, v, "cancelled writes change nothing")
+	_, found, err = ds.Get("b")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
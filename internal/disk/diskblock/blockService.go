@@ -1,16 +1,51 @@
 package diskblock
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
 	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/trace"
 )
 
-const blockSize = 4096
+// DefaultBlockSize is the size of the blocks of tree files created without another size
+const DefaultBlockSize = 4096
 
-const maxLeafSize = (blockSize / pair.PairSize) - 3
+const (
+	// MinBlockSize and MaxBlockSize bound the block sizes accepted, a block holding at least
+	// minLeafSize pairs
+	MinBlockSize = 1024
+	MaxBlockSize = 1 << 20
+
+	// blockHeaderSize covers the block ID and the numbers of pairs and children
+	blockHeaderSize = 3 * 8
+	minLeafSize     = 3
+)
+
+// ErrBlockSize is returned for a block size out of bounds or not matching the file opened
+var ErrBlockSize = errors.New("invalid block size")
+
+// ValidateBlockSize checks that size is a multiple of 512 within MinBlockSize and MaxBlockSize
+func ValidateBlockSize(size int) error {
+	if size < MinBlockSize || size > MaxBlockSize || size%512 != 0 {
+		return fmt.Errorf("%w %d: must be a multiple of 512 between %d and %d", ErrBlockSize, size, MinBlockSize, MaxBlockSize)
+	}
+	return nil
+}
+
+// maxLeafSizeFor returns how many pairs a node of a block of size bytes holds before splitting.
+// An overflowing node, one pair and one child more, still has to fit in the block
+func maxLeafSizeFor(size int) int {
+	return (size - blockHeaderSize - pair.PairSize - 2*8) / (pair.PairSize + 8)
+}
 
 func uint64ToBytes(index uint64) []byte {
 	b := make([]byte, 8)
@@ -23,9 +58,12 @@ func uint64FromBytes(b []byte) uint64 {
 }
 
 type BlockService struct {
-	file      *os.File
-	BlockSize int // TODO be sure this can correspond to actual block size
-	mu        *sync.Mutex
+	file        *os.File
+	BlockSize   int
+	maxLeafSize int
+	// splits counts the nodes of the file split since it was opened
+	splits atomic.Uint64
+	mu     *sync.Mutex
 }
 
 func (bs *BlockService) GetLatestBlockID() (int64, error) {
@@ -40,7 +78,7 @@ func (bs *BlockService) GetLatestBlockID() (int64, error) {
 		return -1, nil
 	}
 	// Calculate page number required to be fetched from disk
-	return (int64(fi.Size()) / int64(blockSize)) - 1, nil
+	return (int64(fi.Size()) / int64(bs.BlockSize)) - 1, nil
 }
 
 //@Todo:Store current root block data somewhere else
@@ -59,26 +97,47 @@ func (bs *BlockService) GetRootBlock() (*DiskBlock, error) {
 
 }
 
+// getBlockFromDiskByBlockNumber reads the block at index. Blocks out of the file or failing to
+// decode are reported as a diskerr.CorruptError naming the block
 func (bs *BlockService) getBlockFromDiskByBlockNumber(index int64) (*DiskBlock, error) {
 	if index < 0 {
-		panic("Index less than 0 asked")
+		return nil, diskerr.CorruptBlock(index, "negative block index")
+	}
+	start := time.Now()
+	offset := index * int64(bs.BlockSize)
+
+	// ReadAt leaves the file offset alone, so reads do not race each other or a write seeking
+	blockBuffer := make([]byte, bs.BlockSize)
+	n, err := bs.file.ReadAt(blockBuffer, offset)
+	blockReadBytes.Add(float64(n))
+	if errors.Is(err, io.EOF) {
+		return nil, diskerr.CorruptBlock(index, "beyond end of file, %d of %d bytes read", n, bs.BlockSize)
 	}
-	offset := index * blockSize
-	_, err := bs.file.Seek(offset, 0)
 	if err != nil {
 		return nil, err
 	}
-
-	blockBuffer := make([]byte, blockSize)
-	_, err = bs.file.Read(blockBuffer)
+	blockReads.Inc()
+	blockReadSeconds.Since(start)
+	block, err := bs.GetBlockFromBuffer(blockBuffer)
+	var corrupt *diskerr.CorruptError
+	if errors.As(err, &corrupt) && corrupt.Block < 0 {
+		corrupt.Block = index
+	}
 	if err != nil {
 		return nil, err
 	}
-	block := bs.GetBlockFromBuffer(blockBuffer)
+	if block.Id != uint64(index) {
+		return nil, diskerr.CorruptBlock(index, "holds block %d", block.Id)
+	}
 	return block, nil
 }
 
-func (bs *BlockService) GetBlockFromBuffer(blockBuffer []byte) *DiskBlock {
+// GetBlockFromBuffer decodes a block written by GetBufferFromBlock, failing with a
+// diskerr.CorruptError when the sizes it holds do not fit in the buffer
+func (bs *BlockService) GetBlockFromBuffer(blockBuffer []byte) (*DiskBlock, error) {
+	if len(blockBuffer) < blockHeaderSize {
+		return nil, diskerr.Corrupt("block truncated to %d bytes", len(blockBuffer))
+	}
 	blockOffset := 0
 	block := &DiskBlock{}
 
@@ -89,10 +148,26 @@ func (bs *BlockService) GetBlockFromBuffer(blockBuffer []byte) *DiskBlock {
 	blockOffset += 8
 	block.currentChildrenSize = uint64FromBytes(blockBuffer[blockOffset:])
 	blockOffset += 8
+	room := uint64(len(blockBuffer) - blockHeaderSize)
+	if block.CurrentLeafSize > room/pair.PairSize || block.currentChildrenSize > room/8 ||
+		block.CurrentLeafSize*pair.PairSize+block.currentChildrenSize*8 > room {
+		return nil, diskerr.Corrupt("%d pairs and %d children overflow the block", block.CurrentLeafSize, block.currentChildrenSize)
+	}
+	if block.currentChildrenSize != 0 && block.currentChildrenSize != block.CurrentLeafSize+1 {
+		return nil, diskerr.Corrupt("%d children for %d pairs", block.currentChildrenSize, block.CurrentLeafSize)
+	}
 	//Read actual pairs now
 	block.DataSet = make([]*pair.Pairs, block.CurrentLeafSize)
 	for i := 0; i < int(block.CurrentLeafSize); i++ {
-		block.DataSet[i] = pair.ConvertBytesToPair(blockBuffer[blockOffset:])
+		p, err := pair.ConvertBytesToPair(blockBuffer[blockOffset:])
+		var corrupt *diskerr.CorruptError
+		if errors.As(err, &corrupt) {
+			return nil, diskerr.Corrupt("pair %d: %s", i, corrupt.Reason)
+		}
+		if err != nil {
+			return nil, err
+		}
+		block.DataSet[i] = p
 		blockOffset += pair.PairSize
 	}
 	// Read children block indexes
@@ -101,11 +176,11 @@ func (bs *BlockService) GetBlockFromBuffer(blockBuffer []byte) *DiskBlock {
 		block.ChildrenBlockIds[i] = uint64FromBytes(blockBuffer[blockOffset:])
 		blockOffset += 8
 	}
-	return block
+	return block, nil
 }
 
 func (bs *BlockService) GetBufferFromBlock(block *DiskBlock) []byte {
-	blockBuffer := make([]byte, blockSize)
+	blockBuffer := make([]byte, bs.BlockSize)
 	blockOffset := 0
 
 	//Write Block index
@@ -150,16 +225,20 @@ func (bs *BlockService) newBlock() (*DiskBlock, error) {
 func (bs *BlockService) WriteBlockToDisk(block *DiskBlock) error {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
-	seekOffset := blockSize * block.Id
+	start := time.Now()
+	seekOffset := uint64(bs.BlockSize) * block.Id
 	blockBuffer := bs.GetBufferFromBlock(block)
 	_, err := bs.file.Seek(int64(seekOffset), 0)
 	if err != nil {
 		return err
 	}
-	_, err = bs.file.Write(blockBuffer)
+	n, err := bs.file.Write(blockBuffer)
+	blockWrittenBytes.Add(float64(n))
 	if err != nil {
 		return err
 	}
+	blockWrites.Inc()
+	blockWriteSeconds.Since(start)
 	return nil
 }
 
@@ -178,6 +257,23 @@ func (bs *BlockService) ConvertDiskNodeToBlock(node *DiskNode) *DiskBlock {
 	return block
 }
 
+// GetNodeAtBlockIDContext reads the node of a block like GetNodeAtBlockID, within a span child
+// of the one ctx carries. Reads outside of any trace are not traced. It fails with the error of
+// ctx once ctx is done, so walks of the tree stop at the next block they read
+func (bs *BlockService) GetNodeAtBlockIDContext(ctx context.Context, blockID uint64) (*DiskNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !trace.SpanContextFrom(ctx).IsValid() {
+		return bs.GetNodeAtBlockID(blockID)
+	}
+	_, span := trace.Start(ctx, "BlockService.ReadBlock", trace.WithAttributes(trace.Attr("block", blockID)))
+	defer span.End()
+	n, err := bs.GetNodeAtBlockID(blockID)
+	span.RecordError(err)
+	return n, err
+}
+
 func (bs *BlockService) GetNodeAtBlockID(blockID uint64) (*DiskNode, error) {
 	block, err := bs.getBlockFromDiskByBlockNumber(int64(blockID))
 	if err != nil {
@@ -225,8 +321,13 @@ func (bs *BlockService) UpdateRootNode(n *DiskNode) error {
 }
 
 func NewBlockService(file *os.File) *BlockService {
-	vbs := os.Getpagesize()
-	return &BlockService{file: file, BlockSize: vbs, mu: &sync.Mutex{}}
+	return NewBlockServiceWithSize(file, DefaultBlockSize)
+}
+
+// NewBlockServiceWithSize returns a block service reading and writing blocks of size bytes, which
+// has to be the size the file was created with. See ValidateBlockSize
+func NewBlockServiceWithSize(file *os.File, size int) *BlockService {
+	return &BlockService{file: file, BlockSize: size, maxLeafSize: maxLeafSizeFor(size), mu: &sync.Mutex{}}
 }
 
 func (bs *BlockService) rootBlockExists() bool {
@@ -243,12 +344,12 @@ func (bs *BlockService) rootBlockExists() bool {
 	}
 }
 
-/**
-@Todo: Implement a function to :
-1. Dynamicaly calculate blockSize
-2. Then based on the blocksize, calculate the maxLeafSize
-*/
+// Splits returns the number of nodes split since the file was opened
+func (bs *BlockService) Splits() uint64 {
+	return bs.splits.Load()
+}
+
+// GetMaxLeafSize returns how many pairs a node holds before it is split, given the block size
 func (bs *BlockService) GetMaxLeafSize() int {
-	// s := bs.VirtualBlockSize
-	return maxLeafSize
+	return bs.maxLeafSize
 }
@@ -1,12 +1,15 @@
 package diskblock_test
 
 import (
+	"encoding/binary"
 	"os"
 	"testing"
 
 	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
 	"github.com/bjornaer/hermes/internal/disk/pair"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -95,7 +98,8 @@ func ShouldSaveNewBlockOnDisk(s *UnitTestSuite) {
 func ShouldConvertPairToAndFromBytes(s *UnitTestSuite) {
 	p := pair.NewPair("Hola  ", "Amigos")
 	pairBytes := pair.ConvertPairsToBytes(p)
-	convertedPair := pair.ConvertBytesToPair(pairBytes)
+	convertedPair, err := pair.ConvertBytesToPair(pairBytes)
+	require.NoError(s.T(), err)
 	assert.Equal(s.T(), p.KeyLen, convertedPair.KeyLen, "Key length should match")
 	assert.Equal(s.T(), p.ValueLen, convertedPair.ValueLen, "Value length should match")
 	assert.Equal(s.T(), p.Key, convertedPair.Key, "Key should match")
@@ -112,7 +116,8 @@ func ShouldConvertBlockToAndFromBytes(s *UnitTestSuite) {
 	elements[2] = pair.NewPair("gooz", "bumps")
 	block.SetData(elements)
 	blockBuffer := s.blockservice.GetBufferFromBlock(block)
-	convertedBlock := s.blockservice.GetBlockFromBuffer(blockBuffer)
+	convertedBlock, err := s.blockservice.GetBlockFromBuffer(blockBuffer)
+	require.NoError(s.T(), err)
 
 	assert.Equal(s.T(), 4, int(convertedBlock.ChildrenBlockIds[2]))
 	assert.Equal(s.T(), len(convertedBlock.DataSet), len(block.DataSet), "Length of blocks should be same")
@@ -140,6 +145,32 @@ func ShouldConvertToAndFromDiskNode(s *UnitTestSuite) {
 	assert.Equal(s.T(), "hola", nodeFromBlock.Keys[0].Key)
 }
 
+func ShouldReportCorruptBlocks(s *UnitTestSuite) {
+	_, err := s.blockservice.GetRootBlock()
+	require.NoError(s.T(), err)
+
+	_, err = s.blockservice.GetNodeAtBlockID(7)
+	assert.ErrorIs(s.T(), err, diskerr.ErrCorrupt, "reading past the end of the file")
+	var corrupt *diskerr.CorruptError
+	require.ErrorAs(s.T(), err, &corrupt)
+	assert.Equal(s.T(), int64(7), corrupt.Block)
+
+	block := &diskblock.DiskBlock{}
+	block.SetData([]*pair.Pairs{pair.NewPair("hola", "amigos")})
+	buffer := s.blockservice.GetBufferFromBlock(block)
+	binary.LittleEndian.PutUint64(buffer[8:], 1<<40)
+	_, err = s.blockservice.GetBlockFromBuffer(buffer)
+	assert.ErrorIs(s.T(), err, diskerr.ErrCorrupt, "more pairs than the block holds")
+
+	buffer = s.blockservice.GetBufferFromBlock(block)
+	binary.LittleEndian.PutUint16(buffer[24:], 4000)
+	_, err = s.blockservice.GetBlockFromBuffer(buffer)
+	assert.ErrorIs(s.T(), err, diskerr.ErrCorrupt, "a key longer than its slot")
+
+	_, err = s.blockservice.GetBlockFromBuffer(buffer[:10])
+	assert.ErrorIs(s.T(), err, diskerr.ErrCorrupt, "a truncated block")
+}
+
 func (s *UnitTestSuite) Test_TableTest() {
 	type testCase struct {
 		name         string
@@ -170,6 +201,10 @@ func (s *UnitTestSuite) Test_TableTest() {
 			name:         "Convert Disk Node To and From Bytes",
 			disckblockFn: ShouldConvertToAndFromDiskNode,
 		},
+		{
+			name:         "Report corrupt blocks",
+			disckblockFn: ShouldReportCorruptBlocks,
+		},
 	}
 
 	for _, testCase := range testCases {
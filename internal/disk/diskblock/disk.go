@@ -1,18 +1,19 @@
 package diskblock
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/bjornaer/hermes/internal/disk/pair"
 	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/hlc"
 )
 
 type Pairs = pair.Pairs
 type node = types.Node
 
-// DiskBlock -- Make sure that it is accomodated in blockSize = 4096
+// DiskBlock -- Make sure that it is accomodated in the block size, DefaultBlockSize = 4096 unless configured
 type DiskBlock struct {
 	Id                  uint64   // 4096 - 8 = 4088
 	CurrentLeafSize     uint64   // 4088 - 8 = 4080
@@ -37,6 +38,8 @@ type DiskNode struct {
 	ChildrenBlockIDs []uint64
 	BlockID          uint64
 	BlockService     *BlockService
+	// ctx is the context of the read walking the tree, its span parenting the block reads
+	ctx context.Context
 }
 
 /**
@@ -90,8 +93,8 @@ func (n *DiskNode) Size() int {
 	return len(root.DataSet)
 }
 
-// PrintTree - Traverse and print the entire tree
-func (n *DiskNode) PrintTree(level int) {
+// PrintTree - Traverse and print the entire tree, stopping at the first child failing to read
+func (n *DiskNode) PrintTree(level int) error {
 	currentLevel := level
 	if level == 0 {
 		currentLevel = 1
@@ -102,10 +105,13 @@ func (n *DiskNode) PrintTree(level int) {
 		fmt.Println("Printing ", i+1, " th child of level : ", currentLevel)
 		childNode, err := n.GetChildAtIndex(i)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if err := childNode.PrintTree(currentLevel + 1); err != nil {
+			return err
 		}
-		childNode.PrintTree(currentLevel + 1)
 	}
+	return nil
 }
 
 /**
@@ -137,6 +143,21 @@ func (n *DiskNode) AddElement(element *Pairs) int {
 	return indexForInsertion
 }
 
+/**
+* Overwrite the element with the same key if this node holds it, bumping its version
+ */
+func (n *DiskNode) replaceElement(element *Pairs) bool {
+	elements := n.GetElements()
+	for i := 0; i < len(elements); i++ {
+		if elements[i].Key == element.Key {
+			element.Version = elements[i].Version + 1
+			elements[i] = element
+			return true
+		}
+	}
+	return false
+}
+
 func (n *DiskNode) HasOverFlown() bool {
 	return len(n.GetElements()) > n.BlockService.GetMaxLeafSize()
 }
@@ -154,7 +175,23 @@ func (n *DiskNode) GetElementAtIndex(index int) *Pairs {
 }
 
 func (n *DiskNode) GetChildAtIndex(index int) (*DiskNode, error) {
-	return n.BlockService.GetNodeAtBlockID(n.ChildrenBlockIDs[index])
+	if n.ctx == nil {
+		return n.BlockService.GetNodeAtBlockID(n.ChildrenBlockIDs[index])
+	}
+	child, err := n.BlockService.GetNodeAtBlockIDContext(n.ctx, n.ChildrenBlockIDs[index])
+	if err != nil {
+		return nil, err
+	}
+	child.ctx = n.ctx
+	return child, nil
+}
+
+// WithContext returns a shallow copy of the node whose reads of descendants are done within ctx,
+// traced as children of its span. The copy shares the keys of n, so it is only fit for reading
+func (n *DiskNode) WithContext(ctx context.Context) *DiskNode {
+	c := *n
+	c.ctx = ctx
+	return &c
 }
 
 func (n *DiskNode) shiftRemainingChildrenToRight(index int) {
@@ -230,6 +267,8 @@ func (n *DiskNode) SplitLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	nodeSplits.Inc()
+	n.BlockService.splits.Add(1)
 	return middle, leftNode, rightNode, nil
 }
 
@@ -270,6 +309,8 @@ func (n *DiskNode) SplitNonLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	nodeSplits.Inc()
+	n.BlockService.splits.Add(1)
 	return middle, leftNode, rightNode, nil
 }
 
@@ -349,7 +390,17 @@ func (n *DiskNode) getChildNodeForElement(key string) (*DiskNode, error) {
 }
 
 func (n *DiskNode) insert(value *Pairs, bt types.Tree) (*Pairs, *DiskNode, *DiskNode, error) {
+	if n.replaceElement(value) {
+		// The key already lives in this node, so this is an update in place and the
+		// shape of the tree does not change
+		err := n.BlockService.UpdateNodeToDisk(n)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, nil
+	}
 	if n.IsLeaf() {
+		value.Version = 1
 		n.AddElement(value)
 		if !n.HasOverFlown() {
 			// So lets store this updated node on disk
@@ -435,35 +486,35 @@ func (n *DiskNode) insert(value *Pairs, bt types.Tree) (*Pairs, *DiskNode, *Disk
 	return nil, nil, nil, nil
 }
 
-func (n *DiskNode) searchElementInNode(key string) (string, time.Time, bool) {
+func (n *DiskNode) searchElementInNode(key string) (*Pairs, bool) {
 	for i := 0; i < len(n.GetElements()); i++ {
 		e := n.GetElementAtIndex(i)
 		if e.Key == key {
-			return e.Value, e.Timestamp, true
+			return e, true
 		}
 	}
-	return "", time.Time{}, false
+	return nil, false
 }
-func (n *DiskNode) search(key string) (string, time.Time, error) {
+func (n *DiskNode) search(key string) (*Pairs, error) {
 	/*
 		Algo:
 		1. Find key in current node, if this is leaf node, then return as not found
 		2. Then find the appropriate child node
 		3. goto step 1
 	*/
-	value, addedAt, foundInCurrentNode := n.searchElementInNode(key)
+	element, foundInCurrentNode := n.searchElementInNode(key)
 
 	if foundInCurrentNode {
-		return value, addedAt, nil
+		return element, nil
 	}
 
 	if n.IsLeaf() {
-		return "", time.Time{}, nil
+		return nil, nil
 	}
 
 	node, err := n.getChildNodeForElement(key)
 	if err != nil {
-		return "", time.Time{}, err
+		return nil, err
 	}
 	return node.search(key)
 }
@@ -477,7 +528,16 @@ func (n *DiskNode) InsertPair(value *Pairs, bt types.Tree) error {
 	return nil
 }
 
-func (n *DiskNode) GetValue(key string) (string, time.Time, error) {
+func (n *DiskNode) GetValue(key string) (string, hlc.Timestamp, error) {
+	element, err := n.search(key)
+	if err != nil || element == nil {
+		return "", hlc.Timestamp{}, err
+	}
+	return element.Value, element.Timestamp, nil
+}
+
+// GetPair - Get the whole stored pair for key, nil if it does not exist
+func (n *DiskNode) GetPair(key string) (*Pairs, error) {
 	return n.search(key)
 }
 
@@ -1,18 +1,38 @@
 package diskblock
 
 import (
+	"fmt"
 	"os"
 )
 
 type diskNodeService struct {
-	file *os.File
+	file      *os.File
+	blockSize int
 }
 
 func NewDiskNodeService(file *os.File) *diskNodeService {
-	return &diskNodeService{file: file}
+	return NewDiskNodeServiceWithBlockSize(file, DefaultBlockSize)
 }
+
+// NewDiskNodeServiceWithBlockSize reads the nodes of a file written in blocks of blockSize bytes
+func NewDiskNodeServiceWithBlockSize(file *os.File, blockSize int) *diskNodeService {
+	return &diskNodeService{file: file, blockSize: blockSize}
+}
+
+// GetRootNodeFromDisk reads the root node, writing an empty one to a new file. A file whose size
+// is not a multiple of the block size was written with another one, which fails with ErrBlockSize
 func (dns *diskNodeService) GetRootNodeFromDisk() (*DiskNode, error) {
-	bs := NewBlockService(dns.file)
+	if err := ValidateBlockSize(dns.blockSize); err != nil {
+		return nil, err
+	}
+	info, err := dns.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size()%int64(dns.blockSize) != 0 {
+		return nil, fmt.Errorf("%w: %s holds %d bytes, not a whole number of %d byte blocks", ErrBlockSize, dns.file.Name(), info.Size(), dns.blockSize)
+	}
+	bs := NewBlockServiceWithSize(dns.file, dns.blockSize)
 	rootBlock, err := bs.GetRootBlock()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,16 @@
+package diskblock
+
+import "github.com/bjornaer/hermes/internal/metrics"
+
+// ioBuckets bound block I/O latencies, from 1µs to 100ms
+var ioBuckets = []float64{0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.01, 0.1}
+
+var (
+	blockReads        = metrics.NewCounter("hermes_block_reads_total", "Blocks read from tree files.")
+	blockWrites       = metrics.NewCounter("hermes_block_writes_total", "Blocks written to tree files.")
+	blockReadBytes    = metrics.NewCounter("hermes_block_read_bytes_total", "Bytes read from tree files.")
+	blockWrittenBytes = metrics.NewCounter("hermes_block_written_bytes_total", "Bytes written to tree files.")
+	blockReadSeconds  = metrics.NewHistogram("hermes_block_read_seconds", "Time taken to read a block.", ioBuckets)
+	blockWriteSeconds = metrics.NewHistogram("hermes_block_write_seconds", "Time taken to write a block.", ioBuckets)
+	nodeSplits        = metrics.NewCounter("hermes_btree_splits_total", "B-tree nodes split because they overflowed.")
+)
@@ -0,0 +1,76 @@
+// Package diskerr holds the errors of the storage layer. The tree file, the B-tree and DiskStorage
+// all return these, wrapped with what went wrong, so callers match them with errors.Is and
+// errors.As whichever layer failed. disk and btree re-export the ones they return
+package diskerr
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when there is nothing stored under a key
+	ErrNotFound = errors.New("key not found")
+	// ErrCorrupt is matched by every CorruptError
+	ErrCorrupt = errors.New("corrupt data")
+	// ErrKeyTooLarge is returned for keys longer than a slot of a block holds
+	ErrKeyTooLarge = errors.New("key too large")
+	// ErrValueTooLarge is returned for values, encoded vectors, longer than a slot of a block holds
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrReservedKey is returned for keys starting with the prefix of the text index
+	ErrReservedKey = errors.New("key uses a reserved prefix")
+	// ErrDimensionMismatch is matched by every DimensionError
+	ErrDimensionMismatch = errors.New("dimension mismatch")
+	// ErrVersionConflict is returned by compare-and-swap writes when the stored version moved on
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrClosed is returned by the operations of a storage closed already
+	ErrClosed = errors.New("storage closed")
+)
+
+// CorruptError reports data read back from a file that cannot have been written by Hermes
+type CorruptError struct {
+	// Block is the block the data was read from, -1 when it is not tied to one
+	Block int64
+	// Reason tells what is wrong with the data
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	if e.Block < 0 {
+		return "corrupt data: " + e.Reason
+	}
+	return fmt.Sprintf("corrupt block %d: %s", e.Block, e.Reason)
+}
+
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// Corrupt returns a CorruptError for data not tied to a block
+func Corrupt(format string, args ...any) error {
+	return &CorruptError{Block: -1, Reason: fmt.Sprintf(format, args...)}
+}
+
+// CorruptBlock returns a CorruptError for the data of a block
+func CorruptBlock(block int64, format string, args ...any) error {
+	return &CorruptError{Block: block, Reason: fmt.Sprintf(format, args...)}
+}
+
+// DimensionError reports a vector whose dimension is not the one expected
+type DimensionError struct {
+	// ID is the datapoint holding the vector, empty for query vectors
+	ID   string
+	Want int
+	Got  int
+}
+
+func (e *DimensionError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("vector has dimension %d, expected %d", e.Got, e.Want)
+	}
+	return fmt.Sprintf("vector of %q has dimension %d, expected %d", e.ID, e.Got, e.Want)
+}
+
+func (e *DimensionError) Is(target error) bool {
+	return target == ErrDimensionMismatch
+}
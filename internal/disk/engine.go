@@ -1,78 +1,247 @@
 package disk
 
 import (
+	"context"
 	"fmt"
-	"math"
-	"sort"
 	"time"
 
+	"github.com/bjornaer/hermes/internal/disk/bm25"
 	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
 	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/disk/pqueue"
 	"github.com/bjornaer/hermes/internal/disk/types"
 	"github.com/bjornaer/hermes/internal/disk/vector"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/bjornaer/hermes/internal/trace"
 )
 
 // DiskStorage is the representation of our storage logical unit, built on top of our VectorIndex and B Tree
 type DiskStorage[T comparable] struct {
 	storage         *btree.Btree[T]
 	distanceMeasure vector.DistanceMeasure
+	text            *bm25.Index
+	textField       string
+	workers         int
 	// vectorIndex *vector.VectorIndex[T]
 }
 
-// Get - Get the stored value from the database for the respective key // FIXME this any casting bs is to avoid handling generics inside BTREE code
-func (ds *DiskStorage[T]) Get(id string) ([]float64, bool) {
-	v, _, found, err := ds.storage.Get(id)
+const defaultTextField = "text"
 
+// Get - Get the stored value from the database for the respective key. The bool is false if there
+// is none, the error telling why the read failed, a CorruptError for a value not decoding
+func (ds *DiskStorage[T]) Get(id string) ([]float64, bool, error) {
+	return ds.GetContext(context.Background(), id)
+}
+
+// GetContext is Get traced as a child of the span ctx carries, failing with the error of ctx when
+// ctx is done before the value is found
+func (ds *DiskStorage[T]) GetContext(ctx context.Context, id string) ([]float64, bool, error) {
+	ctx, span := trace.Start(ctx, "DiskStorage.Get", trace.WithAttributes(trace.Attr("id", id)))
+	defer span.End()
+	v, _, found, err := ds.storage.GetContext(ctx, id)
 	if err != nil {
-		return []float64{}, false
+		span.RecordError(err)
+		return nil, false, err
+	}
+	if !found {
+		return nil, false, nil
 	}
 
-	str := any(v).(string)
-	emb, err := vector.ConvertStrToEmbedding(str)
+	emb, _, err := decodeEmbedding(id, any(v).(string))
 	if err != nil {
-		return []float64{}, false
+		span.RecordError(err)
+		return nil, false, err
 	}
-	return emb, found
+	return emb, true, nil
 }
 
+// Add upserts the datapoint, overwriting any embedding already stored under its ID
 func (ds *DiskStorage[T]) Add(dp types.DataPoint[T]) error {
-	key := any(dp.ID).(string)
-	v := vector.ConvertFloat64ArrToStr(dp.Embedding)
+	return ds.AddContext(context.Background(), dp)
+}
 
-	pair := pair.NewPair(key, v)
-	if err := pair.Validate(); err != nil {
+// AddContext is Add traced as a child of the span ctx carries, giving up with the error of ctx
+// if ctx is done before the write starts
+func (ds *DiskStorage[T]) AddContext(ctx context.Context, dp types.DataPoint[T]) error {
+	return ds.write(ctx, "DiskStorage.Add", dp, hlc.FromTime(time.Now()), ds.storage.InsertContext)
+}
+
+func (ds *DiskStorage[T]) AddWithTime(dp types.DataPoint[T], t time.Time) error {
+	return ds.write(context.Background(), "DiskStorage.Add", dp, hlc.FromTime(t), ds.storage.InsertContext)
+}
+
+// Update replaces the embedding stored under the datapoint ID, returning ErrNotFound if there is none
+func (ds *DiskStorage[T]) Update(dp types.DataPoint[T]) error {
+	return ds.UpdateContext(context.Background(), dp)
+}
+
+// UpdateContext is Update giving up with the error of ctx if ctx is done before the write starts
+func (ds *DiskStorage[T]) UpdateContext(ctx context.Context, dp types.DataPoint[T]) error {
+	return ds.write(ctx, "DiskStorage.Update", dp, hlc.FromTime(time.Now()), ds.storage.UpdateContext)
+}
+
+// CompareAndSwap stores the datapoint only if its current version is expected (0 when it must not exist yet).
+// A concurrent writer that got there first makes it return ErrVersionConflict
+func (ds *DiskStorage[T]) CompareAndSwap(dp types.DataPoint[T], expected uint32) error {
+	return ds.CompareAndSwapContext(context.Background(), dp, expected)
+}
+
+// CompareAndSwapContext is CompareAndSwap giving up with the error of ctx if ctx is done before the write starts
+func (ds *DiskStorage[T]) CompareAndSwapContext(ctx context.Context, dp types.DataPoint[T], expected uint32) error {
+	return ds.write(ctx, "DiskStorage.CompareAndSwap", dp, hlc.FromTime(time.Now()), func(ctx context.Context, p *pair.Pairs) error {
+		return ds.storage.CompareAndSwapContext(ctx, p, expected)
+	})
+}
+
+// write stores the datapoint stamped ts through one of the tree write operations, within a span
+// named name, then indexes its text. Once the tree is written the text is indexed even if ctx is
+// done meanwhile
+func (ds *DiskStorage[T]) write(ctx context.Context, name string, dp types.DataPoint[T], ts hlc.Timestamp, op func(context.Context, *pair.Pairs) error) error {
+	ctx, span := trace.Start(ctx, name, trace.WithAttributes(trace.Attr("id", any(dp.ID))))
+	defer span.End()
+	pair, err := ds.newPair(dp, ts)
+	if err != nil {
+		span.RecordError(err)
 		return err
 	}
-	return ds.storage.Insert(pair)
+	if err := op(ctx, pair); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	err = ds.indexText(dp)
+	span.RecordError(err)
+	return err
 }
 
-func (ds *DiskStorage[T]) AddWithTime(dp types.DataPoint[T], t time.Time) error {
+// decodeEmbedding reads back the embedding stored under key, one not decoding being corrupt
+func decodeEmbedding(key, val string) ([]float64, float64, error) {
+	emb, norm, err := vector.DecodeEmbedding(val)
+	if err != nil {
+		return nil, 0, diskerr.Corrupt("embedding of %q: %v", key, err)
+	}
+	return emb, norm, nil
+}
+
+// Validate reports why dp cannot be stored without writing it, failing with ErrKeyTooLarge,
+// ErrValueTooLarge or ErrReservedKey like a write of it would
+func (ds *DiskStorage[T]) Validate(dp types.DataPoint[T]) error {
+	_, err := ds.newPair(dp, hlc.Timestamp{})
+	return err
+}
+
+func (ds *DiskStorage[T]) newPair(dp types.DataPoint[T], ts hlc.Timestamp) (*pair.Pairs, error) {
 	key := any(dp.ID).(string)
-	v := vector.ConvertFloat64ArrToStr(dp.Embedding)
-	pair := pair.NewPairWithTime(key, v, t)
+	if bm25.IsReserved(key) {
+		return nil, fmt.Errorf("%w: id %q starts like the keys of the text index", ErrReservedKey, key)
+	}
+	v := vector.EncodeEmbedding(dp.Embedding)
+	pair := pair.NewPairWithTimestamp(key, v, ts)
 	if err := pair.Validate(); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// indexText feeds the configured payload text field of the datapoint to the BM25 index. A
+// datapoint written without it drops the text indexed for a previous write of its ID
+func (ds *DiskStorage[T]) indexText(dp types.DataPoint[T]) error {
+	text, ok := dp.Payload[ds.textField]
+	if !ok {
+		return ds.text.Remove(any(dp.ID).(string))
+	}
+	return ds.text.Index(any(dp.ID).(string), text)
+}
+
+// Payloads returns what is kept of the payloads, by datapoint ID: the text field, as it was written.
+// Datapoints written without text have none
+func (ds *DiskStorage[T]) Payloads() (map[string]map[string]string, error) {
+	docs, err := ds.text.Documents()
+	if err != nil {
+		return nil, err
+	}
+	payloads := make(map[string]map[string]string, len(docs))
+	for id, text := range docs {
+		payloads[id] = map[string]string{ds.textField: text}
+	}
+	return payloads, nil
+}
+
+// Delete removes the datapoint stored under id and its text, returning ErrNotFound if there is none
+func (ds *DiskStorage[T]) Delete(id string) error {
+	return ds.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is Delete traced as a child of the span ctx carries, giving up with the error of
+// ctx if ctx is done before the delete starts
+func (ds *DiskStorage[T]) DeleteContext(ctx context.Context, id string) error {
+	ctx, span := trace.Start(ctx, "DiskStorage.Delete", trace.WithAttributes(trace.Attr("id", id)))
+	defer span.End()
+	if bm25.IsReserved(id) {
+		return ErrNotFound
+	}
+	if err := ds.storage.DeleteContext(ctx, id); err != nil {
+		span.RecordError(err)
 		return err
 	}
-	return ds.storage.Insert(pair)
+	err := ds.text.Remove(id)
+	span.RecordError(err)
+	return err
+}
+
+// SetDistanceMeasure selects how vectors are compared, cosine by default
+func (ds *DiskStorage[T]) SetDistanceMeasure(dm vector.DistanceMeasure) {
+	ds.distanceMeasure = dm
+}
+
+// SetTextField selects which payload field is indexed for keyword search, "text" by default
+func (ds *DiskStorage[T]) SetTextField(field string) {
+	ds.textField = field
+}
+
+// Version returns the version counter of a stored datapoint, to be fed back into CompareAndSwap
+//
+// The second return value (bool) indicates whether the element exists or not
+func (ds *DiskStorage[T]) Version(id string) (uint32, bool, error) {
+	return ds.storage.Version(id)
 }
 
 // AddedAt returns the timestamp of a given element if it exists
 //
 // The second return value (bool) indicates whether the element exists or not
 // If the given element does not exist, the second return (bool) is false
-func (ds *DiskStorage[T]) AddedAt(id string) (time.Time, bool) {
+func (ds *DiskStorage[T]) AddedAt(id string) (time.Time, bool, error) {
 	_, t, found, err := ds.storage.Get(id)
-	if err != nil {
-		return time.Time{}, false
+	if err != nil || !found {
+		return time.Time{}, false, err
 	}
-	return t, found
+	return t.Time(), true, nil
 }
 
 // Each traverses the items in the Tree, calling the provided function
-// for each element key/value/timestamp association
+// for each element key/value/timestamp association. Text index entries are skipped
 func (ds *DiskStorage[T]) Each(f func(key, val string, addedAt time.Time) error) error {
+	return ds.each(context.Background(), f)
+}
+
+// EachContext is Each traced as a child of the span ctx carries. The walk stops with the error of
+// ctx once ctx is done, f is not called afterwards
+func (ds *DiskStorage[T]) EachContext(ctx context.Context, f func(key, val string, addedAt time.Time) error) error {
+	ctx, span := trace.Start(ctx, "DiskStorage.Each")
+	defer span.End()
+	err := ds.each(ctx, f)
+	span.RecordError(err)
+	return err
+}
+
+func (ds *DiskStorage[T]) each(ctx context.Context, f func(key, val string, addedAt time.Time) error) error {
 	s := ds.storage
-	err := s.Iterate(f)
+	err := s.IterateContext(ctx, func(key, val string, addedAt hlc.Timestamp) error {
+		if bm25.IsReserved(key) {
+			return nil
+		}
+		return f(key, val, addedAt.Time())
+	})
 	if err != nil {
 		return err
 	}
@@ -82,47 +251,72 @@ func (ds *DiskStorage[T]) Each(f func(key, val string, addedAt time.Time) error)
 	return nil
 }
 
+// Close releases the tree file. Every method fails with ErrClosed afterwards
+func (ds *DiskStorage[T]) Close() error {
+	return ds.storage.Close()
+}
+
 func (ds *DiskStorage[T]) Size() int {
 	return ds.storage.Size()
 }
 
+// SearchOptions shapes a vector query
+type SearchOptions struct {
+	// Limit is the page size, the number of results returned at most
+	Limit int
+	// Offset skips that many of the closest results, for paging through them
+	Offset int
+	// Threshold drops every row whose distance, as computed by the distance measure, is above it
+	Threshold *float64
+}
+
+// SearchByVector returns the limit datapoints closest to input
 func (ds *DiskStorage[T]) SearchByVector(input []float64, limit int) (*[]types.SearchResult[T], error) {
-	count, err := ds.storage.Count()
-	if err != nil {
-		return nil, err
+	return ds.Search(input, SearchOptions{Limit: limit})
+}
+
+// SearchByVectorContext is SearchByVector stopping with the error of ctx once ctx is done
+func (ds *DiskStorage[T]) SearchByVectorContext(ctx context.Context, input []float64, limit int) (*[]types.SearchResult[T], error) {
+	return ds.SearchContext(ctx, input, SearchOptions{Limit: limit})
+}
+
+// Search scans every datapoint once, keeping only the Offset+Limit closest ones in a bounded heap
+// together with the vectors decoded during the scan, so no hit has to be read back from the tree
+func (ds *DiskStorage[T]) Search(input []float64, opts SearchOptions) (*[]types.SearchResult[T], error) {
+	return ds.SearchContext(context.Background(), input, opts)
+}
+
+// SearchContext is Search traced as a child of the span ctx carries. The scan stops with the
+// error of ctx once ctx is done, context.Canceled or context.DeadlineExceeded
+func (ds *DiskStorage[T]) SearchContext(ctx context.Context, input []float64, opts SearchOptions) (*[]types.SearchResult[T], error) {
+	defer searchSeconds.With("vector").Since(time.Now())
+	ctx, span := trace.Start(ctx, "DiskStorage.Search", trace.WithAttributes(trace.Attr("limit", opts.Limit), trace.Attr("offset", opts.Offset)))
+	defer span.End()
+	if opts.Limit <= 0 || opts.Offset < 0 {
+		return &[]types.SearchResult[T]{}, nil
 	}
-	// calculate distances
-	idToDist := make(map[string]float64, count)
-	ann := make([]string, 0, count)
-	ds.Each(
-		func(key, val string, addedAt time.Time) error {
-			ann = append(ann, key)
-			emb, err := vector.ConvertStrToEmbedding(val)
-			if err != nil {
-				return err
-			}
-			idToDist[key] = ds.distanceMeasure.CalcDistance(emb, input)
+	topK := pqueue.NewTopK(opts.Offset + opts.Limit)
+	err := ds.scanDistances(ctx, input, func(row scoredRow) error {
+		if opts.Threshold != nil && row.distance > *opts.Threshold {
 			return nil
-		},
-	)
-
-	// sort the found items by their actual distance
-	sort.Slice(ann, func(i, j int) bool {
-		return idToDist[ann[i]] < idToDist[ann[j]]
+		}
+		topK.Offer(&pqueue.QItem{Value: row.key, Priority: row.distance, Vector: row.vector})
+		return nil
 	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
 
-	// return the top n items
-	if len(ann) > limit {
-		ann = ann[:limit]
+	hits := topK.Sorted()
+	if len(hits) <= opts.Offset {
+		return &[]types.SearchResult[T]{}, nil
 	}
+	hits = hits[opts.Offset:]
 
-	searchResults := make([]types.SearchResult[T], len(ann))
-	for i, id := range ann {
-		emb, found := ds.Get(id)
-		if !found {
-			return nil, fmt.Errorf("embedding not found for id %s", id)
-		}
-		searchResults[i] = types.SearchResult[T]{ID: id, Distance: math.Abs(idToDist[id]), Vector: emb}
+	searchResults := make([]types.SearchResult[T], len(hits))
+	for i, hit := range hits {
+		searchResults[i] = types.SearchResult[T]{ID: hit.Value, Distance: ds.distanceMeasure.Normalize(hit.Priority), Vector: hit.Vector}
 	}
 
 	return &searchResults, nil
@@ -131,13 +325,16 @@ func (ds *DiskStorage[T]) SearchByVector(input []float64, limit int) (*[]types.S
 // NewDiskStorage returns an empty memory DB storage implementation of the CrdtEngine interface
 // TODO: ensure dimension size is respected
 func NewDiskStorage[T comparable](filePath ...string) (*DiskStorage[T], error) {
-	var storage *btree.Btree[T]
-	var err error
+	cfg := btree.Config{}
 	if len(filePath) != 0 {
-		storage, err = btree.InitializeBtree[T](filePath[0])
-	} else {
-		storage, err = btree.InitializeBtree[T]()
+		cfg.Path = filePath[0]
 	}
+	return OpenDiskStorage[T](cfg)
+}
+
+// OpenDiskStorage opens, or creates, the storage kept in the tree file cfg describes
+func OpenDiskStorage[T comparable](cfg btree.Config) (*DiskStorage[T], error) {
+	storage, err := btree.OpenBtree[T](cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -147,5 +344,10 @@ func NewDiskStorage[T comparable](filePath ...string) (*DiskStorage[T], error) {
 	// 	return nil, err
 	// }
 
-	return &DiskStorage[T]{storage: storage}, nil
+	return &DiskStorage[T]{
+		storage:         storage,
+		distanceMeasure: vector.NewCosineDistanceMeasure(),
+		text:            bm25.NewIndex(storage),
+		textField:       defaultTextField,
+	}, nil
 }
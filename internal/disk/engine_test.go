@@ -0,0 +1,257 @@
+package disk_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStorage(t *testing.T) *disk.DiskStorage[string] {
+	ds, err := disk.NewDiskStorage[string](filepath.Join(t.TempDir(), "engine.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestHybridSearch(t *testing.T) {
+	ds := newStorage(t)
+	points := []*types.DataPoint[string]{
+		types.NewDataPointWithPayload("apple", []float64{1, 0, 0}, map[string]string{"text": "red fruit"}),
+		types.NewDataPointWithPayload("cherry", []float64{0.9, 0.1, 0}, map[string]string{"text": "small red stone fruit"}),
+		types.NewDataPointWithPayload("banana", []float64{0, 1, 0}, map[string]string{"text": "yellow fruit"}),
+		types.NewDataPointWithPayload("car", []float64{0, 0, 1}, map[string]string{"text": "red sports car"}),
+	}
+	for _, dp := range points {
+		assert.Nil(t, ds.Add(*dp))
+	}
+
+	results, err := ds.HybridSearch([]float64{1, 0, 0}, "red", 2, disk.HybridOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, *results, 2)
+	assert.Equal(t, "apple", (*results)[0].ID, "close in both rankings")
+	assert.Equal(t, "cherry", (*results)[1].ID)
+
+	results, err = ds.HybridSearch([]float64{1, 0, 0}, "car", 1, disk.HybridOptions{Fusion: disk.FusionWeighted, VectorWeight: 0.1})
+	assert.Nil(t, err)
+	assert.Equal(t, "car", (*results)[0].ID, "keyword match dominates with a low vector weight")
+	assert.Equal(t, []float64{0, 0, 1}, (*results)[0].Vector)
+}
+
+func TestSearchPagesAndThresholds(t *testing.T) {
+	ds := newStorage(t)
+	ds.SetWorkers(3)
+	for i := 0; i < 40; i++ {
+		dp := types.NewDataPoint(fmt.Sprintf("p-%02d", i), []float64{float64(i), 1})
+		assert.Nil(t, ds.Add(*dp))
+	}
+	query := []float64{0, 1}
+
+	first, err := ds.Search(query, disk.SearchOptions{Limit: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"p-00", "p-01", "p-02", "p-03", "p-04"}, resultIDs(*first))
+	assert.Equal(t, []float64{0, 1}, (*first)[0].Vector)
+
+	second, err := ds.Search(query, disk.SearchOptions{Limit: 5, Offset: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"p-05", "p-06", "p-07", "p-08", "p-09"}, resultIDs(*second))
+
+	// cosine distances are negated similarities, keep only the ones above 0.7
+	threshold := -0.7
+	close, err := ds.Search(query, disk.SearchOptions{Limit: 100, Threshold: &threshold})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"p-00", "p-01"}, resultIDs(*close))
+
+	past, err := ds.Search(query, disk.SearchOptions{Limit: 5, Offset: 100})
+	assert.Nil(t, err)
+	assert.Empty(t, *past)
+}
+
+func TestSearchReportsNormalizedDistances(t *testing.T) {
+	ds := newStorage(t)
+	assert.NoError(t, ds.Add(*types.NewDataPoint("same", []float64{2, 0})))
+	assert.NoError(t, ds.Add(*types.NewDataPoint("orthogonal", []float64{0, 1})))
+	assert.NoError(t, ds.Add(*types.NewDataPoint("opposite", []float64{-1, 0})))
+
+	results, err := ds.SearchByVector([]float64{1, 0}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"same", "orthogonal", "opposite"}, resultIDs(*results))
+	for i, want := range []float64{0, 1, 2} {
+		assert.InDelta(t, want, (*results)[i].Distance, 1e-9, "1 - cos for cosine")
+	}
+}
+
+func TestSearchWithinRadius(t *testing.T) {
+	ds := newStorage(t)
+	for i := 0; i < 20; i++ {
+		dp := types.NewDataPoint(fmt.Sprintf("p-%02d", i), []float64{float64(i), 0})
+		assert.Nil(t, ds.Add(*dp))
+	}
+	ds.SetDistanceMeasure(vector.NewEuclideanDistanceMeasure())
+
+	it := ds.SearchWithinRadius([]float64{10, 0}, 2)
+	found := []string{}
+	for it.Next() {
+		assert.LessOrEqual(t, it.Result().Distance, 2.0)
+		found = append(found, it.Result().ID)
+	}
+	assert.Nil(t, it.Err())
+	sort.Strings(found)
+	assert.Equal(t, []string{"p-08", "p-09", "p-10", "p-11", "p-12"}, found)
+
+	// every vector points the same way, so they all sit at cosine distance 0
+	ds.SetDistanceMeasure(vector.NewCosineDistanceMeasure())
+	it = ds.SearchWithinRadius([]float64{1, 0}, 0.01)
+	count := 0
+	for it.Next() {
+		count++
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 19, count, "the zero vector has no direction")
+
+	// stopping early releases the scan
+	it = ds.SearchWithinRadius([]float64{1, 0}, 2)
+	assert.True(t, it.Next())
+	assert.Nil(t, it.Close())
+	assert.False(t, it.Next())
+}
+
+func resultIDs(results []types.SearchResult[string]) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func TestEachSkipsTextIndex(t *testing.T) {
+	ds := newStorage(t)
+	dp := types.NewDataPointWithPayload("doc", []float64{1, 2}, map[string]string{"text": "some words here"})
+	assert.Nil(t, ds.Add(*dp))
+
+	keys := []string{}
+	err := ds.Each(func(key, val string, addedAt time.Time) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"doc"}, keys)
+}
+
+func TestReopenKeepsData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reopen.db")
+	ds, err := disk.NewDiskStorage[string](path)
+	assert.NoError(t, err)
+	assert.NoError(t, ds.Add(*types.NewDataPoint("kept", []float64{1, 2})))
+	assert.NoError(t, ds.Close())
+
+	ds, err = disk.NewDiskStorage[string](path)
+	assert.NoError(t, err)
+	emb, found, err := ds.Get("kept")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []float64{1, 2}, emb)
+	assert.NoError(t, ds.Add(*types.NewDataPoint("added", []float64{3})), "a reopened tree accepts writes")
+	_, found, err = ds.Get("added")
+	assert.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestDeleteRemovesVectorAndText(t *testing.T) {
+	ds := newStorage(t)
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("apple", []float64{1, 0}, map[string]string{"text": "red fruit"})))
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("cherry", []float64{0.9, 0.1}, map[string]string{"text": "red fruit"})))
+
+	assert.NoError(t, ds.Delete("apple"))
+	assert.ErrorIs(t, ds.Delete("apple"), btree.ErrNotFound)
+	_, found, err := ds.Get("apple")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	results, err := ds.SearchByVector([]float64{1, 0}, 5)
+	assert.NoError(t, err)
+	assert.Len(t, *results, 1)
+	results, err = ds.HybridSearch([]float64{1, 0}, "red", 5, disk.HybridOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, *results, 1)
+	assert.Equal(t, "cherry", (*results)[0].ID)
+}
+
+func TestWeightedFusionWithEqualDistances(t *testing.T) {
+	ds := newStorage(t)
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("short", []float64{1, 0}, map[string]string{"text": "red apple"})))
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("long", []float64{0, 1}, map[string]string{"text": "red fruit picked in the orchard today"})))
+
+	// both are as close to the query, so the vector ranking counts as fully similar for both
+	results, err := ds.HybridSearch([]float64{1, 1}, "red", 2, disk.HybridOptions{Fusion: disk.FusionWeighted, VectorWeight: 0.5})
+	assert.NoError(t, err)
+	assert.Len(t, *results, 2)
+	assert.Equal(t, "short", (*results)[0].ID)
+	assert.InDelta(t, 1, (*results)[0].Score, 1e-9)
+	assert.InDelta(t, 0.5, (*results)[1].Score, 1e-9)
+}
+
+func TestWeightedFusionRanksExactMatchFirst(t *testing.T) {
+	ds := newStorage(t)
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("exact", []float64{1, 0}, map[string]string{"text": "red apple"})))
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("orthogonal", []float64{0, 1}, map[string]string{"text": "red apple"})))
+	// closer than the orthogonal vector, which only the keyword ranking then finds
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, ds.Add(*types.NewDataPoint(fmt.Sprintf("filler-%02d", i), []float64{1, 1 + float64(i)/100})))
+	}
+
+	results, err := ds.HybridSearch([]float64{1, 0}, "apple", 2, disk.HybridOptions{Fusion: disk.FusionWeighted, VectorWeight: 0.5, CandidateDepth: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"exact", "orthogonal"}, resultIDs(*results))
+	assert.InDelta(t, 0, (*results)[0].Distance, 1e-9)
+	assert.InDelta(t, 1, (*results)[1].Distance, 1e-9)
+}
+
+func TestUpsertWithoutTextDropsIt(t *testing.T) {
+	ds := newStorage(t)
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("apple", []float64{1, 0}, map[string]string{"text": "red fruit"})))
+	assert.NoError(t, ds.Add(*types.NewDataPointWithPayload("cherry", []float64{0, 1}, map[string]string{"text": "red fruit"})))
+	assert.NoError(t, ds.Add(*types.NewDataPoint("apple", []float64{1, 0})))
+
+	results, err := ds.HybridSearch([]float64{0, 1}, "red", 5, disk.HybridOptions{Fusion: disk.FusionWeighted})
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, r := range *results {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []string{"cherry", "apple"}, ids)
+	assert.Zero(t, (*results)[1].Score, "apple no longer matches the text query")
+}
+
+func TestScansWhileWriting(t *testing.T) {
+	ds := newStorage(t)
+	ds.SetWorkers(2)
+	for i := 0; i < 200; i++ {
+		assert.NoError(t, ds.Add(*types.NewDataPoint(fmt.Sprintf("p-%03d", i), []float64{float64(i), 1})))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 200; i < 400; i++ {
+			assert.NoError(t, ds.Add(*types.NewDataPoint(fmt.Sprintf("p-%03d", i), []float64{float64(i), 1})))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		results, err := ds.SearchByVector([]float64{1, 1}, 5)
+		assert.NoError(t, err)
+		assert.Len(t, *results, 5)
+	}
+	<-done
+	results, err := ds.SearchByVector([]float64{1, 1}, 500)
+	assert.NoError(t, err)
+	assert.Len(t, *results, 400)
+}
@@ -0,0 +1,30 @@
+package disk
+
+import "github.com/bjornaer/hermes/internal/disk/diskerr"
+
+// The errors of the storage layer, to be matched with errors.Is and errors.As. See package diskerr
+var (
+	// ErrNotFound is returned when there is no datapoint stored under the ID
+	ErrNotFound = diskerr.ErrNotFound
+	// ErrCorrupt is matched by every CorruptError, data read back from the tree file not decoding
+	ErrCorrupt = diskerr.ErrCorrupt
+	// ErrKeyTooLarge is returned for a datapoint ID longer than a tree pair holds
+	ErrKeyTooLarge = diskerr.ErrKeyTooLarge
+	// ErrValueTooLarge is returned for an embedding whose encoding is longer than a tree pair holds
+	ErrValueTooLarge = diskerr.ErrValueTooLarge
+	// ErrReservedKey is returned for a datapoint ID starting with the prefix of the text index
+	ErrReservedKey = diskerr.ErrReservedKey
+	// ErrDimensionMismatch is matched by every DimensionError, vectors of different dimensions being compared
+	ErrDimensionMismatch = diskerr.ErrDimensionMismatch
+	// ErrVersionConflict is returned by CompareAndSwap when the datapoint changed since it was read
+	ErrVersionConflict = diskerr.ErrVersionConflict
+	// ErrClosed is returned by every method of a closed storage
+	ErrClosed = diskerr.ErrClosed
+)
+
+type (
+	// CorruptError tells which block of the tree file, if known, failed to decode and why
+	CorruptError = diskerr.CorruptError
+	// DimensionError tells which datapoint has a vector of the wrong dimension
+	DimensionError = diskerr.DimensionError
+)
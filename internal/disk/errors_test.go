@@ -0,0 +1,88 @@
+package disk_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOversizedDatapoints(t *testing.T) {
+	ds := newStorage(t)
+	err := ds.Add(*types.NewDataPoint(strings.Repeat("k", 31), []float64{1}))
+	assert.ErrorIs(t, err, disk.ErrKeyTooLarge)
+	err = ds.Add(*types.NewDataPoint("wide", make([]float64, 64)))
+	assert.ErrorIs(t, err, disk.ErrValueTooLarge)
+}
+
+func TestSearchReportsDimensionMismatch(t *testing.T) {
+	ds := newStorage(t)
+	require.NoError(t, ds.Add(*types.NewDataPoint("flat", []float64{1, 0})))
+	require.NoError(t, ds.Add(*types.NewDataPoint("deep", []float64{1, 0, 0})))
+
+	_, err := ds.SearchByVector([]float64{1, 0}, 5)
+	require.ErrorIs(t, err, disk.ErrDimensionMismatch)
+	var dim *disk.DimensionError
+	require.ErrorAs(t, err, &dim)
+	assert.Equal(t, disk.DimensionError{ID: "deep", Want: 2, Got: 3}, *dim)
+}
+
+func TestCorruptDataIsReported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupt.db")
+	tree, err := btree.InitializeBtree[string](path)
+	require.NoError(t, err)
+	require.NoError(t, tree.Insert(pair.NewPair("garbled", "not$a$vector")))
+	require.NoError(t, tree.Close())
+
+	ds, err := disk.NewDiskStorage[string](path)
+	require.NoError(t, err)
+	_, found, err := ds.Get("garbled")
+	assert.ErrorIs(t, err, disk.ErrCorrupt, "a value not decoding is not reported as missing")
+	assert.False(t, found)
+	_, err = ds.SearchByVector([]float64{1, 0}, 5)
+	assert.ErrorIs(t, err, disk.ErrCorrupt)
+	require.NoError(t, ds.Close())
+
+	// a root claiming more pairs than its block holds
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 8)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = disk.NewDiskStorage[string](path)
+	require.ErrorIs(t, err, disk.ErrCorrupt)
+	var corrupt *disk.CorruptError
+	require.ErrorAs(t, err, &corrupt)
+	assert.Equal(t, int64(0), corrupt.Block)
+}
+
+func TestClosedStorage(t *testing.T) {
+	ds := newStorage(t)
+	require.NoError(t, ds.Add(*types.NewDataPoint("a", []float64{1, 0})))
+	require.NoError(t, ds.Close())
+
+	assert.ErrorIs(t, ds.Add(*types.NewDataPoint("b", []float64{0, 1})), disk.ErrClosed)
+	assert.ErrorIs(t, ds.Delete("a"), disk.ErrClosed)
+	_, _, err := ds.Get("a")
+	assert.ErrorIs(t, err, disk.ErrClosed)
+	_, _, err = ds.Version("a")
+	assert.ErrorIs(t, err, disk.ErrClosed)
+	_, err = ds.SearchByVector([]float64{1, 0}, 5)
+	assert.ErrorIs(t, err, disk.ErrClosed)
+	assert.ErrorIs(t, ds.Close(), disk.ErrClosed)
+}
+
+func TestVersionConflict(t *testing.T) {
+	ds := newStorage(t)
+	require.NoError(t, ds.CompareAndSwap(*types.NewDataPoint("a", []float64{1, 0}), 0))
+	err := ds.CompareAndSwap(*types.NewDataPoint("a", []float64{0, 1}), 0)
+	assert.ErrorIs(t, err, disk.ErrVersionConflict)
+	assert.ErrorIs(t, err, btree.ErrVersionConflict, "the tree and the storage return the same error")
+}
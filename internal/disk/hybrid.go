@@ -0,0 +1,156 @@
+package disk
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/trace"
+)
+
+// Fusion selects how the vector and keyword rankings of a hybrid query are combined
+type Fusion int
+
+const (
+	// FusionRRF scores every hit with the sum of 1/(k+rank) over the rankings it shows up in
+	FusionRRF Fusion = iota
+	// FusionWeighted min-max normalizes both scores and blends them with VectorWeight
+	FusionWeighted
+)
+
+const (
+	defaultRRFConstant    = 60
+	defaultCandidateDepth = 4
+	minCandidates         = 50
+)
+
+// HybridOptions tunes a hybrid query, the zero value means reciprocal rank fusion with k=60
+type HybridOptions struct {
+	Fusion Fusion
+	// RRFConstant is the k of reciprocal rank fusion
+	RRFConstant float64
+	// VectorWeight is the share of the vector similarity in weighted fusion, the rest goes to BM25
+	VectorWeight float64
+	// CandidateDepth is how many candidates per requested result each ranking contributes
+	CandidateDepth int
+}
+
+// HybridSearch ranks datapoints by fusing embedding similarity to input with the BM25 score of
+// query over the indexed payload text field. Results carry the fused value in Score, best first
+func (ds *DiskStorage[T]) HybridSearch(input []float64, query string, limit int, opts HybridOptions) (*[]types.SearchResult[T], error) {
+	return ds.HybridSearchContext(context.Background(), input, query, limit, opts)
+}
+
+// HybridSearchContext is HybridSearch stopping with the error of ctx once ctx is done
+func (ds *DiskStorage[T]) HybridSearchContext(ctx context.Context, input []float64, query string, limit int, opts HybridOptions) (*[]types.SearchResult[T], error) {
+	defer searchSeconds.With("hybrid").Since(time.Now())
+	ctx, span := trace.Start(ctx, "DiskStorage.HybridSearch", trace.WithAttributes(trace.Attr("limit", limit)))
+	defer span.End()
+	if opts.RRFConstant <= 0 {
+		opts.RRFConstant = defaultRRFConstant
+	}
+	if opts.CandidateDepth <= 0 {
+		opts.CandidateDepth = defaultCandidateDepth
+	}
+	candidates := limit * opts.CandidateDepth
+	if candidates < minCandidates {
+		candidates = minCandidates
+	}
+
+	vectorHits, err := ds.SearchByVectorContext(ctx, input, candidates)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	textHits, err := ds.text.Search(query, candidates)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	results := map[string]*types.SearchResult[T]{}
+	scores := map[string]float64{}
+	for _, hit := range *vectorHits {
+		hit := hit
+		results[hit.ID] = &hit
+	}
+
+	switch opts.Fusion {
+	case FusionWeighted:
+		vecMin, vecMax := math.Inf(1), math.Inf(-1)
+		for _, hit := range *vectorHits {
+			vecMin = math.Min(vecMin, hit.Distance)
+			vecMax = math.Max(vecMax, hit.Distance)
+		}
+		for _, hit := range *vectorHits {
+			// smaller distances are better, so flip the normalized value into a similarity
+			scores[hit.ID] += opts.VectorWeight * (1 - normalize(hit.Distance, vecMin, vecMax, 0))
+		}
+		textMin, textMax := math.Inf(1), math.Inf(-1)
+		for _, hit := range textHits {
+			textMin = math.Min(textMin, hit.Score)
+			textMax = math.Max(textMax, hit.Score)
+		}
+		for _, hit := range textHits {
+			scores[hit.ID] += (1 - opts.VectorWeight) * normalize(hit.Score, textMin, textMax, 1)
+		}
+	default:
+		for rank, hit := range *vectorHits {
+			scores[hit.ID] += 1 / (opts.RRFConstant + float64(rank+1))
+		}
+		for rank, hit := range textHits {
+			scores[hit.ID] += 1 / (opts.RRFConstant + float64(rank+1))
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] == scores[ids[j]] {
+			return ids[i] < ids[j]
+		}
+		return scores[ids[i]] > scores[ids[j]]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	searchResults := make([]types.SearchResult[T], 0, len(ids))
+	for _, id := range ids {
+		result, ok := results[id]
+		if !ok {
+			// keyword only hit, fetch its vector so it can be reported like the others
+			emb, found, err := ds.GetContext(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+			if len(emb) != len(input) {
+				return nil, &DimensionError{ID: id, Want: len(input), Got: len(emb)}
+			}
+			distanceComputations.Inc()
+			result = &types.SearchResult[T]{ID: id, Distance: ds.distanceMeasure.Normalize(ds.distanceMeasure.CalcDistance(emb, input)), Vector: emb}
+		}
+		result.Score = scores[id]
+		searchResults = append(searchResults, *result)
+	}
+	return &searchResults, nil
+}
+
+// normalize maps v from [min, max] to [0, 1]. When every value is the same it returns equal, the
+// value standing for the best one: 0 for distances, 1 for scores
+func normalize(v, min, max, equal float64) float64 {
+	if max == min {
+		return equal
+	}
+	return (v - min) / (max - min)
+}
@@ -0,0 +1,134 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bjornaer/hermes/internal/disk/bm25"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+	"github.com/bjornaer/hermes/internal/hlc"
+)
+
+// FileStats describes what a storage file holds
+type FileStats struct {
+	Path string `json:"path"`
+	// Bytes and Blocks are the size of the file, deleted pairs still taking space until Compact
+	Bytes  int64 `json:"bytes"`
+	Blocks int64 `json:"blocks"`
+	// Points are the datapoints stored, TextEntries the pairs of the text index
+	Points      int `json:"points"`
+	TextEntries int `json:"text_entries"`
+	// Dimension is the dimension of the first datapoint read, 0 when there is none
+	Dimension int `json:"dimension"`
+}
+
+// Stats walks the whole tree to describe the storage file
+func (ds *DiskStorage[T]) Stats() (FileStats, error) {
+	stats := FileStats{Path: ds.storage.Path()}
+	info, err := os.Stat(stats.Path)
+	if err != nil {
+		return stats, err
+	}
+	stats.Bytes = info.Size()
+	stats.Blocks = info.Size() / int64(ds.storage.BlockSize())
+	err = ds.storage.Iterate(func(key, val string, _ hlc.Timestamp) error {
+		if bm25.IsReserved(key) {
+			stats.TextEntries++
+			return nil
+		}
+		stats.Points++
+		if stats.Dimension == 0 {
+			v, _, err := vector.DecodeEmbedding(val)
+			if err == nil {
+				stats.Dimension = len(v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, ds.storage.Error()
+}
+
+// Problem is a datapoint Verify found unreadable or inconsistent
+type Problem struct {
+	ID  string `json:"id"`
+	Err string `json:"error"`
+}
+
+// Verify reads back every datapoint, reporting those whose embedding does not decode or whose
+// dimension differs from the first one read. The error is for a tree that cannot be walked at all
+func (ds *DiskStorage[T]) Verify() ([]Problem, error) {
+	problems := []Problem{}
+	dimension := 0
+	err := ds.storage.Iterate(func(key, val string, _ hlc.Timestamp) error {
+		if bm25.IsReserved(key) {
+			return nil
+		}
+		v, _, err := vector.DecodeEmbedding(val)
+		switch {
+		case err != nil:
+			problems = append(problems, Problem{ID: key, Err: err.Error()})
+		case dimension == 0:
+			dimension = len(v)
+		case len(v) != dimension:
+			problems = append(problems, Problem{ID: key, Err: fmt.Sprintf("dimension %d, expected %d", len(v), dimension)})
+		}
+		return nil
+	})
+	if err != nil {
+		return problems, err
+	}
+	return problems, ds.storage.Error()
+}
+
+// Compact rewrites the storage file at path, made of blocks of blockSize bytes (the default when
+// 0), with its live pairs only, dropping the slots deleted pairs kept, and returns its size before
+// and after. The file must not be open meanwhile. Pairs keep their timestamps but their versions
+// start over
+func Compact(path string, blockSize int) (before, after int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	before = info.Size()
+
+	src, err := btree.OpenBtree[string](btree.Config{Path: path, BlockSize: blockSize})
+	if err != nil {
+		return before, 0, err
+	}
+	defer src.Close()
+	tmp := path + ".compact"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return before, 0, err
+	}
+	dst, err := btree.OpenBtree[string](btree.Config{Path: tmp, BlockSize: blockSize})
+	if err != nil {
+		return before, 0, err
+	}
+	err = src.Iterate(func(key, val string, addedAt hlc.Timestamp) error {
+		return dst.Insert(pair.NewPairWithTimestamp(key, val, addedAt))
+	})
+	if err == nil {
+		err = src.Error()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return before, 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return before, 0, err
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		return before, 0, err
+	}
+	return before, info.Size(), nil
+}
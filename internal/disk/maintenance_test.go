@@ -0,0 +1,58 @@
+package disk_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsVerifyAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compact.db")
+	ds, err := disk.NewDiskStorage[string](path)
+	require.NoError(t, err)
+	for i := 0; i < 300; i++ {
+		payload := map[string]string{}
+		if i%100 == 0 {
+			payload["text"] = "landmark"
+		}
+		require.NoError(t, ds.Add(*types.NewDataPointWithPayload(fmt.Sprintf("p%03d", i), []float64{float64(i), 1}, payload)))
+	}
+	for i := 50; i < 300; i++ {
+		require.NoError(t, ds.Delete(fmt.Sprintf("p%03d", i)))
+	}
+
+	stats, err := ds.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 50, stats.Points)
+	assert.Equal(t, 2, stats.Dimension)
+	assert.Positive(t, stats.TextEntries, "p000 is still indexed")
+	problems, err := ds.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	require.NoError(t, ds.Close())
+
+	before, after, err := disk.Compact(path, 0)
+	require.NoError(t, err)
+	assert.Equal(t, stats.Bytes, before)
+	assert.Less(t, after, before)
+
+	ds, err = disk.NewDiskStorage[string](path)
+	require.NoError(t, err)
+	defer ds.Close()
+	compacted, err := ds.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, stats.Points, compacted.Points)
+	assert.Equal(t, stats.TextEntries, compacted.TextEntries)
+	v, found, err := ds.Get("p049")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []float64{49, 1}, v)
+	results, err := ds.HybridSearch([]float64{0, 1}, "landmark", 1, disk.HybridOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "p000", (*results)[0].ID)
+}
@@ -0,0 +1,9 @@
+package disk
+
+import "github.com/bjornaer/hermes/internal/metrics"
+
+var (
+	searchSeconds        = metrics.NewHistogramVec("hermes_search_seconds", "Time taken to answer a search, by kind of search.", nil, "kind")
+	rowsScanned          = metrics.NewCounter("hermes_search_rows_scanned_total", "Stored vectors read by searches.")
+	distanceComputations = metrics.NewCounter("hermes_search_distance_computations_total", "Distances computed between a query and a stored vector.")
+)
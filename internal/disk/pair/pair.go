@@ -4,21 +4,38 @@ import (
 	"encoding/binary"
 	"fmt"
 	"time"
+
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
+	"github.com/bjornaer/hermes/internal/hlc"
 )
 
 // 2+2+30+93+16+2 = 145
 const PairSize = 150
 const maxKeyLength = 30
 const maxValueLength = 93
+const maxTimeLength = 16
+
+// MaxValueLength is the longest value a pair holds
+const MaxValueLength = maxValueLength
+
+// the version counter lives in the spare tail bytes of the pair so older files read as version 0
+const versionOffset = PairSize - 4
+
+// timeFormatOffset is the spare byte before the version. It is 0 in older files, whose timestamps
+// only hold unix seconds, and timeFormatHLC once the full hybrid logical timestamp is stored
+const timeFormatOffset = versionOffset - 1
+
+const timeFormatHLC = 1
 
 // Pairs: Key is the vector index and Value is the actual vector
 type Pairs struct {
-	KeyLen    uint16    // 2
-	ValueLen  uint16    // 2
-	Key       string    // 30
-	Value     string    // 93 // serialize this on the client side, to enable more complex data
-	Timestamp time.Time // 16
-	TimeLen   uint16    // 2
+	KeyLen    uint16        // 2
+	ValueLen  uint16        // 2
+	Key       string        // 30
+	Value     string        // 93 // serialize this on the client side, to enable more complex data
+	Timestamp hlc.Timestamp // 16 - wall nanoseconds, logical counter and node
+	TimeLen   uint16        // 2
+	Version   uint32        // 4 - bumped on every overwrite of the key
 }
 
 func (p *Pairs) SetKey(key string) {
@@ -32,16 +49,21 @@ func (p *Pairs) SetValue(value string) {
 }
 
 func (p *Pairs) SetTime(t time.Time) {
-	p.Timestamp = t
+	p.SetTimestamp(hlc.FromTime(t))
+}
+
+func (p *Pairs) SetTimestamp(ts hlc.Timestamp) {
+	p.Timestamp = ts
 	p.TimeLen = 16
 }
 
+// Validate checks that the pair fits in a slot, failing with diskerr.ErrKeyTooLarge or diskerr.ErrValueTooLarge
 func (p *Pairs) Validate() error {
 	if len(p.Key) > maxKeyLength {
-		return fmt.Errorf("key length should not be more than 30, currently it is %d ", len(p.Key))
+		return fmt.Errorf("%w: key length should not be more than %d, currently it is %d", diskerr.ErrKeyTooLarge, maxKeyLength, len(p.Key))
 	}
 	if len(p.Value) > maxValueLength {
-		return fmt.Errorf("value length should not be more than 93, currently it is %d", len(p.Value))
+		return fmt.Errorf("%w: value length should not be more than %d, currently it is %d", diskerr.ErrValueTooLarge, maxValueLength, len(p.Value))
 	}
 	return nil
 }
@@ -62,6 +84,14 @@ func NewPairWithTime(key string, value string, t time.Time) *Pairs {
 	return pair
 }
 
+func NewPairWithTimestamp(key string, value string, ts hlc.Timestamp) *Pairs {
+	pair := new(Pairs)
+	pair.SetKey(key)
+	pair.SetValue(value)
+	pair.SetTimestamp(ts)
+	return pair
+}
+
 func ConvertPairsToBytes(pair *Pairs) []byte {
 	pairByte := make([]byte, PairSize)
 	var pairOffset uint16
@@ -78,12 +108,19 @@ func ConvertPairsToBytes(pair *Pairs) []byte {
 	valueByte := []byte(pair.Value)
 	copy(pairByte[pairOffset:], valueByte[:pair.ValueLen])
 	pairOffset += pair.ValueLen
-	timeByte := epochToBytes(pair.Timestamp.Unix())
+	timeByte := timestampToBytes(pair.Timestamp)
 	copy(pairByte[pairOffset:], timeByte[:pair.TimeLen])
+	pairByte[timeFormatOffset] = timeFormatHLC
+	binary.LittleEndian.PutUint32(pairByte[versionOffset:], pair.Version)
 	return pairByte
 }
 
-func ConvertBytesToPair(pairByte []byte) *Pairs {
+// ConvertBytesToPair reads a pair written by ConvertPairsToBytes, failing with a diskerr.CorruptError
+// when the lengths it holds do not fit in a slot or its timestamp is too short for its format
+func ConvertBytesToPair(pairByte []byte) (*Pairs, error) {
+	if len(pairByte) < PairSize {
+		return nil, diskerr.Corrupt("pair truncated to %d bytes", len(pairByte))
+	}
 	pair := new(Pairs)
 	var pairOffset uint16
 	pairOffset = 0
@@ -96,13 +133,34 @@ func ConvertBytesToPair(pairByte []byte) *Pairs {
 	//Read timestamp length
 	pair.TimeLen = uint16FromBytes(pairByte[pairOffset:])
 	pairOffset += 2
+	if pair.KeyLen > maxKeyLength || pair.ValueLen > maxValueLength || pair.TimeLen > maxTimeLength {
+		return nil, diskerr.Corrupt("pair lengths %d/%d/%d overflow the slot", pair.KeyLen, pair.ValueLen, pair.TimeLen)
+	}
 	pair.Key = string(pairByte[pairOffset : pairOffset+pair.KeyLen])
 	pairOffset += pair.KeyLen
 	pair.Value = string(pairByte[pairOffset : pairOffset+pair.ValueLen])
 	pairOffset += pair.ValueLen
+	hybrid := pairByte[timeFormatOffset] == timeFormatHLC
+	if need := timeLength(hybrid); pair.TimeLen < need {
+		return nil, diskerr.Corrupt("timestamp of %d bytes, its format needs %d", pair.TimeLen, need)
+	}
 	// log.Fatal(pairByte[pairOffset : pairOffset+pair.TimeLen])
-	pair.Timestamp = time.Unix(bytesToEpoch(pairByte[pairOffset:pairOffset+pair.TimeLen]), 0)
-	return pair
+	timeByte := pairByte[pairOffset : pairOffset+pair.TimeLen]
+	if hybrid {
+		pair.Timestamp = bytesToTimestamp(timeByte)
+	} else {
+		pair.Timestamp = hlc.FromTime(time.Unix(bytesToEpoch(timeByte), 0))
+	}
+	pair.Version = binary.LittleEndian.Uint32(pairByte[versionOffset:])
+	return pair, nil
+}
+
+// timeLength is the width of a hybrid timestamp, or of the unix seconds older files hold
+func timeLength(hybrid bool) uint16 {
+	if hybrid {
+		return 16
+	}
+	return 8
 }
 
 func uint16FromBytes(b []byte) uint16 {
@@ -116,12 +174,22 @@ func uint16ToBytes(value uint16) []byte {
 	return b
 }
 
-func epochToBytes(t int64) []byte {
+func timestampToBytes(ts hlc.Timestamp) []byte {
 	out := make([]byte, 16)
-	binary.LittleEndian.PutUint64(out, uint64(t))
+	binary.LittleEndian.PutUint64(out, uint64(ts.Wall))
+	binary.LittleEndian.PutUint32(out[8:], ts.Logical)
+	binary.LittleEndian.PutUint32(out[12:], ts.Node)
 	return out
 }
 
+func bytesToTimestamp(b []byte) hlc.Timestamp {
+	return hlc.Timestamp{
+		Wall:    int64(binary.LittleEndian.Uint64(b)),
+		Logical: binary.LittleEndian.Uint32(b[8:]),
+		Node:    binary.LittleEndian.Uint32(b[12:]),
+	}
+}
+
 func bytesToEpoch(b []byte) int64 {
 	i := int64(binary.LittleEndian.Uint64(b))
 	return i
@@ -1,9 +1,15 @@
 package pair_test
 
 import (
+	"encoding/binary"
 	"testing"
+	"time"
 
+	"github.com/bjornaer/hermes/internal/disk/diskerr"
 	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidate(t *testing.T) {
@@ -24,3 +30,46 @@ func TestValidate(t *testing.T) {
 		t.Errorf("Shoudl throw error as value is longer than 90")
 	}
 }
+
+func TestTimestampKeepsFullPrecision(t *testing.T) {
+	ts := hlc.Timestamp{Wall: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC).UnixNano(), Logical: 7, Node: 42}
+	p, err := pair.ConvertBytesToPair(pair.ConvertPairsToBytes(pair.NewPairWithTimestamp("key", "value", ts)))
+	require.NoError(t, err)
+	assert.Equal(t, ts, p.Timestamp)
+}
+
+func TestLegacyTimestampInSeconds(t *testing.T) {
+	b := pair.ConvertPairsToBytes(pair.NewPair("key", "value"))
+	// files written before hybrid timestamps hold unix seconds and no format byte
+	binary.LittleEndian.PutUint64(b[6+len("key")+len("value"):], 1700000000)
+	b[pair.PairSize-5] = 0
+	p, err := pair.ConvertBytesToPair(b)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 0), p.Timestamp.Time())
+}
+
+func TestCorruptPairs(t *testing.T) {
+	assert.ErrorIs(t, pair.NewPair("1234567890123456789012345678901", "v").Validate(), diskerr.ErrKeyTooLarge)
+
+	b := pair.ConvertPairsToBytes(pair.NewPair("key", "value"))
+	binary.LittleEndian.PutUint16(b[2:], 500)
+	_, err := pair.ConvertBytesToPair(b)
+	assert.ErrorIs(t, err, diskerr.ErrCorrupt)
+
+	_, err = pair.ConvertBytesToPair(b[:20])
+	assert.ErrorIs(t, err, diskerr.ErrCorrupt)
+}
+
+func TestShortTimestamps(t *testing.T) {
+	b := pair.ConvertPairsToBytes(pair.NewPair("key", "value"))
+	binary.LittleEndian.PutUint16(b[4:], 8)
+	_, err := pair.ConvertBytesToPair(b)
+	assert.ErrorIs(t, err, diskerr.ErrCorrupt, "a hybrid timestamp needs 16 bytes")
+
+	b[pair.PairSize-5] = 0
+	_, err = pair.ConvertBytesToPair(b)
+	assert.NoError(t, err, "unix seconds fit in 8")
+	binary.LittleEndian.PutUint16(b[4:], 4)
+	_, err = pair.ConvertBytesToPair(b)
+	assert.ErrorIs(t, err, diskerr.ErrCorrupt, "unix seconds need 8 bytes")
+}
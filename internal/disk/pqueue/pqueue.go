@@ -1,9 +1,15 @@
 package pqueue
 
+import (
+	"container/heap"
+	"sort"
+)
+
 type QItem struct {
 	Value    string
 	Index    int
 	Priority float64
+	Vector   []float64
 }
 
 type PQueue []*QItem
@@ -34,3 +40,61 @@ func (pq *PQueue) Pop() interface{} {
 
 	return item
 }
+
+// MaxPQueue is a PQueue that pops the highest priority first
+type MaxPQueue struct {
+	PQueue
+}
+
+func (pq MaxPQueue) Less(i, j int) bool { return before(pq.PQueue[j], pq.PQueue[i]) }
+
+// before orders items by priority, then by value, so equal priorities rank the same on every run
+func before(a, b *QItem) bool {
+	if a.Priority == b.Priority {
+		return a.Value < b.Value
+	}
+	return a.Priority < b.Priority
+}
+
+// TopK keeps the k items with the lowest priority offered so far. The worst of them sits at the
+// root of a max heap, so every offer costs O(log k) and memory stays bounded by k
+type TopK struct {
+	items MaxPQueue
+	k     int
+}
+
+// NewTopK returns an empty TopK. Its heap grows as items are offered, so a large k only costs
+// memory once that many items were kept
+func NewTopK(k int) *TopK {
+	return &TopK{k: k}
+}
+
+// Offer keeps item if it is among the k best seen so far, reporting whether it was kept
+func (t *TopK) Offer(item *QItem) bool {
+	if t.k <= 0 {
+		return false
+	}
+	if t.items.Len() < t.k {
+		heap.Push(&t.items, item)
+		return true
+	}
+	if !before(item, t.items.PQueue[0]) {
+		return false
+	}
+	t.items.PQueue[0] = item
+	item.Index = 0
+	heap.Fix(&t.items, 0)
+	return true
+}
+
+func (t *TopK) Len() int {
+	return t.items.Len()
+}
+
+// Sorted returns the kept items, lowest priority first
+func (t *TopK) Sorted() []*QItem {
+	out := make([]*QItem, len(t.items.PQueue))
+	copy(out, t.items.PQueue)
+	sort.SliceStable(out, func(i, j int) bool { return before(out[i], out[j]) })
+	return out
+}
@@ -0,0 +1,48 @@
+package pqueue_test
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk/pqueue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopKKeepsLowestPriorities(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	priorities := make([]float64, 500)
+	topK := pqueue.NewTopK(10)
+	for i := range priorities {
+		priorities[i] = r.Float64()
+		topK.Offer(&pqueue.QItem{Value: strconv.Itoa(i), Priority: priorities[i]})
+	}
+	sort.Float64s(priorities)
+
+	kept := topK.Sorted()
+	assert.Len(t, kept, 10)
+	for i, item := range kept {
+		assert.Equal(t, priorities[i], item.Priority)
+	}
+}
+
+func TestTopKWithZeroCapacity(t *testing.T) {
+	topK := pqueue.NewTopK(0)
+	assert.False(t, topK.Offer(&pqueue.QItem{Value: "a", Priority: 1}))
+	assert.Equal(t, 0, topK.Len())
+}
+
+func TestTopKBreaksTiesOnValue(t *testing.T) {
+	for _, order := range [][]string{{"a", "b", "c", "d"}, {"d", "c", "b", "a"}, {"c", "a", "d", "b"}} {
+		topK := pqueue.NewTopK(2)
+		for _, value := range order {
+			topK.Offer(&pqueue.QItem{Value: value, Priority: 1})
+		}
+		kept := []string{}
+		for _, item := range topK.Sorted() {
+			kept = append(kept, item.Value)
+		}
+		assert.Equal(t, []string{"a", "b"}, kept, "offered in order %v", order)
+	}
+}
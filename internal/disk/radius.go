@@ -0,0 +1,90 @@
+package disk
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bjornaer/hermes/internal/disk/types"
+)
+
+// ResultIterator streams the results of a query as the scan finds them, so large result sets never
+// have to be held in memory. Results come in storage order, not sorted by distance.
+// Close must be called when the caller stops before Next returns false
+type ResultIterator[T comparable] struct {
+	results   chan types.SearchResult[T]
+	done      chan struct{}
+	current   types.SearchResult[T]
+	err       error
+	closeOnce sync.Once
+}
+
+// Next advances to the next result, returning false once the scan is over or failed
+func (it *ResultIterator[T]) Next() bool {
+	result, ok := <-it.results
+	if !ok {
+		return false
+	}
+	it.current = result
+	return true
+}
+
+// Result returns the result Next advanced to
+func (it *ResultIterator[T]) Result() types.SearchResult[T] {
+	return it.current
+}
+
+// Err returns the error that ended the scan, if any. Only valid after Next returned false
+func (it *ResultIterator[T]) Err() error {
+	return it.err
+}
+
+// Close stops the scan and releases its workers
+func (it *ResultIterator[T]) Close() error {
+	it.closeOnce.Do(func() {
+		close(it.done)
+	})
+	// drain so the producer can observe done and exit
+	for range it.results {
+	}
+	return nil
+}
+
+// SearchWithinRadius streams every datapoint whose normalized distance to input is at most radius.
+// The scale of the radius depends on the distance measure:
+//   - cosine: the cosine distance 1 - cos(input, v), between 0 (same direction) and 2 (opposite)
+//   - euclidean: the plain euclidean distance
+//
+// Reported distances are on that same scale
+func (ds *DiskStorage[T]) SearchWithinRadius(input []float64, radius float64) *ResultIterator[T] {
+	return ds.SearchWithinRadiusContext(context.Background(), input, radius)
+}
+
+// SearchWithinRadiusContext is SearchWithinRadius ending the scan once ctx is done, Err then
+// returning the error of ctx
+func (ds *DiskStorage[T]) SearchWithinRadiusContext(ctx context.Context, input []float64, radius float64) *ResultIterator[T] {
+	it := &ResultIterator[T]{
+		results: make(chan types.SearchResult[T], scanBatchSize),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		err := ds.scanDistances(ctx, input, func(row scoredRow) error {
+			distance := ds.distanceMeasure.Normalize(row.distance)
+			if distance > radius {
+				return nil
+			}
+			select {
+			case it.results <- types.SearchResult[T]{ID: row.key, Distance: distance, Vector: row.vector}:
+				return nil
+			case <-it.done:
+				return errScanStopped
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != errScanStopped {
+			it.err = err
+		}
+		close(it.results)
+	}()
+	return it
+}
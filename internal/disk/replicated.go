@@ -0,0 +1,299 @@
+package disk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk/bm25"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/bjornaer/hermes/internal/raft"
+)
+
+// appliedIndexKey remembers the last raft entry applied to the tree, so restarts do not replay it
+const appliedIndexKey = bm25.ReservedPrefix + "a"
+
+const defaultProposeTimeout = 5 * time.Second
+
+type commandOp string
+
+const (
+	opAdd            commandOp = "add"
+	opUpdate         commandOp = "update"
+	opCompareAndSwap commandOp = "cas"
+	opDelete         commandOp = "delete"
+)
+
+// command is a write as it travels through the replicated log. The leader stamps the time so
+// every replica stores the exact same pair
+type command struct {
+	Op        commandOp         `json:"op"`
+	ID        string            `json:"id"`
+	Embedding []float64         `json:"embedding"`
+	Payload   map[string]string `json:"payload,omitempty"`
+	Time      time.Time         `json:"time"`
+	Expected  uint32            `json:"expected,omitempty"`
+}
+
+// stateMachine applies committed commands to the local DiskStorage
+type stateMachine[T comparable] struct {
+	ds *DiskStorage[T]
+}
+
+func (sm *stateMachine[T]) Apply(index uint64, raw []byte) error {
+	var cmd command
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return fmt.Errorf("undecodable replicated command at index %d: %w", index, err)
+	}
+	dp := types.DataPoint[T]{ID: any(cmd.ID).(T), Embedding: cmd.Embedding, Payload: cmd.Payload}
+
+	ts := entryTimestamp(cmd.Time, index)
+	replayed, err := sm.replayed(cmd, ts)
+	if err != nil {
+		return err
+	}
+	switch {
+	case replayed:
+		// only the text may be missing, indexing it again is harmless
+		err = sm.ds.indexText(dp)
+	case cmd.Op == opAdd:
+		err = sm.ds.write(context.Background(), "DiskStorage.Add", dp, ts, sm.ds.storage.InsertContext)
+	case cmd.Op == opUpdate:
+		err = sm.ds.write(context.Background(), "DiskStorage.Update", dp, ts, sm.ds.storage.UpdateContext)
+	case cmd.Op == opCompareAndSwap:
+		err = sm.ds.write(context.Background(), "DiskStorage.CompareAndSwap", dp, ts, func(ctx context.Context, p *pair.Pairs) error {
+			return sm.ds.storage.CompareAndSwapContext(ctx, p, cmd.Expected)
+		})
+	case cmd.Op == opDelete:
+		err = sm.ds.Delete(cmd.ID)
+		if errors.Is(err, ErrNotFound) {
+			// a replayed delete may have stopped between the pair and its text
+			if textErr := sm.ds.text.Remove(cmd.ID); textErr != nil {
+				err = textErr
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown replicated command %q", cmd.Op)
+	}
+	// a rejected write (conflict, missing key) is still an applied entry
+	if recordErr := sm.ds.storage.Insert(pair.NewPair(appliedIndexKey, strconv.FormatUint(index, 10))); recordErr != nil {
+		return recordErr
+	}
+	return err
+}
+
+// entryTimestamp stamps the pair written by the entry at index: the wall time the leader picked,
+// with the high half of the index in the logical counter and the low half in the node. Pairs of
+// later entries order after those of earlier ones sharing their wall time
+func entryTimestamp(t time.Time, index uint64) hlc.Timestamp {
+	return hlc.Timestamp{Wall: t.UnixNano(), Logical: uint32(index >> 32), Node: uint32(index)}
+}
+
+// replayed reports whether the pair stored under the ID of cmd was written by this very entry,
+// stamped ts. The applied index is recorded after the write, so a crash in between has the entry
+// applied again on restart, which must neither bump the version again nor fail a compare and swap
+// that went through
+func (sm *stateMachine[T]) replayed(cmd command, ts hlc.Timestamp) (bool, error) {
+	if cmd.Op == opDelete {
+		return false, nil
+	}
+	_, stored, found, err := sm.ds.storage.Get(cmd.ID)
+	if err != nil || !found {
+		return false, err
+	}
+	return stored == ts, nil
+}
+
+func (sm *stateMachine[T]) AppliedIndex() uint64 {
+	v, _, found, err := sm.ds.storage.Get(appliedIndexKey)
+	if err != nil || !found {
+		return 0
+	}
+	index, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// Snapshot copies the tree file, the applied index included
+func (sm *stateMachine[T]) Snapshot(w io.Writer) error {
+	return sm.ds.storage.Snapshot(w)
+}
+
+// Restore swaps the tree for a snapshot of it. The snapshot may predate trailing no-op entries,
+// so the applied index is set to the one raft restored at
+func (sm *stateMachine[T]) Restore(index uint64, r io.Reader) error {
+	if err := sm.ds.storage.Restore(r); err != nil {
+		return err
+	}
+	return sm.ds.storage.Insert(pair.NewPair(appliedIndexKey, strconv.FormatUint(index, 10)))
+}
+
+// ReplicatedStorage is a DiskStorage whose writes only reach the tree once the Raft group committed
+// them, so every replica applies the same writes in the same order. Get and SearchByVector are
+// served from the local replica, which may lag behind; GetWithOptions and SearchByVectorWithOptions
+// pick the consistency per read and are linearizable by default
+type ReplicatedStorage[T comparable] struct {
+	local *DiskStorage[T]
+	node  *raft.Node
+	// ProposeTimeout bounds how long a write waits to be committed
+	ProposeTimeout time.Duration
+}
+
+// NewReplicatedStorage puts ds behind a raft node configured by cfg and starts it.
+// The state machine of cfg is set to ds, which snapshots its tree file, so cfg.SnapshotThreshold
+// can be set to compact the log
+func NewReplicatedStorage[T comparable](ds *DiskStorage[T], cfg raft.Config) (*ReplicatedStorage[T], error) {
+	cfg.StateMachine = &stateMachine[T]{ds: ds}
+	node, err := raft.NewNode(cfg)
+	if err != nil {
+		return nil, err
+	}
+	node.Start()
+	return &ReplicatedStorage[T]{local: ds, node: node, ProposeTimeout: defaultProposeTimeout}, nil
+}
+
+// Node exposes the raft node, to hook it to a transport or inspect its status
+func (rs *ReplicatedStorage[T]) Node() *raft.Node {
+	return rs.node
+}
+
+// Local returns the underlying storage, writing to it directly bypasses replication
+func (rs *ReplicatedStorage[T]) Local() *DiskStorage[T] {
+	return rs.local
+}
+
+// Stop halts the raft node
+func (rs *ReplicatedStorage[T]) Stop() {
+	rs.node.Stop()
+}
+
+// propose waits for cmd to be committed and applied, at most ProposeTimeout and never past ctx
+func (rs *ReplicatedStorage[T]) propose(ctx context.Context, cmd command) error {
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rs.ProposeTimeout)
+	defer cancel()
+	return rs.node.Propose(ctx, raw)
+}
+
+func (rs *ReplicatedStorage[T]) newCommand(op commandOp, dp types.DataPoint[T]) (command, error) {
+	// validate on the proposer so a bad datapoint never makes it into the log
+	if _, err := rs.local.newPair(dp, hlc.FromTime(time.Now())); err != nil {
+		return command{}, err
+	}
+	return command{Op: op, ID: any(dp.ID).(string), Embedding: dp.Embedding, Payload: dp.Payload, Time: time.Now()}, nil
+}
+
+// Add upserts the datapoint once the group committed it. Only the leader accepts writes,
+// others return a raft.NotLeaderError
+func (rs *ReplicatedStorage[T]) Add(dp types.DataPoint[T]) error {
+	return rs.AddContext(context.Background(), dp)
+}
+
+// AddContext is Add waiting for the commit until ctx is done at most. A write given up on may
+// still be committed later
+func (rs *ReplicatedStorage[T]) AddContext(ctx context.Context, dp types.DataPoint[T]) error {
+	cmd, err := rs.newCommand(opAdd, dp)
+	if err != nil {
+		return err
+	}
+	return rs.propose(ctx, cmd)
+}
+
+func (rs *ReplicatedStorage[T]) AddWithTime(dp types.DataPoint[T], t time.Time) error {
+	cmd, err := rs.newCommand(opAdd, dp)
+	if err != nil {
+		return err
+	}
+	cmd.Time = t
+	return rs.propose(context.Background(), cmd)
+}
+
+// Update replaces a stored datapoint, see DiskStorage.Update
+func (rs *ReplicatedStorage[T]) Update(dp types.DataPoint[T]) error {
+	return rs.UpdateContext(context.Background(), dp)
+}
+
+// UpdateContext is Update waiting for the commit until ctx is done at most
+func (rs *ReplicatedStorage[T]) UpdateContext(ctx context.Context, dp types.DataPoint[T]) error {
+	cmd, err := rs.newCommand(opUpdate, dp)
+	if err != nil {
+		return err
+	}
+	return rs.propose(ctx, cmd)
+}
+
+// CompareAndSwap is checked against the version at the time the command is applied, in log order
+func (rs *ReplicatedStorage[T]) CompareAndSwap(dp types.DataPoint[T], expected uint32) error {
+	return rs.CompareAndSwapContext(context.Background(), dp, expected)
+}
+
+// CompareAndSwapContext is CompareAndSwap waiting for the commit until ctx is done at most
+func (rs *ReplicatedStorage[T]) CompareAndSwapContext(ctx context.Context, dp types.DataPoint[T], expected uint32) error {
+	cmd, err := rs.newCommand(opCompareAndSwap, dp)
+	if err != nil {
+		return err
+	}
+	cmd.Expected = expected
+	return rs.propose(ctx, cmd)
+}
+
+// Delete removes a stored datapoint and its text once the group committed it, see DiskStorage.Delete
+func (rs *ReplicatedStorage[T]) Delete(id string) error {
+	return rs.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is Delete waiting for the commit until ctx is done at most
+func (rs *ReplicatedStorage[T]) DeleteContext(ctx context.Context, id string) error {
+	return rs.propose(ctx, command{Op: opDelete, ID: id, Time: time.Now()})
+}
+
+// Get is an eventual read of the local replica
+func (rs *ReplicatedStorage[T]) Get(id string) ([]float64, bool, error) {
+	return rs.local.Get(id)
+}
+
+func (rs *ReplicatedStorage[T]) Version(id string) (uint32, bool, error) {
+	return rs.local.Version(id)
+}
+
+func (rs *ReplicatedStorage[T]) AddedAt(id string) (time.Time, bool, error) {
+	return rs.local.AddedAt(id)
+}
+
+func (rs *ReplicatedStorage[T]) Each(f func(key, val string, addedAt time.Time) error) error {
+	return rs.local.Each(f)
+}
+
+// Payloads reads the local replica
+func (rs *ReplicatedStorage[T]) Payloads() (map[string]map[string]string, error) {
+	return rs.local.Payloads()
+}
+
+func (rs *ReplicatedStorage[T]) Size() int {
+	return rs.local.Size()
+}
+
+// SearchByVector is an eventual read of the local replica
+func (rs *ReplicatedStorage[T]) SearchByVector(input []float64, limit int) (*[]types.SearchResult[T], error) {
+	return rs.local.SearchByVector(input, limit)
+}
+
+func (rs *ReplicatedStorage[T]) Search(input []float64, opts SearchOptions) (*[]types.SearchResult[T], error) {
+	return rs.local.Search(input, opts)
+}
+
+// SearchContext is an eventual read of the local replica, see DiskStorage.SearchContext
+func (rs *ReplicatedStorage[T]) SearchContext(ctx context.Context, input []float64, opts SearchOptions) (*[]types.SearchResult[T], error) {
+	return rs.local.SearchContext(ctx, input, opts)
+}
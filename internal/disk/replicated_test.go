@@ -0,0 +1,294 @@
+package disk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/bm25"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/raft"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReplicatedGroup(t *testing.T, size int, configure ...func(cfg *raft.Config)) (*raft.Network, []*disk.ReplicatedStorage[string]) {
+	network := raft.NewNetwork()
+	ids := []string{}
+	for i := 0; i < size; i++ {
+		ids = append(ids, fmt.Sprintf("r%d", i))
+	}
+	group := []*disk.ReplicatedStorage[string]{}
+	for _, id := range ids {
+		ds, err := disk.NewDiskStorage[string](filepath.Join(t.TempDir(), id+".db"))
+		require.NoError(t, err)
+		logger, _ := log.NewForTest()
+		cfg := raft.Config{
+			ID:           id,
+			Peers:        ids,
+			Storage:      raft.NewMemoryStorage(),
+			Transport:    network,
+			Logger:       logger,
+			TickInterval: 5 * time.Millisecond,
+		}
+		for _, f := range configure {
+			f(&cfg)
+		}
+		rs, err := disk.NewReplicatedStorage(ds, cfg)
+		require.NoError(t, err)
+		network.Register(id, rs.Node().Step)
+		t.Cleanup(rs.Stop)
+		group = append(group, rs)
+	}
+	return network, group
+}
+
+func groupLeader(t *testing.T, group []*disk.ReplicatedStorage[string]) *disk.ReplicatedStorage[string] {
+	var leader *disk.ReplicatedStorage[string]
+	require.Eventually(t, func() bool {
+		for _, rs := range group {
+			if rs.Node().Status().State == raft.Leader {
+				leader = rs
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 5*time.Millisecond)
+	return leader
+}
+
+func TestReplicatedWritesReachEveryReplica(t *testing.T) {
+	_, group := newReplicatedGroup(t, 3)
+	leader := groupLeader(t, group)
+
+	for i := 0; i < 10; i++ {
+		dp := types.NewDataPoint(fmt.Sprintf("id-%d", i), []float64{float64(i), 1})
+		require.NoError(t, leader.Add(*dp))
+	}
+	require.NoError(t, leader.CompareAndSwap(*types.NewDataPoint("id-0", []float64{9, 9}), 1))
+	err := leader.CompareAndSwap(*types.NewDataPoint("id-0", []float64{7, 7}), 1)
+	assert.ErrorIs(t, err, disk.ErrVersionConflict, "the state machine error travels back to the proposer")
+
+	for _, rs := range group {
+		require.Eventually(t, func() bool {
+			emb, found, _ := rs.Get("id-9")
+			return found && assert.ObjectsAreEqual([]float64{9, 1}, emb)
+		}, 5*time.Second, 5*time.Millisecond)
+		emb, _, err := rs.Get("id-0")
+		require.NoError(t, err)
+		assert.Equal(t, []float64{9, 9}, emb)
+		version, _, err := rs.Version("id-0")
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), version, "replicas apply the same writes so versions agree")
+	}
+}
+
+func TestReplicatedDeletes(t *testing.T) {
+	_, group := newReplicatedGroup(t, 3)
+	leader := groupLeader(t, group)
+	require.NoError(t, leader.Add(*types.NewDataPointWithPayload("gone", []float64{1, 0}, map[string]string{"text": "red fruit"})))
+	require.NoError(t, leader.Add(*types.NewDataPoint("kept", []float64{0, 1})))
+
+	require.NoError(t, leader.Delete("gone"))
+	assert.ErrorIs(t, leader.Delete("gone"), disk.ErrNotFound, "the state machine error travels back to the proposer")
+	for _, rs := range group {
+		require.Eventually(t, func() bool {
+			_, kept, _ := rs.Get("kept")
+			_, gone, err := rs.Get("gone")
+			return err == nil && kept && !gone
+		}, 5*time.Second, 5*time.Millisecond, "every replica applies the delete")
+		results, err := rs.Local().HybridSearch([]float64{1, 0}, "red", 5, disk.HybridOptions{})
+		require.NoError(t, err)
+		for _, r := range *results {
+			assert.NotEqual(t, "gone", r.ID)
+		}
+		if rs != leader {
+			assert.ErrorIs(t, rs.Delete("kept"), raft.ErrNotLeader)
+		}
+	}
+}
+
+func TestReplicatedWritesOnlyOnLeader(t *testing.T) {
+	_, group := newReplicatedGroup(t, 3)
+	leader := groupLeader(t, group)
+	require.NoError(t, leader.Add(*types.NewDataPoint("warmup", []float64{1})))
+
+	for _, rs := range group {
+		if rs == leader {
+			continue
+		}
+		err := rs.Add(*types.NewDataPoint("follower-write", []float64{1}))
+		assert.ErrorIs(t, err, raft.ErrNotLeader)
+		_, found, _ := rs.Local().Get("follower-write")
+		assert.False(t, found)
+	}
+}
+
+func TestReplicatedLaggingReplicaReceivesTree(t *testing.T) {
+	network, group := newReplicatedGroup(t, 3, func(cfg *raft.Config) {
+		cfg.SnapshotThreshold = 10
+		cfg.SnapshotChunkSize = 1024
+	})
+	leader := groupLeader(t, group)
+	var lagging *disk.ReplicatedStorage[string]
+	for _, rs := range group {
+		if rs != leader {
+			lagging = rs
+			break
+		}
+	}
+	network.Isolate(lagging.Node().Status().ID)
+
+	for i := 0; i < 40; i++ {
+		dp := types.NewDataPoint(fmt.Sprintf("id-%d", i), []float64{float64(i), 1})
+		require.NoError(t, leader.Add(*dp))
+	}
+	require.Greater(t, leader.Node().Status().SnapshotIndex, lagging.Node().Status().LastIndex)
+
+	network.Heal()
+	require.Eventually(t, func() bool {
+		_, found, _ := lagging.Get("id-39")
+		return found
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Greater(t, lagging.Node().Status().SnapshotIndex, uint64(0), "the replica got the tree by snapshot")
+	stored := 0
+	require.NoError(t, lagging.Each(func(key, val string, addedAt time.Time) error {
+		stored++
+		return nil
+	}))
+	assert.Equal(t, 40, stored)
+
+	// the restored tree keeps taking replicated writes
+	require.NoError(t, leader.Add(*types.NewDataPoint("after", []float64{1, 2})))
+	require.Eventually(t, func() bool {
+		_, found, _ := lagging.Get("after")
+		return found
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestReplicatedReadConsistency(t *testing.T) {
+	network, group := newReplicatedGroup(t, 3)
+	leader := groupLeader(t, group)
+	require.NoError(t, leader.Add(*types.NewDataPoint("id", []float64{1, 2})))
+
+	// a linearizable read sees the write as soon as it was acknowledged
+	emb, found, err := leader.GetWithOptions("id", disk.ReadOptions{})
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []float64{1, 2}, emb)
+	results, err := leader.SearchByVectorWithOptions([]float64{1, 2}, 1, disk.ReadOptions{Consistency: disk.ReadLinearizable})
+	require.NoError(t, err)
+	require.Len(t, *results, 1)
+
+	var follower *disk.ReplicatedStorage[string]
+	for _, rs := range group {
+		if rs != leader {
+			follower = rs
+			break
+		}
+	}
+	_, _, err = follower.GetWithOptions("id", disk.ReadOptions{})
+	assert.ErrorIs(t, err, raft.ErrNotLeader, "linearizable reads are served by the leader")
+
+	bounded := disk.ReadOptions{Consistency: disk.ReadBoundedStaleness, MaxStaleness: 200 * time.Millisecond}
+	require.Eventually(t, func() bool {
+		_, found, err := follower.GetWithOptions("id", bounded)
+		return err == nil && found
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// cut off from the leader, the follower only serves eventual reads
+	network.Isolate(follower.Node().Status().ID)
+	require.Eventually(t, func() bool {
+		_, _, err := follower.GetWithOptions("id", bounded)
+		return errors.Is(err, disk.ErrStaleRead)
+	}, 5*time.Second, 5*time.Millisecond)
+	_, found, err = follower.GetWithOptions("id", disk.ReadOptions{Consistency: disk.ReadEventual})
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestReplicatedWritesHonourContext(t *testing.T) {
+	network, group := newReplicatedGroup(t, 3)
+	leader := groupLeader(t, group)
+	for i, rs := range group {
+		if rs == leader {
+			// without a quorum the write can only end through its context
+			network.Isolate(fmt.Sprintf("r%d", i))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := leader.AddContext(ctx, *types.NewDataPoint("late", []float64{1}))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), leader.ProposeTimeout, "the caller deadline wins over ProposeTimeout")
+}
+
+func TestReplicatedReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "r0.db")
+	start := func() *disk.ReplicatedStorage[string] {
+		ds, err := disk.NewDiskStorage[string](path)
+		require.NoError(t, err)
+		storage, err := raft.NewFileStorage(filepath.Join(dir, "raft"))
+		require.NoError(t, err)
+		logger, _ := log.NewForTest()
+		rs, err := disk.NewReplicatedStorage(ds, raft.Config{
+			ID:           "r0",
+			Peers:        []string{"r0"},
+			Storage:      storage,
+			Transport:    raft.NewNetwork(),
+			Logger:       logger,
+			TickInterval: 5 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		groupLeader(t, []*disk.ReplicatedStorage[string]{rs})
+		return rs
+	}
+
+	rs := start()
+	require.NoError(t, rs.Add(*types.NewDataPointWithPayload("a", []float64{1, 0}, map[string]string{"text": "red fruit"})))
+	require.NoError(t, rs.CompareAndSwap(*types.NewDataPoint("a", []float64{0, 1}), 1))
+	require.NoError(t, rs.Update(*types.NewDataPoint("a", []float64{1, 1})))
+	applied := rs.Node().Status().LastApplied
+	rs.Stop()
+	require.NoError(t, rs.Local().Close())
+
+	// a crash after the update but before its applied index was recorded
+	tree, err := btree.InitializeBtree[string](path)
+	require.NoError(t, err)
+	require.NoError(t, tree.Insert(pair.NewPair(bm25.ReservedPrefix+"a", strconv.FormatUint(applied-1, 10))))
+	require.NoError(t, tree.Close())
+
+	rs = start()
+	t.Cleanup(rs.Stop)
+	require.NoError(t, rs.Add(*types.NewDataPoint("b", []float64{1, 1})), "the replay does not stop the log")
+	emb, found, err := rs.Get("a")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, []float64{1, 1}, emb)
+	version, _, err := rs.Local().Version("a")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), version, "replayed writes do not bump the version")
+}
+
+func TestReplicatedIdenticalWritesBumpTheVersion(t *testing.T) {
+	_, group := newReplicatedGroup(t, 1)
+	leader := groupLeader(t, group)
+	at := time.Now()
+	dp := *types.NewDataPoint("same", []float64{1, 0})
+	require.NoError(t, leader.AddWithTime(dp, at))
+	require.NoError(t, leader.AddWithTime(dp, at), "the second write is an entry of its own, not a replay")
+	version, _, err := leader.Local().Version("same")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), version)
+}
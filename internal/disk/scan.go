@@ -0,0 +1,154 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk/vector"
+)
+
+// scanBatchSize is how many rows the tree walker hands to a worker at a time
+const scanBatchSize = 256
+
+var errScanStopped = errors.New("scan stopped")
+
+type rawRow struct {
+	key string
+	val string
+}
+
+type scoredRow struct {
+	key      string
+	vector   []float64
+	distance float64
+}
+
+// SetWorkers sets how many goroutines decode and score rows during brute force scans,
+// anything below 1 means one per available CPU
+func (ds *DiskStorage[T]) SetWorkers(n int) {
+	ds.workers = n
+}
+
+func (ds *DiskStorage[T]) scanWorkers() int {
+	if ds.workers < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return ds.workers
+}
+
+// scanDistances walks every datapoint once, sharding the decoding of stored vectors and the
+// distance computations across a pool of workers. emit is only ever called from the calling
+// goroutine, so it can accumulate results without locking; returning an error from it stops the scan.
+// So does ctx being done, the scan then failing with the error of ctx
+func (ds *DiskStorage[T]) scanDistances(ctx context.Context, input []float64, emit func(scoredRow) error) error {
+	workers := ds.scanWorkers()
+	queryNorm := vector.Norm(input)
+
+	batches := make(chan []rawRow, workers)
+	scored := make(chan []scoredRow, workers)
+	done := make(chan struct{})
+
+	var (
+		errMu    sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				out := make([]scoredRow, 0, len(batch))
+				for _, row := range batch {
+					emb, norm, err := decodeEmbedding(row.key, row.val)
+					if err != nil {
+						fail(err)
+						continue
+					}
+					if len(emb) != len(input) {
+						fail(&DimensionError{ID: row.key, Want: len(input), Got: len(emb)})
+						continue
+					}
+					distance := vector.CalcDistanceWithNorms(ds.distanceMeasure, emb, input, norm, queryNorm)
+					out = append(out, scoredRow{key: row.key, vector: emb, distance: distance})
+				}
+				rowsScanned.Add(float64(len(batch)))
+				distanceComputations.Add(float64(len(out)))
+				select {
+				case scored <- out:
+				case <-done:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(batches)
+		batch := make([]rawRow, 0, scanBatchSize)
+		send := func() error {
+			select {
+			case batches <- batch:
+				batch = make([]rawRow, 0, scanBatchSize)
+				return nil
+			case <-done:
+				return errScanStopped
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := ds.each(ctx, func(key, val string, addedAt time.Time) error {
+			batch = append(batch, rawRow{key: key, val: val})
+			if len(batch) == scanBatchSize {
+				return send()
+			}
+			return nil
+		})
+		if err == nil && len(batch) > 0 {
+			err = send()
+		}
+		if err != nil && err != errScanStopped {
+			fail(err)
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(scored)
+	}()
+
+	stopped := false
+	for out := range scored {
+		if stopped {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			fail(err)
+			stopped = true
+			close(done)
+			continue
+		}
+		for _, row := range out {
+			if err := emit(row); err != nil {
+				fail(err)
+				stopped = true
+				close(done)
+				break
+			}
+		}
+	}
+
+	errMu.Lock()
+	defer errMu.Unlock()
+	return firstErr
+}
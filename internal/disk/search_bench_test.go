@@ -0,0 +1,56 @@
+package disk_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/types"
+)
+
+// stored values are capped at 93 characters, so the synthetic vectors are short and rounded
+const benchVectorDims = 6
+
+func syntheticVector(r *rand.Rand) []float64 {
+	v := make([]float64, benchVectorDims)
+	for i := range v {
+		v[i] = math.Round((r.Float64()*2-1)*1000) / 1000
+	}
+	return v
+}
+
+func BenchmarkSearchByVector(b *testing.B) {
+	for _, rows := range []int{1000, 5000} {
+		r := rand.New(rand.NewSource(int64(rows)))
+		ds, err := disk.NewDiskStorage[string](filepath.Join(b.TempDir(), "bench.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < rows; i++ {
+			if err := ds.Add(*types.NewDataPoint(fmt.Sprintf("id-%d", i), syntheticVector(r))); err != nil {
+				b.Fatal(err)
+			}
+		}
+		query := syntheticVector(r)
+
+		workerCounts := []int{1}
+		if procs := runtime.GOMAXPROCS(0); procs > 1 {
+			workerCounts = append(workerCounts, procs)
+		}
+		for _, workers := range workerCounts {
+			b.Run(fmt.Sprintf("rows=%d/workers=%d", rows, workers), func(b *testing.B) {
+				ds.SetWorkers(workers)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := ds.SearchByVector(query, 10); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
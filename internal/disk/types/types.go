@@ -1,16 +1,16 @@
 package types
 
 import (
-	"time"
-
 	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/hlc"
 )
 
 // node - Interface for node
 type Node interface {
 	InsertPair(value *pair.Pairs, tree Tree) error
-	GetValue(key string) (string, time.Time, error)
-	PrintTree(level int)
+	GetValue(key string) (string, hlc.Timestamp, error)
+	GetPair(key string) (*pair.Pairs, error)
+	PrintTree(level int) error
 	Size() int
 	GetElements() []*pair.Pairs
 }
@@ -21,21 +21,27 @@ type Tree interface {
 	IsRootNode(n Node) bool
 	SetRootNode(n Node)
 	Insert(value *pair.Pairs) error
-	Get(key string) (string, time.Time, bool, error)
+	Get(key string) (string, hlc.Timestamp, bool, error)
 	Error() error
 }
 
 type DataPoint[T comparable] struct {
 	ID        T
 	Embedding []float64
+	Payload   map[string]string // only the configured text field is indexed, the payload itself is not stored
 }
 
 type SearchResult[T comparable] struct {
 	ID       string
 	Distance float64
 	Vector   []float64
+	Score    float64 // fused relevance of hybrid queries, higher is better
 }
 
 func NewDataPoint[T comparable](id T, embedding []float64) *DataPoint[T] {
-	return &DataPoint[T]{id, embedding}
+	return &DataPoint[T]{ID: id, Embedding: embedding}
+}
+
+func NewDataPointWithPayload[T comparable](id T, embedding []float64, payload map[string]string) *DataPoint[T] {
+	return &DataPoint[T]{ID: id, Embedding: embedding, Payload: payload}
 }
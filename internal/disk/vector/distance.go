@@ -4,6 +4,25 @@ import "math"
 
 type DistanceMeasure interface {
 	CalcDistance(v1, v2 []float64) float64
+	// Normalize maps a CalcDistance result onto a scale where 0 means identical and larger means
+	// farther apart. Radius queries are expressed on this scale
+	Normalize(distance float64) float64
+	// Denormalize is the inverse of Normalize, turning a radius into a CalcDistance result
+	Denormalize(distance float64) float64
+}
+
+// NormedDistanceMeasure is implemented by measures that can reuse vector norms computed ahead of time
+type NormedDistanceMeasure interface {
+	DistanceMeasure
+	CalcDistanceWithNorms(v1, v2 []float64, norm1, norm2 float64) float64
+}
+
+// CalcDistanceWithNorms uses the precomputed norms when dm knows what to do with them
+func CalcDistanceWithNorms(dm DistanceMeasure, v1, v2 []float64, norm1, norm2 float64) float64 {
+	if ndm, ok := dm.(NormedDistanceMeasure); ok {
+		return ndm.CalcDistanceWithNorms(v1, v2, norm1, norm2)
+	}
+	return dm.CalcDistance(v1, v2)
 }
 
 type cosineDistanceMeasure struct{}
@@ -17,25 +36,20 @@ func (cdm *cosineDistanceMeasure) CalcDistance(v1, v2 []float64) float64 {
 	if len(v1) != len(v2) || len(v1) == 0 {
 		return 0.0
 	}
+	return CosineDistance(v1, v2, Norm(v1), Norm(v2))
+}
 
-	dotProduct := 0.0
-	magA := 0.0
-	magB := 0.0
-
-	for i := 0; i < len(v1); i++ {
-		dotProduct += v1[i] * v2[i]
-		magA += v1[i] * v1[i]
-		magB += v2[i] * v2[i]
-	}
-
-	magA = math.Sqrt(magA)
-	magB = math.Sqrt(magB)
+func (cdm *cosineDistanceMeasure) CalcDistanceWithNorms(v1, v2 []float64, norm1, norm2 float64) float64 {
+	return CosineDistance(v1, v2, norm1, norm2)
+}
 
-	if magA == 0 || magB == 0 {
-		return 0.0
-	}
+// Normalize turns the negated cosine similarity into the cosine distance 1 - cos, which lies in [0, 2]
+func (cdm *cosineDistanceMeasure) Normalize(distance float64) float64 {
+	return 1 + distance
+}
 
-	return -dotProduct / (magA * magB)
+func (cdm *cosineDistanceMeasure) Denormalize(distance float64) float64 {
+	return distance - 1
 }
 
 type euclideanDistanceMeasure struct{}
@@ -50,12 +64,14 @@ func (cdm *euclideanDistanceMeasure) CalcDistance(v1, v2 []float64) float64 {
 		return 0.0
 	}
 
-	sum := 0.0
+	return math.Sqrt(SquaredEuclidean(v1, v2))
+}
 
-	for i := 0; i < len(v1); i++ {
-		diff := v1[i] - v2[i]
-		sum += diff * diff
-	}
+// Normalize is the identity, euclidean distances already start at 0
+func (cdm *euclideanDistanceMeasure) Normalize(distance float64) float64 {
+	return distance
+}
 
-	return math.Sqrt(sum)
+func (cdm *euclideanDistanceMeasure) Denormalize(distance float64) float64 {
+	return distance
 }
@@ -0,0 +1,70 @@
+package vector
+
+import "math"
+
+// Float is the element type the kernels are instantiated for
+type Float interface {
+	~float32 | ~float64
+}
+
+// The kernels below are unrolled by four with independent accumulators, which breaks the
+// dependency chain between iterations so the compiler can keep several multiply-adds in
+// flight and, where the target supports it, pack them into vector registers.
+
+// Dot returns the dot product of a and b, which must have the same length
+func Dot[F Float](a, b []F) F {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 F
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// SquaredNorm returns the dot product of a with itself
+func SquaredNorm[F Float](a []F) F {
+	return Dot(a, a)
+}
+
+// Norm returns the euclidean length of a
+func Norm[F Float](a []F) F {
+	return F(math.Sqrt(float64(SquaredNorm(a))))
+}
+
+// SquaredEuclidean returns the squared euclidean distance between a and b, which must have the same length
+func SquaredEuclidean[F Float](a, b []F) F {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 F
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// CosineDistance returns the negated cosine similarity of a and b given their precomputed norms,
+// matching the convention of the cosine DistanceMeasure
+func CosineDistance[F Float](a, b []F, normA, normB F) F {
+	if len(a) != len(b) || len(a) == 0 || normA == 0 || normB == 0 {
+		return 0
+	}
+	return -Dot(a, b) / (normA * normB)
+}
@@ -0,0 +1,68 @@
+package vector_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk/vector"
+)
+
+var benchDims = []int{128, 768, 1536}
+
+var sink float64
+
+func BenchmarkDot(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, dims := range benchDims {
+		x, y := randomVector(r, dims), randomVector(r, dims)
+		b.Run(fmt.Sprintf("naive/float64/%d", dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = naiveDot(x, y)
+			}
+		})
+		b.Run(fmt.Sprintf("unrolled/float64/%d", dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = vector.Dot(x, y)
+			}
+		})
+		x32, y32 := toFloat32(x), toFloat32(y)
+		b.Run(fmt.Sprintf("unrolled/float32/%d", dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = float64(vector.Dot(x32, y32))
+			}
+		})
+	}
+}
+
+func BenchmarkCosine(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	cosine := vector.NewCosineDistanceMeasure()
+	for _, dims := range benchDims {
+		x, y := randomVector(r, dims), randomVector(r, dims)
+		nx, ny := vector.Norm(x), vector.Norm(y)
+		b.Run(fmt.Sprintf("recompute-norms/%d", dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = cosine.CalcDistance(x, y)
+			}
+		})
+		b.Run(fmt.Sprintf("stored-norms/%d", dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = vector.CalcDistanceWithNorms(cosine, x, y, nx, ny)
+			}
+		})
+	}
+}
+
+func BenchmarkEuclidean(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	euclidean := vector.NewEuclideanDistanceMeasure()
+	for _, dims := range benchDims {
+		x, y := randomVector(r, dims), randomVector(r, dims)
+		b.Run(fmt.Sprint(dims), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = euclidean.CalcDistance(x, y)
+			}
+		})
+	}
+}
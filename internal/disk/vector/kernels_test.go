@@ -0,0 +1,87 @@
+package vector_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/disk/pair"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+	"github.com/stretchr/testify/assert"
+)
+
+func naiveDot(a, b []float64) float64 {
+	s := 0.0
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func TestKernelsMatchNaiveLoops(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// lengths around the unroll factor exercise the remainder loop
+	for _, dims := range []int{1, 3, 4, 7, 128, 1531} {
+		a, b := randomVector(r, dims), randomVector(r, dims)
+		assert.InDelta(t, naiveDot(a, b), vector.Dot(a, b), 1e-9)
+		assert.InDelta(t, math.Sqrt(naiveDot(a, a)), vector.Norm(a), 1e-9)
+
+		diff := make([]float64, dims)
+		for i := range a {
+			diff[i] = a[i] - b[i]
+		}
+		assert.InDelta(t, naiveDot(diff, diff), vector.SquaredEuclidean(a, b), 1e-9)
+
+		a32, b32 := toFloat32(a), toFloat32(b)
+		assert.InDelta(t, naiveDot(a, b), float64(vector.Dot(a32, b32)), 1e-2)
+	}
+}
+
+func TestCosineWithStoredNorm(t *testing.T) {
+	cosine := vector.NewCosineDistanceMeasure()
+	a, b := []float64{1, 2, 3}, []float64{-2, 0.5, 4}
+
+	emb, norm, err := vector.DecodeEmbedding(vector.EncodeEmbedding(a))
+	assert.Nil(t, err)
+	assert.Equal(t, a, emb)
+	assert.InDelta(t, cosine.CalcDistance(a, b), vector.CalcDistanceWithNorms(cosine, emb, b, norm, vector.Norm(b)), 1e-12)
+
+	// values written before norms were stored still decode
+	emb, norm, err = vector.DecodeEmbedding(vector.ConvertFloat64ArrToStr(a))
+	assert.Nil(t, err)
+	assert.Equal(t, a, emb)
+	assert.InDelta(t, vector.Norm(a), norm, 1e-12)
+}
+
+func TestNormNeverMakesEmbeddingsTooLarge(t *testing.T) {
+	// the largest embedding storable before norms were stored, 93 bytes once serialized
+	v := make([]float64, 46)
+	for i := range v {
+		v[i] = 1
+	}
+	v[45] = 10
+	assert.Len(t, vector.ConvertFloat64ArrToStr(v), pair.MaxValueLength)
+
+	encoded := vector.EncodeEmbedding(v)
+	assert.NoError(t, pair.NewPair("max", encoded).Validate())
+	emb, norm, err := vector.DecodeEmbedding(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, v, emb)
+	assert.InDelta(t, vector.Norm(v), norm, 1e-12)
+}
+
+func randomVector(r *rand.Rand, dims int) []float64 {
+	v := make([]float64, dims)
+	for i := range v {
+		v[i] = r.Float64()*2 - 1
+	}
+	return v
+}
+
+func toFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = float32(f)
+	}
+	return out
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/bjornaer/hermes/internal/disk/pair"
 	"github.com/bjornaer/hermes/internal/disk/types"
 	imath "github.com/bjornaer/hermes/internal/math"
 )
@@ -129,7 +130,40 @@ func ConvertFloat64ArrToStr(flts []float64) string {
 	return s
 }
 
+// normSeparator splits the serialized embedding from its precomputed norm
+const normSeparator = "#"
+
+// EncodeEmbedding serializes an embedding followed by its norm, so scans do not recompute it.
+// The norm is left out when it would not fit in a pair along with the embedding, so it never
+// makes an embedding too large to store; DecodeEmbedding computes it again then
+func EncodeEmbedding(flts []float64) string {
+	s := ConvertFloat64ArrToStr(flts)
+	withNorm := s + normSeparator + strconv.FormatFloat(Norm(flts), 'g', -1, 64)
+	if len(withNorm) > pair.MaxValueLength {
+		return s
+	}
+	return withNorm
+}
+
+// DecodeEmbedding parses a stored embedding and its norm, computing the norm for values written without one
+func DecodeEmbedding(s string) ([]float64, float64, error) {
+	vec, norm, hasNorm := strings.Cut(s, normSeparator)
+	embed, err := ConvertStrToEmbedding(vec)
+	if err != nil {
+		return embed, 0, err
+	}
+	if !hasNorm {
+		return embed, Norm(embed), nil
+	}
+	n, err := strconv.ParseFloat(norm, 64)
+	if err != nil {
+		return embed, 0, err
+	}
+	return embed, n, nil
+}
+
 func ConvertStrToEmbedding(s string) ([]float64, error) {
+	s, _, _ = strings.Cut(s, normSeparator)
 	spl := strings.Split(s, "$")
 	var embed []float64
 	for _, v := range spl {
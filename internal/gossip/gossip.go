@@ -0,0 +1,495 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/log"
+)
+
+const (
+	defaultTickInterval     = 50 * time.Millisecond
+	defaultProbeTick        = 10
+	defaultProbeTimeoutTick = 4
+	defaultSuspicionTick    = 40
+	defaultIndirectChecks   = 3
+	defaultRetransmitMult   = 4
+	defaultMaxPiggyback     = 8
+	inboxSize               = 1024
+)
+
+// Config configures a Node, zero values fall back to sane defaults
+type Config struct {
+	ID   string
+	Addr string
+	// Seeds are IDs of members to contact first, the rest of the cluster is learned from them
+	Seeds     []string
+	Transport Transport
+	Logger    log.Logger
+	// OnChange is called, from the node goroutine, every time the state of a member changes
+	OnChange func(Member)
+
+	TickInterval time.Duration
+	// ProbeTick is the number of ticks between two probes, every probe targets one member
+	ProbeTick int
+	// ProbeTimeoutTick is how long a direct ping waits for its ack before asking
+	// IndirectChecks other members to ping the target too
+	ProbeTimeoutTick int
+	IndirectChecks   int
+	// SuspicionTick is how long a suspect member has to refute the suspicion before it is declared dead
+	SuspicionTick int
+	// ReconnectTick is the number of ticks between two pings to a random dead member, so both
+	// sides of a healed partition find each other again. Defaults to SuspicionTick
+	ReconnectTick int
+	// RetransmitMult scales how many times an update is piggybacked, RetransmitMult*log10(n+1) times
+	RetransmitMult int
+	MaxPiggyback   int
+}
+
+type member struct {
+	Member
+	suspectedAt int
+}
+
+type probe struct {
+	target   string
+	seq      uint64
+	start    int
+	indirect bool
+	acked    bool
+}
+
+// relay is a ping sent on behalf of another member, its ack is forwarded back to the requester
+type relay struct {
+	requester string
+	seq       uint64
+	expires   int
+}
+
+type broadcast struct {
+	update    Update
+	transmits int
+}
+
+// Node runs the SWIM failure detector and disseminates membership by piggybacking updates on
+// its probes. Like the raft node, its state is owned by a single goroutine
+type Node struct {
+	cfg    Config
+	logger log.Logger
+
+	members    map[string]*member
+	order      []string
+	orderIndex int
+	probe      *probe
+	lastProbe  int
+	lastDead   int
+	relays     map[uint64]relay
+	broadcasts []*broadcast
+	seq        uint64
+	ticks      int
+	rand       *rand.Rand
+
+	msgc     chan Message
+	stopc    chan struct{}
+	donec    chan struct{}
+	once     sync.Once
+	mu       sync.RWMutex
+	snapshot []Member
+}
+
+// New creates a node that considers itself alive and its seeds alive until probed
+func New(cfg Config) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("gossip: node needs an ID")
+	}
+	if cfg.Transport == nil {
+		return nil, errors.New("gossip: transport is required")
+	}
+	if cfg.TickInterval <= 0 {
+		cfg.TickInterval = defaultTickInterval
+	}
+	if cfg.ProbeTick <= 0 {
+		cfg.ProbeTick = defaultProbeTick
+	}
+	if cfg.ProbeTimeoutTick <= 0 || cfg.ProbeTimeoutTick >= cfg.ProbeTick {
+		cfg.ProbeTimeoutTick = max(cfg.ProbeTick/2, 1)
+	}
+	if cfg.IndirectChecks <= 0 {
+		cfg.IndirectChecks = defaultIndirectChecks
+	}
+	if cfg.SuspicionTick <= 0 {
+		cfg.SuspicionTick = defaultSuspicionTick
+	}
+	if cfg.ReconnectTick <= 0 {
+		cfg.ReconnectTick = cfg.SuspicionTick
+	}
+	if cfg.RetransmitMult <= 0 {
+		cfg.RetransmitMult = defaultRetransmitMult
+	}
+	if cfg.MaxPiggyback <= 0 {
+		cfg.MaxPiggyback = defaultMaxPiggyback
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New()
+	}
+
+	n := &Node{
+		cfg:     cfg,
+		logger:  cfg.Logger.With(context.Background(), "gossip_node", cfg.ID),
+		members: map[string]*member{},
+		relays:  map[uint64]relay{},
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano() + int64(len(cfg.ID)))),
+		msgc:    make(chan Message, inboxSize),
+		stopc:   make(chan struct{}),
+		donec:   make(chan struct{}),
+	}
+	self := &member{Member: Member{ID: cfg.ID, Addr: cfg.Addr, State: StateAlive, Since: time.Now()}}
+	n.members[cfg.ID] = self
+	n.enqueue(n.updateOf(self))
+	for _, seed := range cfg.Seeds {
+		if seed != cfg.ID {
+			n.members[seed] = &member{Member: Member{ID: seed, State: StateAlive, Since: time.Now()}}
+		}
+	}
+	n.publish()
+	return n, nil
+}
+
+// Start runs the node until Stop is called
+func (n *Node) Start() {
+	go n.run()
+}
+
+// Stop halts the node, the others will find out it is gone
+func (n *Node) Stop() {
+	n.once.Do(func() {
+		close(n.stopc)
+	})
+	<-n.donec
+}
+
+// Step hands a message received from the network to the node, dropping it if the inbox is full
+func (n *Node) Step(msg Message) {
+	select {
+	case n.msgc <- msg:
+	default:
+	}
+}
+
+// Members returns every known member, the local node included, sorted by ID
+func (n *Node) Members() []Member {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return append([]Member{}, n.snapshot...)
+}
+
+// Member returns what the node knows about id
+func (n *Node) Member(id string) (Member, bool) {
+	for _, m := range n.Members() {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// Alive returns the members not known to be dead, including suspects
+func (n *Node) Alive() []Member {
+	alive := []Member{}
+	for _, m := range n.Members() {
+		if m.State != StateDead {
+			alive = append(alive, m)
+		}
+	}
+	return alive
+}
+
+func (n *Node) run() {
+	defer close(n.donec)
+	ticker := time.NewTicker(n.cfg.TickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.tick()
+		case m := <-n.msgc:
+			n.step(m)
+		case <-n.stopc:
+			return
+		}
+		n.publish()
+	}
+}
+
+func (n *Node) publish() {
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		members = append(members, m.Member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.snapshot = members
+}
+
+func (n *Node) tick() {
+	n.ticks++
+	if p := n.probe; p != nil && !p.acked {
+		elapsed := n.ticks - p.start
+		if elapsed >= n.cfg.ProbeTick {
+			n.probeFailed(p.target)
+			n.probe = nil
+		} else if elapsed >= n.cfg.ProbeTimeoutTick && !p.indirect {
+			n.probeIndirectly(p)
+		}
+	}
+	if n.ticks-n.lastProbe >= n.cfg.ProbeTick {
+		n.startProbe()
+	}
+	if n.ticks-n.lastDead >= n.cfg.ReconnectTick {
+		n.pingDead()
+	}
+
+	for _, m := range n.members {
+		if m.State == StateSuspect && n.ticks-m.suspectedAt >= n.cfg.SuspicionTick {
+			n.setState(m, StateDead, m.Incarnation)
+			n.enqueue(n.updateOf(m))
+		}
+	}
+	for seq, r := range n.relays {
+		if n.ticks >= r.expires {
+			delete(n.relays, seq)
+		}
+	}
+}
+
+// nextTarget walks the members in a random order, reshuffled after each round, so every member
+// gets probed within a bounded time
+func (n *Node) nextTarget() (string, bool) {
+	for attempts := 0; attempts < 2; attempts++ {
+		for n.orderIndex < len(n.order) {
+			id := n.order[n.orderIndex]
+			n.orderIndex++
+			if m, ok := n.members[id]; ok && m.State != StateDead && id != n.cfg.ID {
+				return id, true
+			}
+		}
+		n.order = n.order[:0]
+		for id := range n.members {
+			n.order = append(n.order, id)
+		}
+		n.rand.Shuffle(len(n.order), func(i, j int) { n.order[i], n.order[j] = n.order[j], n.order[i] })
+		n.orderIndex = 0
+	}
+	return "", false
+}
+
+func (n *Node) startProbe() {
+	n.lastProbe = n.ticks
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+	n.seq++
+	n.probe = &probe{target: target, seq: n.seq, start: n.ticks}
+	n.send(Message{Type: MsgPing, To: target, Seq: n.seq})
+}
+
+// pingDead pings a random dead member. Its answer carries its refutation if it is still around
+func (n *Node) pingDead() {
+	n.lastDead = n.ticks
+	dead := []string{}
+	for id, m := range n.members {
+		if m.State == StateDead {
+			dead = append(dead, id)
+		}
+	}
+	if len(dead) == 0 {
+		return
+	}
+	sort.Strings(dead)
+	n.seq++
+	n.send(Message{Type: MsgPing, To: dead[n.rand.Intn(len(dead))], Seq: n.seq})
+}
+
+func (n *Node) probeIndirectly(p *probe) {
+	p.indirect = true
+	helpers := []string{}
+	for id, m := range n.members {
+		if id != n.cfg.ID && id != p.target && m.State == StateAlive {
+			helpers = append(helpers, id)
+		}
+	}
+	n.rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	for _, helper := range helpers[:min(len(helpers), n.cfg.IndirectChecks)] {
+		n.send(Message{Type: MsgPingReq, To: helper, Seq: p.seq, Target: p.target})
+	}
+}
+
+func (n *Node) probeFailed(target string) {
+	m, ok := n.members[target]
+	if !ok || m.State != StateAlive {
+		return
+	}
+	n.logger.Infof("suspecting %s, no ack within the probe interval", target)
+	n.setState(m, StateSuspect, m.Incarnation)
+	n.enqueue(n.updateOf(m))
+}
+
+func (n *Node) step(m Message) {
+	for _, u := range m.Updates {
+		n.apply(u)
+	}
+	if _, known := n.members[m.From]; !known && m.From != "" {
+		// a node joining through us, its own alive update is on its way
+		n.apply(Update{ID: m.From, State: StateAlive})
+	}
+
+	switch m.Type {
+	case MsgPing:
+		n.send(Message{Type: MsgAck, To: m.From, Seq: m.Seq, Target: n.cfg.ID})
+	case MsgPingReq:
+		n.seq++
+		n.relays[n.seq] = relay{requester: m.From, seq: m.Seq, expires: n.ticks + n.cfg.ProbeTick}
+		n.send(Message{Type: MsgPing, To: m.Target, Seq: n.seq})
+	case MsgAck:
+		if r, ok := n.relays[m.Seq]; ok {
+			delete(n.relays, m.Seq)
+			n.send(Message{Type: MsgAck, To: r.requester, Seq: r.seq, Target: m.From})
+			return
+		}
+		if p := n.probe; p != nil && p.seq == m.Seq && p.target == m.Target {
+			p.acked = true
+		}
+	}
+}
+
+// apply merges a piece of gossip, following the SWIM precedence rules: a higher incarnation
+// wins, and for the same incarnation dead overrides suspect which overrides alive
+func (n *Node) apply(u Update) {
+	if u.ID == n.cfg.ID {
+		n.refute(u)
+		return
+	}
+	m, known := n.members[u.ID]
+	switch u.State {
+	case StateAlive:
+		if known && u.Incarnation <= m.Incarnation {
+			if m.Addr == "" {
+				// seeds are only known by ID until they gossip about themselves
+				m.Addr = u.Addr
+			}
+			return
+		}
+		if !known {
+			m = &member{Member: Member{ID: u.ID}}
+			n.members[u.ID] = m
+			m.State = StateDead // so setState reports the member as joining
+		}
+		if u.Addr != "" {
+			m.Addr = u.Addr
+		}
+		n.setState(m, StateAlive, u.Incarnation)
+	case StateSuspect:
+		if !known || m.State == StateDead || u.Incarnation < m.Incarnation {
+			return
+		}
+		if m.State == StateSuspect && u.Incarnation == m.Incarnation {
+			return
+		}
+		n.setState(m, StateSuspect, u.Incarnation)
+	case StateDead:
+		if !known || m.State == StateDead || u.Incarnation < m.Incarnation {
+			return
+		}
+		n.setState(m, StateDead, u.Incarnation)
+	default:
+		return
+	}
+	n.enqueue(n.updateOf(m))
+}
+
+// refute answers gossip claiming the local node is suspect or dead by outbidding its incarnation
+func (n *Node) refute(u Update) {
+	self := n.members[n.cfg.ID]
+	if u.State == StateAlive || u.Incarnation < self.Incarnation {
+		return
+	}
+	self.Incarnation = u.Incarnation + 1
+	n.logger.Infof("refuting %s gossip about us with incarnation %d", u.State, self.Incarnation)
+	n.enqueue(n.updateOf(self))
+}
+
+func (n *Node) setState(m *member, state MemberState, incarnation uint64) {
+	changed := m.State != state
+	m.Incarnation = incarnation
+	if !changed {
+		return
+	}
+	m.State = state
+	m.Since = time.Now()
+	if state == StateSuspect {
+		m.suspectedAt = n.ticks
+	}
+	if state == StateDead {
+		n.logger.Infof("%s is dead", m.ID)
+	}
+	if n.cfg.OnChange != nil {
+		n.cfg.OnChange(m.Member)
+	}
+}
+
+func (n *Node) updateOf(m *member) Update {
+	return Update{ID: m.ID, Addr: m.Addr, State: m.State, Incarnation: m.Incarnation}
+}
+
+// enqueue schedules an update for dissemination, replacing older gossip about the same member
+func (n *Node) enqueue(u Update) {
+	for i, b := range n.broadcasts {
+		if b.update.ID == u.ID {
+			n.broadcasts = append(n.broadcasts[:i], n.broadcasts[i+1:]...)
+			break
+		}
+	}
+	n.broadcasts = append(n.broadcasts, &broadcast{update: u})
+}
+
+// piggyback picks the least sent updates and drops the ones sent often enough to have reached
+// everyone with high probability
+func (n *Node) piggyback() []Update {
+	if len(n.broadcasts) == 0 {
+		return nil
+	}
+	limit := n.cfg.RetransmitMult * int(math.Ceil(math.Log10(float64(len(n.members)+1))))
+	sort.SliceStable(n.broadcasts, func(i, j int) bool {
+		return n.broadcasts[i].transmits < n.broadcasts[j].transmits
+	})
+	updates := []Update{}
+	kept := n.broadcasts[:0]
+	for _, b := range n.broadcasts {
+		if len(updates) < n.cfg.MaxPiggyback {
+			updates = append(updates, b.update)
+			b.transmits++
+		}
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	n.broadcasts = kept
+	return updates
+}
+
+func (n *Node) send(m Message) {
+	m.From = n.cfg.ID
+	m.Updates = n.piggyback()
+	if to, ok := n.members[m.To]; ok && to.State == StateDead {
+		// tell a member we buried, if it is still around it refutes with a higher incarnation
+		m.Updates = append(m.Updates, n.updateOf(to))
+	}
+	n.cfg.Transport.Send(m)
+}
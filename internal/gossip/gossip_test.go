@@ -0,0 +1,180 @@
+package gossip_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCluster struct {
+	t       *testing.T
+	network *gossip.Network
+	nodes   map[string]*gossip.Node
+}
+
+// newTestCluster starts size nodes that only know about the first one
+func newTestCluster(t *testing.T, size int) *testCluster {
+	c := &testCluster{t: t, network: gossip.NewNetwork(), nodes: map[string]*gossip.Node{}}
+	for i := 0; i < size; i++ {
+		c.start(fmt.Sprintf("g%d", i))
+	}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.Stop()
+		}
+	})
+	return c
+}
+
+func (c *testCluster) start(id string) {
+	logger, _ := log.NewForTest()
+	n, err := gossip.New(gossip.Config{
+		ID:            id,
+		Addr:          "mem://" + id,
+		Seeds:         []string{"g0"},
+		Transport:     c.network,
+		Logger:        logger,
+		TickInterval:  2 * time.Millisecond,
+		ProbeTick:     5,
+		SuspicionTick: 30,
+	})
+	require.NoError(c.t, err)
+	c.network.Register(id, n.Step)
+	c.nodes[id] = n
+	n.Start()
+}
+
+// waitState waits until every node in observers sees id in state
+func (c *testCluster) waitState(id string, state gossip.MemberState, observers ...string) {
+	for _, observer := range observers {
+		require.Eventually(c.t, func() bool {
+			m, ok := c.nodes[observer].Member(id)
+			return ok && m.State == state
+		}, 5*time.Second, 5*time.Millisecond, "%s never saw %s %s", observer, id, state)
+	}
+}
+
+func (c *testCluster) others(id string) []string {
+	ids := []string{}
+	for other := range c.nodes {
+		if other != id {
+			ids = append(ids, other)
+		}
+	}
+	return ids
+}
+
+func TestMembersDiscoverEachOther(t *testing.T) {
+	c := newTestCluster(t, 5)
+	for id := range c.nodes {
+		require.Eventually(t, func() bool {
+			return len(c.nodes[id].Alive()) == 5
+		}, 5*time.Second, 5*time.Millisecond, "%s did not learn every member", id)
+	}
+	m, ok := c.nodes["g3"].Member("g0")
+	require.True(t, ok)
+	assert.Equal(t, "mem://g0", m.Addr, "seeds are learned by address once they gossip")
+}
+
+func TestCrashedMemberIsDeclaredDead(t *testing.T) {
+	c := newTestCluster(t, 5)
+	c.waitState("g4", gossip.StateAlive, c.others("g4")...)
+
+	c.network.Unregister("g4")
+	c.nodes["g4"].Stop()
+	delete(c.nodes, "g4")
+	c.waitState("g4", gossip.StateDead, c.others("g4")...)
+	for id := range c.nodes {
+		assert.Len(t, c.nodes[id].Alive(), 4)
+	}
+}
+
+func TestSuspectRefutes(t *testing.T) {
+	c := newTestCluster(t, 4)
+	c.waitState("g3", gossip.StateAlive, c.others("g3")...)
+
+	// cut off long enough to be suspected but not buried
+	c.network.Isolate("g3")
+	c.waitState("g3", gossip.StateSuspect, "g0")
+	c.network.Heal()
+	c.waitState("g3", gossip.StateAlive, c.others("g3")...)
+	m, _ := c.nodes["g0"].Member("g3")
+	assert.Greater(t, m.Incarnation, uint64(0), "g3 refuted with a higher incarnation")
+}
+
+func TestNoFalsePositivesUnderLoss(t *testing.T) {
+	c := newTestCluster(t, 5)
+	for id := range c.nodes {
+		require.Eventually(t, func() bool {
+			return len(c.nodes[id].Alive()) == 5
+		}, 5*time.Second, 5*time.Millisecond)
+	}
+
+	// indirect probes get around lost pings
+	c.network.SetLossRate(0.1)
+	time.Sleep(300 * time.Millisecond)
+	c.network.SetLossRate(0)
+	for id := range c.nodes {
+		assert.Len(t, c.nodes[id].Alive(), 5, "%s declared a live member dead", id)
+	}
+}
+
+func TestDeadMemberRejoins(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.waitState("g2", gossip.StateAlive, c.others("g2")...)
+	c.network.Isolate("g2")
+	c.waitState("g2", gossip.StateDead, "g0", "g1")
+
+	c.network.Heal()
+	c.waitState("g2", gossip.StateAlive, "g0", "g1")
+}
+
+func TestGossipOverHTTP(t *testing.T) {
+	servers := []*httptest.Server{}
+	nodes := []*gossip.Node{}
+	for i := 0; i < 3; i++ {
+		mux := http.NewServeMux()
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+		logger, _ := log.NewForTest()
+		tr := gossip.NewHTTPTransport(logger)
+		t.Cleanup(tr.Close)
+		seed := srv.URL
+		if i > 0 {
+			seed = servers[0].URL
+		}
+		n, err := gossip.New(gossip.Config{
+			ID:            srv.URL,
+			Addr:          srv.URL,
+			Seeds:         []string{seed},
+			Transport:     tr,
+			Logger:        logger,
+			TickInterval:  2 * time.Millisecond,
+			ProbeTick:     5,
+			SuspicionTick: 30,
+		})
+		require.NoError(t, err)
+		mux.Handle("POST "+gossip.HTTPPath, gossip.Handler(n))
+		n.Start()
+		t.Cleanup(n.Stop)
+		servers = append(servers, srv)
+		nodes = append(nodes, n)
+	}
+
+	for _, n := range nodes {
+		require.Eventually(t, func() bool { return len(n.Alive()) == 3 }, 5*time.Second, 5*time.Millisecond)
+	}
+	nodes[2].Stop()
+	servers[2].Close()
+	require.Eventually(t, func() bool {
+		m, ok := nodes[0].Member(servers[2].URL)
+		return ok && m.State == gossip.StateDead
+	}, 5*time.Second, 5*time.Millisecond)
+}
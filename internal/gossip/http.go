@@ -0,0 +1,29 @@
+package gossip
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/transport"
+)
+
+// HTTPPath is where nodes gossiping over HTTP receive messages, below their address
+const HTTPPath = "/gossip"
+
+// NewHTTPTransport returns a Transport posting every message to the HTTPPath of its destination.
+// Nodes gossiping over HTTP go by their address, such as http://10.0.0.2:8080, so their IDs and
+// seeds are addresses too
+func NewHTTPTransport(logger log.Logger) *transport.HTTP[Message] {
+	return transport.NewHTTP(transport.HTTPConfig[Message]{
+		URLOf: func(msg Message) (string, bool) {
+			return strings.TrimSuffix(msg.To, "/") + HTTPPath, msg.To != ""
+		},
+		Logger: logger,
+	})
+}
+
+// Handler hands the messages posted to it to n
+func Handler(n *Node) http.Handler {
+	return transport.Handler(n.Step)
+}
@@ -0,0 +1,82 @@
+package gossip
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Transport delivers messages to other nodes. Send must not block, lost messages only delay detection
+type Transport interface {
+	Send(msg Message)
+}
+
+// Network is an in process Transport, used to run several nodes in one program and to test
+// failure detection with crashed nodes, cut links and lost messages
+type Network struct {
+	mu       sync.Mutex
+	nodes    map[string]func(Message)
+	blocked  map[[2]string]bool
+	lossRate float64
+	rand     *rand.Rand
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		nodes:   map[string]func(Message){},
+		blocked: map[[2]string]bool{},
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Register routes messages addressed to id into deliver, typically a Node's Step
+func (nw *Network) Register(id string, deliver func(Message)) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.nodes[id] = deliver
+}
+
+// Unregister stops delivering messages to id, as if it crashed
+func (nw *Network) Unregister(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	delete(nw.nodes, id)
+}
+
+// SetLossRate makes the network drop each message with probability p
+func (nw *Network) SetLossRate(p float64) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.lossRate = p
+}
+
+// Isolate cuts id off from every other registered node
+func (nw *Network) Isolate(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	for other := range nw.nodes {
+		if other != id {
+			nw.blocked[[2]string{id, other}] = true
+			nw.blocked[[2]string{other, id}] = true
+		}
+	}
+}
+
+// Heal restores every link
+func (nw *Network) Heal() {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.blocked = map[[2]string]bool{}
+}
+
+// Send delivers msg unless the link is cut or the message is lost
+func (nw *Network) Send(msg Message) {
+	nw.mu.Lock()
+	deliver, ok := nw.nodes[msg.To]
+	drop := !ok || nw.blocked[[2]string{msg.From, msg.To}] ||
+		(nw.lossRate > 0 && nw.rand.Float64() < nw.lossRate)
+	nw.mu.Unlock()
+	if !drop {
+		deliver(msg)
+	}
+}
@@ -0,0 +1,84 @@
+package gossip
+
+import (
+	"fmt"
+	"time"
+)
+
+// MemberState is what a node believes about another member
+type MemberState int
+
+const (
+	// StateAlive members answered a probe, or gossip says they did
+	StateAlive MemberState = iota
+	// StateSuspect members missed a probe. They are declared dead unless they refute the
+	// suspicion, by gossiping a higher incarnation, before the suspicion timeout
+	StateSuspect
+	// StateDead members stay listed so their death keeps spreading and stale gossip about them
+	// is ignored, until they come back with a higher incarnation
+	StateDead
+)
+
+func (s MemberState) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// Member is a node of the cluster as seen by the local node
+type Member struct {
+	ID   string
+	Addr string
+	// Incarnation is only ever increased by the member itself, to refute suspicions about it
+	Incarnation uint64
+	State       MemberState
+	// Since is when the local node last saw the state change
+	Since time.Time
+}
+
+// MessageType identifies the SWIM message a Message carries
+type MessageType int
+
+const (
+	MsgPing MessageType = iota
+	MsgAck
+	// MsgPingReq asks the receiver to probe Target on behalf of the sender
+	MsgPingReq
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgPing:
+		return "Ping"
+	case MsgAck:
+		return "Ack"
+	case MsgPingReq:
+		return "PingReq"
+	}
+	return fmt.Sprintf("message(%d)", int(t))
+}
+
+// Message is the envelope of every exchange between nodes. Every message piggybacks a few
+// membership updates, which is how they spread through the cluster
+type Message struct {
+	Type    MessageType
+	From    string
+	To      string
+	Seq     uint64
+	Target  string
+	Updates []Update
+}
+
+// Update is a piece of gossip about a member
+type Update struct {
+	ID          string
+	Addr        string
+	State       MemberState
+	Incarnation uint64
+}
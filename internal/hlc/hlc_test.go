@@ -0,0 +1,59 @@
+package hlc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/hlc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTime is a wall clock the test moves by hand
+type fakeTime struct {
+	now time.Time
+}
+
+func (f *fakeTime) read() time.Time {
+	return f.now
+}
+
+func TestNowNeverGoesBackwards(t *testing.T) {
+	wall := &fakeTime{now: time.Unix(100, 0)}
+	c := hlc.NewClock("a", wall.read)
+	first := c.Now()
+	second := c.Now()
+	assert.True(t, second.After(first), "same wall time bumps the logical counter")
+	assert.Equal(t, uint32(1), second.Logical)
+
+	wall.now = time.Unix(90, 0)
+	third := c.Now()
+	assert.True(t, third.After(second), "a clock stepping back does not reorder writes")
+
+	wall.now = time.Unix(200, 0)
+	fourth := c.Now()
+	assert.Equal(t, time.Unix(200, 0), fourth.Time())
+	assert.Zero(t, fourth.Logical)
+}
+
+func TestUpdateOrdersAfterRemoteTimestamps(t *testing.T) {
+	// b runs a minute behind a
+	a := hlc.NewClock("a", func() time.Time { return time.Unix(160, 0) })
+	b := hlc.NewClock("b", func() time.Time { return time.Unix(100, 0) })
+
+	written := a.Now()
+	assert.True(t, b.Now().Before(written))
+	b.Update(written)
+	overwrite := b.Now()
+	assert.True(t, overwrite.After(written), "a write made after seeing another is ordered after it")
+	assert.Equal(t, b.Node(), overwrite.Node)
+}
+
+func TestNodeBreaksTies(t *testing.T) {
+	x := hlc.Timestamp{Wall: 5, Logical: 1, Node: hlc.NodeID("a")}
+	y := hlc.Timestamp{Wall: 5, Logical: 1, Node: hlc.NodeID("b")}
+	assert.NotZero(t, x.Compare(y))
+	assert.Equal(t, -x.Compare(y), y.Compare(x))
+	assert.Zero(t, x.Compare(x))
+	assert.True(t, hlc.FromTime(time.Time{}).IsZero())
+	assert.True(t, hlc.Timestamp{}.Time().IsZero())
+}
@@ -2,7 +2,9 @@ package log
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/bjornaer/hermes/internal/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
@@ -36,6 +38,49 @@ func New() Logger {
 	return NewWithZap(l)
 }
 
+// Config selects how a logger built by NewFromConfig writes
+type Config struct {
+	// Level is the lowest level written: debug, info, warn or error. info when empty
+	Level string
+	// Format is json or console, json when empty
+	Format string
+	// Development turns on stack traces from warnings up and panics on DPanic
+	Development bool
+}
+
+// NewFromConfig returns a logger writing to stderr as cfg describes
+func NewFromConfig(cfg Config) (Logger, error) {
+	zc := zap.NewProductionConfig()
+	if cfg.Development {
+		zc = zap.NewDevelopmentConfig()
+	}
+	if cfg.Level != "" {
+		level, err := zapcore.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		zc.Level = zap.NewAtomicLevelAt(level)
+	}
+	switch cfg.Format {
+	case "":
+		zc.Encoding = "json"
+	case "json", "console":
+		zc.Encoding = cfg.Format
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want json or console", cfg.Format)
+	}
+	if zc.Encoding == "json" {
+		zc.EncoderConfig = zap.NewProductionEncoderConfig()
+	} else {
+		zc.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+	l, err := zc.Build()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithZap(l), nil
+}
+
 func NewWithZap(l *zap.Logger) Logger {
 	return &logger{l.Sugar()}
 }
@@ -55,6 +100,10 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 		if id, ok := ctx.Value(correlationIDKey).(string); ok {
 			args = append(args, zap.String("correlation_id", id))
 		}
+
+		if sc := trace.SpanContextFrom(ctx); sc.IsValid() {
+			args = append(args, zap.String("trace_id", sc.TraceID.String()), zap.String("span_id", sc.SpanID.String()))
+		}
 	}
 
 	if len(args) > 0 {
@@ -63,3 +112,26 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 
 	return l
 }
+
+// WithRequestID returns a copy of ctx carrying the ID of the request being served, logged as request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// WithCorrelationID returns a copy of ctx carrying the ID tying together the requests made on behalf
+// of the same operation, logged as correlation_id
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// CorrelationID returns the correlation ID carried by ctx, empty if there is none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
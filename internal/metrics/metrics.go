@@ -0,0 +1,219 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the Prometheus text
+// exposition format. Instrumented packages declare their metrics as package variables registered in
+// Default, which the server exposes at /metrics
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefBuckets are histogram upper bounds in seconds, from 100µs to 10s, suited to request latencies
+var DefBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter is a value that only goes up
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Inc adds 1 to the counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative, to the counter
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value returns the current count
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Gauge is a value that goes up and down, or is read from a function when collected
+type Gauge struct {
+	bits atomic.Uint64
+	fn   func() float64
+}
+
+// Set replaces the value of the gauge
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds v, which may be negative, to the gauge
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	if g.fn != nil {
+		return g.fn()
+	}
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts observations in buckets of increasing upper bounds
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upper: buckets, counts: make([]atomic.Uint64, len(buckets))}
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	addFloat(&h.sum, v)
+	h.count.Add(1)
+}
+
+// Since records the seconds elapsed since start
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of the observations
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sum.Load())
+}
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// vec holds the series of a metric, one per combination of label values
+type vec[S any] struct {
+	labels []string
+	newS   func() *S
+	mu     sync.RWMutex
+	series map[string]*S
+	values map[string][]string
+}
+
+func newVec[S any](labels []string, newS func() *S) *vec[S] {
+	return &vec[S]{labels: labels, newS: newS, series: map[string]*S{}, values: map[string][]string{}}
+}
+
+func (v *vec[S]) with(values []string) *S {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %v", len(values), v.labels))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = v.newS()
+		v.series[key] = s
+		v.values[key] = append([]string{}, values...)
+	}
+	return s
+}
+
+func (v *vec[S]) set(values []string, s *S) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.series[key] = s
+	v.values[key] = append([]string{}, values...)
+}
+
+func (v *vec[S]) delete(values []string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.series, key)
+	delete(v.values, key)
+}
+
+// each calls f for every series, sorted by label values
+func (v *vec[S]) each(f func(values []string, s *S)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*S, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		series[i], values[i] = v.series[key], v.values[key]
+	}
+	v.mu.RUnlock()
+	for i := range keys {
+		f(values[i], series[i])
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// With returns the counter of the given label values, in the order the labels were declared
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values)
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// With returns the gauge of the given label values, in the order the labels were declared
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values)
+}
+
+// Func makes the series of the given label values report what fn returns when collected
+func (v *GaugeVec) Func(fn func() float64, values ...string) {
+	v.set(values, &Gauge{fn: fn})
+}
+
+// Delete drops the series of the given label values, for instance once what it measured is gone
+func (v *GaugeVec) Delete(values ...string) {
+	v.delete(values)
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// With returns the histogram of the given label values, in the order the labels were declared
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values)
+}
@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func text(t *testing.T, r *metrics.Registry) string {
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	return buf.String()
+}
+
+func TestTextFormat(t *testing.T) {
+	r := metrics.NewRegistry()
+	reads := r.Counter("reads_total", "Blocks read.")
+	requests := r.CounterVec("requests_total", "Requests served.", "method", "code")
+	depth := r.GaugeVec("depth", "Tree depth.", "file")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1})
+
+	reads.Add(3)
+	requests.With("GET", "200").Inc()
+	requests.With("GET", "200").Inc()
+	requests.With("PUT", "400").Inc()
+	depth.With(`a "quoted\path"`).Set(2)
+	depth.Func(func() float64 { return 4 }, "b.db")
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(0.5)
+	latency.Observe(7)
+
+	assert.Equal(t, `# HELP depth Tree depth.
+# TYPE depth gauge
+depth{file="a \"quoted\\path\""} 2
+depth{file="b.db"} 4
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 7.65
+latency_seconds_count 4
+# HELP reads_total Blocks read.
+# TYPE reads_total counter
+reads_total 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 2
+requests_total{method="PUT",code="400"} 1
+`, text(t, r))
+
+	depth.Delete("b.db")
+	assert.NotContains(t, text(t, r), "b.db")
+}
+
+func TestRegistrationMistakesPanic(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("once_total", "")
+	assert.Panics(t, func() { r.Counter("once_total", "") })
+	assert.Panics(t, func() { r.Counter("bad-name", "") })
+	assert.Panics(t, func() { r.CounterVec("labels_total", "", "le") })
+	assert.Panics(t, func() { r.Histogram("unsorted", "", []float64{1, 0.5}) })
+	assert.Panics(t, func() { r.CounterVec("arity_total", "", "a").With("x", "y") })
+	assert.Panics(t, func() { r.Counter("down_total", "").Add(-1) })
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.CounterVec("hits_total", "", "shard")
+	g := r.Gauge("inflight", "")
+	h := r.Histogram("size", "", []float64{10})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.With("a").Inc()
+				g.Add(1)
+				g.Add(-1)
+				h.Observe(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 8000.0, c.With("a").Value())
+	assert.Equal(t, 0.0, g.Value())
+	assert.Equal(t, uint64(8000), h.Count())
+	assert.Equal(t, 8000.0, h.Sum())
+}
+
+func TestHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("up_total", "Up.").Inc()
+	rec := httptest.NewRecorder()
+	metrics.Handler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "up_total 1\n")
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry the package level constructors register in
+var Default = NewRegistry()
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// family is a registered metric and the way to write its series
+type family struct {
+	name, help, kind string
+	write            func(w *bufio.Writer, name string, labels []string)
+	labels           []string
+}
+
+// Registry holds metrics by name
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+func (r *Registry) register(f *family) {
+	if !validName.MatchString(f.name) {
+		panic("metrics: invalid metric name " + f.name)
+	}
+	for _, l := range f.labels {
+		if !validName.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic("metrics: invalid label name " + l)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[f.name]; ok {
+		panic("metrics: " + f.name + " registered twice")
+	}
+	r.families[f.name] = f
+}
+
+// CounterVec registers a counter partitioned by labels. Counter names end in _total
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newVec(labels, func() *Counter { return &Counter{} })}
+	r.register(&family{name: name, help: help, kind: "counter", labels: labels, write: func(w *bufio.Writer, name string, labels []string) {
+		v.each(func(values []string, c *Counter) {
+			writeSample(w, name, labels, values, "", "", c.Value())
+		})
+	}})
+	return v
+}
+
+// Counter registers a counter without labels
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+// GaugeVec registers a gauge partitioned by labels
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newVec(labels, func() *Gauge { return &Gauge{} })}
+	r.register(&family{name: name, help: help, kind: "gauge", labels: labels, write: func(w *bufio.Writer, name string, labels []string) {
+		v.each(func(values []string, g *Gauge) {
+			writeSample(w, name, labels, values, "", "", g.Value())
+		})
+	}})
+	return v
+}
+
+// Gauge registers a gauge without labels
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).With()
+}
+
+// HistogramVec registers a histogram partitioned by labels, buckets being sorted upper bounds,
+// DefBuckets when nil
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	v := &HistogramVec{newVec(labels, func() *Histogram { return newHistogram(buckets) })}
+	r.register(&family{name: name, help: help, kind: "histogram", labels: labels, write: func(w *bufio.Writer, name string, labels []string) {
+		v.each(func(values []string, h *Histogram) {
+			cumulative := uint64(0)
+			for i, upper := range h.upper {
+				cumulative += h.counts[i].Load()
+				writeSample(w, name+"_bucket", labels, values, "le", formatValue(upper), float64(cumulative))
+			}
+			// reading count last keeps the +Inf bucket at least as large as the others
+			count := h.Count()
+			if count < cumulative {
+				count = cumulative
+			}
+			writeSample(w, name+"_bucket", labels, values, "le", "+Inf", float64(count))
+			writeSample(w, name+"_sum", labels, values, "", "", h.Sum())
+			writeSample(w, name+"_count", labels, values, "", "", float64(count))
+		})
+	}})
+	return v
+}
+
+// Histogram registers a histogram without labels
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).With()
+}
+
+// NewCounter registers a counter in Default
+func NewCounter(name, help string) *Counter {
+	return Default.Counter(name, help)
+}
+
+// NewCounterVec registers a counter partitioned by labels in Default
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.CounterVec(name, help, labels...)
+}
+
+// NewGauge registers a gauge in Default
+func NewGauge(name, help string) *Gauge {
+	return Default.Gauge(name, help)
+}
+
+// NewGaugeVec registers a gauge partitioned by labels in Default
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.GaugeVec(name, help, labels...)
+}
+
+// NewHistogram registers a histogram in Default
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.Histogram(name, help, buckets)
+}
+
+// NewHistogramVec registers a histogram partitioned by labels in Default
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.HistogramVec(name, help, buckets, labels...)
+}
+
+// WriteText writes every metric in the Prometheus text exposition format, sorted by name
+func (r *Registry) WriteText(out io.Writer) error {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+		f.write(w, f.name, f.labels)
+	}
+	return w.Flush()
+}
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler serves the metrics of r
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteText(w)
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(v))
+	w.WriteByte('\n')
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
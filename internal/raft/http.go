@@ -0,0 +1,31 @@
+package raft
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/transport"
+)
+
+// HTTPPath is the path below which nodes talking raft over HTTP receive messages, followed by
+// the name of the group they belong to
+const HTTPPath = "/raft/"
+
+// NewHTTPTransport returns a Transport posting the messages of group to the HTTPPath of the
+// address peers has for their destination. Messages to nodes missing from peers are dropped
+func NewHTTPTransport(group string, peers map[string]string, logger log.Logger) *transport.HTTP[Message] {
+	return transport.NewHTTP(transport.HTTPConfig[Message]{
+		URLOf: func(msg Message) (string, bool) {
+			addr, ok := peers[msg.To]
+			return strings.TrimSuffix(addr, "/") + HTTPPath + url.PathEscape(group), ok
+		},
+		Logger: logger,
+	})
+}
+
+// Handler hands the messages posted to it to n
+func Handler(n *Node) http.Handler {
+	return transport.Handler(n.Step)
+}
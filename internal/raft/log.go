@@ -0,0 +1,125 @@
+package raft
+
+// raftLog is the in memory copy of the log, written through to Storage.
+// entries[0] holds index offset+1, so a log that starts mid way after compaction looks the same
+type raftLog struct {
+	storage    Storage
+	entries    []Entry
+	offset     uint64
+	offsetTerm uint64
+}
+
+// newRaftLog rebuilds the log from what storage loaded, starting after snapshot when there is one.
+// Entries the snapshot already covers are left over by a crash before compaction and are skipped
+func newRaftLog(storage Storage, entries []Entry, snapshot SnapshotMeta) *raftLog {
+	l := &raftLog{storage: storage, offset: snapshot.Index, offsetTerm: snapshot.Term}
+	if len(entries) > 0 && snapshot.Index == 0 {
+		l.offset = entries[0].Index - 1
+	}
+	for i, e := range entries {
+		if e.Index == l.offset+1 {
+			l.entries = entries[i:]
+			break
+		}
+	}
+	return l
+}
+
+func (l *raftLog) lastIndex() uint64 {
+	return l.offset + uint64(len(l.entries))
+}
+
+func (l *raftLog) lastTerm() uint64 {
+	return l.term(l.lastIndex())
+}
+
+// term returns the term of the entry at index, 0 if the log does not hold it
+func (l *raftLog) term(index uint64) uint64 {
+	if index == l.offset {
+		return l.offsetTerm
+	}
+	if index < l.offset || index > l.lastIndex() {
+		return 0
+	}
+	return l.entries[index-l.offset-1].Term
+}
+
+func (l *raftLog) entry(index uint64) (Entry, bool) {
+	if index <= l.offset || index > l.lastIndex() {
+		return Entry{}, false
+	}
+	return l.entries[index-l.offset-1], true
+}
+
+// slice returns a copy of the entries in [lo, hi), at most max of them
+func (l *raftLog) slice(lo, hi uint64, max int) []Entry {
+	if lo <= l.offset {
+		lo = l.offset + 1
+	}
+	if hi > l.lastIndex()+1 {
+		hi = l.lastIndex() + 1
+	}
+	if lo >= hi {
+		return nil
+	}
+	if hi-lo > uint64(max) {
+		hi = lo + uint64(max)
+	}
+	out := make([]Entry, hi-lo)
+	copy(out, l.entries[lo-l.offset-1:hi-l.offset-1])
+	return out
+}
+
+func (l *raftLog) append(entries ...Entry) error {
+	if err := l.storage.Append(entries); err != nil {
+		return err
+	}
+	l.entries = append(l.entries, entries...)
+	return nil
+}
+
+// truncateFrom drops every entry from index onwards
+func (l *raftLog) truncateFrom(index uint64) error {
+	if index > l.lastIndex() {
+		return nil
+	}
+	if err := l.storage.TruncateFrom(index); err != nil {
+		return err
+	}
+	l.entries = l.entries[:index-l.offset-1]
+	return nil
+}
+
+// compact drops every entry up to index, which a snapshot now covers
+func (l *raftLog) compact(index uint64) error {
+	if index <= l.offset || index > l.lastIndex() {
+		return nil
+	}
+	if err := l.storage.Compact(index); err != nil {
+		return err
+	}
+	l.offsetTerm = l.term(index)
+	l.entries = append([]Entry{}, l.entries[index-l.offset:]...)
+	l.offset = index
+	return nil
+}
+
+// restore makes the log start right after an installed snapshot. Entries following it are kept
+// when the log agrees with the snapshot on its last entry, everything is dropped otherwise
+func (l *raftLog) restore(meta SnapshotMeta) error {
+	if meta.Index <= l.lastIndex() && meta.Index > l.offset && l.term(meta.Index) == meta.Term {
+		return l.compact(meta.Index)
+	}
+	if err := l.storage.TruncateFrom(0); err != nil {
+		return err
+	}
+	l.entries = nil
+	l.offset = meta.Index
+	l.offsetTerm = meta.Term
+	return nil
+}
+
+// isUpToDate tells whether a candidate log ending at (index, term) is at least as recent as ours
+func (l *raftLog) isUpToDate(index, term uint64) bool {
+	return term > l.lastTerm() || (term == l.lastTerm() && index >= l.lastIndex())
+}
@@ -0,0 +1,187 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ConfChangeType is the kind of membership change a ConfChange makes
+type ConfChangeType int
+
+const (
+	// ConfAddVoter adds a voting member, or promotes a learner
+	ConfAddVoter ConfChangeType = iota
+	// ConfAddLearner adds a member that receives the log but neither votes nor counts towards commits
+	ConfAddLearner
+	// ConfRemoveNode removes a voter or a learner
+	ConfRemoveNode
+)
+
+func (t ConfChangeType) String() string {
+	switch t {
+	case ConfAddVoter:
+		return "add-voter"
+	case ConfAddLearner:
+		return "add-learner"
+	case ConfRemoveNode:
+		return "remove"
+	}
+	return fmt.Sprintf("confchange(%d)", int(t))
+}
+
+// ConfChange changes the membership by a single node. It travels through the log like any other
+// command and takes effect once committed. Changing one node at a time keeps every majority of the
+// old membership overlapping every majority of the new one, so no joint configuration is needed
+type ConfChange struct {
+	Type   ConfChangeType
+	NodeID string
+}
+
+// Membership lists the members of a group. Voters elect the leader and form the quorums,
+// learners only replicate the log, typically to catch up before being promoted
+type Membership struct {
+	Voters   []string
+	Learners []string
+}
+
+func (m Membership) IsVoter(id string) bool {
+	return contains(m.Voters, id)
+}
+
+func (m Membership) IsLearner(id string) bool {
+	return contains(m.Learners, id)
+}
+
+// Members returns voters and learners
+func (m Membership) Members() []string {
+	return append(append([]string{}, m.Voters...), m.Learners...)
+}
+
+func (m Membership) clone() Membership {
+	return Membership{
+		Voters:   append([]string{}, m.Voters...),
+		Learners: append([]string{}, m.Learners...),
+	}
+}
+
+// apply returns the membership cc leads to, or why it is not a valid change
+func (m Membership) apply(cc ConfChange) (Membership, error) {
+	if cc.NodeID == "" {
+		return m, fmt.Errorf("raft: membership change %s without a node ID", cc.Type)
+	}
+	next := m.clone()
+	switch cc.Type {
+	case ConfAddVoter:
+		if next.IsVoter(cc.NodeID) {
+			return m, fmt.Errorf("raft: %s is already a voter", cc.NodeID)
+		}
+		next.Learners = remove(next.Learners, cc.NodeID)
+		next.Voters = append(next.Voters, cc.NodeID)
+	case ConfAddLearner:
+		if next.IsVoter(cc.NodeID) || next.IsLearner(cc.NodeID) {
+			return m, fmt.Errorf("raft: %s is already a member", cc.NodeID)
+		}
+		next.Learners = append(next.Learners, cc.NodeID)
+	case ConfRemoveNode:
+		if !next.IsVoter(cc.NodeID) && !next.IsLearner(cc.NodeID) {
+			return m, fmt.Errorf("raft: %s is not a member", cc.NodeID)
+		}
+		next.Voters = remove(next.Voters, cc.NodeID)
+		next.Learners = remove(next.Learners, cc.NodeID)
+		if len(next.Voters) == 0 {
+			return m, fmt.Errorf("raft: removing %s would leave no voter", cc.NodeID)
+		}
+	default:
+		return m, fmt.Errorf("raft: unknown membership change %s", cc.Type)
+	}
+	return next, nil
+}
+
+// ProposeConfChange replicates a membership change and returns once it is committed and in effect.
+// A leader accepts a single change at a time, others fail with ErrConfChangePending
+func (n *Node) ProposeConfChange(ctx context.Context, cc ConfChange) error {
+	raw, err := json.Marshal(cc)
+	if err != nil {
+		return err
+	}
+	return n.submit(ctx, proposal{command: raw, entryType: EntryConfChange, result: make(chan error, 1)})
+}
+
+// AddVoter adds id as a voting member, or promotes it if it is a learner.
+// Adding a new node as a learner first lets it catch up without slowing commits down
+func (n *Node) AddVoter(ctx context.Context, id string) error {
+	return n.ProposeConfChange(ctx, ConfChange{Type: ConfAddVoter, NodeID: id})
+}
+
+// AddLearner adds id as a non voting member
+func (n *Node) AddLearner(ctx context.Context, id string) error {
+	return n.ProposeConfChange(ctx, ConfChange{Type: ConfAddLearner, NodeID: id})
+}
+
+// RemoveNode removes id from the group. A leader removing itself steps down once the change commits
+func (n *Node) RemoveNode(ctx context.Context, id string) error {
+	return n.ProposeConfChange(ctx, ConfChange{Type: ConfRemoveNode, NodeID: id})
+}
+
+// applyMembership puts the membership carried by a committed entry in effect
+func (n *Node) applyMembership(e Entry) error {
+	if e.Type == EntryConfChange {
+		return n.applyConfChange(e)
+	}
+	var m Membership
+	if err := json.Unmarshal(e.Command, &m); err != nil {
+		return fmt.Errorf("undecodable membership at index %d: %w", e.Index, err)
+	}
+	n.setMembership(m)
+	return nil
+}
+
+func (n *Node) applyConfChange(e Entry) error {
+	var cc ConfChange
+	if err := json.Unmarshal(e.Command, &cc); err != nil {
+		return fmt.Errorf("undecodable membership change at index %d: %w", e.Index, err)
+	}
+	next, err := n.membership.apply(cc)
+	if err != nil {
+		// every node rejects the same change the same way, it is still an applied entry
+		return err
+	}
+	n.setMembership(next)
+	n.logger.Infof("membership changed at index %d: %s %s, voters %v learners %v", e.Index, cc.Type, cc.NodeID, next.Voters, next.Learners)
+	return nil
+}
+
+func (n *Node) setMembership(m Membership) {
+	n.membership = m
+	if n.state != Leader {
+		return
+	}
+	for _, id := range m.Members() {
+		if _, ok := n.nextIndex[id]; !ok {
+			n.nextIndex[id] = n.log.lastIndex() + 1
+			n.matchIndex[id] = 0
+		}
+	}
+	for id := range n.nextIndex {
+		if id != n.id && !m.IsVoter(id) && !m.IsLearner(id) {
+			delete(n.nextIndex, id)
+			delete(n.matchIndex, id)
+			n.dropTransfer(id)
+		}
+	}
+	if !m.IsVoter(n.id) {
+		n.logger.Infof("stepping down, no longer a voter")
+		n.becomeFollower(n.term, "")
+	}
+}
+
+func remove(list []string, s string) []string {
+	out := []string{}
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
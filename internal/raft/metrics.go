@@ -0,0 +1,9 @@
+package raft
+
+import "github.com/bjornaer/hermes/internal/metrics"
+
+var (
+	elections      = metrics.NewCounter("hermes_raft_elections_total", "Elections started by the nodes of this process.")
+	leaderships    = metrics.NewCounter("hermes_raft_leaderships_total", "Elections won by the nodes of this process.")
+	entriesApplied = metrics.NewCounterVec("hermes_raft_entries_applied_total", "Committed log entries applied to the state machine, by entry type.", "type")
+)
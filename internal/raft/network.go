@@ -0,0 +1,98 @@
+package raft
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Network is an in process Transport connecting nodes of the same program. It can drop a share
+// of the messages and cut links between nodes, which makes it the harness for partition tests
+// as well as a way to run a whole group inside one binary
+type Network struct {
+	mu       sync.RWMutex
+	nodes    map[string]func(Message)
+	blocked  map[[2]string]bool
+	lossRate float64
+	rand     *rand.Rand
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		nodes:   map[string]func(Message){},
+		blocked: map[[2]string]bool{},
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Register routes messages addressed to id into deliver, typically a Node's Step
+func (nw *Network) Register(id string, deliver func(Message)) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.nodes[id] = deliver
+}
+
+// Unregister stops delivering messages to id, as if it crashed
+func (nw *Network) Unregister(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	delete(nw.nodes, id)
+}
+
+// SetLossRate makes the network drop each message with probability p
+func (nw *Network) SetLossRate(p float64) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.lossRate = p
+}
+
+// Partition splits the nodes into groups that can only talk among themselves.
+// Nodes left out of every group keep talking to everyone
+func (nw *Network) Partition(groups ...[]string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.blocked = map[[2]string]bool{}
+	for i, group := range groups {
+		for j, other := range groups {
+			if i == j {
+				continue
+			}
+			for _, a := range group {
+				for _, b := range other {
+					nw.blocked[[2]string{a, b}] = true
+				}
+			}
+		}
+	}
+}
+
+// Isolate cuts id off from every other registered node
+func (nw *Network) Isolate(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	for other := range nw.nodes {
+		if other != id {
+			nw.blocked[[2]string{id, other}] = true
+			nw.blocked[[2]string{other, id}] = true
+		}
+	}
+}
+
+// Heal restores every link
+func (nw *Network) Heal() {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.blocked = map[[2]string]bool{}
+}
+
+// Send delivers msg unless the link is cut or the message is lost
+func (nw *Network) Send(msg Message) {
+	nw.mu.Lock()
+	deliver, ok := nw.nodes[msg.To]
+	drop := !ok || nw.blocked[[2]string{msg.From, msg.To}] ||
+		(nw.lossRate > 0 && nw.rand.Float64() < nw.lossRate)
+	nw.mu.Unlock()
+	if !drop {
+		deliver(msg)
+	}
+}
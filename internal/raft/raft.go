@@ -0,0 +1,874 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/trace"
+)
+
+const (
+	defaultTickInterval     = 10 * time.Millisecond
+	defaultElectionTick     = 10
+	defaultHeartbeatTick    = 1
+	defaultMaxEntriesPerMsg = 64
+	defaultSnapshotChunk    = 64 * 1024
+	inboxSize               = 1024
+)
+
+// StateMachine is what the replicated log drives. Apply is called once per committed command, in
+// log order, on every node. AppliedIndex is read at start so a restarted node resumes after the
+// last entry the state machine already holds instead of replaying the whole log
+type StateMachine interface {
+	Apply(index uint64, command []byte) error
+	AppliedIndex() uint64
+}
+
+// Snapshotter is implemented by state machines that can be snapshotted, which is required to
+// compact the log. Restore replaces the whole state with the one written by Snapshot, taken
+// once every entry up to index was applied
+type Snapshotter interface {
+	Snapshot(w io.Writer) error
+	Restore(index uint64, r io.Reader) error
+}
+
+// Transport delivers messages to other nodes. Send must not block, raft copes with lost messages
+type Transport interface {
+	Send(msg Message)
+}
+
+// Config configures a Node, zero values fall back to sane defaults
+type Config struct {
+	ID string
+	// Peers lists every voting member the group starts with, this node included, and must be the
+	// same on all of them. It is only read when the log is empty, afterwards the membership
+	// stored in the log or the snapshot takes precedence
+	Peers []string
+	// Join starts the node without any member, not even itself, so it waits to be added to an
+	// existing group by its leader instead of bootstrapping a group of its own
+	Join         bool
+	Storage      Storage
+	Transport    Transport
+	StateMachine StateMachine
+	Logger       log.Logger
+
+	TickInterval time.Duration
+	// ElectionTick is the minimum number of ticks without hearing from a leader before campaigning,
+	// the actual timeout is randomized in [ElectionTick, 2*ElectionTick)
+	ElectionTick int
+	// HeartbeatTick is the number of ticks between two heartbeats of a leader
+	HeartbeatTick    int
+	MaxEntriesPerMsg int
+
+	// SnapshotThreshold is the number of applied entries after which the state machine is
+	// snapshotted and the log compacted, 0 never compacts. The state machine must be a Snapshotter
+	SnapshotThreshold uint64
+	// SnapshotTrailing entries are kept in the log behind a snapshot, so followers lagging a
+	// little catch up from the log instead of a whole snapshot
+	SnapshotTrailing uint64
+	// SnapshotChunkSize bounds the bytes of snapshot sent in a single message
+	SnapshotChunkSize int
+}
+
+type proposal struct {
+	command     []byte
+	entryType   EntryType
+	traceParent string
+	result      chan error
+}
+
+type waiter struct {
+	term   uint64
+	result chan error
+}
+
+// answer is the outcome of a proposal, handed to its waiter once the status shows it applied
+type answer struct {
+	result chan error
+	err    error
+}
+
+// snapshotTransfer is a snapshot being streamed to a follower, chunk is resent until acknowledged
+type snapshotTransfer struct {
+	meta   SnapshotMeta
+	reader io.ReadCloser
+	offset uint64
+	chunk  []byte
+	done   bool
+}
+
+// pendingSnapshot is a snapshot being received from the leader
+type pendingSnapshot struct {
+	meta   SnapshotMeta
+	sink   SnapshotSink
+	offset uint64
+}
+
+// Node is a single member of a Raft group. Its state is owned by one goroutine that reacts to
+// ticks, incoming messages and proposals, so none of the fields below need locking
+type Node struct {
+	cfg        Config
+	id         string
+	membership Membership
+	logger     log.Logger
+
+	state       StateType
+	term        uint64
+	vote        string
+	leader      string
+	log         *raftLog
+	commitIndex uint64
+	lastApplied uint64
+	// pendingConfIndex is the index of the last membership change a leader appended
+	pendingConfIndex uint64
+
+	electionElapsed           int
+	heartbeatElapsed          int
+	randomizedElectionTimeout int
+	votes                     map[string]bool
+	recentActive              map[string]bool
+	nextIndex                 map[string]uint64
+	matchIndex                map[string]uint64
+	waiters                   map[uint64]waiter
+	answers                   []answer
+	readSeq                   uint64
+	reads                     []*readState
+	leaderCommit              uint64
+	lastContact               time.Time
+	transfers                 map[string]*snapshotTransfer
+	pending                   *pendingSnapshot
+	rand                      *rand.Rand
+
+	msgc   chan Message
+	propc  chan proposal
+	readc  chan readRequest
+	stopc  chan struct{}
+	donec  chan struct{}
+	status Status
+	err    error
+	mu     sync.RWMutex
+	once   sync.Once
+}
+
+// NewNode restores a node from its storage, it does nothing until Start is called
+func NewNode(cfg Config) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("raft: node needs an ID")
+	}
+	if cfg.Storage == nil || cfg.Transport == nil || cfg.StateMachine == nil {
+		return nil, errors.New("raft: storage, transport and state machine are required")
+	}
+	if cfg.TickInterval <= 0 {
+		cfg.TickInterval = defaultTickInterval
+	}
+	if cfg.ElectionTick <= 0 {
+		cfg.ElectionTick = defaultElectionTick
+	}
+	if cfg.HeartbeatTick <= 0 {
+		cfg.HeartbeatTick = defaultHeartbeatTick
+	}
+	if cfg.MaxEntriesPerMsg <= 0 {
+		cfg.MaxEntriesPerMsg = defaultMaxEntriesPerMsg
+	}
+	if cfg.SnapshotChunkSize <= 0 {
+		cfg.SnapshotChunkSize = defaultSnapshotChunk
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New()
+	}
+	snapshotter, canSnapshot := cfg.StateMachine.(Snapshotter)
+	if cfg.SnapshotThreshold > 0 && !canSnapshot {
+		return nil, errors.New("raft: compacting the log needs a state machine implementing Snapshotter")
+	}
+	membership := Membership{}
+	if !cfg.Join {
+		membership.Voters = append(membership.Voters, cfg.Peers...)
+		if !membership.IsVoter(cfg.ID) {
+			membership.Voters = append(membership.Voters, cfg.ID)
+		}
+	}
+
+	st, entries, err := cfg.Storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := restoreSnapshot(cfg.Storage, cfg.StateMachine, snapshotter)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshot.Membership.Voters) > 0 {
+		membership = snapshot.Membership
+	}
+
+	n := &Node{
+		cfg:          cfg,
+		id:           cfg.ID,
+		membership:   membership,
+		logger:       cfg.Logger.With(context.Background(), "raft_node", cfg.ID),
+		term:         st.Term,
+		vote:         st.Vote,
+		log:          newRaftLog(cfg.Storage, entries, snapshot),
+		nextIndex:    map[string]uint64{},
+		matchIndex:   map[string]uint64{},
+		recentActive: map[string]bool{},
+		waiters:      map[uint64]waiter{},
+		transfers:    map[string]*snapshotTransfer{},
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano() + int64(len(cfg.ID)))),
+		msgc:         make(chan Message, inboxSize),
+		propc:        make(chan proposal),
+		readc:        make(chan readRequest),
+		stopc:        make(chan struct{}),
+		donec:        make(chan struct{}),
+	}
+	// whatever the state machine already holds was committed before
+	n.lastApplied = max(cfg.StateMachine.AppliedIndex(), snapshot.Index)
+	if n.lastApplied > n.log.lastIndex() {
+		n.lastApplied = n.log.lastIndex()
+	}
+	n.commitIndex = n.lastApplied
+	if !cfg.Join && n.log.lastIndex() == 0 {
+		// every initial member writes the same first entry, so they agree on it without an election
+		raw, err := json.Marshal(membership)
+		if err != nil {
+			return nil, err
+		}
+		if err := n.log.append(Entry{Index: 1, Type: EntryMembership, Command: raw}); err != nil {
+			return nil, err
+		}
+	}
+	// membership changes applied before the restart are back in effect
+	for index := n.log.offset + 1; index <= n.lastApplied; index++ {
+		if e, _ := n.log.entry(index); e.Type == EntryConfChange || e.Type == EntryMembership {
+			n.applyMembership(e)
+		}
+	}
+	n.becomeFollower(n.term, "")
+	n.publishStatus()
+	return n, nil
+}
+
+// restoreSnapshot loads the state machine from the stored snapshot when it is behind it
+func restoreSnapshot(storage Storage, sm StateMachine, snapshotter Snapshotter) (SnapshotMeta, error) {
+	meta, r, err := storage.OpenSnapshot()
+	if errors.Is(err, ErrNoSnapshot) {
+		return SnapshotMeta{}, nil
+	}
+	if err != nil {
+		return meta, err
+	}
+	defer r.Close()
+	if sm.AppliedIndex() >= meta.Index {
+		return meta, nil
+	}
+	if snapshotter == nil {
+		return meta, errors.New("raft: storage holds a snapshot but the state machine is not a Snapshotter")
+	}
+	return meta, snapshotter.Restore(meta.Index, r)
+}
+
+// Start runs the node until Stop is called
+func (n *Node) Start() {
+	go n.run()
+}
+
+// Stop halts the node, pending proposals fail with ErrStopped
+func (n *Node) Stop() {
+	n.once.Do(func() {
+		close(n.stopc)
+	})
+	<-n.donec
+}
+
+// Step hands a message received from the network to the node. Messages are dropped when the
+// inbox is full, which raft tolerates like any other lost message
+func (n *Node) Step(msg Message) {
+	select {
+	case n.msgc <- msg:
+	default:
+	}
+}
+
+// Propose replicates command and returns once it has been committed and applied on this node,
+// with the error the state machine returned for it. Only the leader accepts proposals, followers
+// answer with a NotLeaderError naming the leader they know of
+func (n *Node) Propose(ctx context.Context, command []byte) error {
+	ctx, span := trace.Start(ctx, "raft.Propose", trace.WithAttributes(trace.Attr("raft.node", n.id)))
+	defer span.End()
+	err := n.submit(ctx, proposal{command: command, entryType: EntryNormal, traceParent: trace.TraceParent(ctx), result: make(chan error, 1)})
+	span.RecordError(err)
+	return err
+}
+
+func (n *Node) submit(ctx context.Context, p proposal) error {
+	select {
+	case n.propc <- p:
+	case <-n.stopc:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-p.result:
+		return err
+	case <-n.donec:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the state of the node as of the last event it processed
+func (n *Node) Status() Status {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.status
+}
+
+// Err returns the storage error that halted the node, if any
+func (n *Node) Err() error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.err
+}
+
+func (n *Node) run() {
+	defer close(n.donec)
+	ticker := time.NewTicker(n.cfg.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ticker.C:
+			err = n.tick()
+		case m := <-n.msgc:
+			err = n.step(m)
+		case p := <-n.propc:
+			err = n.propose(p)
+		case r := <-n.readc:
+			n.readIndex(r)
+		case <-n.stopc:
+			n.failWaiters(ErrStopped)
+			n.failReads(ErrStopped)
+			n.resetSnapshotTransfers()
+			return
+		}
+		if err == nil {
+			err = n.applyCommitted()
+		}
+		if err == nil {
+			err = n.maybeSnapshot()
+		}
+		n.resolveReads()
+		if err != nil {
+			n.logger.Errorf("raft node halted: %v", err)
+			n.mu.Lock()
+			n.err = err
+			n.mu.Unlock()
+			n.answer()
+			n.failWaiters(err)
+			n.failReads(err)
+			n.resetSnapshotTransfers()
+			return
+		}
+		n.publishStatus()
+		n.answer()
+	}
+}
+
+// answer hands the proposals applied in this round their outcome. It comes after publishStatus,
+// so a proposer reading the status right away sees its entry applied and any snapshot it caused
+func (n *Node) answer() {
+	for _, a := range n.answers {
+		a.result <- a.err
+	}
+	n.answers = n.answers[:0]
+}
+
+func (n *Node) publishStatus() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.status = Status{
+		ID:          n.id,
+		State:       n.state,
+		Term:        n.term,
+		Leader:      n.leader,
+		CommitIndex: n.commitIndex,
+		LastApplied: n.lastApplied,
+		LastIndex:   n.log.lastIndex(),
+
+		SnapshotIndex: n.log.offset,
+		Membership:    n.membership.clone(),
+		LeaderCommit:  n.leaderCommit,
+		LastContact:   n.lastContact,
+	}
+	if n.state == Leader {
+		n.status.LeaderCommit = n.commitIndex
+		n.status.LastContact = time.Now()
+	}
+}
+
+func (n *Node) tick() error {
+	if n.state == Leader {
+		n.heartbeatElapsed++
+		if n.heartbeatElapsed >= n.cfg.HeartbeatTick {
+			n.heartbeatElapsed = 0
+			n.broadcastAppend()
+		}
+		n.electionElapsed++
+		if n.electionElapsed >= n.cfg.ElectionTick {
+			n.electionElapsed = 0
+			n.checkQuorum()
+		}
+		return nil
+	}
+	n.electionElapsed++
+	if n.electionElapsed >= n.randomizedElectionTimeout {
+		if !n.membership.IsVoter(n.id) {
+			// learners and nodes waiting to join never campaign
+			n.resetElectionTimer()
+			return nil
+		}
+		return n.campaign()
+	}
+	return nil
+}
+
+// checkQuorum steps down a leader that did not hear from a quorum for a whole election timeout,
+// so a leader cut off in a minority stops accepting proposals it could never commit
+func (n *Node) checkQuorum() {
+	n.recentActive[n.id] = true
+	if !n.hasQuorum(n.countVoters(n.recentActive)) {
+		n.logger.Infof("stepping down, no quorum heard from in term %d", n.term)
+		n.becomeFollower(n.term, "")
+	}
+	n.recentActive = map[string]bool{}
+}
+
+func (n *Node) resetElectionTimer() {
+	n.electionElapsed = 0
+	n.randomizedElectionTimeout = n.cfg.ElectionTick + n.rand.Intn(n.cfg.ElectionTick)
+}
+
+func (n *Node) persistHardState() error {
+	return n.cfg.Storage.SaveHardState(HardState{Term: n.term, Vote: n.vote})
+}
+
+func (n *Node) becomeFollower(term uint64, leader string) {
+	if n.state == Leader {
+		n.resetSnapshotTransfers()
+		n.failReads(&NotLeaderError{Leader: leader})
+	}
+	n.state = Follower
+	n.term = term
+	n.leader = leader
+	n.resetElectionTimer()
+}
+
+func (n *Node) campaign() error {
+	elections.Inc()
+	n.state = Candidate
+	n.term++
+	n.vote = n.id
+	n.leader = ""
+	n.resetElectionTimer()
+	if err := n.persistHardState(); err != nil {
+		return err
+	}
+	n.votes = map[string]bool{n.id: true}
+	if n.hasQuorum(len(n.votes)) {
+		return n.becomeLeader()
+	}
+	for _, peer := range n.membership.Voters {
+		if peer == n.id {
+			continue
+		}
+		n.send(Message{
+			Type:         MsgVote,
+			To:           peer,
+			LastLogIndex: n.log.lastIndex(),
+			LastLogTerm:  n.log.lastTerm(),
+		})
+	}
+	return nil
+}
+
+func (n *Node) becomeLeader() error {
+	leaderships.Inc()
+	n.state = Leader
+	n.leader = n.id
+	n.heartbeatElapsed = 0
+	n.electionElapsed = 0
+	n.recentActive = map[string]bool{}
+	n.resetSnapshotTransfers()
+	n.nextIndex = map[string]uint64{}
+	n.matchIndex = map[string]uint64{}
+	for _, peer := range n.membership.Members() {
+		n.nextIndex[peer] = n.log.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+	// entries of previous terms only commit once an entry of the current term does
+	if err := n.appendEntry(Entry{Type: EntryNoop}); err != nil {
+		return err
+	}
+	// any uncommitted entry may be a membership change, wait for all of them before accepting another
+	n.pendingConfIndex = n.log.lastIndex()
+	n.broadcastAppend()
+	n.maybeCommit()
+	return nil
+}
+
+func (n *Node) appendEntry(e Entry) error {
+	e.Term = n.term
+	e.Index = n.log.lastIndex() + 1
+	if err := n.log.append(e); err != nil {
+		return err
+	}
+	n.matchIndex[n.id] = e.Index
+	return nil
+}
+
+func (n *Node) propose(p proposal) error {
+	if n.state != Leader {
+		p.result <- &NotLeaderError{Leader: n.leader}
+		return nil
+	}
+	if p.entryType == EntryConfChange {
+		if n.pendingConfIndex > n.lastApplied {
+			p.result <- ErrConfChangePending
+			return nil
+		}
+		var cc ConfChange
+		if err := json.Unmarshal(p.command, &cc); err != nil {
+			p.result <- err
+			return nil
+		}
+		if _, err := n.membership.apply(cc); err != nil {
+			p.result <- err
+			return nil
+		}
+	}
+	if err := n.appendEntry(Entry{Type: p.entryType, Command: p.command, TraceParent: p.traceParent}); err != nil {
+		p.result <- err
+		return err
+	}
+	if p.entryType == EntryConfChange {
+		n.pendingConfIndex = n.log.lastIndex()
+	}
+	n.waiters[n.log.lastIndex()] = waiter{term: n.term, result: p.result}
+	n.broadcastAppend()
+	n.maybeCommit()
+	return nil
+}
+
+func (n *Node) send(m Message) {
+	m.From = n.id
+	m.Term = n.term
+	// appends carrying traced entries are sent within the trace of the latest of them
+	parent := ""
+	for _, e := range m.Entries {
+		if e.TraceParent != "" {
+			parent = e.TraceParent
+		}
+	}
+	if parent == "" {
+		n.cfg.Transport.Send(m)
+		return
+	}
+	ctx, span := trace.Start(trace.ContextWithTraceParent(context.Background(), parent), "raft send "+m.Type.String(),
+		trace.WithKind(trace.KindClient),
+		trace.WithAttributes(trace.Attr("raft.node", n.id), trace.Attr("raft.to", m.To), trace.Attr("raft.entries", len(m.Entries))))
+	defer span.End()
+	m.TraceParent = trace.TraceParent(ctx)
+	n.cfg.Transport.Send(m)
+}
+
+func (n *Node) broadcastAppend() {
+	for _, peer := range n.membership.Members() {
+		if peer != n.id {
+			n.sendAppend(peer)
+		}
+	}
+}
+
+func (n *Node) sendAppend(to string) {
+	next := n.nextIndex[to]
+	if next == 0 {
+		next = 1
+	}
+	if next <= n.log.offset {
+		// the entries the follower needs were compacted away
+		n.sendSnapshot(to)
+		return
+	}
+	prev := next - 1
+	n.send(Message{
+		Type:         MsgApp,
+		To:           to,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.log.term(prev),
+		Entries:      n.log.slice(next, n.log.lastIndex()+1, n.cfg.MaxEntriesPerMsg),
+		LeaderCommit: n.commitIndex,
+		Context:      n.readSeq,
+	})
+}
+
+func (n *Node) step(m Message) error {
+	if m.TraceParent != "" {
+		_, span := trace.Start(trace.ContextWithTraceParent(context.Background(), m.TraceParent), "raft "+m.Type.String(),
+			trace.WithKind(trace.KindServer), trace.WithAttributes(trace.Attr("raft.node", n.id), trace.Attr("raft.from", m.From)))
+		defer span.End()
+	}
+	if m.Type == MsgVote && m.Term > n.term && n.leader != "" && n.electionElapsed < n.cfg.ElectionTick {
+		// we heard from a leader within the election timeout, so the candidate is not needed. This keeps
+		// nodes that were removed, and no longer hear from the leader, from disrupting the group
+		return nil
+	}
+	if m.Term > n.term {
+		leader := ""
+		if m.Type == MsgApp || m.Type == MsgSnap {
+			leader = m.From
+		}
+		n.vote = ""
+		n.becomeFollower(m.Term, leader)
+		if err := n.persistHardState(); err != nil {
+			return err
+		}
+	}
+	if m.Term < n.term {
+		// let stale senders learn about the new term
+		switch m.Type {
+		case MsgVote:
+			n.send(Message{Type: MsgVoteResp, To: m.From, Granted: false})
+		case MsgApp:
+			n.send(Message{Type: MsgAppResp, To: m.From, Success: false, Index: n.log.lastIndex()})
+		case MsgSnap:
+			n.send(Message{Type: MsgSnapResp, To: m.From, Snapshot: m.Snapshot})
+		}
+		return nil
+	}
+
+	switch m.Type {
+	case MsgVote:
+		return n.handleVote(m)
+	case MsgVoteResp:
+		return n.handleVoteResponse(m)
+	case MsgApp:
+		return n.handleAppend(m)
+	case MsgAppResp:
+		n.handleAppendResponse(m)
+	case MsgSnap:
+		return n.handleSnapshot(m)
+	case MsgSnapResp:
+		return n.handleSnapshotResponse(m)
+	}
+	return nil
+}
+
+func (n *Node) handleVote(m Message) error {
+	canVote := n.vote == "" || n.vote == m.From
+	grant := canVote && n.log.isUpToDate(m.LastLogIndex, m.LastLogTerm)
+	if grant {
+		n.vote = m.From
+		n.resetElectionTimer()
+		if err := n.persistHardState(); err != nil {
+			return err
+		}
+	}
+	n.send(Message{Type: MsgVoteResp, To: m.From, Granted: grant})
+	return nil
+}
+
+func (n *Node) handleVoteResponse(m Message) error {
+	if n.state != Candidate || !m.Granted || !n.membership.IsVoter(m.From) {
+		return nil
+	}
+	n.votes[m.From] = true
+	if n.hasQuorum(len(n.votes)) {
+		return n.becomeLeader()
+	}
+	return nil
+}
+
+func (n *Node) handleAppend(m Message) error {
+	n.becomeFollower(n.term, m.From)
+	n.leaderCommit = m.LeaderCommit
+	n.lastContact = time.Now()
+
+	if m.PrevLogIndex < n.log.offset {
+		// entries up to the snapshot are committed, so they match the leader ones
+		skip := n.log.offset - m.PrevLogIndex
+		if skip >= uint64(len(m.Entries)) {
+			m.Entries = nil
+		} else {
+			m.Entries = m.Entries[skip:]
+		}
+		m.PrevLogIndex, m.PrevLogTerm = n.log.offset, n.log.offsetTerm
+	}
+	if m.PrevLogIndex > n.log.lastIndex() {
+		n.send(Message{Type: MsgAppResp, To: m.From, Success: false, Index: n.log.lastIndex(), Context: m.Context})
+		return nil
+	}
+	if n.log.term(m.PrevLogIndex) != m.PrevLogTerm {
+		n.send(Message{Type: MsgAppResp, To: m.From, Success: false, Index: m.PrevLogIndex - 1, Context: m.Context})
+		return nil
+	}
+
+	for i, e := range m.Entries {
+		if e.Index <= n.log.lastIndex() {
+			if n.log.term(e.Index) == e.Term {
+				continue
+			}
+			if e.Index <= n.commitIndex {
+				return errors.New("raft: leader tried to overwrite a committed entry")
+			}
+			if err := n.log.truncateFrom(e.Index); err != nil {
+				return err
+			}
+		}
+		if err := n.log.append(m.Entries[i:]...); err != nil {
+			return err
+		}
+		break
+	}
+
+	lastNew := m.PrevLogIndex + uint64(len(m.Entries))
+	if m.LeaderCommit > n.commitIndex {
+		n.commitIndex = min(m.LeaderCommit, lastNew)
+	}
+	n.send(Message{Type: MsgAppResp, To: m.From, Success: true, Index: lastNew, Context: m.Context})
+	return nil
+}
+
+func (n *Node) handleAppendResponse(m Message) {
+	if n.state != Leader {
+		return
+	}
+	n.recentActive[m.From] = true
+	n.ackReads(m.From, m.Context)
+	if !m.Success {
+		// back off using the follower hint instead of one entry per round trip
+		next := n.nextIndex[m.From] - 1
+		if m.Index+1 < next {
+			next = m.Index + 1
+		}
+		if next < 1 {
+			next = 1
+		}
+		n.nextIndex[m.From] = next
+		n.sendAppend(m.From)
+		return
+	}
+	if m.Index > n.matchIndex[m.From] {
+		n.matchIndex[m.From] = m.Index
+	}
+	n.nextIndex[m.From] = n.matchIndex[m.From] + 1
+	n.maybeCommit()
+	if n.nextIndex[m.From] <= n.log.lastIndex() {
+		n.sendAppend(m.From)
+	}
+}
+
+// maybeCommit advances the commit index to the highest entry of the current term a quorum stores
+func (n *Node) maybeCommit() {
+	for index := n.log.lastIndex(); index > n.commitIndex; index-- {
+		if n.log.term(index) != n.term {
+			break
+		}
+		replicated := 0
+		for _, peer := range n.membership.Voters {
+			if n.matchIndex[peer] >= index {
+				replicated++
+			}
+		}
+		if n.hasQuorum(replicated) {
+			n.commitIndex = index
+			return
+		}
+	}
+}
+
+// hasQuorum tells whether count voters are a majority of the voters
+func (n *Node) hasQuorum(count int) bool {
+	return count > len(n.membership.Voters)/2
+}
+
+func (n *Node) countVoters(ids map[string]bool) int {
+	count := 0
+	for id := range ids {
+		if n.membership.IsVoter(id) {
+			count++
+		}
+	}
+	return count
+}
+
+func (n *Node) applyCommitted() error {
+	for n.lastApplied < n.commitIndex {
+		index := n.lastApplied + 1
+		e, ok := n.log.entry(index)
+		if !ok {
+			return errors.New("raft: committed entry missing from the log")
+		}
+		var applyErr error
+		switch e.Type {
+		case EntryNormal:
+			applyErr = n.apply(e)
+		case EntryConfChange, EntryMembership:
+			applyErr = n.applyMembership(e)
+		}
+		n.lastApplied = index
+		entriesApplied.With(e.Type.String()).Inc()
+		if w, ok := n.waiters[index]; ok {
+			delete(n.waiters, index)
+			if w.term == e.Term {
+				n.answers = append(n.answers, answer{result: w.result, err: applyErr})
+			} else {
+				n.answers = append(n.answers, answer{result: w.result, err: ErrProposalDropped})
+			}
+		}
+	}
+	// a new leader may have overwritten proposals that never made it
+	for index, w := range n.waiters {
+		if e, ok := n.log.entry(index); !ok || e.Term != w.term {
+			delete(n.waiters, index)
+			w.result <- ErrProposalDropped
+		}
+	}
+	return nil
+}
+
+// apply hands a normal entry to the state machine, within the trace of its proposal if it has one
+func (n *Node) apply(e Entry) error {
+	if e.TraceParent == "" {
+		return n.cfg.StateMachine.Apply(e.Index, e.Command)
+	}
+	_, span := trace.Start(trace.ContextWithTraceParent(context.Background(), e.TraceParent), "raft.Apply",
+		trace.WithAttributes(trace.Attr("raft.node", n.id), trace.Attr("raft.index", e.Index)))
+	defer span.End()
+	err := n.cfg.StateMachine.Apply(e.Index, e.Command)
+	span.RecordError(err)
+	return err
+}
+
+func (n *Node) failWaiters(err error) {
+	for index, w := range n.waiters {
+		delete(n.waiters, index)
+		w.result <- err
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
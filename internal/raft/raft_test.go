@@ -0,0 +1,616 @@
+package raft_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/raft"
+	"github.com/bjornaer/hermes/internal/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingStateMachine struct {
+	mu       sync.Mutex
+	commands []string
+	applied  uint64
+}
+
+func (sm *recordingStateMachine) Apply(index uint64, command []byte) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.commands = append(sm.commands, string(command))
+	sm.applied = index
+	return nil
+}
+
+func (sm *recordingStateMachine) AppliedIndex() uint64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.applied
+}
+
+func (sm *recordingStateMachine) Snapshot(w io.Writer) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return json.NewEncoder(w).Encode(sm.commands)
+}
+
+func (sm *recordingStateMachine) Restore(index uint64, r io.Reader) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.commands = nil
+	sm.applied = index
+	return json.NewDecoder(r).Decode(&sm.commands)
+}
+
+func (sm *recordingStateMachine) Commands() []string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return append([]string{}, sm.commands...)
+}
+
+type testCluster struct {
+	t        *testing.T
+	network  *raft.Network
+	ids      []string
+	nodes    map[string]*raft.Node
+	machines map[string]*recordingStateMachine
+	storages map[string]raft.Storage
+	// configure tweaks the config of every node before it starts
+	configure func(cfg *raft.Config)
+}
+
+func newTestCluster(t *testing.T, size int) *testCluster {
+	return newTestClusterWith(t, size, func(*raft.Config) {})
+}
+
+func newTestClusterWith(t *testing.T, size int, configure func(cfg *raft.Config)) *testCluster {
+	c := &testCluster{
+		configure: configure,
+		t:         t,
+		network:   raft.NewNetwork(),
+		nodes:     map[string]*raft.Node{},
+		machines:  map[string]*recordingStateMachine{},
+		storages:  map[string]raft.Storage{},
+	}
+	for i := 0; i < size; i++ {
+		c.ids = append(c.ids, fmt.Sprintf("n%d", i))
+	}
+	for _, id := range c.ids {
+		c.storages[id] = raft.NewMemoryStorage()
+		c.machines[id] = &recordingStateMachine{}
+		c.start(id)
+	}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.Stop()
+		}
+	})
+	return c
+}
+
+func (c *testCluster) start(id string) {
+	logger, _ := log.NewForTest()
+	cfg := raft.Config{
+		ID:           id,
+		Peers:        c.ids,
+		Storage:      c.storages[id],
+		Transport:    c.network,
+		StateMachine: c.machines[id],
+		Logger:       logger,
+		TickInterval: 5 * time.Millisecond,
+	}
+	c.configure(&cfg)
+	n, err := raft.NewNode(cfg)
+	require.NoError(c.t, err)
+	c.nodes[id] = n
+	c.network.Register(id, n.Step)
+	n.Start()
+}
+
+// join starts a new node that waits to be added to the group
+func (c *testCluster) join(id string) {
+	c.storages[id] = raft.NewMemoryStorage()
+	c.machines[id] = &recordingStateMachine{}
+	c.ids = append(c.ids, id)
+	configure := c.configure
+	c.configure = func(cfg *raft.Config) {
+		configure(cfg)
+		cfg.Join = true
+	}
+	c.start(id)
+	c.configure = configure
+}
+
+// leader waits until exactly one node among ids considers itself leader of the highest term
+func (c *testCluster) leader(ids ...string) string {
+	if len(ids) == 0 {
+		ids = c.ids
+	}
+	var leader string
+	require.Eventually(c.t, func() bool {
+		leader = ""
+		var term uint64
+		for _, id := range ids {
+			st := c.nodes[id].Status()
+			if st.State == raft.Leader && st.Term >= term {
+				leader, term = id, st.Term
+			}
+		}
+		return leader != ""
+	}, 5*time.Second, 10*time.Millisecond, "no leader elected")
+	return leader
+}
+
+// propose retries on whichever node leads until the command is committed
+func (c *testCluster) propose(command string, ids ...string) {
+	require.Eventually(c.t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		return c.nodes[c.leader(ids...)].Propose(ctx, []byte(command)) == nil
+	}, 10*time.Second, time.Millisecond, "command %q never committed", command)
+}
+
+func (c *testCluster) waitConverged(expected []string, ids ...string) {
+	if len(ids) == 0 {
+		ids = c.ids
+	}
+	for _, id := range ids {
+		require.Eventually(c.t, func() bool {
+			return assert.ObjectsAreEqual(expected, c.machines[id].Commands())
+		}, 10*time.Second, 10*time.Millisecond, "node %s did not converge: %v", id, c.machines[id].Commands())
+	}
+}
+
+func TestElectsSingleLeader(t *testing.T) {
+	c := newTestCluster(t, 3)
+	leader := c.leader()
+
+	term := c.nodes[leader].Status().Term
+	for _, id := range c.ids {
+		st := c.nodes[id].Status()
+		if id != leader && st.Term == term {
+			assert.NotEqual(t, raft.Leader, st.State, "two leaders in term %d", term)
+		}
+	}
+}
+
+func TestReplicatesInOrder(t *testing.T) {
+	c := newTestCluster(t, 5)
+	expected := []string{}
+	for i := 0; i < 30; i++ {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		c.propose(cmd)
+		expected = append(expected, cmd)
+	}
+	c.waitConverged(expected)
+}
+
+func TestFollowerRedirectsToLeader(t *testing.T) {
+	c := newTestCluster(t, 3)
+	leader := c.leader()
+	// give followers a heartbeat to learn who leads
+	c.propose("hello")
+
+	for _, id := range c.ids {
+		if id == leader {
+			continue
+		}
+		err := c.nodes[id].Propose(context.Background(), []byte("nope"))
+		var notLeader *raft.NotLeaderError
+		require.True(t, errors.As(err, &notLeader))
+		assert.ErrorIs(t, err, raft.ErrNotLeader)
+		assert.Equal(t, leader, notLeader.Leader)
+	}
+}
+
+func TestLeaderPartition(t *testing.T) {
+	c := newTestCluster(t, 5)
+	c.propose("before")
+	oldLeader := c.leader()
+	oldTerm := c.nodes[oldLeader].Status().Term
+
+	c.network.Isolate(oldLeader)
+	majority := []string{}
+	for _, id := range c.ids {
+		if id != oldLeader {
+			majority = append(majority, id)
+		}
+	}
+
+	// the isolated leader can not commit anything
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := c.nodes[oldLeader].Propose(ctx, []byte("lost"))
+	assert.Error(t, err)
+
+	c.propose("during", majority...)
+	newLeader := c.leader(majority...)
+	assert.NotEqual(t, oldLeader, newLeader)
+	assert.Greater(t, c.nodes[newLeader].Status().Term, oldTerm)
+
+	c.network.Heal()
+	c.propose("after")
+	c.waitConverged([]string{"before", "during", "after"})
+}
+
+func TestMinorityCanNotElect(t *testing.T) {
+	c := newTestCluster(t, 5)
+	c.leader()
+	c.network.Partition(c.ids[:2], c.ids[2:])
+
+	c.propose("majority", c.ids[2:]...)
+	time.Sleep(300 * time.Millisecond)
+	for _, id := range c.ids[:2] {
+		assert.NotEqual(t, raft.Leader, c.nodes[id].Status().State)
+	}
+}
+
+func TestMessageLoss(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.network.SetLossRate(0.2)
+	expected := []string{}
+	for i := 0; i < 20; i++ {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		c.propose(cmd)
+		expected = append(expected, cmd)
+	}
+	c.network.SetLossRate(0)
+	c.waitConverged(expected)
+}
+
+func TestRestartKeepsPersistentState(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := raft.NewFileStorage(dir)
+	require.NoError(t, err)
+	network := raft.NewNetwork()
+	sm := &recordingStateMachine{}
+	logger, _ := log.NewForTest()
+	cfg := raft.Config{ID: "solo", Storage: storage, Transport: network, StateMachine: sm, Logger: logger, TickInterval: 5 * time.Millisecond}
+
+	n, err := raft.NewNode(cfg)
+	require.NoError(t, err)
+	n.Start()
+	require.Eventually(t, func() bool { return n.Status().State == raft.Leader }, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, n.Propose(context.Background(), []byte("one")))
+	require.NoError(t, n.Propose(context.Background(), []byte("two")))
+	before := n.Status()
+	n.Stop()
+	require.NoError(t, storage.Close())
+
+	storage, err = raft.NewFileStorage(dir)
+	require.NoError(t, err)
+	defer storage.Close()
+	cfg.Storage = storage
+	n, err = raft.NewNode(cfg)
+	require.NoError(t, err)
+	restored := n.Status()
+	assert.Equal(t, before.Term, restored.Term)
+	assert.Equal(t, before.LastIndex, restored.LastIndex)
+	assert.Equal(t, before.LastApplied, restored.LastApplied, "applied entries are not replayed")
+
+	n.Start()
+	defer n.Stop()
+	require.Eventually(t, func() bool { return n.Status().State == raft.Leader }, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, n.Propose(context.Background(), []byte("three")))
+	assert.Equal(t, []string{"one", "two", "three"}, sm.Commands())
+	assert.Greater(t, n.Status().Term, before.Term)
+}
+
+func TestLaggingFollowerInstallsSnapshot(t *testing.T) {
+	c := newTestClusterWith(t, 3, func(cfg *raft.Config) {
+		cfg.SnapshotThreshold = 5
+		cfg.SnapshotChunkSize = 16
+	})
+	c.propose("first")
+	leader := c.leader()
+	var lagging string
+	for _, id := range c.ids {
+		if id != leader {
+			lagging = id
+			break
+		}
+	}
+	c.network.Isolate(lagging)
+	majority := []string{}
+	for _, id := range c.ids {
+		if id != lagging {
+			majority = append(majority, id)
+		}
+	}
+
+	expected := []string{"first"}
+	for i := 0; i < 30; i++ {
+		cmd := fmt.Sprintf("cmd-%d", i)
+		c.propose(cmd, majority...)
+		expected = append(expected, cmd)
+	}
+	st := c.nodes[c.leader(majority...)].Status()
+	assert.Greater(t, st.SnapshotIndex, uint64(0), "the leader compacted its log")
+	assert.Less(t, st.LastIndex-st.SnapshotIndex, uint64(10))
+	assert.Greater(t, st.SnapshotIndex, c.nodes[lagging].Status().LastIndex, "the lagging follower needs the snapshot")
+
+	c.network.Heal()
+	c.waitConverged(expected)
+	assert.Greater(t, c.nodes[lagging].Status().SnapshotIndex, uint64(0), "the follower caught up from a snapshot")
+
+	c.propose("after")
+	c.waitConverged(append(expected, "after"))
+}
+
+func TestRestartRestoresSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := raft.NewFileStorage(dir)
+	require.NoError(t, err)
+	network := raft.NewNetwork()
+	logger, _ := log.NewForTest()
+	cfg := raft.Config{
+		ID:                "solo",
+		Storage:           storage,
+		Transport:         network,
+		StateMachine:      &recordingStateMachine{},
+		Logger:            logger,
+		TickInterval:      5 * time.Millisecond,
+		SnapshotThreshold: 3,
+	}
+
+	n, err := raft.NewNode(cfg)
+	require.NoError(t, err)
+	n.Start()
+	require.Eventually(t, func() bool { return n.Status().State == raft.Leader }, 5*time.Second, 5*time.Millisecond)
+	for _, cmd := range []string{"one", "two", "three", "four"} {
+		require.NoError(t, n.Propose(context.Background(), []byte(cmd)))
+	}
+	before := n.Status()
+	require.Greater(t, before.SnapshotIndex, uint64(0))
+	n.Stop()
+	require.NoError(t, storage.Close())
+
+	// a state machine that lost everything is rebuilt from the snapshot and the log after it
+	storage, err = raft.NewFileStorage(dir)
+	require.NoError(t, err)
+	defer storage.Close()
+	sm := &recordingStateMachine{}
+	cfg.Storage, cfg.StateMachine = storage, sm
+	n, err = raft.NewNode(cfg)
+	require.NoError(t, err)
+	restored := n.Status()
+	assert.Equal(t, before.SnapshotIndex, restored.SnapshotIndex)
+	assert.Equal(t, before.LastIndex, restored.LastIndex)
+
+	n.Start()
+	defer n.Stop()
+	require.Eventually(t, func() bool { return n.Status().State == raft.Leader }, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, n.Propose(context.Background(), []byte("five")))
+	assert.Equal(t, []string{"one", "two", "three", "four", "five"}, sm.Commands())
+}
+
+func TestAddLearnerThenPromote(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.propose("before")
+	c.join("n3")
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NotEqual(t, raft.Leader, c.nodes["n3"].Status().State, "a joining node does not bootstrap a group")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.nodes[c.leader()].AddLearner(ctx, "n3"))
+	c.waitConverged([]string{"before"}, "n3")
+	membership := c.nodes[c.leader()].Status().Membership
+	assert.ElementsMatch(t, []string{"n0", "n1", "n2"}, membership.Voters)
+	assert.Equal(t, []string{"n3"}, membership.Learners)
+
+	err := c.nodes[c.leader()].AddLearner(ctx, "n3")
+	assert.Error(t, err, "n3 is already a member")
+
+	require.NoError(t, c.nodes[c.leader()].AddVoter(ctx, "n3"))
+	c.propose("after")
+	c.waitConverged([]string{"before", "after"})
+	for _, id := range c.ids {
+		require.Eventually(t, func() bool {
+			return len(c.nodes[id].Status().Membership.Voters) == 4
+		}, 5*time.Second, 10*time.Millisecond, "node %s did not learn the membership", id)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.propose("before")
+	leader := c.leader()
+	remaining := []string{}
+	for _, id := range c.ids {
+		if id != leader {
+			remaining = append(remaining, id)
+		}
+	}
+
+	// the leader removes itself and steps down once the change commits
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.nodes[leader].RemoveNode(ctx, leader))
+	assert.NotEqual(t, raft.Leader, c.nodes[leader].Status().State)
+
+	c.propose("after", remaining...)
+	c.waitConverged([]string{"before", "after"}, remaining...)
+	st := c.nodes[c.leader(remaining...)].Status()
+	assert.ElementsMatch(t, remaining, st.Membership.Voters)
+
+	// with two voters left both are needed to commit
+	c.network.Isolate(remaining[0])
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := c.nodes[remaining[1]].Propose(ctx, []byte("lost"))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"before"}, c.machines[leader].Commands(), "the removed node is not replicated to")
+}
+
+func TestMembershipSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := raft.NewFileStorage(dir)
+	require.NoError(t, err)
+	logger, _ := log.NewForTest()
+	cfg := raft.Config{
+		ID:                "solo",
+		Storage:           storage,
+		Transport:         raft.NewNetwork(),
+		StateMachine:      &recordingStateMachine{},
+		Logger:            logger,
+		TickInterval:      5 * time.Millisecond,
+		SnapshotThreshold: 4,
+	}
+
+	n, err := raft.NewNode(cfg)
+	require.NoError(t, err)
+	n.Start()
+	require.Eventually(t, func() bool { return n.Status().State == raft.Leader }, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, n.AddLearner(context.Background(), "learner"))
+	require.NoError(t, n.Propose(context.Background(), []byte("one")))
+	require.NoError(t, n.AddLearner(context.Background(), "gone"))
+	require.NoError(t, n.RemoveNode(context.Background(), "gone"))
+	n.Stop()
+	require.NoError(t, storage.Close())
+
+	storage, err = raft.NewFileStorage(dir)
+	require.NoError(t, err)
+	defer storage.Close()
+	cfg.Storage = storage
+	n, err = raft.NewNode(cfg)
+	require.NoError(t, err)
+	n.Start()
+	defer n.Stop()
+	require.Eventually(t, func() bool {
+		st := n.Status()
+		return st.State == raft.Leader && st.CommitIndex == st.LastIndex
+	}, 5*time.Second, 5*time.Millisecond)
+	st := n.Status()
+	assert.Greater(t, st.SnapshotIndex, uint64(0), "part of the membership comes from the snapshot")
+	assert.Equal(t, []string{"solo"}, st.Membership.Voters)
+	assert.Equal(t, []string{"learner"}, st.Membership.Learners)
+}
+
+func TestReadIndex(t *testing.T) {
+	c := newTestCluster(t, 3)
+	c.propose("one")
+	leader := c.leader()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	index, err := c.nodes[leader].ReadIndex(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, c.nodes[leader].Status().LastApplied, index)
+	assert.Equal(t, []string{"one"}, c.machines[leader].Commands(), "the read index waits for the state machine")
+
+	for _, id := range c.ids {
+		if id != leader {
+			_, err := c.nodes[id].ReadIndex(ctx)
+			assert.ErrorIs(t, err, raft.ErrNotLeader)
+		}
+	}
+
+	// a leader cut off from the others can not confirm it still leads
+	c.network.Isolate(leader)
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	_, err = c.nodes[leader].ReadIndex(short)
+	assert.Error(t, err)
+}
+
+func TestProposalsAreTracedAcrossNodes(t *testing.T) {
+	spans := trace.NewInMemoryExporter()
+	trace.SetExporter(spans)
+	t.Cleanup(func() { trace.SetExporter(nil) })
+	c := newTestCluster(t, 3)
+
+	ctx, root := trace.Start(context.Background(), "client")
+	require.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		return c.nodes[c.leader()].Propose(ctx, []byte("traced")) == nil
+	}, 10*time.Second, time.Millisecond)
+	root.End()
+	c.waitConverged([]string{"traced"})
+
+	traceID := root.SpanContext().TraceID
+	require.Eventually(t, func() bool { return len(spans.Named("raft.Apply")) == 3 }, 5*time.Second, 10*time.Millisecond)
+	nodes := map[any]bool{}
+	for _, span := range spans.Named("raft.Apply") {
+		assert.Equal(t, traceID, span.SpanContext.TraceID)
+		nodes[span.Attribute("raft.node")] = true
+	}
+	assert.Len(t, nodes, 3, "every node applies within the trace")
+	received := spans.Named("raft AppendEntries")
+	require.NotEmpty(t, received)
+	for _, span := range received {
+		assert.Equal(t, traceID, span.SpanContext.TraceID)
+		assert.Equal(t, trace.KindServer, span.Kind)
+	}
+	assert.NotEmpty(t, spans.Named("raft send AppendEntries"))
+}
+
+func TestGroupOverHTTP(t *testing.T) {
+	ids := []string{"h1", "h2", "h3"}
+	peers := map[string]string{}
+	muxes := map[string]*http.ServeMux{}
+	for _, id := range ids {
+		muxes[id] = http.NewServeMux()
+		srv := httptest.NewServer(muxes[id])
+		t.Cleanup(srv.Close)
+		peers[id] = srv.URL
+	}
+	nodes := map[string]*raft.Node{}
+	machines := map[string]*recordingStateMachine{}
+	for _, id := range ids {
+		logger, _ := log.NewForTest()
+		tr := raft.NewHTTPTransport("group", peers, logger)
+		t.Cleanup(tr.Close)
+		machines[id] = &recordingStateMachine{}
+		n, err := raft.NewNode(raft.Config{
+			ID:                id,
+			Peers:             ids,
+			Storage:           raft.NewMemoryStorage(),
+			Transport:         tr,
+			StateMachine:      machines[id],
+			Logger:            logger,
+			SnapshotThreshold: 4,
+			SnapshotChunkSize: 16,
+		})
+		require.NoError(t, err)
+		muxes[id].Handle("POST "+raft.HTTPPath+"group", raft.Handler(n))
+		nodes[id] = n
+		n.Start()
+		t.Cleanup(n.Stop)
+	}
+
+	var leader *raft.Node
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if n.Status().State == raft.Leader {
+				leader = n
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		require.NoError(t, leader.Propose(ctx, []byte(fmt.Sprintf("cmd-%d", i))))
+		cancel()
+	}
+	for _, id := range ids {
+		require.Eventually(t, func() bool {
+			cmds := machines[id].Commands()
+			return len(cmds) > 0 && cmds[len(cmds)-1] == "cmd-9"
+		}, 5*time.Second, 10*time.Millisecond, "%s applies every command", id)
+	}
+}
@@ -0,0 +1,88 @@
+package raft
+
+import "context"
+
+type readRequest struct {
+	result chan readResult
+}
+
+type readResult struct {
+	index uint64
+	err   error
+}
+
+// readState is a read waiting for a quorum to confirm the leader is still leading
+type readState struct {
+	seq    uint64
+	acks   map[string]bool
+	result chan readResult
+}
+
+// ReadIndex confirms with a quorum that this node still leads, and returns once its state machine
+// applied every entry committed before the call, with the commit index it waited for. Reading the
+// state machine afterwards is linearizable. Followers answer with a NotLeaderError
+func (n *Node) ReadIndex(ctx context.Context) (uint64, error) {
+	r := readRequest{result: make(chan readResult, 1)}
+	select {
+	case n.readc <- r:
+	case <-n.stopc:
+		return 0, ErrStopped
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	select {
+	case res := <-r.result:
+		return res.index, res.err
+	case <-n.donec:
+		return 0, ErrStopped
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (n *Node) readIndex(r readRequest) {
+	if n.state != Leader {
+		r.result <- readResult{err: &NotLeaderError{Leader: n.leader}}
+		return
+	}
+	n.readSeq++
+	n.reads = append(n.reads, &readState{seq: n.readSeq, acks: map[string]bool{n.id: true}, result: r.result})
+	// the heartbeat carries the read sequence, followers echo it back
+	n.broadcastAppend()
+}
+
+// ackReads records that a follower answered a heartbeat sent for read seq, and any before it
+func (n *Node) ackReads(from string, seq uint64) {
+	for _, r := range n.reads {
+		if r.seq <= seq {
+			r.acks[from] = true
+		}
+	}
+}
+
+// resolveReads answers the reads a quorum confirmed. A new leader only knows the commit index
+// once an entry of its own term committed, and the state machine has to have caught up with it
+func (n *Node) resolveReads() {
+	if n.state != Leader || len(n.reads) == 0 {
+		return
+	}
+	if n.log.term(n.commitIndex) != n.term || n.lastApplied < n.commitIndex {
+		return
+	}
+	pending := n.reads[:0]
+	for _, r := range n.reads {
+		if n.hasQuorum(n.countVoters(r.acks)) {
+			r.result <- readResult{index: n.commitIndex}
+			continue
+		}
+		pending = append(pending, r)
+	}
+	n.reads = pending
+}
+
+func (n *Node) failReads(err error) {
+	for _, r := range n.reads {
+		r.result <- readResult{err: err}
+	}
+	n.reads = nil
+}
@@ -0,0 +1,209 @@
+package raft
+
+import (
+	"errors"
+	"io"
+)
+
+// maybeSnapshot snapshots the state machine and compacts the log once enough entries were applied
+// since the last snapshot
+func (n *Node) maybeSnapshot() error {
+	threshold := n.cfg.SnapshotThreshold
+	if threshold == 0 || n.lastApplied < n.log.offset+threshold {
+		return nil
+	}
+	// membership changes take effect when applied, so this is the membership as of lastApplied
+	meta := SnapshotMeta{Index: n.lastApplied, Term: n.log.term(n.lastApplied), Membership: n.membership.clone()}
+	sink, err := n.cfg.Storage.CreateSnapshot(meta)
+	if err != nil {
+		return err
+	}
+	if err := n.cfg.StateMachine.(Snapshotter).Snapshot(sink); err != nil {
+		sink.Abort()
+		return err
+	}
+	if err := sink.Commit(); err != nil {
+		return err
+	}
+	if meta.Index <= n.cfg.SnapshotTrailing {
+		return nil
+	}
+	return n.log.compact(meta.Index - n.cfg.SnapshotTrailing)
+}
+
+// sendSnapshot streams the stored snapshot to a follower missing compacted entries.
+// It sends the chunk waiting for an acknowledgement, opening the snapshot first if needed
+func (n *Node) sendSnapshot(to string) {
+	tr, ok := n.transfers[to]
+	if !ok {
+		meta, r, err := n.cfg.Storage.OpenSnapshot()
+		if err != nil {
+			n.logger.Errorf("can not open snapshot for %s: %v", to, err)
+			return
+		}
+		tr = &snapshotTransfer{meta: meta, reader: r}
+		if err := n.readChunk(tr); err != nil {
+			n.logger.Errorf("can not read snapshot for %s: %v", to, err)
+			r.Close()
+			return
+		}
+		n.transfers[to] = tr
+		n.logger.Infof("sending snapshot at index %d to %s", meta.Index, to)
+	}
+	n.send(Message{
+		Type:     MsgSnap,
+		To:       to,
+		Snapshot: tr.meta,
+		Offset:   tr.offset,
+		Data:     tr.chunk,
+		Done:     tr.done,
+	})
+}
+
+func (n *Node) readChunk(tr *snapshotTransfer) error {
+	buf := make([]byte, n.cfg.SnapshotChunkSize)
+	read, err := io.ReadFull(tr.reader, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		tr.done = true
+	} else if err != nil {
+		return err
+	}
+	tr.chunk = buf[:read]
+	return nil
+}
+
+func (n *Node) dropTransfer(to string) {
+	if tr, ok := n.transfers[to]; ok {
+		tr.reader.Close()
+		delete(n.transfers, to)
+	}
+}
+
+func (n *Node) handleSnapshotResponse(m Message) error {
+	if n.state != Leader {
+		return nil
+	}
+	n.recentActive[m.From] = true
+	tr, ok := n.transfers[m.From]
+	if !ok || !tr.meta.sameAs(m.Snapshot) {
+		return nil
+	}
+	if m.Done {
+		n.dropTransfer(m.From)
+		if tr.meta.Index > n.matchIndex[m.From] {
+			n.matchIndex[m.From] = tr.meta.Index
+		}
+		n.nextIndex[m.From] = n.matchIndex[m.From] + 1
+		n.maybeCommit()
+		n.sendAppend(m.From)
+		return nil
+	}
+
+	switch m.Offset {
+	case tr.offset + uint64(len(tr.chunk)):
+		tr.offset = m.Offset
+		if err := n.readChunk(tr); err != nil {
+			n.logger.Errorf("can not read snapshot for %s: %v", m.From, err)
+			n.dropTransfer(m.From)
+			return nil
+		}
+	case 0:
+		// the follower lost what it received, start over
+		n.dropTransfer(m.From)
+	default:
+		// a stale acknowledgement
+		return nil
+	}
+	n.sendSnapshot(m.From)
+	return nil
+}
+
+// handleSnapshot writes a chunk of the leader snapshot and installs it once the last one arrived.
+// Chunks must arrive in order, the response tells the leader how many bytes were received
+func (n *Node) handleSnapshot(m Message) error {
+	n.becomeFollower(n.term, m.From)
+	snapshotter, ok := n.cfg.StateMachine.(Snapshotter)
+	if !ok {
+		return errors.New("raft: leader sent a snapshot but the state machine is not a Snapshotter")
+	}
+	if m.Snapshot.Index <= n.commitIndex {
+		// we already hold everything the snapshot does
+		n.send(Message{Type: MsgSnapResp, To: m.From, Snapshot: m.Snapshot, Done: true})
+		return nil
+	}
+
+	if m.Offset == 0 {
+		n.abortPendingSnapshot()
+		sink, err := n.cfg.Storage.CreateSnapshot(m.Snapshot)
+		if err != nil {
+			return err
+		}
+		n.pending = &pendingSnapshot{meta: m.Snapshot, sink: sink}
+	}
+	p := n.pending
+	if p == nil || !p.meta.sameAs(m.Snapshot) || p.offset != m.Offset {
+		var expected uint64
+		if p != nil && p.meta.sameAs(m.Snapshot) {
+			expected = p.offset
+		}
+		n.send(Message{Type: MsgSnapResp, To: m.From, Snapshot: m.Snapshot, Offset: expected})
+		return nil
+	}
+
+	if _, err := p.sink.Write(m.Data); err != nil {
+		n.abortPendingSnapshot()
+		return err
+	}
+	p.offset += uint64(len(m.Data))
+	if !m.Done {
+		n.send(Message{Type: MsgSnapResp, To: m.From, Snapshot: m.Snapshot, Offset: p.offset})
+		return nil
+	}
+
+	n.pending = nil
+	if err := p.sink.Commit(); err != nil {
+		return err
+	}
+	if err := n.installSnapshot(p.meta, snapshotter); err != nil {
+		return err
+	}
+	n.send(Message{Type: MsgSnapResp, To: m.From, Snapshot: m.Snapshot, Offset: p.offset, Done: true})
+	return nil
+}
+
+// installSnapshot restores the state machine from the stored snapshot and restarts the log after it
+func (n *Node) installSnapshot(meta SnapshotMeta, snapshotter Snapshotter) error {
+	_, r, err := n.cfg.Storage.OpenSnapshot()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := snapshotter.Restore(meta.Index, r); err != nil {
+		return err
+	}
+	if err := n.log.restore(meta); err != nil {
+		return err
+	}
+	n.commitIndex = max(n.commitIndex, meta.Index)
+	n.lastApplied = meta.Index
+	if len(meta.Membership.Voters) > 0 {
+		n.setMembership(meta.Membership)
+	}
+	n.logger.Infof("installed snapshot at index %d term %d", meta.Index, meta.Term)
+	return nil
+}
+
+func (n *Node) abortPendingSnapshot() {
+	if n.pending != nil {
+		n.pending.sink.Abort()
+		n.pending = nil
+	}
+}
+
+// resetSnapshotTransfers forgets every snapshot being sent or received
+func (n *Node) resetSnapshotTransfers() {
+	for to := range n.transfers {
+		n.dropTransfer(to)
+	}
+	n.abortPendingSnapshot()
+}
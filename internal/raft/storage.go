@@ -0,0 +1,413 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Storage persists the hard state, the log and the latest snapshot of a node so it can restart
+// where it left off. Entries are always appended contiguously after the last stored one
+type Storage interface {
+	Load() (HardState, []Entry, error)
+	SaveHardState(st HardState) error
+	Append(entries []Entry) error
+	// TruncateFrom drops every entry with an index greater or equal to index
+	TruncateFrom(index uint64) error
+	// Compact drops every entry with an index lower or equal to index, they live in the snapshot now
+	Compact(index uint64) error
+	// CreateSnapshot returns a sink that replaces the current snapshot once committed
+	CreateSnapshot(meta SnapshotMeta) (SnapshotSink, error)
+	// OpenSnapshot returns the current snapshot, ErrNoSnapshot if there is none
+	OpenSnapshot() (SnapshotMeta, io.ReadCloser, error)
+}
+
+// SnapshotSink receives the bytes of a snapshot
+type SnapshotSink interface {
+	io.Writer
+	Commit() error
+	Abort() error
+}
+
+// MemoryStorage keeps everything in memory, a node restarted on the same instance still finds its state
+type MemoryStorage struct {
+	mu           sync.Mutex
+	state        HardState
+	entries      []Entry
+	snapshotMeta SnapshotMeta
+	snapshot     []byte
+	hasSnapshot  bool
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (ms *MemoryStorage) Load() (HardState, []Entry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	entries := make([]Entry, len(ms.entries))
+	copy(entries, ms.entries)
+	return ms.state, entries, nil
+}
+
+func (ms *MemoryStorage) SaveHardState(st HardState) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.state = st
+	return nil
+}
+
+func (ms *MemoryStorage) Append(entries []Entry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.entries = append(ms.entries, entries...)
+	return nil
+}
+
+func (ms *MemoryStorage) TruncateFrom(index uint64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i, e := range ms.entries {
+		if e.Index >= index {
+			ms.entries = ms.entries[:i]
+			break
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) Compact(index uint64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	keep := []Entry{}
+	for _, e := range ms.entries {
+		if e.Index > index {
+			keep = append(keep, e)
+		}
+	}
+	ms.entries = keep
+	return nil
+}
+
+type memorySink struct {
+	bytes.Buffer
+	meta    SnapshotMeta
+	storage *MemoryStorage
+}
+
+func (s *memorySink) Commit() error {
+	s.storage.mu.Lock()
+	defer s.storage.mu.Unlock()
+	s.storage.snapshotMeta = s.meta
+	s.storage.snapshot = s.Bytes()
+	s.storage.hasSnapshot = true
+	return nil
+}
+
+func (s *memorySink) Abort() error {
+	return nil
+}
+
+func (ms *MemoryStorage) CreateSnapshot(meta SnapshotMeta) (SnapshotSink, error) {
+	return &memorySink{meta: meta, storage: ms}, nil
+}
+
+func (ms *MemoryStorage) OpenSnapshot() (SnapshotMeta, io.ReadCloser, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if !ms.hasSnapshot {
+		return SnapshotMeta{}, nil, ErrNoSnapshot
+	}
+	return ms.snapshotMeta, io.NopCloser(bytes.NewReader(ms.snapshot)), nil
+}
+
+const (
+	hardStateFile = "state.json"
+	logFile       = "log"
+	snapshotFile  = "snapshot"
+)
+
+// FileStorage keeps the hard state in a small JSON file replaced atomically, the log in an
+// append only file of length prefixed JSON records, and the snapshot in a file that starts with
+// a JSON line of metadata so both are replaced by the same rename
+type FileStorage struct {
+	dir     string
+	log     *os.File
+	offsets []int64 // file offset where each stored entry starts
+	first   uint64  // index of the first stored entry
+	size    int64
+	mu      sync.Mutex
+}
+
+// NewFileStorage opens, or creates, the raft state kept in dir
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir, log: f}, nil
+}
+
+func (fs *FileStorage) Load() (HardState, []Entry, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var st HardState
+	raw, err := os.ReadFile(filepath.Join(fs.dir, hardStateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return st, nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &st); err != nil {
+			return st, nil, fmt.Errorf("corrupt raft hard state: %w", err)
+		}
+	}
+
+	if _, err := fs.log.Seek(0, io.SeekStart); err != nil {
+		return st, nil, err
+	}
+	reader := bufio.NewReader(fs.log)
+	entries := []Entry{}
+	fs.offsets = fs.offsets[:0]
+	var offset int64
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				// a torn write at the tail, the entry was never acknowledged
+				break
+			}
+			return st, nil, err
+		}
+		record := make([]byte, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(reader, record); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				break
+			}
+			return st, nil, err
+		}
+		var e Entry
+		if err := json.Unmarshal(record, &e); err != nil {
+			return st, nil, fmt.Errorf("corrupt raft log record at offset %d: %w", offset, err)
+		}
+		entries = append(entries, e)
+		fs.offsets = append(fs.offsets, offset)
+		offset += int64(len(header) + len(record))
+	}
+	fs.size = offset
+	if err := fs.log.Truncate(offset); err != nil {
+		return st, nil, err
+	}
+	if len(entries) > 0 {
+		fs.first = entries[0].Index
+	}
+	return st, entries, nil
+}
+
+func (fs *FileStorage) SaveHardState(st HardState) error {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(fs.dir, hardStateFile+".tmp")
+	if err := writeFileSync(tmp, raw); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(fs.dir, hardStateFile))
+}
+
+func (fs *FileStorage) Append(entries []Entry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	if len(fs.offsets) == 0 {
+		fs.first = entries[0].Index
+	}
+	buf := []byte{}
+	offset := fs.size
+	for _, e := range entries {
+		record, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		fs.offsets = append(fs.offsets, offset)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(record)))
+		buf = append(buf, record...)
+		offset += int64(4 + len(record))
+	}
+	if _, err := fs.log.WriteAt(buf, fs.size); err != nil {
+		return err
+	}
+	fs.size = offset
+	return fs.log.Sync()
+}
+
+func (fs *FileStorage) TruncateFrom(index uint64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(fs.offsets) == 0 || index >= fs.first+uint64(len(fs.offsets)) {
+		return nil
+	}
+	keep := 0
+	if index > fs.first {
+		keep = int(index - fs.first)
+	}
+	size := int64(0)
+	if keep < len(fs.offsets) {
+		size = fs.offsets[keep]
+	}
+	if err := fs.log.Truncate(size); err != nil {
+		return err
+	}
+	fs.offsets = fs.offsets[:keep]
+	fs.size = size
+	return fs.log.Sync()
+}
+
+func (fs *FileStorage) Compact(index uint64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(fs.offsets) == 0 || index < fs.first {
+		return nil
+	}
+	drop := int(index - fs.first + 1)
+	if drop > len(fs.offsets) {
+		drop = len(fs.offsets)
+	}
+	start := fs.size
+	if drop < len(fs.offsets) {
+		start = fs.offsets[drop]
+	}
+
+	// copy the entries we keep into a fresh file and swap it in
+	tmpPath := filepath.Join(fs.dir, logFile+".tmp")
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(fs.log, start, fs.size-start)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(fs.dir, logFile)); err != nil {
+		tmp.Close()
+		return err
+	}
+	fs.log.Close()
+	fs.log = tmp
+
+	offsets := make([]int64, 0, len(fs.offsets)-drop)
+	for _, o := range fs.offsets[drop:] {
+		offsets = append(offsets, o-start)
+	}
+	fs.offsets = offsets
+	fs.first = index + 1
+	fs.size -= start
+	return nil
+}
+
+type fileSink struct {
+	*os.File
+	dir string
+}
+
+func (s *fileSink) Commit() error {
+	if err := s.Sync(); err != nil {
+		s.Close()
+		return err
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return os.Rename(s.Name(), filepath.Join(s.dir, snapshotFile))
+}
+
+func (s *fileSink) Abort() error {
+	s.Close()
+	return os.Remove(s.Name())
+}
+
+func (fs *FileStorage) CreateSnapshot(meta SnapshotMeta) (SnapshotSink, error) {
+	f, err := os.CreateTemp(fs.dir, snapshotFile+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(meta)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(append(header, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileSink{File: f, dir: fs.dir}, nil
+}
+
+type snapshotReader struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func (fs *FileStorage) OpenSnapshot() (SnapshotMeta, io.ReadCloser, error) {
+	var meta SnapshotMeta
+	f, err := os.Open(filepath.Join(fs.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return meta, nil, ErrNoSnapshot
+	}
+	if err != nil {
+		return meta, nil, err
+	}
+	reader := bufio.NewReader(f)
+	header, err := reader.ReadBytes('\n')
+	if err != nil {
+		f.Close()
+		return meta, nil, fmt.Errorf("corrupt raft snapshot header: %w", err)
+	}
+	if err := json.Unmarshal(header, &meta); err != nil {
+		f.Close()
+		return meta, nil, fmt.Errorf("corrupt raft snapshot header: %w", err)
+	}
+	return meta, snapshotReader{Reader: reader, Closer: f}, nil
+}
+
+// Close releases the log file
+func (fs *FileStorage) Close() error {
+	return fs.log.Close()
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
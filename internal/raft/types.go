@@ -0,0 +1,195 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StateType is the role a node currently plays in its group
+type StateType int
+
+const (
+	Follower StateType = iota
+	Candidate
+	Leader
+)
+
+func (s StateType) String() string {
+	switch s {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// EntryType tells the state machine entries apart from the ones raft uses for itself
+type EntryType int
+
+const (
+	// EntryNormal carries a command for the state machine
+	EntryNormal EntryType = iota
+	// EntryNoop is appended by every new leader so entries of older terms get committed
+	EntryNoop
+	// EntryConfChange carries a JSON encoded ConfChange
+	EntryConfChange
+	// EntryMembership carries a whole JSON encoded Membership. A new group starts with one at index 1,
+	// which is how nodes joining later learn the initial members
+	EntryMembership
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case EntryNormal:
+		return "normal"
+	case EntryNoop:
+		return "noop"
+	case EntryConfChange:
+		return "conf_change"
+	case EntryMembership:
+		return "membership"
+	}
+	return fmt.Sprintf("entry(%d)", int(t))
+}
+
+// Entry is a single slot of the replicated log
+type Entry struct {
+	Index   uint64
+	Term    uint64
+	Type    EntryType
+	Command []byte
+	// TraceParent is the W3C traceparent of the proposal, so every node applies the entry within its trace
+	TraceParent string `json:",omitempty"`
+}
+
+// HardState is what a node has to persist before answering any RPC
+type HardState struct {
+	Term uint64
+	Vote string
+}
+
+// MessageType identifies the RPC a Message carries
+type MessageType int
+
+const (
+	MsgVote MessageType = iota
+	MsgVoteResp
+	MsgApp
+	MsgAppResp
+	MsgSnap
+	MsgSnapResp
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgVote:
+		return "RequestVote"
+	case MsgVoteResp:
+		return "RequestVoteResponse"
+	case MsgApp:
+		return "AppendEntries"
+	case MsgAppResp:
+		return "AppendEntriesResponse"
+	case MsgSnap:
+		return "InstallSnapshot"
+	case MsgSnapResp:
+		return "InstallSnapshotResponse"
+	}
+	return fmt.Sprintf("message(%d)", int(t))
+}
+
+// Message is the envelope of every RPC exchanged between nodes, only the fields of its Type are set
+type Message struct {
+	Type MessageType
+	From string
+	To   string
+	Term uint64
+
+	// RequestVote
+	LastLogIndex uint64
+	LastLogTerm  uint64
+	Granted      bool
+
+	// AppendEntries
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []Entry
+	LeaderCommit uint64
+	Success      bool
+	// Index is the last index the follower matched on success, a hint of where to retry from otherwise
+	Index uint64
+	// Context is the latest read request of the leader, echoed back so it can confirm its leadership
+	Context uint64
+
+	// InstallSnapshot streams Snapshot in chunks: Data starts at byte Offset and Done marks the last chunk.
+	// Responses acknowledge with Offset the number of bytes received so far
+	Snapshot SnapshotMeta
+	Offset   uint64
+	Data     []byte
+	Done     bool
+
+	// TraceParent is the W3C traceparent of the span sending the message, empty outside of any trace
+	TraceParent string
+}
+
+// SnapshotMeta identifies the last log entry a snapshot includes, and the membership as of that entry
+type SnapshotMeta struct {
+	Index      uint64
+	Term       uint64
+	Membership Membership
+}
+
+func (m SnapshotMeta) sameAs(other SnapshotMeta) bool {
+	return m.Index == other.Index && m.Term == other.Term
+}
+
+// Status is a point in time view of a node
+type Status struct {
+	ID          string
+	State       StateType
+	Term        uint64
+	Leader      string
+	CommitIndex uint64
+	LastApplied uint64
+	LastIndex   uint64
+	// SnapshotIndex is the last entry compacted into the snapshot, the log starts right after it
+	SnapshotIndex uint64
+	Membership    Membership
+	// LeaderCommit is the commit index of the leader as of LastContact, the last time this node heard
+	// from it. A leader reports its own commit index and the current time
+	LeaderCommit uint64
+	LastContact  time.Time
+}
+
+var (
+	// ErrNotLeader is matched by every NotLeaderError
+	ErrNotLeader = errors.New("raft: not the leader")
+	// ErrProposalDropped is returned when a proposal got overwritten by a new leader before committing
+	ErrProposalDropped = errors.New("raft: proposal dropped")
+	// ErrStopped is returned for proposals made to, or pending on, a stopped node
+	ErrStopped = errors.New("raft: node stopped")
+	// ErrNoSnapshot is returned by Storage.OpenSnapshot before any snapshot was taken
+	ErrNoSnapshot = errors.New("raft: no snapshot")
+	// ErrConfChangePending is returned for a membership change proposed before the previous one took effect
+	ErrConfChangePending = errors.New("raft: a membership change is already in progress")
+)
+
+// NotLeaderError is returned by proposals made to a follower, Leader is empty when it is not known
+type NotLeaderError struct {
+	Leader string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.Leader == "" {
+		return "raft: not the leader, leader unknown"
+	}
+	return fmt.Sprintf("raft: not the leader, try %s", e.Leader)
+}
+
+func (e *NotLeaderError) Is(target error) bool {
+	return target == ErrNotLeader
+}
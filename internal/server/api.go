@@ -0,0 +1,82 @@
+package server
+
+// Request and response bodies of the HTTP API, api/hermes/v1/hermes.proto describes the same
+// messages for gRPC
+
+// CreateCollectionRequest is the body of PUT /collections/{name}
+type CreateCollectionRequest struct {
+	Dimension int    `json:"dimension"`
+	Distance  string `json:"distance,omitempty"`
+}
+
+// CollectionStats is returned by GET /collections/{name}
+type CollectionStats struct {
+	CollectionInfo
+	Points int `json:"points"`
+}
+
+// ListCollectionsResponse is returned by GET /collections
+type ListCollectionsResponse struct {
+	Collections []CollectionInfo `json:"collections"`
+}
+
+// Point is a datapoint as sent and returned by the API. Only the text field of the payload is
+// kept, indexed for keyword search
+type Point struct {
+	ID      string            `json:"id"`
+	Vector  []float64         `json:"vector"`
+	Payload map[string]string `json:"payload,omitempty"`
+}
+
+// UpsertRequest is the body of PUT /collections/{name}/points
+type UpsertRequest struct {
+	Points []Point `json:"points"`
+}
+
+// UpsertResponse tells how many points were written
+type UpsertResponse struct {
+	Upserted int `json:"upserted"`
+}
+
+// SearchRequest is the body of POST /collections/{name}/search
+type SearchRequest struct {
+	Vector []float64 `json:"vector"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset,omitempty"`
+	// MaxDistance drops hits farther than it, on the scale of radius queries: 1 - cos for cosine
+	MaxDistance *float64 `json:"max_distance,omitempty"`
+	// WithVectors returns the vectors of the hits too
+	WithVectors bool `json:"with_vectors,omitempty"`
+}
+
+// Hit is one search result, Distance being 0 for an identical vector
+type Hit struct {
+	ID       string    `json:"id"`
+	Distance float64   `json:"distance"`
+	Vector   []float64 `json:"vector,omitempty"`
+}
+
+// SearchResponse lists the hits closest first
+type SearchResponse struct {
+	Hits []Hit `json:"hits"`
+}
+
+// ClusterResponse is returned by GET /cluster
+type ClusterResponse struct {
+	Nodes []string `json:"nodes"`
+}
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+const (
+	// defaultSearchLimit is the page size of searches that do not set one
+	defaultSearchLimit = 10
+	// maxSearchLimit and maxSearchOffset bound the pages of searches, the scan keeping
+	// offset+limit hits in memory
+	maxSearchLimit  = 1000
+	maxSearchOffset = 10000
+)
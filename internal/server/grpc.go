@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	hermesv1 "github.com/bjornaer/hermes/api/hermes/v1"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/raft"
+	"github.com/bjornaer/hermes/internal/trace"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// LeaderMetadata is the header of the gRPC answers of a follower to a write, holding the address
+	// of the leader the write has to be sent to
+	LeaderMetadata = "hermes-leader"
+	// traceParentMetadata carries the W3C traceparent of a call, as the header of the same name does
+	traceParentMetadata = "traceparent"
+)
+
+// GRPCServer returns a gRPC server of the Hermes service of api/hermes/v1/hermes.proto, answering
+// from the same collections as the HTTP API with the same limits, request IDs and access log
+func (s *Server) GRPCServer() *grpc.Server {
+	g := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(s.cfg.MaxBodyBytes)),
+		grpc.UnaryInterceptor(s.unaryRequestIDs),
+	)
+	hermesv1.RegisterHermesServer(g, &grpcService{s: s})
+	return g
+}
+
+// unaryRequestIDs is the gRPC counterpart of withRequestIDs, the IDs travelling as the metadata
+// keys x-request-id and x-correlation-id
+func (s *Server) unaryRequestIDs(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	requestID := first(RequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	correlationID := first(CorrelationIDHeader)
+	if correlationID == "" {
+		correlationID = requestID
+	}
+	ctx = log.WithCorrelationID(log.WithRequestID(ctx, requestID), correlationID)
+	if parent := first(traceParentMetadata); parent != "" {
+		ctx = trace.ContextWithTraceParent(ctx, parent)
+	}
+	ctx, span := trace.Start(ctx, "gRPC "+info.FullMethod, trace.WithKind(trace.KindServer),
+		trace.WithAttributes(
+			trace.Attr("rpc.method", info.FullMethod),
+			trace.Attr("rpc.request_id", requestID),
+		))
+	defer span.End()
+	_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(RequestIDHeader), requestID, strings.ToLower(CorrelationIDHeader), correlationID))
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err)
+	span.SetAttributes(trace.Attr("rpc.grpc.status_code", code.String()))
+	if code == codes.Internal || code == codes.Unavailable {
+		span.RecordError(err)
+	}
+	s.logger.With(ctx, "method", info.FullMethod, "code", code.String(), "duration", time.Since(start)).
+		Info("request served")
+	return resp, err
+}
+
+// grpcError maps err to the gRPC status matching the HTTP one statusOf gives, a follower naming
+// the leader in the LeaderMetadata header
+func (s *Server) grpcError(ctx context.Context, err error) error {
+	var notLeader *raft.NotLeaderError
+	if s.cfg.Replication != nil && errors.As(err, &notLeader) {
+		if addr, ok := s.cfg.Replication.Peers[notLeader.Leader]; ok && notLeader.Leader != s.cfg.Replication.NodeID {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(LeaderMetadata, addr))
+		}
+	}
+	code := codes.Internal
+	switch statusOf(err) {
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusRequestEntityTooLarge:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	case statusClientClosedRequest:
+		code = codes.Canceled
+	}
+	return status.Error(code, err.Error())
+}
+
+// grpcService implements hermesv1.HermesServer over the collections of s
+type grpcService struct {
+	hermesv1.UnimplementedHermesServer
+	s *Server
+}
+
+func (g *grpcService) ListCollections(ctx context.Context, req *hermesv1.ListCollectionsRequest) (*hermesv1.ListCollectionsResponse, error) {
+	resp := &hermesv1.ListCollectionsResponse{}
+	for _, info := range g.s.collections.list() {
+		resp.Collections = append(resp.Collections, collectionInfo(info))
+	}
+	return resp, nil
+}
+
+func (g *grpcService) CreateCollection(ctx context.Context, req *hermesv1.CreateCollectionRequest) (*hermesv1.CollectionInfo, error) {
+	info, err := g.s.collections.create(CollectionInfo{Name: req.GetName(), Dimension: int(req.GetDimension()), Distance: req.GetDistance()})
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	return collectionInfo(info), nil
+}
+
+func (g *grpcService) GetCollection(ctx context.Context, req *hermesv1.GetCollectionRequest) (*hermesv1.CollectionStats, error) {
+	c, err := g.s.collections.get(req.GetName())
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	stats, err := c.stats(ctx)
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	return &hermesv1.CollectionStats{Info: collectionInfo(stats.CollectionInfo), Points: int64(stats.Points)}, nil
+}
+
+func (g *grpcService) DropCollection(ctx context.Context, req *hermesv1.DropCollectionRequest) (*hermesv1.DropCollectionResponse, error) {
+	if err := g.s.collections.drop(req.GetName()); err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	return &hermesv1.DropCollectionResponse{}, nil
+}
+
+func (g *grpcService) Upsert(ctx context.Context, req *hermesv1.UpsertRequest) (*hermesv1.UpsertResponse, error) {
+	c, err := g.s.collections.get(req.GetCollection())
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	points := make([]Point, 0, len(req.GetPoints()))
+	for _, p := range req.GetPoints() {
+		points = append(points, Point{ID: p.GetId(), Vector: p.GetVector(), Payload: p.GetPayload()})
+	}
+	upserted, err := g.s.upsertPoints(ctx, c, points)
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	return &hermesv1.UpsertResponse{Upserted: int32(upserted)}, nil
+}
+
+func (g *grpcService) GetPoint(ctx context.Context, req *hermesv1.GetPointRequest) (*hermesv1.Point, error) {
+	c, err := g.s.collections.get(req.GetCollection())
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	p, err := c.point(ctx, req.GetId())
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	return &hermesv1.Point{Id: p.ID, Vector: p.Vector}, nil
+}
+
+func (g *grpcService) DeletePoint(ctx context.Context, req *hermesv1.DeletePointRequest) (*hermesv1.DeletePointResponse, error) {
+	c, err := g.s.collections.get(req.GetCollection())
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	if err := c.deletePoint(ctx, req.GetId()); err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	return &hermesv1.DeletePointResponse{}, nil
+}
+
+func (g *grpcService) SearchByVector(ctx context.Context, req *hermesv1.SearchRequest) (*hermesv1.SearchResponse, error) {
+	c, err := g.s.collections.get(req.GetCollection())
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	hits, err := c.search(ctx, SearchRequest{
+		Vector:      req.GetVector(),
+		Limit:       int(req.GetLimit()),
+		Offset:      int(req.GetOffset()),
+		MaxDistance: req.MaxDistance,
+		WithVectors: req.GetWithVectors(),
+	})
+	if err != nil {
+		return nil, g.s.grpcError(ctx, err)
+	}
+	resp := &hermesv1.SearchResponse{}
+	for _, hit := range hits {
+		resp.Hits = append(resp.Hits, &hermesv1.Hit{Id: hit.ID, Distance: hit.Distance, Vector: hit.Vector})
+	}
+	return resp, nil
+}
+
+func collectionInfo(info CollectionInfo) *hermesv1.CollectionInfo {
+	return &hermesv1.CollectionInfo{
+		Name:      info.Name,
+		Dimension: int32(info.Dimension),
+		Distance:  info.Distance,
+		CreatedAt: timestamppb.New(info.CreatedAt),
+	}
+}
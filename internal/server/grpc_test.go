@@ -0,0 +1,102 @@
+package server_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	hermesv1 "github.com/bjornaer/hermes/api/hermes/v1"
+	"github.com/bjornaer/hermes/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// dialGRPC serves the gRPC service of s and returns a client of it
+func dialGRPC(t *testing.T, s *server.Server) hermesv1.HermesClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	g := s.GRPCServer()
+	go g.Serve(ln)
+	t.Cleanup(g.Stop)
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return hermesv1.NewHermesClient(conn)
+}
+
+func TestGRPC(t *testing.T) {
+	s := newServer(t, server.Config{})
+	client := dialGRPC(t, s)
+	ctx := context.Background()
+
+	info, err := client.CreateCollection(ctx, &hermesv1.CreateCollectionRequest{Name: "docs", Dimension: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "cosine", info.Distance)
+	_, err = client.CreateCollection(ctx, &hermesv1.CreateCollectionRequest{Name: "docs", Dimension: 2})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	upserted, err := client.Upsert(ctx, &hermesv1.UpsertRequest{Collection: "docs", Points: []*hermesv1.Point{
+		{Id: "a", Vector: []float64{1, 0}},
+		{Id: "b", Vector: []float64{0, 1}},
+	}})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, upserted.Upserted)
+	_, err = client.Upsert(ctx, &hermesv1.UpsertRequest{Collection: "docs", Points: []*hermesv1.Point{{Id: "c", Vector: []float64{1}}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the HTTP API sees what was written over gRPC
+	var stats server.CollectionStats
+	call(t, s.Handler(), "GET", "/collections/docs", nil, &stats)
+	assert.Equal(t, 2, stats.Points)
+	grpcStats, err := client.GetCollection(ctx, &hermesv1.GetCollectionRequest{Name: "docs"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, grpcStats.Points)
+
+	point, err := client.GetPoint(ctx, &hermesv1.GetPointRequest{Collection: "docs", Id: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 0}, point.Vector)
+
+	maxDistance := 0.5
+	hits, err := client.SearchByVector(ctx, &hermesv1.SearchRequest{Collection: "docs", Vector: []float64{1, 0.1}, MaxDistance: &maxDistance, WithVectors: true})
+	require.NoError(t, err)
+	require.Len(t, hits.Hits, 1)
+	assert.Equal(t, "a", hits.Hits[0].Id)
+	assert.Equal(t, []float64{1, 0}, hits.Hits[0].Vector)
+	_, err = client.SearchByVector(ctx, &hermesv1.SearchRequest{Collection: "docs", Vector: []float64{1, 0}, Limit: 5000})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DeletePoint(ctx, &hermesv1.DeletePointRequest{Collection: "docs", Id: "a"})
+	require.NoError(t, err)
+	_, err = client.GetPoint(ctx, &hermesv1.GetPointRequest{Collection: "docs", Id: "a"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.DeletePoint(ctx, &hermesv1.DeletePointRequest{Collection: "docs", Id: "a"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListCollections(ctx, &hermesv1.ListCollectionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Collections, 1)
+	assert.Equal(t, "docs", list.Collections[0].Name)
+	_, err = client.DropCollection(ctx, &hermesv1.DropCollectionRequest{Name: "docs"})
+	require.NoError(t, err)
+	_, err = client.GetCollection(ctx, &hermesv1.GetCollectionRequest{Name: "docs"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCRequestIDsAndSizeLimit(t *testing.T) {
+	client := dialGRPC(t, newServer(t, server.Config{MaxBodyBytes: 1024}))
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-1")
+	_, err := client.ListCollections(ctx, &hermesv1.ListCollectionsRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"req-1"}, header.Get("x-request-id"))
+	assert.Equal(t, []string{"req-1"}, header.Get("x-correlation-id"))
+
+	_, err = client.Upsert(context.Background(), &hermesv1.UpsertRequest{Collection: "docs", Points: []*hermesv1.Point{{Id: "a", Vector: make([]float64, 512)}}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
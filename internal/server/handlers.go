@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/metrics"
+	"github.com/bjornaer/hermes/internal/raft"
+)
+
+// statusClientClosedRequest answers requests whose client went away before they were served, as
+// nginx does. Nobody reads it, but it keeps them apart from failures in the access log and metrics
+const statusClientClosedRequest = 499
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errBodyTooLarge   = errors.New("request body too large")
+	errPointNotFound  = errors.New("point does not exist")
+)
+
+// routes registers the handlers of the API
+func (s *Server) routes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", s.health)
+	mux.Handle("GET /metrics", metrics.Handler(metrics.Default))
+	if s.cfg.Cluster != nil {
+		mux.HandleFunc("GET /cluster", s.clusterNodes)
+	}
+	if s.cfg.Gossip != nil {
+		mux.Handle("POST "+gossip.HTTPPath, gossip.Handler(s.cfg.Gossip))
+	}
+	if s.cfg.Replication != nil {
+		mux.HandleFunc("POST "+raft.HTTPPath+"{group}", s.raftMessage)
+	}
+	mux.HandleFunc("GET /collections", s.listCollections)
+	mux.HandleFunc("PUT /collections/{collection}", s.createCollection)
+	mux.HandleFunc("GET /collections/{collection}", s.getCollection)
+	mux.HandleFunc("DELETE /collections/{collection}", s.dropCollection)
+	mux.HandleFunc("GET /collections/{collection}/points", s.scan)
+	mux.HandleFunc("PUT /collections/{collection}/points", s.upsert)
+	mux.HandleFunc("GET /collections/{collection}/points/{id}", s.getPoint)
+	mux.HandleFunc("DELETE /collections/{collection}/points/{id}", s.deletePoint)
+	mux.HandleFunc("POST /collections/{collection}/search", s.search)
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) clusterNodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ClusterResponse{Nodes: s.cfg.Cluster.Members()})
+}
+
+func (s *Server) listCollections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ListCollectionsResponse{Collections: s.collections.list()})
+}
+
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var req CreateCollectionRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	info, err := s.collections.create(CollectionInfo{Name: r.PathValue("collection"), Dimension: req.Dimension, Distance: req.Distance})
+	if err != nil {
+		s.writeFailure(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func (s *Server) getCollection(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collections.get(r.PathValue("collection"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	stats, err := c.stats(r.Context())
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// stats counts the points of c
+func (c *collection) stats(ctx context.Context) (CollectionStats, error) {
+	points := 0
+	err := c.storage.EachContext(ctx, func(string, string, time.Time) error {
+		points++
+		return nil
+	})
+	return CollectionStats{CollectionInfo: c.info, Points: points}, err
+}
+
+func (s *Server) dropCollection(w http.ResponseWriter, r *http.Request) {
+	if err := s.collections.drop(r.PathValue("collection")); err != nil {
+		s.writeFailure(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) upsert(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collections.get(r.PathValue("collection"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	var req UpsertRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	upserted, err := s.upsertPoints(r.Context(), c, req.Points)
+	if err != nil {
+		s.writeFailure(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, UpsertResponse{Upserted: upserted})
+}
+
+// upsertPoints writes points to c, checking the whole batch first so a bad point does not leave it
+// half written
+func (s *Server) upsertPoints(ctx context.Context, c *collection, points []Point) (int, error) {
+	dps := make([]types.DataPoint[string], 0, len(points))
+	for _, p := range points {
+		if p.ID == "" {
+			return 0, fmt.Errorf("%w: point without id", errInvalidRequest)
+		}
+		if err := c.checkDimension(p.Vector); err != nil {
+			return 0, fmt.Errorf("point %q: %w", p.ID, err)
+		}
+		dp := types.NewDataPointWithPayload(p.ID, p.Vector, p.Payload)
+		if err := c.storage.Validate(*dp); err != nil {
+			return 0, fmt.Errorf("point %q: %w", p.ID, err)
+		}
+		dps = append(dps, *dp)
+	}
+	for i, dp := range dps {
+		if err := c.add(ctx, dp); err != nil {
+			if i > 0 {
+				s.logger.With(ctx, "collection", c.info.Name, "id", dp.ID).Errorf("upsert failed after %d points: %v", i, err)
+			}
+			return i, fmt.Errorf("point %q: %w", dp.ID, err)
+		}
+	}
+	return len(dps), nil
+}
+
+// scan streams every point of the collection as JSON lines, in no particular order
+func (s *Server) scan(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collections.get(r.PathValue("collection"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	err = c.storage.EachContext(r.Context(), func(id, value string, _ time.Time) error {
+		v, _, err := vector.DecodeEmbedding(value)
+		if err != nil {
+			return fmt.Errorf("point %q: %w", id, err)
+		}
+		return enc.Encode(Point{ID: id, Vector: v})
+	})
+	if err != nil {
+		// the status is sent already, the client sees the stream end early
+		s.logger.With(r.Context(), "collection", c.info.Name).Errorf("scan failed: %v", err)
+	}
+}
+
+func (s *Server) getPoint(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collections.get(r.PathValue("collection"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	p, err := c.point(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// point returns the point id of c, errPointNotFound when it has none
+func (c *collection) point(ctx context.Context, id string) (Point, error) {
+	v, found, err := c.storage.GetContext(ctx, id)
+	if err != nil {
+		return Point{}, err
+	}
+	if !found {
+		return Point{}, errPointNotFound
+	}
+	return Point{ID: id, Vector: v}, nil
+}
+
+func (s *Server) deletePoint(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collections.get(r.PathValue("collection"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	if err := c.deletePoint(r.Context(), r.PathValue("id")); err != nil {
+		s.writeFailure(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePoint deletes the point id of c, errPointNotFound when it has none
+func (c *collection) deletePoint(ctx context.Context, id string) error {
+	err := c.delete(ctx, id)
+	if errors.Is(err, disk.ErrNotFound) {
+		return errPointNotFound
+	}
+	return err
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collections.get(r.PathValue("collection"))
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	var req SearchRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	hits, err := c.search(r.Context(), req)
+	if err != nil {
+		writeError(w, r, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SearchResponse{Hits: hits})
+}
+
+// search returns the page of the points of c closest to req.Vector that req asks for
+func (c *collection) search(ctx context.Context, req SearchRequest) ([]Hit, error) {
+	if err := c.checkDimension(req.Vector); err != nil {
+		return nil, err
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit and offset cannot be negative", errInvalidRequest)
+	}
+	if req.Limit > maxSearchLimit || req.Offset > maxSearchOffset {
+		return nil, fmt.Errorf("%w: limit cannot be above %d, offset above %d", errInvalidRequest, maxSearchLimit, maxSearchOffset)
+	}
+	opts := disk.SearchOptions{Limit: req.Limit, Offset: req.Offset}
+	if req.MaxDistance != nil {
+		threshold := c.distanceMeasure.Denormalize(*req.MaxDistance)
+		opts.Threshold = &threshold
+	}
+	results, err := c.storage.SearchContext(ctx, req.Vector, opts)
+	if err != nil {
+		return nil, err
+	}
+	hits := []Hit{}
+	for _, result := range *results {
+		hit := Hit{ID: result.ID, Distance: result.Distance}
+		if req.WithVectors {
+			hit.Vector = result.Vector
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// checkDimension fails for vectors of another dimension than the collection's
+func (c *collection) checkDimension(v []float64) error {
+	if len(v) != c.info.Dimension {
+		return fmt.Errorf("%w: collection %q: %w", errInvalidRequest, c.info.Name, &disk.DimensionError{Want: c.info.Dimension, Got: len(v)})
+	}
+	return nil
+}
+
+// decode reads the JSON body of r into v, rejecting unknown fields
+func decode(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errBodyTooLarge
+		}
+		return fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+	return nil
+}
+
+// statusOf maps the errors of the API and of the storage to HTTP statuses
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownCollection), errors.Is(err, errPointNotFound), errors.Is(err, disk.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCollectionExists):
+		return http.StatusConflict
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidCollection), errors.Is(err, errInvalidRequest),
+		errors.Is(err, disk.ErrKeyTooLarge), errors.Is(err, disk.ErrValueTooLarge), errors.Is(err, disk.ErrReservedKey),
+		errors.Is(err, disk.ErrDimensionMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, disk.ErrClosed), errors.Is(err, raft.ErrNotLeader), errors.Is(err, raft.ErrStopped):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error(), RequestID: log.RequestID(r.Context())})
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/bjornaer/hermes/internal/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("hermes_http_requests_total", "API requests served, by method and status code.", "method", "code")
+	httpSeconds  = metrics.NewHistogramVec("hermes_http_request_seconds", "Time taken to serve an API request, by method.", nil, "method")
+)
+
+// methodLabel keeps the methods of the API as they are and folds the others into one label value,
+// so arbitrary methods cannot create series
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodHead:
+		return method
+	}
+	return "OTHER"
+}
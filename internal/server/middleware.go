@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/trace"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request, generated when the caller did not set one
+	RequestIDHeader = "X-Request-ID"
+	// CorrelationIDHeader carries the ID shared by every request made for the same operation,
+	// the request ID when the caller did not set one
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
+// statusRecorder remembers the status written, for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestIDs puts the request and correlation IDs in the request context, where log.Logger.With
+// picks them up, echoes them back as headers and logs every request once served. Every request is
+// served within a span, child of the one its traceparent header names if any
+func withRequestIDs(logger log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		correlationID := r.Header.Get(CorrelationIDHeader)
+		if correlationID == "" {
+			correlationID = requestID
+		}
+		ctx := log.WithCorrelationID(log.WithRequestID(r.Context(), requestID), correlationID)
+		ctx, span := trace.Start(trace.Extract(ctx, r.Header), "HTTP "+r.Method, trace.WithKind(trace.KindServer),
+			trace.WithAttributes(
+				trace.Attr("http.method", r.Method),
+				trace.Attr("http.target", r.URL.Path),
+				trace.Attr("http.request_id", requestID),
+			))
+		defer span.End()
+		w.Header().Set(RequestIDHeader, requestID)
+		w.Header().Set(CorrelationIDHeader, correlationID)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		method := methodLabel(r.Method)
+		httpRequests.With(method, strconv.Itoa(rec.status)).Inc()
+		httpSeconds.With(method).Since(start)
+		span.SetAttributes(trace.Attr("http.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(rec.status)))
+		}
+		logger.With(ctx, "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start)).
+			Info("request served")
+	})
+}
+
+// withBodyLimit fails reads of request bodies larger than limit bytes, 0 leaving them unbounded
+func withBodyLimit(limit int64, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			writeError(w, r, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
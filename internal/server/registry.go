@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/btree"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/raft"
+)
+
+var (
+	// ErrCollectionExists is returned when creating a collection under a name already in use
+	ErrCollectionExists = errors.New("collection already exists")
+	// ErrUnknownCollection is returned for operations on a collection that does not exist
+	ErrUnknownCollection = errors.New("collection does not exist")
+	// ErrInvalidCollection is returned when a collection name or definition cannot be used
+	ErrInvalidCollection = errors.New("invalid collection")
+)
+
+const manifestFile = "collections.json"
+
+// collectionName keeps names usable as file names
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// distances maps the names accepted by the API to the measures of the vector package
+var distances = map[string]func() vector.DistanceMeasure{
+	"cosine":    vector.NewCosineDistanceMeasure,
+	"euclidean": vector.NewEuclideanDistanceMeasure,
+}
+
+// CollectionInfo describes a collection, it is what the manifest stores for each of them
+type CollectionInfo struct {
+	Name      string `json:"name"`
+	Dimension int    `json:"dimension"`
+	Distance  string `json:"distance"`
+	// BlockSize is the block size of the collection file, the default one when 0
+	BlockSize int       `json:"block_size,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// collection is an open collection: its definition and the storage holding its datapoints.
+// A replicated collection is read from its local replica and written through its raft group
+type collection struct {
+	info            CollectionInfo
+	storage         *disk.DiskStorage[string]
+	distanceMeasure vector.DistanceMeasure
+	replicated      *disk.ReplicatedStorage[string]
+	group           *group
+}
+
+func (c *collection) add(ctx context.Context, dp types.DataPoint[string]) error {
+	if c.replicated != nil {
+		return c.replicated.AddContext(ctx, dp)
+	}
+	return c.storage.AddContext(ctx, dp)
+}
+
+func (c *collection) delete(ctx context.Context, id string) error {
+	if c.replicated != nil {
+		return c.replicated.DeleteContext(ctx, id)
+	}
+	return c.storage.DeleteContext(ctx, id)
+}
+
+func (c *collection) close() error {
+	var errs []error
+	if c.replicated != nil {
+		c.replicated.Stop()
+		errs = append(errs, c.group.close())
+	}
+	return errors.Join(append(errs, c.storage.Close())...)
+}
+
+// registry keeps the collections of a data directory, one B-tree file each, and the manifest
+// listing them so they are reopened on restart. With replication the manifest is changed by the
+// meta raft group only
+type registry struct {
+	dir string
+	// blockSize is the block size of the files of new collections
+	blockSize   int
+	collections map[string]*collection
+	mu          sync.RWMutex
+
+	replication *Replication
+	logger      log.Logger
+	meta        *raft.Node
+	metaGroup   *group
+}
+
+// openRegistry opens every collection listed in the manifest of dir, creating dir if needed.
+// New collections are made of blocks of blockSize bytes, existing ones keep theirs. Collections
+// are replicated when replication is not nil
+func openRegistry(dir string, blockSize int, replication *Replication, logger log.Logger) (*registry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := &registry{dir: dir, blockSize: blockSize, collections: map[string]*collection{}, replication: replication, logger: logger}
+	infos, err := r.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		c, err := r.open(info)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.collections[info.Name] = c
+	}
+	if replication != nil {
+		if err := r.startMeta(); err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *registry) readManifest() ([]CollectionInfo, error) {
+	infos := []CollectionInfo{}
+	raw, err := os.ReadFile(filepath.Join(r.dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return infos, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &infos); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", manifestFile, err)
+	}
+	return infos, nil
+}
+
+func (r *registry) path(name string) string {
+	return filepath.Join(r.dir, name+".db")
+}
+
+func (r *registry) open(info CollectionInfo) (*collection, error) {
+	newMeasure, ok := distances[info.Distance]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown distance %q", ErrInvalidCollection, info.Distance)
+	}
+	storage, err := disk.OpenDiskStorage[string](btree.Config{Path: r.path(info.Name), BlockSize: info.BlockSize})
+	if err != nil {
+		return nil, err
+	}
+	dm := newMeasure()
+	storage.SetDistanceMeasure(dm)
+	c := &collection{info: info, storage: storage, distanceMeasure: dm}
+	if r.replication != nil {
+		if err := r.replicate(c); err != nil {
+			storage.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// writeManifest saves the collection definitions, replacing the file in one rename. It expects mu held
+func (r *registry) writeManifest() error {
+	infos := make([]CollectionInfo, 0, len(r.collections))
+	for _, c := range r.collections {
+		infos = append(infos, c.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	raw, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(r.dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(r.dir, manifestFile))
+}
+
+// create adds a collection, cosine being the distance when none is given
+func (r *registry) create(info CollectionInfo) (CollectionInfo, error) {
+	if !collectionName.MatchString(info.Name) {
+		return CollectionInfo{}, fmt.Errorf("%w: name %q must be 1 to 64 letters, digits, '-' or '_'", ErrInvalidCollection, info.Name)
+	}
+	if info.Dimension <= 0 {
+		return CollectionInfo{}, fmt.Errorf("%w: dimension must be positive", ErrInvalidCollection)
+	}
+	if info.Distance == "" {
+		info.Distance = "cosine"
+	}
+	info.BlockSize = r.blockSize
+	info.CreatedAt = time.Now().UTC()
+
+	var err error
+	if r.meta != nil {
+		err = r.propose(manifestCommand{Op: opCreate, Info: info})
+	} else {
+		err = r.add(info)
+	}
+	if err != nil {
+		return CollectionInfo{}, err
+	}
+	return info, nil
+}
+
+// add opens a collection and lists it in the manifest
+func (r *registry) add(info CollectionInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.collections[info.Name]; exists {
+		return ErrCollectionExists
+	}
+	c, err := r.open(info)
+	if err != nil {
+		return err
+	}
+	r.collections[info.Name] = c
+	if err := r.writeManifest(); err != nil {
+		delete(r.collections, info.Name)
+		c.close()
+		return err
+	}
+	return nil
+}
+
+// drop closes a collection and deletes its files
+func (r *registry) drop(name string) error {
+	if r.meta != nil {
+		return r.propose(manifestCommand{Op: opDrop, Info: CollectionInfo{Name: name}})
+	}
+	return r.remove(name)
+}
+
+// remove takes a collection off the manifest and deletes its files
+func (r *registry) remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.collections[name]
+	if !ok {
+		return ErrUnknownCollection
+	}
+	delete(r.collections, name)
+	if err := r.writeManifest(); err != nil {
+		r.collections[name] = c
+		return err
+	}
+	if err := c.close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(r.raftDir(name)); err != nil {
+		return err
+	}
+	return os.Remove(r.path(name))
+}
+
+func (r *registry) get(name string) (*collection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.collections[name]
+	if !ok {
+		return nil, ErrUnknownCollection
+	}
+	return c, nil
+}
+
+// list returns the collection definitions sorted by name
+func (r *registry) list() []CollectionInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]CollectionInfo, 0, len(r.collections))
+	for _, c := range r.collections {
+		infos = append(infos, c.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// close releases the files of every collection
+func (r *registry) close() error {
+	errs := []error{r.stopMeta()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, c := range r.collections {
+		errs = append(errs, c.close())
+		delete(r.collections, name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/raft"
+	"github.com/bjornaer/hermes/internal/transport"
+)
+
+// Replication names this node and the nodes replicating the collections with it. Every collection
+// is a raft group of all of them, and one more group replicates the creation and drop of
+// collections, so every node holds the same ones
+type Replication struct {
+	// NodeID is the ID of this node, a key of Peers
+	NodeID string
+	// Peers maps the ID of every node, this one included, to the address its API is served on
+	Peers map[string]string
+	// TickInterval paces the raft nodes, see raft.Config
+	TickInterval time.Duration
+}
+
+const (
+	// metaGroup is the group replicating the manifest, named so no collection can take its name
+	metaGroup = ".collections"
+	// appliedFile remembers the last entry of the meta group applied to the manifest
+	appliedFile = "collections.applied"
+	// snapshotThreshold is how many entries the log of a collection grows before it is compacted
+	snapshotThreshold = 4096
+	// proposeTimeout bounds how long creating or dropping a collection waits to be committed
+	proposeTimeout = 5 * time.Second
+)
+
+func (rep *Replication) validate() error {
+	if _, ok := rep.Peers[rep.NodeID]; !ok {
+		return fmt.Errorf("replication: node %q is not among the peers", rep.NodeID)
+	}
+	return nil
+}
+
+func (rep *Replication) ids() []string {
+	ids := make([]string, 0, len(rep.Peers))
+	for id := range rep.Peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// group is what a raft node of this server holds open besides itself
+type group struct {
+	storage   *raft.FileStorage
+	transport *transport.HTTP[raft.Message]
+}
+
+func (g *group) close() error {
+	g.transport.Close()
+	return g.storage.Close()
+}
+
+// raftConfig returns the settings of the raft node of name, its log kept in a directory next to
+// the collection files
+func (r *registry) raftConfig(name string) (raft.Config, *group, error) {
+	storage, err := raft.NewFileStorage(r.raftDir(name))
+	if err != nil {
+		return raft.Config{}, nil, err
+	}
+	g := &group{storage: storage, transport: raft.NewHTTPTransport(name, r.replication.Peers, r.logger)}
+	return raft.Config{
+		ID:           r.replication.NodeID,
+		Peers:        r.replication.ids(),
+		Storage:      storage,
+		Transport:    g.transport,
+		Logger:       r.logger.With(context.Background(), "raft_group", name),
+		TickInterval: r.replication.TickInterval,
+	}, g, nil
+}
+
+func (r *registry) raftDir(name string) string {
+	return filepath.Join(r.dir, name+".raft")
+}
+
+// replicate puts the storage of c behind the raft group of its collection
+func (r *registry) replicate(c *collection) error {
+	cfg, g, err := r.raftConfig(c.info.Name)
+	if err != nil {
+		return err
+	}
+	cfg.SnapshotThreshold = snapshotThreshold
+	rs, err := disk.NewReplicatedStorage(c.storage, cfg)
+	if err != nil {
+		g.close()
+		return err
+	}
+	c.replicated, c.group = rs, g
+	return nil
+}
+
+// startMeta starts the group replicating the manifest. Its log is never compacted, holding one
+// entry per collection created or dropped
+func (r *registry) startMeta() error {
+	cfg, g, err := r.raftConfig(metaGroup)
+	if err != nil {
+		return err
+	}
+	cfg.StateMachine = &manifestMachine{r: r}
+	node, err := raft.NewNode(cfg)
+	if err != nil {
+		g.close()
+		return err
+	}
+	r.meta, r.metaGroup = node, g
+	node.Start()
+	return nil
+}
+
+// stopMeta stops the meta group, which must happen before the collections are closed as applying
+// its entries opens and closes them
+func (r *registry) stopMeta() error {
+	if r.meta == nil {
+		return nil
+	}
+	r.meta.Stop()
+	return r.metaGroup.close()
+}
+
+// node returns the raft node of group, nil when this server has none
+func (r *registry) node(group string) *raft.Node {
+	if group == metaGroup {
+		return r.meta
+	}
+	c, err := r.get(group)
+	if err != nil || c.replicated == nil {
+		return nil
+	}
+	return c.replicated.Node()
+}
+
+type manifestOp string
+
+const (
+	opCreate manifestOp = "create"
+	opDrop   manifestOp = "drop"
+)
+
+// manifestCommand is a change of the manifest as it travels through the log of the meta group
+type manifestCommand struct {
+	Op   manifestOp     `json:"op"`
+	Info CollectionInfo `json:"info"`
+}
+
+// propose waits for cmd to be applied to the manifest, returning the error applying it gave
+func (r *registry) propose(cmd manifestCommand) error {
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), proposeTimeout)
+	defer cancel()
+	return r.meta.Propose(ctx, raw)
+}
+
+// manifestMachine applies the entries of the meta group to the registry
+type manifestMachine struct {
+	r *registry
+}
+
+func (m *manifestMachine) Apply(index uint64, raw []byte) error {
+	var cmd manifestCommand
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return fmt.Errorf("undecodable manifest command at index %d: %w", index, err)
+	}
+	var err error
+	switch cmd.Op {
+	case opCreate:
+		err = m.r.add(cmd.Info)
+	case opDrop:
+		err = m.r.remove(cmd.Info.Name)
+	default:
+		err = fmt.Errorf("unknown manifest command %q", cmd.Op)
+	}
+	// the manifest is written first, an entry applied again after a crash in between fails
+	// with ErrCollectionExists or ErrUnknownCollection and changes nothing
+	tmp := filepath.Join(m.r.dir, appliedFile+".tmp")
+	if writeErr := os.WriteFile(tmp, []byte(strconv.FormatUint(index, 10)), 0o644); writeErr != nil {
+		return writeErr
+	}
+	if renameErr := os.Rename(tmp, filepath.Join(m.r.dir, appliedFile)); renameErr != nil {
+		return renameErr
+	}
+	return err
+}
+
+func (m *manifestMachine) AppliedIndex() uint64 {
+	raw, err := os.ReadFile(filepath.Join(m.r.dir, appliedFile))
+	if err != nil {
+		return 0
+	}
+	index, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// raftMessage hands a message posted by another node to the raft node of its group
+func (s *Server) raftMessage(w http.ResponseWriter, r *http.Request) {
+	node := s.collections.node(r.PathValue("group"))
+	if node == nil {
+		writeError(w, r, http.StatusNotFound, fmt.Errorf("%w: no raft group %q", ErrUnknownCollection, r.PathValue("group")))
+		return
+	}
+	raft.Handler(node).ServeHTTP(w, r)
+}
+
+// writeFailure answers err, sending writes that reached a follower to the leader of the group
+func (s *Server) writeFailure(w http.ResponseWriter, r *http.Request, err error) {
+	var notLeader *raft.NotLeaderError
+	if s.cfg.Replication != nil && errors.As(err, &notLeader) {
+		if addr, ok := s.cfg.Replication.Peers[notLeader.Leader]; ok && notLeader.Leader != s.cfg.Replication.NodeID {
+			http.Redirect(w, r, strings.TrimSuffix(addr, "/")+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+	}
+	writeError(w, r, statusOf(err), err)
+}
@@ -0,0 +1,151 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startReplicated serves size nodes replicating their collections, returning their addresses
+func startReplicated(t *testing.T, size int) []string {
+	listeners := []net.Listener{}
+	peers := map[string]string{}
+	for i := 0; i < size; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listeners = append(listeners, ln)
+		peers[fmt.Sprintf("n%d", i)] = "http://" + ln.Addr().String()
+	}
+	addrs := []string{}
+	for i, ln := range listeners {
+		id := fmt.Sprintf("n%d", i)
+		logger, _ := log.NewForTest()
+		s, err := server.New(server.Config{DataDir: t.TempDir(), Replication: &server.Replication{NodeID: id, Peers: peers}}, logger)
+		require.NoError(t, err)
+		srv := &httptest.Server{Listener: ln, Config: &http.Server{Handler: s.Handler()}}
+		srv.Start()
+		t.Cleanup(func() {
+			srv.Close()
+			s.Close()
+		})
+		addrs = append(addrs, peers[id])
+	}
+	return addrs
+}
+
+func send(t *testing.T, client *http.Client, method, url string, body any) *http.Response {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestReplicatedCollections(t *testing.T) {
+	addrs := startReplicated(t, 3)
+	client := &http.Client{Timeout: 10 * time.Second}
+	noRedirects := &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	// writes reaching a follower are redirected to the leader, none is elected at first
+	require.Eventually(t, func() bool {
+		resp := send(t, client, http.MethodPut, addrs[1]+"/collections/docs", server.CreateCollectionRequest{Dimension: 2})
+		return resp.StatusCode == http.StatusCreated
+	}, 10*time.Second, 20*time.Millisecond)
+	for _, addr := range addrs {
+		require.Eventually(t, func() bool {
+			return send(t, client, http.MethodGet, addr+"/collections/docs", nil).StatusCode == http.StatusOK
+		}, 5*time.Second, 10*time.Millisecond, "%s has the collection", addr)
+	}
+	resp := send(t, client, http.MethodPut, addrs[2]+"/collections/docs", server.CreateCollectionRequest{Dimension: 2})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	redirected := 0
+	for i, addr := range addrs {
+		upsert := server.UpsertRequest{Points: []server.Point{{ID: fmt.Sprintf("p%d", i), Vector: []float64{float64(i), 1}}}}
+		require.Eventually(t, func() bool {
+			resp := send(t, noRedirects, http.MethodPut, addr+"/collections/docs/points", upsert)
+			if resp.StatusCode == http.StatusTemporaryRedirect {
+				redirected++
+				location := resp.Header.Get("Location")
+				assert.True(t, strings.HasSuffix(location, "/collections/docs/points"), location)
+				resp = send(t, client, http.MethodPut, addr+"/collections/docs/points", upsert)
+			}
+			return resp.StatusCode == http.StatusOK
+		}, 10*time.Second, 20*time.Millisecond)
+	}
+	assert.GreaterOrEqual(t, redirected, 2, "both followers redirect")
+	for _, addr := range addrs {
+		for i := range addrs {
+			require.Eventually(t, func() bool {
+				return send(t, client, http.MethodGet, fmt.Sprintf("%s/collections/docs/points/p%d", addr, i), nil).StatusCode == http.StatusOK
+			}, 5*time.Second, 10*time.Millisecond, "%s has p%d", addr, i)
+		}
+	}
+
+	resp = send(t, client, http.MethodDelete, addrs[0]+"/collections/docs/points/p0", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = send(t, client, http.MethodDelete, addrs[0]+"/collections/docs", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	for _, addr := range addrs {
+		require.Eventually(t, func() bool {
+			return send(t, client, http.MethodGet, addr+"/collections/docs", nil).StatusCode == http.StatusNotFound
+		}, 5*time.Second, 10*time.Millisecond, "%s dropped the collection", addr)
+	}
+}
+
+func TestReplicatedRestart(t *testing.T) {
+	dir := t.TempDir()
+	replication := &server.Replication{NodeID: "a", Peers: map[string]string{"a": "http://127.0.0.1:1"}}
+	open := func() (*server.Server, *httptest.Server) {
+		logger, _ := log.NewForTest()
+		s, err := server.New(server.Config{DataDir: dir, Replication: replication}, logger)
+		require.NoError(t, err)
+		return s, httptest.NewServer(s.Handler())
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	s, srv := open()
+	require.Eventually(t, func() bool {
+		return send(t, client, http.MethodPut, srv.URL+"/collections/docs", server.CreateCollectionRequest{Dimension: 2}).StatusCode == http.StatusCreated
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		upsert := server.UpsertRequest{Points: []server.Point{{ID: "p", Vector: []float64{1, 1}}}}
+		return send(t, client, http.MethodPut, srv.URL+"/collections/docs/points", upsert).StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	srv.Close()
+	require.NoError(t, s.Close())
+
+	// the log of the meta group is replayed over the manifest it already changed
+	s, srv = open()
+	defer func() {
+		srv.Close()
+		s.Close()
+	}()
+	assert.Equal(t, http.StatusOK, send(t, client, http.MethodGet, srv.URL+"/collections/docs/points/p", nil).StatusCode)
+	require.Eventually(t, func() bool {
+		return send(t, client, http.MethodPut, srv.URL+"/collections/docs", server.CreateCollectionRequest{Dimension: 2}).StatusCode == http.StatusConflict
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,166 @@
+// Package server exposes the vector store over an HTTP/JSON API: collection management, upserts,
+// gets, deletes and vector search, and optionally over the gRPC service of api/hermes/v1. Every
+// collection is a DiskStorage file in the data directory
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/cluster"
+	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"google.golang.org/grpc"
+)
+
+// Config tunes a Server, zero fields taking the defaults below
+type Config struct {
+	// Addr is the address to listen on, ":8080" by default
+	Addr string
+	// GRPCAddr is the address the gRPC service listens on, it is not served when empty
+	GRPCAddr string
+	// DataDir holds the collection files and their manifest
+	DataDir string
+	// MaxBodyBytes bounds request bodies, larger ones are answered 413. 4 MiB by default
+	MaxBodyBytes int64
+	// ShutdownTimeout is how long requests in flight get to finish once the server stops, 10s by default
+	ShutdownTimeout time.Duration
+	// BlockSize is the block size of the files of new collections, diskblock.DefaultBlockSize by default
+	BlockSize int
+	// Cluster lists the nodes served at /cluster, none when nil
+	Cluster *cluster.Cluster
+	// Gossip receives the gossip other nodes post to gossip.HTTPPath, when not nil
+	Gossip *gossip.Node
+	// Replication replicates the collections over raft groups of the nodes it lists, when not nil
+	Replication *Replication
+}
+
+const (
+	DefaultAddr            = ":8080"
+	DefaultMaxBodyBytes    = 4 << 20
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// Server serves the collections of a data directory
+type Server struct {
+	cfg         Config
+	logger      log.Logger
+	collections *registry
+	handler     http.Handler
+}
+
+// New opens the collections of cfg.DataDir, creating the directory if needed
+func New(cfg Config, logger log.Logger) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+	if cfg.MaxBodyBytes == 0 {
+		cfg.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if cfg.DataDir == "" {
+		return nil, errors.New("server needs a data directory")
+	}
+	if cfg.BlockSize != 0 {
+		if err := diskblock.ValidateBlockSize(cfg.BlockSize); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Replication != nil {
+		if err := cfg.Replication.validate(); err != nil {
+			return nil, err
+		}
+	}
+	collections, err := openRegistry(cfg.DataDir, cfg.BlockSize, cfg.Replication, logger)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{cfg: cfg, logger: logger, collections: collections}
+	mux := http.NewServeMux()
+	s.routes(mux)
+	s.handler = withRequestIDs(logger, withBodyLimit(cfg.MaxBodyBytes, mux))
+	return s, nil
+}
+
+// Handler returns the API handler, for mounting it elsewhere or testing it with httptest
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ListenAndServe listens on the configured addresses and serves until ctx is done, see Serve
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	var grpcLn net.Listener
+	if s.cfg.GRPCAddr != "" {
+		if grpcLn, err = net.Listen("tcp", s.cfg.GRPCAddr); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	return s.serve(ctx, ln, grpcLn)
+}
+
+// Serve answers requests on ln until ctx is done, then stops accepting connections, lets the
+// requests in flight finish within the shutdown timeout and closes the collections
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	return s.serve(ctx, ln, nil)
+}
+
+// serve is Serve, answering gRPC calls on grpcLn as well unless it is nil
+func (s *Server) serve(ctx context.Context, ln, grpcLn net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+	served := make(chan error, 2)
+	go func() {
+		s.logger.Infof("serving on %s", ln.Addr())
+		served <- srv.Serve(ln)
+	}()
+	var grpcSrv *grpc.Server
+	if grpcLn != nil {
+		grpcSrv = s.GRPCServer()
+		go func() {
+			s.logger.Infof("serving gRPC on %s", grpcLn.Addr())
+			served <- grpcSrv.Serve(grpcLn)
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+	}
+	s.logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcSrv.Stop()
+		}
+	}
+	err = errors.Join(err, srv.Shutdown(shutdownCtx))
+	return errors.Join(err, s.Close())
+}
+
+// Close releases the collection files, the server must not serve requests afterwards
+func (s *Server) Close() error {
+	return s.collections.close()
+}
@@ -0,0 +1,361 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/cluster"
+	"github.com/bjornaer/hermes/internal/disk/diskblock"
+	"github.com/bjornaer/hermes/internal/gossip"
+	"github.com/bjornaer/hermes/internal/log"
+	"github.com/bjornaer/hermes/internal/server"
+	"github.com/bjornaer/hermes/internal/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, cfg server.Config) *server.Server {
+	logger, _ := log.NewForTest()
+	if cfg.DataDir == "" {
+		cfg.DataDir = t.TempDir()
+	}
+	s, err := server.New(cfg, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// call sends body as JSON and decodes the response into out when given, returning the response
+func call(t *testing.T, h http.Handler, method, path string, body any, out any) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, reader))
+	if out != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+	}
+	return rec
+}
+
+func TestCollectionsAndPoints(t *testing.T) {
+	h := newServer(t, server.Config{}).Handler()
+
+	rec := call(t, h, http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2}, nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = call(t, h, http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2}, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = call(t, h, http.MethodPut, "/collections/bad.name", server.CreateCollectionRequest{Dimension: 2}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	upsert := server.UpsertRequest{Points: []server.Point{
+		{ID: "east", Vector: []float64{1, 0}},
+		{ID: "north", Vector: []float64{0, 1}},
+		{ID: "north-east", Vector: []float64{1, 1}},
+	}}
+	var upserted server.UpsertResponse
+	rec = call(t, h, http.MethodPut, "/collections/docs/points", upsert, &upserted)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 3, upserted.Upserted)
+
+	rec = call(t, h, http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: []server.Point{{ID: "x", Vector: []float64{1}}}}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "dimension mismatch")
+	rec = call(t, h, http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: []server.Point{{ID: strings.Repeat("k", 40), Vector: []float64{1, 1}}}}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "key too large")
+	batch := server.UpsertRequest{Points: []server.Point{{ID: "first", Vector: []float64{1, 0}}, {ID: strings.Repeat("k", 40), Vector: []float64{1, 1}}}}
+	rec = call(t, h, http.MethodPut, "/collections/docs/points", batch, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "key too large at the end of a batch")
+	rec = call(t, h, http.MethodGet, "/collections/docs/points/first", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "nothing of the rejected batch is written")
+
+	var p server.Point
+	rec = call(t, h, http.MethodGet, "/collections/docs/points/north", nil, &p)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []float64{0, 1}, p.Vector)
+
+	var res server.SearchResponse
+	rec = call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0.1}, Limit: 2}, &res)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, res.Hits, 2)
+	assert.Equal(t, "east", res.Hits[0].ID)
+	assert.Equal(t, "north-east", res.Hits[1].ID)
+	assert.Less(t, res.Hits[0].Distance, res.Hits[1].Distance)
+
+	rec = call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0}, Limit: 1 << 40}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "limit above the cap")
+	rec = call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0}, Offset: 1 << 62}, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "offset above the cap")
+
+	maxDistance := 0.1
+	rec = call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0}, MaxDistance: &maxDistance}, &res)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, res.Hits, 1)
+	assert.Equal(t, "east", res.Hits[0].ID)
+	rec = call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0}, Limit: 1, Offset: 1, MaxDistance: &maxDistance}, &res)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, res.Hits, "the page after the only close hit")
+
+	rec = call(t, h, http.MethodDelete, "/collections/docs/points/east", nil, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = call(t, h, http.MethodDelete, "/collections/docs/points/east", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = call(t, h, http.MethodGet, "/collections/docs/points/east", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var stats server.CollectionStats
+	rec = call(t, h, http.MethodGet, "/collections/docs", nil, &stats)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, stats.Points)
+	assert.Equal(t, "cosine", stats.Distance)
+
+	rec = call(t, h, http.MethodDelete, "/collections/docs", nil, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = call(t, h, http.MethodGet, "/collections/docs/points/north", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCollectionsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	logger, _ := log.NewForTest()
+	s, err := server.New(server.Config{DataDir: dir}, logger)
+	require.NoError(t, err)
+	call(t, s.Handler(), http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2, Distance: "euclidean"}, nil)
+	call(t, s.Handler(), http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: []server.Point{{ID: "a", Vector: []float64{3, 4}}}}, nil)
+	require.NoError(t, s.Close())
+
+	s = newServer(t, server.Config{DataDir: dir})
+	var list server.ListCollectionsResponse
+	call(t, s.Handler(), http.MethodGet, "/collections", nil, &list)
+	require.Len(t, list.Collections, 1)
+	assert.Equal(t, "euclidean", list.Collections[0].Distance)
+
+	var res server.SearchResponse
+	call(t, s.Handler(), http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{0, 0}}, &res)
+	require.Len(t, res.Hits, 1)
+	assert.InDelta(t, 5, res.Hits[0].Distance, 1e-9)
+}
+
+func TestCollectionsKeepTheirBlockSize(t *testing.T) {
+	dir := t.TempDir()
+	logger, _ := log.NewForTest()
+	s, err := server.New(server.Config{DataDir: dir, BlockSize: 8192}, logger)
+	require.NoError(t, err)
+	var info server.CollectionInfo
+	call(t, s.Handler(), http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2}, &info)
+	assert.Equal(t, 8192, info.BlockSize)
+	call(t, s.Handler(), http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: []server.Point{{ID: "a", Vector: []float64{3, 4}}}}, nil)
+	require.NoError(t, s.Close())
+
+	s = newServer(t, server.Config{DataDir: dir})
+	rec := call(t, s.Handler(), http.MethodGet, "/collections/docs/points/a", nil, nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	_, err = server.New(server.Config{DataDir: t.TempDir(), BlockSize: 1000}, logger)
+	assert.Error(t, err)
+}
+
+func TestClusterNodes(t *testing.T) {
+	rec := call(t, newServer(t, server.Config{}).Handler(), http.MethodGet, "/cluster", nil, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	c, err := cluster.New(cluster.Config{Size: 2, Peers: []string{"http://other:8008"}})
+	require.NoError(t, err)
+	var nodes server.ClusterResponse
+	rec = call(t, newServer(t, server.Config{Cluster: c}).Handler(), http.MethodGet, "/cluster", nil, &nodes)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"http://localhost:8008", "http://localhost:8009", "http://other:8008"}, nodes.Nodes)
+}
+
+func TestClusterNodesFromGossip(t *testing.T) {
+	logger, _ := log.NewForTest()
+	peer := httptest.NewUnstartedServer(nil)
+	self, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	peerURL, selfURL := "http://"+peer.Listener.Addr().String(), "http://"+self.Addr().String()
+	newNode := func(id string, seeds ...string) *gossip.Node {
+		tr := gossip.NewHTTPTransport(logger)
+		t.Cleanup(tr.Close)
+		n, err := gossip.New(gossip.Config{ID: id, Addr: id, Seeds: seeds, Transport: tr, Logger: logger, TickInterval: 2 * time.Millisecond})
+		require.NoError(t, err)
+		n.Start()
+		t.Cleanup(n.Stop)
+		return n
+	}
+	peer.Config.Handler = gossip.Handler(newNode(peerURL, selfURL))
+	peer.Start()
+	defer peer.Close()
+
+	// the server only learns about the peer through the gossip posted to it
+	g := newNode(selfURL)
+	c, err := cluster.New(cluster.Config{})
+	require.NoError(t, err)
+	c.UseGossip(g)
+	srv := &httptest.Server{Listener: self, Config: &http.Server{Handler: newServer(t, server.Config{Cluster: c, Gossip: g}).Handler()}}
+	srv.Start()
+	defer srv.Close()
+
+	require.Eventually(t, func() bool {
+		var nodes server.ClusterResponse
+		rec := call(t, srv.Config.Handler, http.MethodGet, "/cluster", nil, &nodes)
+		return rec.Code == http.StatusOK && assert.ObjectsAreEqual(sorted([]string{peerURL, selfURL}), sorted(nodes.Nodes))
+	}, 5*time.Second, 10*time.Millisecond, "the peer gossips its way into the cluster")
+}
+
+func sorted(s []string) []string {
+	s = append([]string{}, s...)
+	slices.Sort(s)
+	return s
+}
+
+func TestMetrics(t *testing.T) {
+	h := newServer(t, server.Config{}).Handler()
+	call(t, h, http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2}, nil)
+	call(t, h, http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: []server.Point{{ID: "a", Vector: []float64{1, 0}}}}, nil)
+	call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0}}, nil)
+
+	rec := call(t, h, http.MethodGet, "/metrics", nil, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`hermes_http_requests_total{method="POST",code="200"}`,
+		`hermes_search_seconds_count{kind="vector"}`,
+		"hermes_search_rows_scanned_total",
+		"hermes_search_distance_computations_total",
+		"hermes_block_writes_total",
+		"hermes_block_read_seconds_bucket",
+		"hermes_btree_splits_total",
+		`hermes_btree_depth{file="`,
+	} {
+		assert.Contains(t, body, want)
+	}
+}
+
+func TestRequestIDsAndBodyLimit(t *testing.T) {
+	h := newServer(t, server.Config{MaxBodyBytes: 64}).Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set(server.CorrelationIDHeader, "op-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.NotEmpty(t, rec.Header().Get(server.RequestIDHeader))
+	assert.Equal(t, "op-1", rec.Header().Get(server.CorrelationIDHeader))
+
+	req = httptest.NewRequest(http.MethodPut, "/collections/docs", strings.NewReader(`{"dimension": 2}`))
+	req.Header.Set(server.RequestIDHeader, "req-1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "req-1", rec.Header().Get(server.RequestIDHeader))
+	assert.Equal(t, "req-1", rec.Header().Get(server.CorrelationIDHeader), "correlation defaults to the request ID")
+
+	big := server.UpsertRequest{Points: []server.Point{{ID: "a", Vector: make([]float64, 2)}, {ID: "b", Vector: make([]float64, 2)}, {ID: "c", Vector: make([]float64, 2)}}}
+	var failed server.ErrorResponse
+	rec = call(t, h, http.MethodPut, "/collections/docs/points", big, &failed)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.NotEmpty(t, failed.RequestID)
+}
+
+func TestTracing(t *testing.T) {
+	spans := trace.NewInMemoryExporter()
+	trace.SetExporter(spans)
+	t.Cleanup(func() { trace.SetExporter(nil) })
+	h := newServer(t, server.Config{BlockSize: diskblock.MinBlockSize}).Handler()
+	call(t, h, http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2}, nil)
+	points := []server.Point{}
+	for i := 0; i < 100; i++ {
+		points = append(points, server.Point{ID: fmt.Sprintf("p%03d", i), Vector: []float64{1, float64(i)}})
+	}
+	call(t, h, http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: points}, nil)
+	spans.Reset()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/collections/docs/points/p042", nil)
+	req.Header.Set(trace.TraceParentHeader, "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	served := spans.Named("HTTP GET")
+	require.Len(t, served, 1)
+	assert.Equal(t, traceID, served[0].SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", served[0].Parent.SpanID.String())
+	assert.Equal(t, trace.KindServer, served[0].Kind)
+	assert.Equal(t, http.StatusOK, served[0].Attribute("http.status_code"))
+	assert.Equal(t, "/collections/docs/points/p042", served[0].Attribute("http.target"))
+
+	get := spans.Named("DiskStorage.Get")
+	require.Len(t, get, 1)
+	assert.Equal(t, served[0].SpanContext.SpanID, get[0].Parent.SpanID)
+	reads := spans.Named("BlockService.ReadBlock")
+	require.NotEmpty(t, reads, "the point lives below the root")
+	for _, read := range reads {
+		assert.Equal(t, traceID, read.SpanContext.TraceID.String())
+		assert.Equal(t, get[0].SpanContext.SpanID, read.Parent.SpanID)
+	}
+
+	// requests without a traceparent start their own trace
+	spans.Reset()
+	call(t, h, http.MethodPost, "/collections/docs/search", server.SearchRequest{Vector: []float64{1, 0}}, nil)
+	search := spans.Named("DiskStorage.Search")
+	require.Len(t, search, 1)
+	assert.NotEqual(t, traceID, search[0].SpanContext.TraceID.String())
+	assert.NotEmpty(t, spans.Named("BlockService.ReadBlock"))
+}
+
+func TestCancelledRequests(t *testing.T) {
+	h := newServer(t, server.Config{}).Handler()
+	call(t, h, http.MethodPut, "/collections/docs", server.CreateCollectionRequest{Dimension: 2}, nil)
+	call(t, h, http.MethodPut, "/collections/docs/points", server.UpsertRequest{Points: []server.Point{{ID: "a", Vector: []float64{1, 0}}}}, nil)
+
+	search := func(ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/collections/docs/search", strings.NewReader(`{"vector": [1, 0]}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, 499, search(ctx).Code)
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	assert.Equal(t, http.StatusGatewayTimeout, search(ctx).Code)
+	assert.Equal(t, http.StatusOK, search(context.Background()).Code)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := newServer(t, server.Config{ShutdownTimeout: time.Second})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln) }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	_, err = http.Get("http://" + ln.Addr().String() + "/healthz")
+	assert.Error(t, err)
+}
@@ -0,0 +1,279 @@
+package shard
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk/pqueue"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/disk/vector"
+)
+
+var (
+	// ErrNoShards is returned by writes to a collection without any shard
+	ErrNoShards = errors.New("collection has no shards")
+	// ErrShardExists is returned when adding a shard ID already in use
+	ErrShardExists = errors.New("shard already in collection")
+	// ErrUnknownShard is returned when removing a shard that is not part of the collection
+	ErrUnknownShard = errors.New("shard not in collection")
+)
+
+// Store is a shard group as seen by the collection: a disk.ReplicatedStorage led by this node,
+// or a plain disk.DiskStorage
+type Store[T comparable] interface {
+	AddWithTime(dp types.DataPoint[T], t time.Time) error
+	Update(dp types.DataPoint[T]) error
+	Get(id string) ([]float64, bool, error)
+	Delete(id string) error
+	Each(f func(key, val string, addedAt time.Time) error) error
+	Payloads() (map[string]map[string]string, error)
+	SearchByVector(input []float64, limit int) (*[]types.SearchResult[T], error)
+}
+
+// Collection splits the key space of a collection over shard groups with a consistent hash ring.
+// Writes and gets go to the shard owning the key, vector queries are sent to every shard and their
+// top-k merged.
+//
+// A datapoint moved by a rebalance is deleted from its previous shard once copied. Should the
+// delete fail, the leftover is never read: a shard only answers for keys it owns.
+//
+// The server does not shard yet, each of its collections being a single shard group. Collection is
+// what a collection spread over several of them goes through
+type Collection[T comparable] struct {
+	ring   *Ring
+	shards map[string]Store[T]
+	mu     sync.RWMutex
+}
+
+// NewCollection returns an empty collection placing every shard on virtualNodes points of the ring, 64 when 0
+func NewCollection[T comparable](virtualNodes int) *Collection[T] {
+	return &Collection[T]{ring: NewRing(virtualNodes), shards: map[string]Store[T]{}}
+}
+
+// Shards returns the IDs of the shards, sorted
+func (c *Collection[T]) Shards() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.Owners()
+}
+
+// Locate returns the shard owning id
+func (c *Collection[T]) Locate(id string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.Locate(id)
+}
+
+// AddShard puts s on the ring and moves it the datapoints it takes over from the other shards,
+// returning how many moved. Writes wait until the move is done
+func (c *Collection[T]) AddShard(id string, s Store[T]) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.shards[id]; exists {
+		return 0, ErrShardExists
+	}
+	ring := c.ring.Clone()
+	ring.Add(id)
+	moved := 0
+	leftovers := map[string][]string{}
+	for from, store := range c.shards {
+		keys, err := c.migrate(from, store, ring, func(string) Store[T] { return s })
+		moved += len(keys)
+		if err != nil {
+			return moved, err
+		}
+		leftovers[from] = keys
+	}
+	c.shards[id] = s
+	c.ring = ring
+	for from, keys := range leftovers {
+		for _, key := range keys {
+			if err := c.shards[from].Delete(key); err != nil {
+				return moved, err
+			}
+		}
+	}
+	return moved, nil
+}
+
+// RemoveShard takes a shard off the ring after copying its datapoints to the shards now owning
+// them, returning how many moved. The store itself is left untouched
+func (c *Collection[T]) RemoveShard(id string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	store, exists := c.shards[id]
+	if !exists {
+		return 0, ErrUnknownShard
+	}
+	ring := c.ring.Clone()
+	ring.Remove(id)
+	if len(ring.Owners()) == 0 {
+		delete(c.shards, id)
+		c.ring = ring
+		return 0, nil
+	}
+	keys, err := c.migrate(id, store, ring, func(owner string) Store[T] { return c.shards[owner] })
+	if err != nil {
+		return len(keys), err
+	}
+	delete(c.shards, id)
+	c.ring = ring
+	return len(keys), nil
+}
+
+// migrate copies the datapoints store owns under the current ring but not under next to their new
+// owner, keeping their timestamps and payload text, and returns the keys copied
+func (c *Collection[T]) migrate(id string, store Store[T], next *Ring, target func(owner string) Store[T]) ([]string, error) {
+	payloads, err := store.Payloads()
+	if err != nil {
+		return nil, err
+	}
+	moved := []string{}
+	err = store.Each(func(key, val string, addedAt time.Time) error {
+		if c.ring.Locate(key) != id {
+			return nil
+		}
+		owner := next.Locate(key)
+		if owner == id {
+			return nil
+		}
+		emb, _, err := vector.DecodeEmbedding(val)
+		if err != nil {
+			return err
+		}
+		dp := types.DataPoint[T]{ID: any(key).(T), Embedding: emb, Payload: payloads[key]}
+		if err := target(owner).AddWithTime(dp, addedAt); err != nil {
+			return err
+		}
+		moved = append(moved, key)
+		return nil
+	})
+	return moved, err
+}
+
+// owner returns the store owning id
+func (c *Collection[T]) owner(id string) (Store[T], error) {
+	owner := c.ring.Locate(id)
+	if owner == "" {
+		return nil, ErrNoShards
+	}
+	return c.shards[owner], nil
+}
+
+// Add upserts the datapoint on the shard owning its ID
+func (c *Collection[T]) Add(dp types.DataPoint[T]) error {
+	return c.AddWithTime(dp, time.Now())
+}
+
+func (c *Collection[T]) AddWithTime(dp types.DataPoint[T], t time.Time) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, err := c.owner(any(dp.ID).(string))
+	if err != nil {
+		return err
+	}
+	return s.AddWithTime(dp, t)
+}
+
+// Update replaces a stored datapoint on the shard owning its ID
+func (c *Collection[T]) Update(dp types.DataPoint[T]) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, err := c.owner(any(dp.ID).(string))
+	if err != nil {
+		return err
+	}
+	return s.Update(dp)
+}
+
+// Delete removes the datapoint from the shard owning id
+func (c *Collection[T]) Delete(id string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, err := c.owner(id)
+	if err != nil {
+		return err
+	}
+	return s.Delete(id)
+}
+
+// Get reads the datapoint from the shard owning id
+func (c *Collection[T]) Get(id string) ([]float64, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, err := c.owner(id)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.Get(id)
+}
+
+// SearchByVector queries every shard concurrently for its limit closest datapoints and merges them
+// into the limit closest overall. Every shard has to search with the same distance measure, their
+// distances being compared as they are
+func (c *Collection[T]) SearchByVector(input []float64, limit int) (*[]types.SearchResult[T], error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if limit <= 0 {
+		return &[]types.SearchResult[T]{}, nil
+	}
+
+	type answer struct {
+		results []types.SearchResult[T]
+		err     error
+	}
+	answers := make(chan answer, len(c.shards))
+	for id, s := range c.shards {
+		go func(id string, s Store[T]) {
+			results, err := c.searchShard(id, s, input, limit)
+			answers <- answer{results: results, err: err}
+		}(id, s)
+	}
+
+	topK := pqueue.NewTopK(limit)
+	var errs []error
+	for range c.shards {
+		a := <-answers
+		if a.err != nil {
+			errs = append(errs, a.err)
+			continue
+		}
+		for _, r := range a.results {
+			topK.Offer(&pqueue.QItem{Value: r.ID, Priority: r.Distance, Vector: r.Vector})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	hits := topK.Sorted()
+	results := make([]types.SearchResult[T], len(hits))
+	for i, hit := range hits {
+		results[i] = types.SearchResult[T]{ID: hit.Value, Distance: hit.Priority, Vector: hit.Vector}
+	}
+	return &results, nil
+}
+
+// searchShard returns the limit closest datapoints owned by shard id. Leftovers of a rebalance may
+// crowd out owned datapoints, so the page grows until it holds limit owned ones or the whole shard
+func (c *Collection[T]) searchShard(id string, s Store[T], input []float64, limit int) ([]types.SearchResult[T], error) {
+	for page := limit; ; page *= 2 {
+		found, err := s.SearchByVector(input, page)
+		if err != nil {
+			return nil, err
+		}
+		owned := []types.SearchResult[T]{}
+		for _, r := range *found {
+			if c.ring.Locate(r.ID) == id {
+				owned = append(owned, r)
+			}
+		}
+		if len(owned) >= limit || len(*found) < page {
+			if len(owned) > limit {
+				owned = owned[:limit]
+			}
+			return owned, nil
+		}
+	}
+}
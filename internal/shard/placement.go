@@ -0,0 +1,75 @@
+package shard
+
+import "sort"
+
+// Placement maps every shard group to the nodes holding one of its replicas
+type Placement map[string][]string
+
+// Place spreads replicas copies of every shard over nodes with rendezvous hashing: a shard goes to
+// the nodes scoring highest for it, so a node joining or leaving only moves the replicas it takes
+// or held. Shards get fewer replicas when there are not enough nodes
+func Place(shards, nodes []string, replicas int) Placement {
+	p := Placement{}
+	for _, shard := range shards {
+		ranked := append([]string{}, nodes...)
+		sort.Slice(ranked, func(i, j int) bool {
+			si, sj := hashKey(shard+"/"+ranked[i]), hashKey(shard+"/"+ranked[j])
+			if si != sj {
+				return si > sj
+			}
+			return ranked[i] < ranked[j]
+		})
+		if len(ranked) > replicas {
+			ranked = ranked[:replicas]
+		}
+		sort.Strings(ranked)
+		p[shard] = ranked
+	}
+	return p
+}
+
+// Move is the membership change of one shard group, to be applied with raft: the nodes in Add
+// join as learners and are promoted once caught up, before the nodes in Remove leave the group
+type Move struct {
+	Shard  string
+	Add    []string
+	Remove []string
+}
+
+// Plan returns the moves turning placement from into to, ordered by shard
+func Plan(from, to Placement) []Move {
+	shards := []string{}
+	for shard := range to {
+		shards = append(shards, shard)
+	}
+	for shard := range from {
+		if _, kept := to[shard]; !kept {
+			shards = append(shards, shard)
+		}
+	}
+	sort.Strings(shards)
+
+	moves := []Move{}
+	for _, shard := range shards {
+		move := Move{Shard: shard, Add: difference(to[shard], from[shard]), Remove: difference(from[shard], to[shard])}
+		if len(move.Add) > 0 || len(move.Remove) > 0 {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// difference returns the elements of a missing from b
+func difference(a, b []string) []string {
+	in := map[string]bool{}
+	for _, s := range b {
+		in[s] = true
+	}
+	out := []string{}
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
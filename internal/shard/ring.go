@@ -0,0 +1,111 @@
+package shard
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const defaultVirtualNodes = 64
+
+// Ring is a consistent hash ring. Every owner is hashed to VirtualNodes points on the ring and a key
+// belongs to the first point at or after its own hash, so adding or removing an owner only moves
+// the keys of the arcs it gains or loses. A Ring is not safe for concurrent use
+type Ring struct {
+	virtualNodes int
+	points       []uint64
+	owners       map[uint64]string
+}
+
+// NewRing returns a ring placing every owner on virtualNodes points, 64 when 0
+func NewRing(virtualNodes int, owners ...string) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+	r := &Ring{virtualNodes: virtualNodes, owners: map[uint64]string{}}
+	for _, owner := range owners {
+		r.Add(owner)
+	}
+	return r
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// fnv barely mixes the last bytes, which are all that differ between virtual nodes
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+// Add places owner on the ring, adding an owner twice is a no-op
+func (r *Ring) Add(owner string) {
+	for i := 0; i < r.virtualNodes; i++ {
+		point := hashKey(owner + "#" + strconv.Itoa(i))
+		// on the rare collision the smallest owner keeps the point, so it does not depend on insertion order
+		if current, taken := r.owners[point]; taken {
+			if current <= owner {
+				continue
+			}
+		} else {
+			r.points = append(r.points, point)
+		}
+		r.owners[point] = owner
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove takes owner off the ring, its keys move to the owners following its points
+func (r *Ring) Remove(owner string) {
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.owners[point] == owner {
+			delete(r.owners, point)
+			continue
+		}
+		points = append(points, point)
+	}
+	r.points = points
+	// owners that lost a collision to the removed one get their point back
+	for _, other := range r.Owners() {
+		r.Add(other)
+	}
+}
+
+// Locate returns the owner of key, "" when the ring is empty
+func (r *Ring) Locate(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Owners returns the owners on the ring, sorted
+func (r *Ring) Owners() []string {
+	seen := map[string]bool{}
+	owners := []string{}
+	for _, owner := range r.owners {
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// Clone returns a copy of the ring that can be changed independently
+func (r *Ring) Clone() *Ring {
+	c := &Ring{virtualNodes: r.virtualNodes, points: append([]uint64{}, r.points...), owners: map[uint64]string{}}
+	for point, owner := range r.owners {
+		c.owners[point] = owner
+	}
+	return c
+}
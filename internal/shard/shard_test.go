@@ -0,0 +1,202 @@
+package shard_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/disk"
+	"github.com/bjornaer/hermes/internal/disk/types"
+	"github.com/bjornaer/hermes/internal/shard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingMovesFewKeys(t *testing.T) {
+	ring := shard.NewRing(0, "s0", "s1", "s2")
+	before := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = ring.Locate(key)
+		counts[before[key]]++
+	}
+	for _, owner := range []string{"s0", "s1", "s2"} {
+		assert.InDelta(t, 1000, counts[owner], 350, "%s is badly balanced", owner)
+	}
+
+	ring.Add("s3")
+	for key, owner := range before {
+		if now := ring.Locate(key); now != owner {
+			assert.Equal(t, "s3", now, "keys only move to the new owner")
+		}
+	}
+	ring.Remove("s3")
+	for key, owner := range before {
+		assert.Equal(t, owner, ring.Locate(key))
+	}
+	assert.Equal(t, []string{"s0", "s1", "s2"}, ring.Owners())
+}
+
+func TestPlanOnlyMovesReplicasOfChangedNodes(t *testing.T) {
+	shards := []string{"a", "b", "c", "d", "e", "f"}
+	from := shard.Place(shards, []string{"n1", "n2", "n3", "n4"}, 3)
+	for _, nodes := range from {
+		assert.Len(t, nodes, 3)
+	}
+
+	to := shard.Place(shards, []string{"n1", "n2", "n3", "n4", "n5"}, 3)
+	for _, move := range shard.Plan(from, to) {
+		assert.Equal(t, []string{"n5"}, move.Add)
+		assert.Len(t, move.Remove, 1)
+	}
+
+	to = shard.Place(shards, []string{"n1", "n2", "n4"}, 3)
+	for _, move := range shard.Plan(from, to) {
+		assert.Equal(t, []string{"n3"}, move.Remove)
+		assert.Len(t, move.Add, 1)
+	}
+}
+
+func newStore(t *testing.T) *disk.DiskStorage[string] {
+	ds, err := disk.NewDiskStorage[string](filepath.Join(t.TempDir(), "shard.db"))
+	require.NoError(t, err)
+	return ds
+}
+
+func TestScatterGatherMatchesSingleStore(t *testing.T) {
+	single := newStore(t)
+	c := shard.NewCollection[string](0)
+	for i := 0; i < 3; i++ {
+		_, err := c.AddShard(fmt.Sprintf("s%d", i), newStore(t))
+		require.NoError(t, err)
+	}
+	for i := 0; i < 60; i++ {
+		dp := types.NewDataPoint(fmt.Sprintf("id-%d", i), []float64{float64(i % 7), float64(i % 5), 1})
+		require.NoError(t, c.Add(*dp))
+		require.NoError(t, single.Add(*dp))
+	}
+
+	query := []float64{3, 2, 1}
+	want, err := single.SearchByVector(query, 10)
+	require.NoError(t, err)
+	got, err := c.SearchByVector(query, 10)
+	require.NoError(t, err)
+	require.Len(t, *got, 10)
+	for i := range *want {
+		assert.InDelta(t, (*want)[i].Distance, (*got)[i].Distance, 1e-9)
+	}
+}
+
+func TestRebalanceKeepsEveryDatapoint(t *testing.T) {
+	c := shard.NewCollection[string](0)
+	s0, s1 := newStore(t), newStore(t)
+	_, err := c.AddShard("s0", s0)
+	require.NoError(t, err)
+	require.NoError(t, c.Add(*types.NewDataPoint("x", []float64{1, 1})))
+	for i := 0; i < 100; i++ {
+		payload := map[string]string{"text": fmt.Sprintf("point number%d", i)}
+		require.NoError(t, c.Add(*types.NewDataPointWithPayload(fmt.Sprintf("id-%d", i), []float64{float64(i), 1}, payload)))
+	}
+
+	moved, err := c.AddShard("s1", s1)
+	require.NoError(t, err)
+	assert.Greater(t, moved, 0)
+	assert.Less(t, moved, 101)
+	assert.Equal(t, 101, count(t, s0)+count(t, s1), "moved datapoints leave their previous shard")
+	payloads := map[*disk.DiskStorage[string]]map[string]map[string]string{}
+	for _, s := range []*disk.DiskStorage[string]{s0, s1} {
+		payloads[s], err = s.Payloads()
+		require.NoError(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("id-%d", i)
+		owner := s0
+		if c.Locate(id) == "s1" {
+			owner = s1
+		}
+		assert.Equal(t, fmt.Sprintf("point number%d", i), payloads[owner][id]["text"], "the text moves as it was written")
+		results, err := owner.HybridSearch([]float64{0, 1}, fmt.Sprintf("number%d", i), 1, disk.HybridOptions{Fusion: disk.FusionWeighted})
+		require.NoError(t, err)
+		require.Len(t, *results, 1)
+		assert.Equal(t, id, (*results)[0].ID, "the text moves along")
+		assert.Positive(t, (*results)[0].Score)
+	}
+	_, err = c.AddShard("s1", newStore(t))
+	assert.ErrorIs(t, err, shard.ErrShardExists)
+
+	check := func() {
+		for i := 0; i < 100; i++ {
+			emb, found, err := c.Get(fmt.Sprintf("id-%d", i))
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, []float64{float64(i), 1}, emb)
+		}
+		// leftovers on the previous owner never show up twice
+		all, err := c.SearchByVector([]float64{50, 1}, 200)
+		require.NoError(t, err)
+		assert.Len(t, *all, 101)
+	}
+	check()
+
+	// an update lands on the new owner only, the stale leftover must not resurface
+	require.NoError(t, c.Update(*types.NewDataPoint("id-7", []float64{7, 7})))
+	_, err = c.RemoveShard("s0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s1"}, c.Shards())
+	emb, _, err := c.Get("id-7")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{7, 7}, emb)
+	require.NoError(t, c.Update(*types.NewDataPoint("id-7", []float64{7, 1})))
+	check()
+
+	_, err = c.RemoveShard("s0")
+	assert.ErrorIs(t, err, shard.ErrUnknownShard)
+}
+
+func TestDeleteGoesToTheOwner(t *testing.T) {
+	c := shard.NewCollection[string](0)
+	stores := map[string]*disk.DiskStorage[string]{}
+	for _, id := range []string{"s0", "s1", "s2"} {
+		stores[id] = newStore(t)
+		_, err := c.AddShard(id, stores[id])
+		require.NoError(t, err)
+	}
+	for i := 0; i < 30; i++ {
+		require.NoError(t, c.Add(*types.NewDataPoint(fmt.Sprintf("id-%d", i), []float64{float64(i), 1})))
+	}
+	for i := 0; i < 30; i += 2 {
+		id := fmt.Sprintf("id-%d", i)
+		require.NoError(t, c.Delete(id))
+		_, found, err := stores[c.Locate(id)].Get(id)
+		require.NoError(t, err)
+		assert.False(t, found, id)
+	}
+	assert.Equal(t, 15, count(t, stores["s0"])+count(t, stores["s1"])+count(t, stores["s2"]))
+	assert.ErrorIs(t, c.Delete("id-0"), disk.ErrNotFound)
+}
+
+// a shard group is a replicated storage
+var _ shard.Store[string] = (*disk.ReplicatedStorage[string])(nil)
+
+func count(t *testing.T, s *disk.DiskStorage[string]) int {
+	n := 0
+	require.NoError(t, s.Each(func(key, val string, addedAt time.Time) error {
+		n++
+		return nil
+	}))
+	return n
+}
+
+func TestEmptyCollection(t *testing.T) {
+	c := shard.NewCollection[string](0)
+	assert.ErrorIs(t, c.Add(*types.NewDataPoint("x", []float64{1})), shard.ErrNoShards)
+	_, found, err := c.Get("x")
+	assert.ErrorIs(t, err, shard.ErrNoShards)
+	assert.False(t, found)
+	assert.ErrorIs(t, c.Delete("x"), shard.ErrNoShards)
+	results, err := c.SearchByVector([]float64{1}, 5)
+	require.NoError(t, err)
+	assert.Empty(t, *results)
+}
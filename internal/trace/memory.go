@@ -0,0 +1,45 @@
+package trace
+
+import "sync"
+
+// InMemoryExporter keeps the spans it receives, for tests and debugging
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter returns an exporter holding no span
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns a copy of the spans received so far, in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData{}, e.spans...)
+}
+
+// Named returns the spans received so far called name
+func (e *InMemoryExporter) Named(name string) []SpanData {
+	named := []SpanData{}
+	for _, s := range e.Spans() {
+		if s.Name == name {
+			named = append(named, s)
+		}
+	}
+	return named
+}
+
+// Reset forgets the spans received so far
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,103 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceParentHeader carries the trace ID, the parent span ID and the sampled flag
+	TraceParentHeader = "Traceparent"
+	// TraceStateHeader carries vendor specific trace data, passed on unchanged
+	TraceStateHeader = "Tracestate"
+)
+
+// ErrTraceParent is returned for a traceparent header not following the W3C format
+var ErrTraceParent = errors.New("invalid traceparent")
+
+// FormatTraceParent writes sc as a version 00 traceparent header, 00-<trace id>-<span id>-<flags>
+func FormatTraceParent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent reads a traceparent header. Versions above 00 are read as 00, as the
+// specification asks, provided they start with the same fields
+func ParseTraceParent(h string) (SpanContext, error) {
+	h = strings.TrimSpace(h)
+	parts := strings.Split(h, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, ErrTraceParent
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return SpanContext{}, ErrTraceParent
+	}
+	if strings.ToLower(h) != h {
+		return SpanContext{}, ErrTraceParent
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, ErrTraceParent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, ErrTraceParent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, ErrTraceParent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// TraceParent returns the traceparent header of the span ctx carries, empty if there is none
+func TraceParent(ctx context.Context) string {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return FormatTraceParent(sc)
+}
+
+// ContextWithTraceParent returns a copy of ctx whose next span is a child of the span h describes.
+// An empty or invalid header leaves ctx as it is
+func ContextWithTraceParent(ctx context.Context, h string) context.Context {
+	if h == "" {
+		return ctx
+	}
+	sc, err := ParseTraceParent(h)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemote(ctx, sc)
+}
+
+// Inject sets the trace context headers of the span ctx carries on h
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceParentHeader, FormatTraceParent(sc))
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	}
+}
+
+// Extract returns a copy of ctx whose next span is a child of the remote span the headers of h
+// describe. Missing or invalid headers leave ctx as it is, the next span starting a new trace
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceParent(h.Get(TraceParentHeader))
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = h.Get(TraceStateHeader)
+	return ContextWithRemote(ctx, sc)
+}
@@ -0,0 +1,267 @@
+// Package trace records spans following the OpenTelemetry data model and propagates them with the
+// W3C trace context headers, so the spans of Hermes join the traces of its callers. Spans are always
+// created, keeping the trace context flowing, but only sampled ones reach the exporter
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, the spans of one operation across every process it went through
+type TraceID [16]byte
+
+// SpanID identifies a span within its trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether t is not all zeros, which W3C trace context forbids
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether s is not all zeros, which W3C trace context forbids
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled tells whether the span is recorded, callers deciding for the whole trace
+	Sampled bool
+	// TraceState is the vendor specific tracestate header, carried along untouched
+	TraceState string
+	// Remote is set on contexts extracted from a request
+	Remote bool
+}
+
+// IsValid reports whether sc identifies a span
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind tells what role a span plays in a call between processes, as in OpenTelemetry
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindServer
+	KindClient
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// Attribute is a key and value describing a span
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr returns the attribute key=value
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is a finished span as exporters receive it
+type SpanData struct {
+	Name        string
+	Kind        Kind
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  []Attribute
+	Err         error
+}
+
+// Duration returns how long the span lasted
+func (d SpanData) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// Attribute returns the value of the attribute key, nil if the span has none
+func (d SpanData) Attribute(key string) any {
+	for _, a := range d.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// Span is an operation being timed. Its methods are safe for concurrent use and do nothing on a nil span
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the identity of the span, to propagate it
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || !s.data.SpanContext.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// RecordError marks the span as failed with err, nil errors being ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+// End finishes the span and hands it to the exporter if it is sampled. Only the first call counts
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.SpanContext.Sampled {
+		if e := exporter(); e != nil {
+			e.ExportSpan(data)
+		}
+	}
+}
+
+// Exporter receives every sampled span once it ends. ExportSpan is called on the goroutine ending
+// the span, so exporters doing I/O should queue the spans and send them in the background
+type Exporter interface {
+	ExportSpan(SpanData)
+}
+
+var (
+	mu       sync.RWMutex
+	current  Exporter
+	spanKeyV = spanKey{}
+)
+
+type spanKey struct{}
+
+// SetExporter makes e receive the sampled spans, nil turning sampling of new traces off
+func SetExporter(e Exporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = e
+}
+
+func exporter() Exporter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// StartOption shapes a span being started
+type StartOption func(*SpanData)
+
+// WithKind sets the kind of the span, internal by default
+func WithKind(k Kind) StartOption {
+	return func(d *SpanData) { d.Kind = k }
+}
+
+// WithAttributes sets attributes from the start
+func WithAttributes(attrs ...Attribute) StartOption {
+	return func(d *SpanData) { d.Attributes = append(d.Attributes, attrs...) }
+}
+
+// Start begins a span named name, child of the span ctx carries if any, and returns a copy of ctx
+// carrying the new span. New traces are sampled while an exporter is set, child spans follow
+// their parent
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	parent := SpanContextFrom(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = exporter() != nil
+	}
+	s := &Span{data: SpanData{Name: name, SpanContext: sc, Parent: parent, Start: time.Now()}}
+	for _, opt := range opts {
+		opt(&s.data)
+	}
+	if !sc.Sampled {
+		s.data.Attributes = nil
+	}
+	return context.WithValue(ctx, spanKeyV, s), s
+}
+
+// FromContext returns the span ctx carries, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKeyV).(*Span)
+	return s
+}
+
+// SpanContextFrom returns the identity of the span ctx carries, or of the remote parent extracted
+// into it, invalid if there is neither
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	switch v := ctx.Value(spanKeyV).(type) {
+	case *Span:
+		return v.SpanContext()
+	case SpanContext:
+		return v
+	}
+	return SpanContext{}
+}
+
+// ContextWithRemote returns a copy of ctx whose next span is a child of the remote span sc
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	sc.Remote = true
+	return context.WithValue(ctx, spanKeyV, sc)
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		rand.Read(s[:])
+	}
+	return s
+}
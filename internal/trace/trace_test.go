@@ -0,0 +1,119 @@
+package trace_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bjornaer/hermes/internal/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withExporter(t *testing.T) *trace.InMemoryExporter {
+	e := trace.NewInMemoryExporter()
+	trace.SetExporter(e)
+	t.Cleanup(func() { trace.SetExporter(nil) })
+	return e
+}
+
+func TestChildrenJoinTheTraceOfTheirParent(t *testing.T) {
+	e := withExporter(t)
+	ctx, parent := trace.Start(context.Background(), "parent", trace.WithKind(trace.KindServer))
+	_, child := trace.Start(ctx, "child", trace.WithAttributes(trace.Attr("block", 3)))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := e.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, parent.SpanContext().SpanID, spans[0].Parent.SpanID)
+	assert.Equal(t, 3, spans[0].Attribute("block"))
+	assert.EqualError(t, spans[0].Err, "boom")
+	assert.Equal(t, trace.KindServer, spans[1].Kind)
+	assert.False(t, spans[1].Parent.IsValid())
+	assert.GreaterOrEqual(t, spans[1].Duration(), spans[0].Duration())
+}
+
+func TestNothingIsSampledWithoutExporter(t *testing.T) {
+	ctx, span := trace.Start(context.Background(), "unsampled")
+	assert.True(t, span.SpanContext().IsValid())
+	assert.False(t, span.SpanContext().Sampled)
+	span.End()
+
+	// a trace started unsampled stays so once an exporter is set
+	e := withExporter(t)
+	_, child := trace.Start(ctx, "child")
+	child.End()
+	assert.Empty(t, e.Spans())
+}
+
+func TestTraceParent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := trace.ParseTraceParent(header)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, header, trace.FormatTraceParent(sc))
+
+	sc, err = trace.ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-later")
+	require.NoError(t, err)
+	assert.False(t, sc.Sampled)
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		_, err := trace.ParseTraceParent(bad)
+		assert.ErrorIs(t, err, trace.ErrTraceParent, bad)
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	e := withExporter(t)
+	h := http.Header{}
+	h.Set(trace.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(trace.TraceStateHeader, "vendor=value")
+
+	ctx, span := trace.Start(trace.Extract(context.Background(), h), "server")
+	out := http.Header{}
+	trace.Inject(ctx, out)
+	span.End()
+
+	spans := e.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID.String())
+	assert.True(t, spans[0].Parent.Remote)
+	assert.Equal(t, trace.FormatTraceParent(span.SpanContext()), out.Get(trace.TraceParentHeader))
+	assert.Equal(t, "vendor=value", out.Get(trace.TraceStateHeader))
+
+	// a bad header starts a new trace rather than failing the request
+	h.Set(trace.TraceParentHeader, "garbage")
+	_, span = trace.Start(trace.Extract(context.Background(), h), "server")
+	span.End()
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID.String())
+}
+
+func TestInMemoryExporter(t *testing.T) {
+	e := withExporter(t)
+	for _, name := range []string{"a", "b", "a"} {
+		_, span := trace.Start(context.Background(), name)
+		span.End()
+	}
+	assert.Len(t, e.Spans(), 3)
+	assert.Len(t, e.Named("a"), 2)
+	e.Reset()
+	assert.Empty(t, e.Spans())
+}
@@ -0,0 +1,153 @@
+// Package transport carries the messages of raft and gossip nodes between processes. Messages
+// travel as JSON bodies of POST requests, each destination having its own queue, so a slow or dead
+// peer only delays what is addressed to it. Like the in process networks of those packages, it may
+// lose messages: sending never blocks, a full queue or a failed request drops the message
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/log"
+)
+
+const (
+	// DefaultQueueSize is how many messages wait for a destination before new ones are dropped
+	DefaultQueueSize = 256
+	// DefaultTimeout bounds every request
+	DefaultTimeout = 5 * time.Second
+	// MaxMessageBytes bounds the messages a Handler accepts
+	MaxMessageBytes = 64 << 20
+)
+
+// HTTPConfig configures an HTTP transport, zero values fall back to the defaults
+type HTTPConfig[M any] struct {
+	// URLOf returns where msg is posted, false when its destination is unknown
+	URLOf     func(msg M) (string, bool)
+	Client    *http.Client
+	QueueSize int
+	Logger    log.Logger
+}
+
+// HTTP sends messages of type M to the URL their destination has, see HTTPConfig
+type HTTP[M any] struct {
+	cfg    HTTPConfig[M]
+	mu     sync.Mutex
+	queues map[string]chan M
+	closed bool
+	stopc  chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewHTTP returns a transport posting messages where cfg.URLOf says
+func NewHTTP[M any](cfg HTTPConfig[M]) *HTTP[M] {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New()
+	}
+	return &HTTP[M]{cfg: cfg, queues: map[string]chan M{}, stopc: make(chan struct{})}
+}
+
+// Send queues msg for its destination, dropping it when the queue is full or the transport closed
+func (t *HTTP[M]) Send(msg M) {
+	url, ok := t.cfg.URLOf(msg)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	q, ok := t.queues[url]
+	if !ok {
+		q = make(chan M, t.cfg.QueueSize)
+		t.queues[url] = q
+		t.wg.Add(1)
+		go t.deliver(url, q)
+	}
+	select {
+	case q <- msg:
+	default:
+		t.cfg.Logger.Debugf("queue to %s is full, dropping a message", url)
+	}
+}
+
+// Close stops sending, messages still queued are dropped
+func (t *HTTP[M]) Close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.stopc)
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+}
+
+// deliver posts the messages queued for url one after another, so they arrive in order
+func (t *HTTP[M]) deliver(url string, q chan M) {
+	defer t.wg.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-t.stopc
+		cancel()
+	}()
+	for {
+		select {
+		case msg := <-q:
+			if err := t.post(ctx, url, msg); err != nil {
+				t.cfg.Logger.Debugf("sending to %s: %v", url, err)
+			}
+		case <-t.stopc:
+			return
+		}
+	}
+}
+
+func (t *HTTP[M]) post(ctx context.Context, url string, msg M) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Handler decodes the messages posted by an HTTP transport and hands them to deliver, which must
+// not block, typically the Step of a node
+func Handler[M any](deliver func(M)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg M
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxMessageBytes)).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		deliver(msg)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
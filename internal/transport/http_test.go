@@ -0,0 +1,50 @@
+package transport_test
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bjornaer/hermes/internal/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	To  string
+	Seq int
+}
+
+func TestMessagesArriveInOrder(t *testing.T) {
+	var mu sync.Mutex
+	got := []int{}
+	srv := httptest.NewServer(transport.Handler(func(m message) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, m.Seq)
+	}))
+	defer srv.Close()
+
+	tr := transport.NewHTTP(transport.HTTPConfig[message]{
+		URLOf: func(m message) (string, bool) { return m.To, m.To != "" },
+	})
+	defer tr.Close()
+	tr.Send(message{Seq: -1}) // no destination, dropped
+	for i := 0; i < 50; i++ {
+		tr.Send(message{To: srv.URL, Seq: i})
+	}
+	want := make([]int, 50)
+	for i := range want {
+		want[i] = i
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 50
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, want, got)
+
+	tr.Close()
+	tr.Send(message{To: srv.URL, Seq: 50}) // closed, dropped
+}